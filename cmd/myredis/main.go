@@ -1,9 +1,12 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -14,17 +17,48 @@ import (
 )
 
 func main() {
+	databases := flag.Int("databases", 16, "number of logical databases")
+	shards := flag.Int("shards", storage.DefaultShardCount, "number of lock-striped shards per database, rounded up to a power of two")
+	maxMemory := flag.String("maxmemory", "0", "memory limit for the dataset, e.g. 100mb; 0 means no limit")
+	maxMemoryPolicy := flag.String("maxmemory-policy", "noeviction", "how keys are evicted when maxmemory is reached")
+	limits := storage.DefaultEncodingLimits()
+	flag.IntVar(&limits.HashMaxListpackEntries, "hash-max-listpack-entries", limits.HashMaxListpackEntries, "max fields of a listpack encoded hash")
+	flag.IntVar(&limits.HashMaxListpackValue, "hash-max-listpack-value", limits.HashMaxListpackValue, "max field or value length of a listpack encoded hash")
+	flag.IntVar(&limits.SetMaxIntsetEntries, "set-max-intset-entries", limits.SetMaxIntsetEntries, "max members of an intset encoded set")
+	flag.IntVar(&limits.SetMaxListpackEntries, "set-max-listpack-entries", limits.SetMaxListpackEntries, "max members of a listpack encoded set")
+	flag.IntVar(&limits.SetMaxListpackValue, "set-max-listpack-value", limits.SetMaxListpackValue, "max member length of a listpack encoded set")
+	flag.IntVar(&limits.ZsetMaxListpackEntries, "zset-max-listpack-entries", limits.ZsetMaxListpackEntries, "max members of a listpack encoded sorted set")
+	flag.IntVar(&limits.ZsetMaxListpackValue, "zset-max-listpack-value", limits.ZsetMaxListpackValue, "max member length of a listpack encoded sorted set")
+	flag.IntVar(&limits.ListMaxListpackSize, "list-max-listpack-size", limits.ListMaxListpackSize, "max elements of a listpack encoded list, or -1..-5 for 4..64 KB")
+	flag.IntVar(&limits.StreamNodeMaxBytes, "stream-node-max-bytes", limits.StreamNodeMaxBytes, "max bytes of a stream node, 0 for no limit")
+	flag.IntVar(&limits.StreamNodeMaxEntries, "stream-node-max-entries", limits.StreamNodeMaxEntries, "max entries of a stream node, 0 for no limit")
+	flag.IntVar(&limits.HLLSparseMaxBytes, "hll-sparse-max-bytes", limits.HLLSparseMaxBytes, "max bytes of a sparse encoded HyperLogLog")
+	flag.Parse()
+	if *databases < 1 {
+		panic("databases must be at least 1")
+	}
+	maxMemoryBytes, err := parseMemory(*maxMemory)
+	if err != nil {
+		panic(fmt.Sprintf("Invalid maxmemory: %v", err))
+	}
+	policy, err := storage.ParseEvictionPolicy(*maxMemoryPolicy)
+	if err != nil {
+		panic(fmt.Sprintf("Invalid maxmemory-policy: %v", err))
+	}
+
 	fmt.Println("Starting MyRedis server...")
 
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 
-	storage := storage.NewKV()
+	dbs := storage.NewDatabases(*databases, *shards)
+	dbs.SetMaxMemory(maxMemoryBytes, policy)
+	dbs.SetEncodingLimits(limits)
 	aof, err := persistence.NewAOF("appendonly.aof")
 	if err != nil {
 		panic(fmt.Sprintf("Can't open AOF file: %v", err))
 	}
-	server := server.New("6380", storage, aof, time.Duration(5)*time.Second)
+	server := server.New("6380", dbs, aof, time.Second/10)
 
 	go server.Start()
 
@@ -32,3 +66,28 @@ func main() {
 	fmt.Println("\nShutting down gracefully...")
 	server.Shutdown()
 }
+
+// parseMemory parses sizes the way redis.conf does: a plain number of bytes
+// or a number with a k, kb, m, mb, g or gb suffix.
+func parseMemory(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		mul    int64
+	}{
+		{"kb", 1024}, {"mb", 1024 * 1024}, {"gb", 1024 * 1024 * 1024},
+		{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000},
+	}
+	s = strings.ToLower(s)
+	mul := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s, mul = strings.TrimSuffix(s, u.suffix), u.mul
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * mul, nil
+}
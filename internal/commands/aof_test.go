@@ -0,0 +1,165 @@
+package commands
+
+import (
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/engine"
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/persistence"
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/storage"
+)
+
+// replayed runs cmds against fresh databases and returns the databases
+// they were run on and the ones rebuilt by replaying the AOF they wrote.
+// A {"SLEEP", ms} step waits instead of running a command, to let TTLs pass.
+func replayed(t *testing.T, cmds [][]string) (live, replay *storage.Databases) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	aof, err := persistence.NewAOF(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	live = storage.NewDatabases(16, 4)
+	engine.LogKeyspaceDeletions(live, aof)
+	ctx := engine.NewCommandContext(live, aof)
+	for _, cmd := range cmds {
+		if cmd[0] == "SLEEP" {
+			ms, _ := strconv.Atoi(cmd[1])
+			time.Sleep(time.Duration(ms) * time.Millisecond)
+			continue
+		}
+		if reply := engine.DispatchCommand(ctx, cmd[0], cmd[1:]); reply.Typ() == "error" {
+			t.Fatalf("%q failed: %s", cmd, reply.Marshal())
+		}
+	}
+	if err := aof.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if aof, err = persistence.NewAOF(path); err != nil {
+		t.Fatal(err)
+	}
+	defer aof.Close()
+	replay = storage.NewDatabases(16, 4)
+	ctx = engine.NewCommandContext(replay, aof)
+	ctx.StartReplay()
+	cmdCh := make(chan persistence.ReplayCommand)
+	go aof.Load(cmdCh)
+	for cmd := range cmdCh {
+		engine.DispatchCommand(ctx, cmd.Name, cmd.Args)
+	}
+	ctx.EndReplay()
+	return live, replay
+}
+
+func TestReplayHIncrByFloatKeepsFieldTTL(t *testing.T) {
+	live, replay := replayed(t, [][]string{
+		{"HSET", "h", "f", "1.5", "g", "1"},
+		{"HEXPIRE", "h", "1000", "FIELDS", "1", "f"},
+		{"HINCRBYFLOAT", "h", "f", "1"},
+		{"HINCRBYFLOAT", "h", "g", "1"},
+	})
+	for _, dbs := range []*storage.Databases{live, replay} {
+		got, err := dbs.DB(0).HExpireTime("h", "f", "g")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got[0] <= 0 || got[1] != -1 {
+			t.Fatalf("got expiration times %v; want f to keep its TTL and g to have none", got)
+		}
+		if v, _, _ := dbs.DB(0).HGet("h", "f"); v != "2.5" {
+			t.Fatalf("got f = %q; want 2.5", v)
+		}
+	}
+}
+
+func TestReplaySelectAcrossDatabases(t *testing.T) {
+	live, replay := replayed(t, [][]string{
+		{"SET", "k", "db0"},
+		{"SELECT", "3"},
+		{"SET", "k", "db3"},
+		{"RPUSH", "l", "a", "b"},
+		{"SELECT", "5"},
+		{"SET", "k", "db5"},
+		{"MOVE", "k", "7"},
+		{"SELECT", "3"},
+		{"LPOP", "l"},
+		{"SELECT", "0"},
+		{"DEL", "missing"},
+		{"INCR", "n"},
+	})
+	tests := []struct {
+		db    int
+		key   string
+		value string
+	}{
+		{0, "k", "db0"},
+		{0, "n", "1"},
+		{3, "k", "db3"},
+		{5, "k", ""},
+		{7, "k", "db5"},
+	}
+	for _, dbs := range []*storage.Databases{live, replay} {
+		for _, tt := range tests {
+			if got, _, _ := dbs.DB(tt.db).Get(tt.key); got != tt.value {
+				t.Fatalf("db %d: got %s = %q; want %q", tt.db, tt.key, got, tt.value)
+			}
+		}
+		if got, _ := dbs.DB(3).LRange("l", 0, -1); len(got) != 1 || got[0] != "b" {
+			t.Fatalf("db 3: got l = %q; want [b]", got)
+		}
+	}
+}
+
+func TestReplayKeepsKeysThatExpiredAfterTheirWrites(t *testing.T) {
+	live, replay := replayed(t, [][]string{
+		{"SET", "a", "1"},
+		{"PEXPIRE", "a", "50"},
+		{"INCR", "a"},
+		{"SET", "b", "1"},
+		{"PEXPIREAT", "b", strconv.FormatInt(time.Now().Add(50*time.Millisecond).UnixMilli(), 10)},
+		{"SET", "m", "v"},
+		{"PEXPIRE", "m", "50"},
+		{"SLEEP", "70"},
+		// b and m expire on these lookups and are logged as DEL
+		{"INCR", "b"},
+		{"MOVE", "m", "1"},
+	})
+	for _, dbs := range []*storage.Databases{live, replay} {
+		if n := dbs.DB(0).Exists("a", "m") + dbs.DB(1).Exists("m"); n != 0 {
+			t.Fatalf("got %d expired keys back", n)
+		}
+		if v, _, _ := dbs.DB(0).Get("b"); v != "1" {
+			t.Fatalf("got b = %q; want 1", v)
+		}
+		if ttl := dbs.DB(0).TTL("b"); ttl != -1 {
+			t.Fatalf("got TTL %d for b; want -1", ttl)
+		}
+	}
+}
+
+func TestReplayDropsStringsWrittenBeforeTheyExpired(t *testing.T) {
+	live, replay := replayed(t, [][]string{
+		{"SET", "incr", "1", "PX", "50"},
+		{"INCR", "incr"},
+		{"SET", "append", "a", "PX", "50"},
+		{"APPEND", "append", "b"},
+		{"SET", "setrange", "abc", "PXAT", strconv.FormatInt(time.Now().Add(50*time.Millisecond).UnixMilli(), 10)},
+		{"SETRANGE", "setrange", "1", "x"},
+		{"SET", "float", "1.5", "PX", "50"},
+		{"INCRBYFLOAT", "float", "1"},
+		{"SET", "keepttl", "a", "PX", "50"},
+		{"SET", "keepttl", "b", "KEEPTTL"},
+		{"SLEEP", "70"},
+	})
+	keys := []string{"incr", "append", "setrange", "float", "keepttl"}
+	for _, dbs := range []*storage.Databases{live, replay} {
+		for _, key := range keys {
+			if v, exists, _ := dbs.DB(0).Get(key); exists {
+				t.Fatalf("got %s = %q after it expired", key, v)
+			}
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package commands
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/engine"
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/resp"
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/storage"
+)
+
+var (
+	errBitOffset    = errors.New("ERR bit offset is not an integer or out of range")
+	errBitfieldType = errors.New("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+)
+
+func parseBitOffset(s string) (uint64, error) {
+	offset, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || offset > storage.MaxBitOffset {
+		return 0, errBitOffset
+	}
+	return offset, nil
+}
+
+func handleSetBit(ctx *engine.CommandContext, args []string) resp.Value {
+	if len(args) != 3 {
+		return errWrongArgs()
+	}
+	offset, err := parseBitOffset(args[1])
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	if args[2] != "0" && args[2] != "1" {
+		return resp.NewErrorValue("ERR bit is not an integer or out of range")
+	}
+	old, err := ctx.Storage().SetBit(args[0], offset, int(args[2][0]-'0'))
+	if err != nil {
+		return storageError("SETBIT", err)
+	}
+	return resp.NewIntValue(int64(old))
+}
+
+func handleGetBit(ctx *engine.CommandContext, args []string) resp.Value {
+	if len(args) != 2 {
+		return errWrongArgs()
+	}
+	offset, err := parseBitOffset(args[1])
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	bit, err := ctx.Storage().GetBit(args[0], offset)
+	if err != nil {
+		return storageError("GETBIT", err)
+	}
+	return resp.NewIntValue(int64(bit))
+}
+
+// parseBitRange parses the optional start, end and BYTE|BIT arguments shared
+// by BITCOUNT and BITPOS.
+func parseBitRange(args []string) (storage.BitRange, error) {
+	var r storage.BitRange
+	if len(args) == 0 {
+		return r, nil
+	}
+	if len(args) > 3 {
+		return r, errSyntax
+	}
+	var err error
+	if r.Start, err = strconv.ParseInt(args[0], 10, 64); err != nil {
+		return r, errNotInteger
+	}
+	r.Set = true
+	if len(args) >= 2 {
+		if r.End, err = strconv.ParseInt(args[1], 10, 64); err != nil {
+			return r, errNotInteger
+		}
+		r.HasEnd = true
+	}
+	if len(args) == 3 {
+		switch strings.ToUpper(args[2]) {
+		case "BYTE":
+		case "BIT":
+			r.Bit = true
+		default:
+			return r, errSyntax
+		}
+	}
+	return r, nil
+}
+
+func handleBitCount(ctx *engine.CommandContext, args []string) resp.Value {
+	if len(args) < 1 {
+		return errWrongArgs()
+	}
+	if len(args) == 2 {
+		return resp.NewErrorValue(errSyntax.Error())
+	}
+	r, err := parseBitRange(args[1:])
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	count, err := ctx.Storage().BitCount(args[0], r)
+	if err != nil {
+		return storageError("BITCOUNT", err)
+	}
+	return resp.NewIntValue(count)
+}
+
+func handleBitPos(ctx *engine.CommandContext, args []string) resp.Value {
+	if len(args) < 2 {
+		return errWrongArgs()
+	}
+	if args[1] != "0" && args[1] != "1" {
+		return resp.NewErrorValue("ERR The bit argument must be 1 or 0.")
+	}
+	r, err := parseBitRange(args[2:])
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	pos, err := ctx.Storage().BitPos(args[0], int(args[1][0]-'0'), r)
+	if err != nil {
+		return storageError("BITPOS", err)
+	}
+	return resp.NewIntValue(pos)
+}
+
+func handleBitOp(ctx *engine.CommandContext, args []string) resp.Value {
+	if len(args) < 3 {
+		return errWrongArgs()
+	}
+	var op storage.BitOp
+	switch strings.ToUpper(args[0]) {
+	case "AND":
+		op = storage.BitAnd
+	case "OR":
+		op = storage.BitOr
+	case "XOR":
+		op = storage.BitXor
+	case "NOT":
+		op = storage.BitNot
+		if len(args) != 3 {
+			return resp.NewErrorValue("ERR BITOP NOT must be called with a single source key.")
+		}
+	default:
+		return resp.NewErrorValue(errSyntax.Error())
+	}
+	n, err := ctx.Storage().BitOp(op, args[1], args[2:]...)
+	if err != nil {
+		return storageError("BITOP", err)
+	}
+	return resp.NewIntValue(int64(n))
+}
+
+func parseBitfieldType(s string) (signed bool, bits int, err error) {
+	if len(s) < 2 || s[0] != 'i' && s[0] != 'u' && s[0] != 'I' && s[0] != 'U' {
+		return false, 0, errBitfieldType
+	}
+	signed = s[0] == 'i' || s[0] == 'I'
+	bits, err = strconv.Atoi(s[1:])
+	if err != nil || bits < 1 || signed && bits > 64 || !signed && bits > 63 {
+		return false, 0, errBitfieldType
+	}
+	return signed, bits, nil
+}
+
+// parseBitfieldOffset parses a bit offset, or with a # prefix an index
+// multiplied by the field width.
+func parseBitfieldOffset(s string, bits int) (uint64, error) {
+	multiplier := uint64(1)
+	if strings.HasPrefix(s, "#") {
+		s, multiplier = s[1:], uint64(bits)
+	}
+	offset, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || offset > storage.MaxBitOffset/multiplier {
+		return 0, errBitOffset
+	}
+	offset *= multiplier
+	if offset+uint64(bits)-1 > storage.MaxBitOffset {
+		return 0, errBitOffset
+	}
+	return offset, nil
+}
+
+func parseBitfieldOps(args []string, readOnly bool) ([]storage.BitFieldOp, error) {
+	var ops []storage.BitFieldOp
+	overflow := storage.OverflowWrap
+	for i := 0; i < len(args); i++ {
+		sub := strings.ToUpper(args[i])
+		if sub == "OVERFLOW" {
+			if i+1 >= len(args) {
+				return nil, errSyntax
+			}
+			switch strings.ToUpper(args[i+1]) {
+			case "WRAP":
+				overflow = storage.OverflowWrap
+			case "SAT":
+				overflow = storage.OverflowSat
+			case "FAIL":
+				overflow = storage.OverflowFail
+			default:
+				return nil, errors.New("ERR Invalid OVERFLOW type specified")
+			}
+			i++
+			continue
+		}
+
+		var op storage.BitFieldOp
+		argc := 3
+		switch sub {
+		case "GET":
+			op.Kind, argc = storage.BitFieldGet, 2
+		case "SET":
+			op.Kind = storage.BitFieldSet
+		case "INCRBY":
+			op.Kind = storage.BitFieldIncrBy
+		default:
+			return nil, errSyntax
+		}
+		if i+argc >= len(args) {
+			return nil, errSyntax
+		}
+		if readOnly && op.Kind != storage.BitFieldGet {
+			return nil, errors.New("ERR BITFIELD_RO only supports the GET subcommand")
+		}
+		var err error
+		if op.Signed, op.Bits, err = parseBitfieldType(args[i+1]); err != nil {
+			return nil, err
+		}
+		if op.Offset, err = parseBitfieldOffset(args[i+2], op.Bits); err != nil {
+			return nil, err
+		}
+		if argc == 3 {
+			if op.Value, err = strconv.ParseInt(args[i+3], 10, 64); err != nil {
+				return nil, errNotInteger
+			}
+		}
+		op.Overflow = overflow
+		ops = append(ops, op)
+		i += argc
+	}
+	return ops, nil
+}
+
+func handleBitField(ctx *engine.CommandContext, cmdName string, args []string, readOnly bool) resp.Value {
+	if len(args) < 1 {
+		return errWrongArgs()
+	}
+	ops, err := parseBitfieldOps(args[1:], readOnly)
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	results, err := ctx.Storage().BitField(args[0], ops)
+	if err != nil {
+		return storageError(cmdName, err)
+	}
+
+	changed := false
+	reply := make([]resp.Value, len(results))
+	for i, r := range results {
+		if r.Nil {
+			reply[i] = resp.NewNullValue()
+			continue
+		}
+		reply[i] = resp.NewIntValue(r.Value)
+		changed = changed || ops[i].Kind != storage.BitFieldGet
+	}
+	if !changed {
+		ctx.SkipPropagation()
+	}
+	return resp.NewArrayValue(reply)
+}
+
+func wrapHandleBitField(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleBitField(ctx, "BITFIELD", args, false)
+}
+
+func wrapHandleBitFieldRO(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleBitField(ctx, "BITFIELD_RO", args, true)
+}
+
+func init() {
+	engine.RegisterCommand("SETBIT", 3, true, handleSetBit)
+	engine.RegisterCommand("GETBIT", 2, false, handleGetBit)
+	engine.RegisterCommand("BITCOUNT", -1, false, handleBitCount)
+	engine.RegisterCommand("BITPOS", -2, false, handleBitPos)
+	engine.RegisterCommand("BITOP", -3, true, handleBitOp)
+	engine.RegisterCommand("BITFIELD", -1, true, wrapHandleBitField)
+	engine.RegisterCommand("BITFIELD_RO", -1, false, wrapHandleBitFieldRO)
+}
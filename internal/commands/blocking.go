@@ -0,0 +1,76 @@
+package commands
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/engine"
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/resp"
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/storage"
+)
+
+// parseTimeout parses the timeout of a blocking command in seconds, which
+// may be fractional. Zero means blocking forever.
+func parseTimeout(arg string) (time.Duration, error) {
+	secs, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(secs) || math.IsInf(secs, 0) {
+		return 0, errors.New("ERR timeout is not a float or out of range")
+	}
+	if secs < 0 {
+		return 0, errors.New("ERR timeout is negative")
+	}
+	return time.Duration(secs * float64(time.Second)), nil
+}
+
+// block runs try, and if it had nothing to serve, waits on keys and runs it
+// again every time one of them is written to. It gives up with a null reply
+// when the timeout expires or the client goes away. try reports whether it
+// served the client; a key of the wrong type fails only on the first try,
+// later the client keeps waiting like Redis does.
+func block(ctx *engine.CommandContext, cmdName string, keys []string, timeout time.Duration, try func() (resp.Value, bool, error)) resp.Value {
+	var w *storage.Waiter
+	if ctx.CanBlock() {
+		// registered before the first try so that no write in between is missed
+		w = ctx.Databases().Block(ctx.SelectedDB(), keys)
+		defer ctx.Databases().Unblock(w)
+	}
+
+	reply, served, err := try()
+	switch {
+	case err != nil:
+		return storageError(cmdName, err)
+	case served:
+		return reply
+	case w == nil:
+		ctx.SkipPropagation()
+		return resp.NewNullValue()
+	}
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	for {
+		select {
+		case <-w.Ready():
+			reply, served, err := try()
+			switch {
+			case errors.Is(err, storage.ErrWrongType):
+			case err != nil:
+				return storageError(cmdName, err)
+			case served:
+				return reply
+			}
+		case <-expired:
+			ctx.SkipPropagation()
+			return resp.NewNullValue()
+		case <-ctx.Done():
+			ctx.SkipPropagation()
+			return resp.NewNullValue()
+		}
+	}
+}
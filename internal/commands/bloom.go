@@ -0,0 +1,167 @@
+package commands
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/engine"
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/resp"
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/storage"
+)
+
+// handleBFReserve implements BF.RESERVE key error_rate capacity [EXPANSION
+// expansion] [NONSCALING].
+func handleBFReserve(ctx *engine.CommandContext, args []string) resp.Value {
+	errorRate, err := strconv.ParseFloat(args[1], 64)
+	if err != nil {
+		return resp.NewErrorValue("ERR bad error rate")
+	}
+	if !(errorRate > 0 && errorRate < 1) {
+		return resp.NewErrorValue("ERR (0 < error rate range < 1)")
+	}
+	capacity, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return resp.NewErrorValue("ERR bad capacity")
+	}
+	if capacity <= 0 {
+		return resp.NewErrorValue("ERR (capacity should be larger than 0)")
+	}
+	expansion, hasExpansion, nonScaling := storage.BloomDefaultExpansion, false, false
+	for i := 3; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); {
+		case opt == "NONSCALING":
+			nonScaling = true
+		case opt == "EXPANSION" && i+1 < len(args):
+			n, err := strconv.ParseInt(args[i+1], 10, 32)
+			if err != nil {
+				return resp.NewErrorValue("ERR bad expansion")
+			}
+			if n < 1 {
+				return resp.NewErrorValue("ERR expansion should be greater or equal to 1")
+			}
+			expansion, hasExpansion = int(n), true
+			i++
+		default:
+			return resp.NewErrorValue(errSyntax.Error())
+		}
+	}
+	if nonScaling {
+		if hasExpansion {
+			return resp.NewErrorValue("ERR Nonscaling filters cannot expand")
+		}
+		expansion = 0
+	}
+	if err := ctx.Storage().BFReserve(args[0], errorRate, capacity, expansion); err != nil {
+		return storageError("BF.RESERVE", err)
+	}
+	return resp.NewStringValue("OK")
+}
+
+func boolValues(values []bool) []resp.Value {
+	reply := make([]resp.Value, len(values))
+	for i, v := range values {
+		reply[i] = resp.NewIntValue(0)
+		if v {
+			reply[i] = resp.NewIntValue(1)
+		}
+	}
+	return reply
+}
+
+func handleBFAdd(ctx *engine.CommandContext, args []string) resp.Value {
+	added, err := ctx.Storage().BFAdd(args[0], args[1])
+	if err != nil {
+		return storageError("BF.ADD", err)
+	}
+	if !added[0] {
+		ctx.SkipPropagation()
+		return resp.NewIntValue(0)
+	}
+	return resp.NewIntValue(1)
+}
+
+// handleBFMAdd implements BF.MADD key item [item ...]. If the filter fills
+// up, the items that didn't fit get an error in the reply.
+func handleBFMAdd(ctx *engine.CommandContext, args []string) resp.Value {
+	items := args[1:]
+	added, err := ctx.Storage().BFAdd(args[0], items...)
+	if err != nil && !errors.Is(err, storage.ErrBloomFull) {
+		return storageError("BF.MADD", err)
+	}
+	if !slices.Contains(added, true) {
+		ctx.SkipPropagation()
+	}
+	reply := boolValues(added)
+	for range len(items) - len(added) {
+		reply = append(reply, storageError("BF.MADD", err))
+	}
+	return resp.NewArrayValue(reply)
+}
+
+func handleBFExists(ctx *engine.CommandContext, args []string) resp.Value {
+	found, err := ctx.Storage().BFExists(args[0], args[1])
+	if err != nil {
+		return storageError("BF.EXISTS", err)
+	}
+	if found[0] {
+		return resp.NewIntValue(1)
+	}
+	return resp.NewIntValue(0)
+}
+
+func handleBFMExists(ctx *engine.CommandContext, args []string) resp.Value {
+	found, err := ctx.Storage().BFExists(args[0], args[1:]...)
+	if err != nil {
+		return storageError("BF.MEXISTS", err)
+	}
+	return resp.NewArrayValue(boolValues(found))
+}
+
+// handleBFInfo implements BF.INFO key [CAPACITY|SIZE|FILTERS|ITEMS|EXPANSION].
+func handleBFInfo(ctx *engine.CommandContext, args []string) resp.Value {
+	if len(args) > 2 {
+		return errWrongArgsFor("bf.info")
+	}
+	info, err := ctx.Storage().BFInfo(args[0])
+	if err != nil {
+		return storageError("BF.INFO", err)
+	}
+	expansion := resp.NewNullValue()
+	if info.Expansion > 0 {
+		expansion = resp.NewIntValue(int64(info.Expansion))
+	}
+	fields := []struct {
+		opt, name string
+		value     resp.Value
+	}{
+		{"CAPACITY", "Capacity", resp.NewIntValue(info.Capacity)},
+		{"SIZE", "Size", resp.NewIntValue(info.Size)},
+		{"FILTERS", "Number of filters", resp.NewIntValue(int64(info.Filters))},
+		{"ITEMS", "Number of items inserted", resp.NewIntValue(info.Items)},
+		{"EXPANSION", "Expansion rate", expansion},
+	}
+	var reply []resp.Value
+	for _, f := range fields {
+		switch {
+		case len(args) == 1:
+			reply = append(reply, resp.NewStringValue(f.name), f.value)
+		case strings.EqualFold(args[1], f.opt):
+			return resp.NewArrayValue([]resp.Value{f.value})
+		}
+	}
+	if len(args) > 1 {
+		return resp.NewErrorValue("ERR Invalid information value")
+	}
+	return resp.NewArrayValue(reply)
+}
+
+func init() {
+	engine.RegisterCommand("BF.RESERVE", -3, true, handleBFReserve)
+	engine.RegisterCommand("BF.ADD", 2, true, handleBFAdd)
+	engine.RegisterCommand("BF.MADD", -2, true, handleBFMAdd)
+	engine.RegisterCommand("BF.EXISTS", 2, false, handleBFExists)
+	engine.RegisterCommand("BF.MEXISTS", -2, false, handleBFMExists)
+	engine.RegisterCommand("BF.INFO", -1, false, handleBFInfo)
+}
@@ -0,0 +1,112 @@
+package commands
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/engine"
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/resp"
+)
+
+func parseCMSDim(arg, name string) (int, error) {
+	n, err := strconv.ParseInt(arg, 10, 32)
+	if err != nil || n < 1 {
+		return 0, errors.New("CMS: invalid " + name)
+	}
+	return int(n), nil
+}
+
+func handleCMSInitByDim(ctx *engine.CommandContext, args []string) resp.Value {
+	width, err := parseCMSDim(args[1], "width")
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	depth, err := parseCMSDim(args[2], "depth")
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	if err := ctx.Storage().CMSInitByDim(args[0], width, depth); err != nil {
+		return storageError("CMS.INITBYDIM", err)
+	}
+	return resp.NewStringValue("OK")
+}
+
+func countsReply(counts []int64) resp.Value {
+	reply := make([]resp.Value, len(counts))
+	for i, n := range counts {
+		reply[i] = resp.NewIntValue(n)
+	}
+	return resp.NewArrayValue(reply)
+}
+
+// handleCMSIncrBy implements CMS.INCRBY key item increment [item increment
+// ...] and replies with the new estimated counts.
+func handleCMSIncrBy(ctx *engine.CommandContext, args []string) resp.Value {
+	pairs := args[1:]
+	if len(pairs)%2 != 0 {
+		return errWrongArgsFor("cms.incrby")
+	}
+	items := make([]string, 0, len(pairs)/2)
+	incrs := make([]int64, 0, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		n, err := strconv.ParseInt(pairs[i+1], 10, 64)
+		if err != nil || n < 0 {
+			return resp.NewErrorValue("CMS: Cannot parse number")
+		}
+		items = append(items, pairs[i])
+		incrs = append(incrs, n)
+	}
+	counts, err := ctx.Storage().CMSIncrBy(args[0], items, incrs)
+	if err != nil {
+		return storageError("CMS.INCRBY", err)
+	}
+	return countsReply(counts)
+}
+
+func handleCMSQuery(ctx *engine.CommandContext, args []string) resp.Value {
+	counts, err := ctx.Storage().CMSQuery(args[0], args[1:]...)
+	if err != nil {
+		return storageError("CMS.QUERY", err)
+	}
+	return countsReply(counts)
+}
+
+// handleCMSMerge implements CMS.MERGE destination numKeys source [source
+// ...] [WEIGHTS weight [weight ...]].
+func handleCMSMerge(ctx *engine.CommandContext, args []string) resp.Value {
+	numKeys, err := strconv.ParseInt(args[1], 10, 32)
+	if err != nil || numKeys < 1 {
+		return resp.NewErrorValue("CMS: invalid numkeys")
+	}
+	rest := args[2:]
+	if int64(len(rest)) < numKeys {
+		return errWrongArgsFor("cms.merge")
+	}
+	srcs, rest := rest[:numKeys], rest[numKeys:]
+	weights := make([]int64, numKeys)
+	for i := range weights {
+		weights[i] = 1
+	}
+	if len(rest) > 0 {
+		if !strings.EqualFold(rest[0], "WEIGHTS") || int64(len(rest)-1) != numKeys {
+			return errWrongArgsFor("cms.merge")
+		}
+		for i, arg := range rest[1:] {
+			if weights[i], err = strconv.ParseInt(arg, 10, 64); err != nil {
+				return resp.NewErrorValue("CMS: invalid weight value")
+			}
+		}
+	}
+	if err := ctx.Storage().CMSMerge(args[0], srcs, weights); err != nil {
+		return storageError("CMS.MERGE", err)
+	}
+	return resp.NewStringValue("OK")
+}
+
+func init() {
+	engine.RegisterCommand("CMS.INITBYDIM", 3, true, handleCMSInitByDim)
+	engine.RegisterCommand("CMS.INCRBY", -3, true, handleCMSIncrBy)
+	engine.RegisterCommand("CMS.QUERY", -2, false, handleCMSQuery)
+	engine.RegisterCommand("CMS.MERGE", -3, true, handleCMSMerge)
+}
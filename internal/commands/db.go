@@ -0,0 +1,54 @@
+package commands
+
+import (
+	"strconv"
+
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/engine"
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/resp"
+)
+
+func handleSelect(ctx *engine.CommandContext, args []string) resp.Value {
+	if len(args) != 1 {
+		return errWrongArgs()
+	}
+	index, err := strconv.Atoi(args[0])
+	if err != nil {
+		return resp.NewErrorValue("ERR value is not an integer or out of range")
+	}
+	if err := ctx.SelectDB(index); err != nil {
+		return resp.NewErrorValue("ERR DB index is out of range")
+	}
+	return resp.NewStringValue("OK")
+}
+
+func handleSwapDB(ctx *engine.CommandContext, args []string) resp.Value {
+	if len(args) != 2 {
+		return errWrongArgs()
+	}
+	first, err := strconv.Atoi(args[0])
+	if err != nil {
+		return resp.NewErrorValue("ERR invalid first DB index")
+	}
+	second, err := strconv.Atoi(args[1])
+	if err != nil {
+		return resp.NewErrorValue("ERR invalid second DB index")
+	}
+	if err := ctx.Databases().Swap(first, second); err != nil {
+		return resp.NewErrorValue("ERR DB index is out of range")
+	}
+	return resp.NewStringValue("OK")
+}
+
+func handleFlushall(ctx *engine.CommandContext, args []string) resp.Value {
+	if len(args) != 0 {
+		return errWrongArgs()
+	}
+	ctx.Databases().FlushAll()
+	return resp.NewStringValue("OK")
+}
+
+func init() {
+	engine.RegisterCommand("SELECT", 1, false, handleSelect)
+	engine.RegisterCommand("SWAPDB", 2, true, handleSwapDB, engine.FlagAllowOOM)
+	engine.RegisterCommand("FLUSHALL", 0, true, handleFlushall, engine.FlagAllowOOM)
+}
@@ -1,7 +1,56 @@
 package commands
 
 import (
+	"errors"
+	"log"
+
 	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/resp"
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/storage"
+)
+
+var (
+	errSyntax     = errors.New("ERR syntax error")
+	errNotInteger = errors.New("ERR value is not an integer or out of range")
+	errOutOfRange = errors.New("ERR value is out of range")
 )
 
 func errWrongArgs() resp.Value { return resp.NewErrorValue("ERR wrong number of arguments") }
+
+func errWrongArgsFor(cmdName string) resp.Value {
+	return resp.NewErrorValue("ERR wrong number of arguments for '" + cmdName + "' command")
+}
+
+// storageError translates the errors returned by storage into replies.
+func storageError(cmdName string, err error) resp.Value {
+	switch {
+	case errors.Is(err, storage.ErrWrongType):
+		return resp.NewErrorValue("WRONGTYPE Operation against a key holding the wrong kind of value")
+	case errors.Is(err, storage.ErrNotInteger):
+		return resp.NewErrorValue(errNotInteger.Error())
+	case errors.Is(err, storage.ErrOverflow), errors.Is(err, storage.ErrNotFloat),
+		errors.Is(err, storage.ErrNaN), errors.Is(err, storage.ErrTooLarge),
+		errors.Is(err, storage.ErrNoSuchKey), errors.Is(err, storage.ErrOutOfRange),
+		errors.Is(err, storage.ErrHashNotInt), errors.Is(err, storage.ErrHashNotFloat),
+		errors.Is(err, storage.ErrScoreNaN), errors.Is(err, storage.ErrGeoMember),
+		errors.Is(err, storage.ErrStreamIDTooSmall), errors.Is(err, storage.ErrStreamIDZero),
+		errors.Is(err, storage.ErrStreamExhausted), errors.Is(err, storage.ErrStreamKey),
+		errors.Is(err, storage.ErrItemExists), errors.Is(err, storage.ErrNotFound),
+		errors.Is(err, storage.ErrBloomFull), errors.Is(err, storage.ErrFilterTooLarge),
+		errors.Is(err, storage.ErrJSONInvalid), errors.Is(err, storage.ErrJSONPath),
+		errors.Is(err, storage.ErrJSONNoPath), errors.Is(err, storage.ErrJSONNewRoot),
+		errors.Is(err, storage.ErrJSONNoKey):
+		return resp.NewErrorValue("ERR " + err.Error())
+	case errors.Is(err, storage.ErrBusyGroup):
+		return resp.NewErrorValue("BUSYGROUP " + err.Error())
+	case errors.Is(err, storage.ErrNotHLL), errors.Is(err, storage.ErrJSONType):
+		return resp.NewErrorValue("WRONGTYPE " + err.Error())
+	case errors.Is(err, storage.ErrHLLCorrupt):
+		return resp.NewErrorValue("INVALIDOBJ " + err.Error())
+	case errors.Is(err, storage.ErrCMSKeyExists), errors.Is(err, storage.ErrCMSNoKey),
+		errors.Is(err, storage.ErrCMSDims), errors.Is(err, storage.ErrCMSOverflow):
+		return resp.NewErrorValue(err.Error())
+	default:
+		log.Printf("internal error in %s: %v", cmdName, err)
+		return resp.NewErrorValue("ERR internal error")
+	}
+}
@@ -1,8 +1,11 @@
 package commands
 
 import (
+	"errors"
+	"fmt"
 	"math"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/engine"
@@ -10,25 +13,102 @@ import (
 	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/storage"
 )
 
-func handleExpire(args []string, storage *storage.KV, useSeconds bool) resp.Value {
-	if len(args) != 2 {
+func parseExpireCondition(options []string) (storage.ExpireCondition, error) {
+	var cond storage.ExpireCondition
+	for _, opt := range options {
+		switch strings.ToUpper(opt) {
+		case "NX":
+			cond |= storage.ExpireNX
+		case "XX":
+			cond |= storage.ExpireXX
+		case "GT":
+			cond |= storage.ExpireGT
+		case "LT":
+			cond |= storage.ExpireLT
+		default:
+			return 0, fmt.Errorf("ERR Unsupported option %s", opt)
+		}
+	}
+
+	if cond&storage.ExpireNX != 0 && cond != storage.ExpireNX {
+		return 0, errors.New("ERR NX and XX, GT or LT options at the same time are not compatible")
+	}
+	if cond&storage.ExpireGT != 0 && cond&storage.ExpireLT != 0 {
+		return 0, errors.New("ERR GT and LT options at the same time are not compatible")
+	}
+	return cond, nil
+}
+
+func errInvalidExpire(cmdName string) error {
+	return fmt.Errorf("ERR invalid expire time in '%s' command", strings.ToLower(cmdName))
+}
+
+// toUnixMilli converts an expiration given in unit, relative to now unless
+// absolute, to unix milliseconds. It fails if the result overflows.
+func toUnixMilli(when int64, unit time.Duration, absolute bool) (int64, bool) {
+	factor := unit.Milliseconds()
+	if when > math.MaxInt64/factor || when < math.MinInt64/factor {
+		return 0, false
+	}
+	whenMilli := when * factor
+	if !absolute {
+		now := time.Now().UnixMilli()
+		if whenMilli > math.MaxInt64-now {
+			return 0, false
+		}
+		whenMilli += now
+	}
+	return whenMilli, true
+}
+
+// parseExpireOption parses the argument of an EX, PX, EXAT or PXAT option
+// into unix milliseconds. Unlike EXPIRE, these options reject times that
+// aren't positive.
+func parseExpireOption(cmdName, opt, arg string) (int64, error) {
+	when, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return 0, errNotInteger
+	}
+	unit, absolute := time.Second, false
+	switch strings.ToUpper(opt) {
+	case "PX":
+		unit = time.Millisecond
+	case "EXAT":
+		absolute = true
+	case "PXAT":
+		unit, absolute = time.Millisecond, true
+	}
+	whenMilli, ok := toUnixMilli(when, unit, absolute)
+	if when <= 0 || !ok {
+		return 0, errInvalidExpire(cmdName)
+	}
+	return whenMilli, nil
+}
+
+func handleExpire(ctx *engine.CommandContext, cmdName string, args []string, unit time.Duration, absolute bool) resp.Value {
+	if len(args) < 2 {
 		return errWrongArgs()
 	}
-	dur, err := strconv.ParseInt(args[1], 10, 64)
+	when, err := strconv.ParseInt(args[1], 10, 64)
 	if err != nil {
 		return resp.NewErrorValue("ERR value is not an integer or out of range")
 	}
-	var durTime time.Duration
-	if useSeconds {
-		durTime = time.Duration(dur) * time.Second
-	} else {
-		durTime = time.Duration(dur) * time.Millisecond
+	cond, err := parseExpireCondition(args[2:])
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
 	}
-	keyExists := storage.SetExpire(args[0], durTime)
-	if keyExists {
-		return resp.NewIntValue(1)
+
+	whenMilli, ok := toUnixMilli(when, unit, absolute)
+	if !ok {
+		return resp.NewErrorValue(errInvalidExpire(cmdName).Error())
 	}
-	return resp.NewIntValue(0)
+
+	if !ctx.Storage().ExpireAt(args[0], whenMilli, cond) {
+		ctx.SkipPropagation()
+		return resp.NewIntValue(0)
+	}
+	ctx.Propagate("PEXPIREAT", args[0], strconv.FormatInt(whenMilli, 10))
+	return resp.NewIntValue(1)
 }
 
 func handleTTL(args []string, storage *storage.KV, useSeconds bool) resp.Value {
@@ -46,12 +126,43 @@ func handleTTL(args []string, storage *storage.KV, useSeconds bool) resp.Value {
 	return resp.NewIntValue(int64(ttlMilli))
 }
 
+func handleExpireTime(args []string, storage *storage.KV, useSeconds bool) resp.Value {
+	if len(args) != 1 {
+		return errWrongArgs()
+	}
+
+	expireTime := storage.ExpireTime(args[0])
+	if expireTime < 0 || !useSeconds {
+		return resp.NewIntValue(expireTime)
+	}
+	return resp.NewIntValue(expireTime / 1000)
+}
+
+func handlePersist(ctx *engine.CommandContext, args []string) resp.Value {
+	if len(args) != 1 {
+		return errWrongArgs()
+	}
+	if ctx.Storage().Persist(args[0]) {
+		return resp.NewIntValue(1)
+	}
+	ctx.SkipPropagation()
+	return resp.NewIntValue(0)
+}
+
 func wrapHandleExpire(ctx *engine.CommandContext, args []string) resp.Value {
-	return handleExpire(args, ctx.Storage(), true)
+	return handleExpire(ctx, "EXPIRE", args, time.Second, false)
 }
 
 func wrapHandlePExpire(ctx *engine.CommandContext, args []string) resp.Value {
-	return handleExpire(args, ctx.Storage(), false)
+	return handleExpire(ctx, "PEXPIRE", args, time.Millisecond, false)
+}
+
+func wrapHandleExpireAt(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleExpire(ctx, "EXPIREAT", args, time.Second, true)
+}
+
+func wrapHandlePExpireAt(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleExpire(ctx, "PEXPIREAT", args, time.Millisecond, true)
 }
 
 func wrapHandleTTL(ctx *engine.CommandContext, args []string) resp.Value {
@@ -62,9 +173,22 @@ func wrapHandlePTTL(ctx *engine.CommandContext, args []string) resp.Value {
 	return handleTTL(args, ctx.Storage(), false)
 }
 
+func wrapHandleExpireTime(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleExpireTime(args, ctx.Storage(), true)
+}
+
+func wrapHandlePExpireTime(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleExpireTime(args, ctx.Storage(), false)
+}
+
 func init() {
-	engine.RegisterCommand("EXPIRE", 2, true, wrapHandleExpire)
-	engine.RegisterCommand("PEXPIRE", 2, true, wrapHandlePExpire)
+	engine.RegisterCommand("EXPIRE", -2, true, wrapHandleExpire, engine.FlagAllowOOM)
+	engine.RegisterCommand("PEXPIRE", -2, true, wrapHandlePExpire, engine.FlagAllowOOM)
+	engine.RegisterCommand("EXPIREAT", -2, true, wrapHandleExpireAt, engine.FlagAllowOOM)
+	engine.RegisterCommand("PEXPIREAT", -2, true, wrapHandlePExpireAt, engine.FlagAllowOOM)
+	engine.RegisterCommand("PERSIST", 1, true, handlePersist, engine.FlagAllowOOM)
 	engine.RegisterCommand("TTL", 1, false, wrapHandleTTL)
 	engine.RegisterCommand("PTTL", 1, false, wrapHandlePTTL)
+	engine.RegisterCommand("EXPIRETIME", 1, false, wrapHandleExpireTime)
+	engine.RegisterCommand("PEXPIRETIME", 1, false, wrapHandlePExpireTime)
 }
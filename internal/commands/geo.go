@@ -0,0 +1,324 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/engine"
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/geo"
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/resp"
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/storage"
+)
+
+var (
+	errGeoUnit    = errors.New("ERR unsupported unit provided. please use M, KM, FT, MI")
+	errGeoCount   = errors.New("ERR COUNT must be > 0")
+	errGeoAny     = errors.New("ERR the ANY argument requires COUNT argument")
+	errGeoNegSize = errors.New("ERR height or width cannot be negative")
+	errGeoNegRad  = errors.New("ERR radius cannot be negative")
+)
+
+// geoUnits are the meters in each unit a distance can be given in.
+var geoUnits = map[string]float64{"M": 1, "KM": 1000, "FT": 0.3048, "MI": 1609.34}
+
+func parseGeoUnit(arg string) (float64, error) {
+	unit, ok := geoUnits[strings.ToUpper(arg)]
+	if !ok {
+		return 0, errGeoUnit
+	}
+	return unit, nil
+}
+
+func parseLonLat(lonArg, latArg string) (lon, lat float64, err error) {
+	if lon, err = parseScore(lonArg); err != nil {
+		return 0, 0, err
+	}
+	if lat, err = parseScore(latArg); err != nil {
+		return 0, 0, err
+	}
+	if !geo.Valid(lon, lat) {
+		return 0, 0, fmt.Errorf("ERR invalid longitude,latitude pair %f,%f", lon, lat)
+	}
+	return lon, lat, nil
+}
+
+// formatCoord formats a coordinate like Redis's %.17Lf without the trailing
+// zeros.
+func formatCoord(v float64) string {
+	s := strconv.FormatFloat(v, 'f', 17, 64)
+	return strings.TrimRight(strings.TrimRight(s, "0"), ".")
+}
+
+func formatDist(meters, unit float64) string {
+	return strconv.FormatFloat(meters/unit, 'f', 4, 64)
+}
+
+func coordReply(score float64) resp.Value {
+	lon, lat := geo.Decode(uint64(score))
+	return resp.NewArrayValue([]resp.Value{resp.NewBulkValue(formatCoord(lon)), resp.NewBulkValue(formatCoord(lat))})
+}
+
+// handleGeoAdd implements GEOADD key [NX|XX] [CH] longitude latitude member
+// [longitude latitude member ...].
+func handleGeoAdd(ctx *engine.CommandContext, args []string) resp.Value {
+	var flags storage.ZAddFlags
+	ch := false
+	i := 1
+options:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			flags |= storage.ZAddNX
+		case "XX":
+			flags |= storage.ZAddXX
+		case "CH":
+			ch = true
+		default:
+			break options
+		}
+	}
+	triples := args[i:]
+	if len(triples) == 0 || len(triples)%3 != 0 {
+		return resp.NewErrorValue(errSyntax.Error())
+	}
+	if flags&storage.ZAddNX != 0 && flags&storage.ZAddXX != 0 {
+		return resp.NewErrorValue(errZAddNXXX.Error())
+	}
+
+	members := make([]storage.ZMember, 0, len(triples)/3)
+	for j := 0; j < len(triples); j += 3 {
+		lon, lat, err := parseLonLat(triples[j], triples[j+1])
+		if err != nil {
+			return resp.NewErrorValue(err.Error())
+		}
+		members = append(members, storage.ZMember{Member: triples[j+2], Score: float64(geo.Encode(lon, lat))})
+	}
+	added, changed, err := ctx.Storage().ZAdd(args[0], flags, members...)
+	if err != nil {
+		return storageError("GEOADD", err)
+	}
+	if ch {
+		return resp.NewIntValue(int64(added + changed))
+	}
+	return resp.NewIntValue(int64(added))
+}
+
+func handleGeoPos(ctx *engine.CommandContext, args []string) resp.Value {
+	scores, found, err := ctx.Storage().ZMScore(args[0], args[1:]...)
+	if err != nil {
+		return storageError("GEOPOS", err)
+	}
+	reply := make([]resp.Value, len(scores))
+	for i, score := range scores {
+		reply[i] = resp.NewNullValue()
+		if found[i] {
+			reply[i] = coordReply(score)
+		}
+	}
+	return resp.NewArrayValue(reply)
+}
+
+// handleGeoDist implements GEODIST key member1 member2 [M|KM|FT|MI].
+func handleGeoDist(ctx *engine.CommandContext, args []string) resp.Value {
+	unit := 1.0
+	switch len(args) {
+	case 3:
+	case 4:
+		var err error
+		if unit, err = parseGeoUnit(args[3]); err != nil {
+			return resp.NewErrorValue(err.Error())
+		}
+	default:
+		return resp.NewErrorValue(errSyntax.Error())
+	}
+	scores, found, err := ctx.Storage().ZMScore(args[0], args[1], args[2])
+	if err != nil {
+		return storageError("GEODIST", err)
+	}
+	if !found[0] || !found[1] {
+		return resp.NewNullValue()
+	}
+	lon1, lat1 := geo.Decode(uint64(scores[0]))
+	lon2, lat2 := geo.Decode(uint64(scores[1]))
+	return resp.NewBulkValue(formatDist(geo.Distance(lon1, lat1, lon2, lat2), unit))
+}
+
+func handleGeoHash(ctx *engine.CommandContext, args []string) resp.Value {
+	scores, found, err := ctx.Storage().ZMScore(args[0], args[1:]...)
+	if err != nil {
+		return storageError("GEOHASH", err)
+	}
+	reply := make([]resp.Value, len(scores))
+	for i, score := range scores {
+		reply[i] = resp.NewNullValue()
+		if found[i] {
+			reply[i] = resp.NewBulkValue(geo.String(uint64(score)))
+		}
+	}
+	return resp.NewArrayValue(reply)
+}
+
+// geoSearchArgs are the parsed options of GEOSEARCH and GEOSEARCHSTORE.
+type geoSearchArgs struct {
+	query                         storage.GeoQuery
+	unit                          float64
+	withCoord, withDist, withHash bool
+	storeDist                     bool
+}
+
+// parseGeoSearch parses "FROMMEMBER member | FROMLONLAT longitude latitude
+// BYRADIUS radius unit | BYBOX width height unit [ASC|DESC] [COUNT count
+// [ANY]]", followed by [WITHCOORD] [WITHDIST] [WITHHASH] for GEOSEARCH or
+// by [STOREDIST] for GEOSEARCHSTORE.
+func parseGeoSearch(cmdName string, args []string, store bool) (geoSearchArgs, error) {
+	var a geoSearchArgs
+	q := &a.query
+	from, by := 0, 0
+	for i := 0; i < len(args); i++ {
+		left := len(args) - i - 1
+		var err error
+		switch opt := strings.ToUpper(args[i]); {
+		case opt == "FROMMEMBER" && left >= 1:
+			q.FromMember, q.Member = true, args[i+1]
+			from++
+			i++
+		case opt == "FROMLONLAT" && left >= 2:
+			if q.Lon, q.Lat, err = parseLonLat(args[i+1], args[i+2]); err != nil {
+				return a, err
+			}
+			from++
+			i += 2
+		case opt == "BYRADIUS" && left >= 2:
+			if q.Shape.Radius, err = parseScore(args[i+1]); err != nil {
+				return a, errors.New("ERR need numeric radius")
+			}
+			if q.Shape.Radius < 0 {
+				return a, errGeoNegRad
+			}
+			if a.unit, err = parseGeoUnit(args[i+2]); err != nil {
+				return a, err
+			}
+			by++
+			i += 2
+		case opt == "BYBOX" && left >= 3:
+			if q.Shape.Width, err = parseScore(args[i+1]); err != nil {
+				return a, errors.New("ERR need numeric width")
+			}
+			if q.Shape.Height, err = parseScore(args[i+2]); err != nil {
+				return a, errors.New("ERR need numeric height")
+			}
+			if q.Shape.Width < 0 || q.Shape.Height < 0 {
+				return a, errGeoNegSize
+			}
+			if a.unit, err = parseGeoUnit(args[i+3]); err != nil {
+				return a, err
+			}
+			by++
+			i += 3
+		case opt == "ASC":
+			q.Sort = storage.GeoAsc
+		case opt == "DESC":
+			q.Sort = storage.GeoDesc
+		case opt == "COUNT" && left >= 1:
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return a, errNotInteger
+			}
+			if n <= 0 {
+				return a, errGeoCount
+			}
+			q.Count = int(n)
+			i++
+			if i+1 < len(args) && strings.EqualFold(args[i+1], "ANY") {
+				q.Any = true
+				i++
+			}
+		case opt == "ANY":
+			return a, errGeoAny
+		case opt == "WITHCOORD":
+			a.withCoord = true
+		case opt == "WITHDIST":
+			a.withDist = true
+		case opt == "WITHHASH":
+			a.withHash = true
+		case opt == "STOREDIST" && store:
+			a.storeDist = true
+		default:
+			return a, errSyntax
+		}
+	}
+	if from != 1 {
+		return a, fmt.Errorf("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for %s", cmdName)
+	}
+	if by != 1 {
+		return a, fmt.Errorf("ERR exactly one of BYRADIUS and BYBOX can be specified for %s", cmdName)
+	}
+	if store && (a.withCoord || a.withDist || a.withHash) {
+		return a, fmt.Errorf("ERR %s is not compatible with WITHDIST, WITHHASH and WITHCOORD options", cmdName)
+	}
+	q.Shape.Radius *= a.unit
+	q.Shape.Width *= a.unit
+	q.Shape.Height *= a.unit
+	// like Redis, a capped search returns the nearest points unless ANY
+	if q.Count > 0 && !q.Any && q.Sort == storage.GeoUnsorted {
+		q.Sort = storage.GeoAsc
+	}
+	return a, nil
+}
+
+// handleGeoSearch implements GEOSEARCH key with the options parsed by
+// parseGeoSearch.
+func handleGeoSearch(ctx *engine.CommandContext, args []string) resp.Value {
+	a, err := parseGeoSearch("GEOSEARCH", args[1:], false)
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	matches, err := ctx.Storage().GeoSearch(args[0], a.query)
+	if err != nil {
+		return storageError("GEOSEARCH", err)
+	}
+	reply := make([]resp.Value, len(matches))
+	for i, m := range matches {
+		if !a.withDist && !a.withHash && !a.withCoord {
+			reply[i] = resp.NewBulkValue(m.Member)
+			continue
+		}
+		item := []resp.Value{resp.NewBulkValue(m.Member)}
+		if a.withDist {
+			item = append(item, resp.NewBulkValue(formatDist(m.Dist, a.unit)))
+		}
+		if a.withHash {
+			item = append(item, resp.NewIntValue(int64(m.Score)))
+		}
+		if a.withCoord {
+			item = append(item, coordReply(m.Score))
+		}
+		reply[i] = resp.NewArrayValue(item)
+	}
+	return resp.NewArrayValue(reply)
+}
+
+// handleGeoSearchStore implements GEOSEARCHSTORE destination source with the
+// options parsed by parseGeoSearch.
+func handleGeoSearchStore(ctx *engine.CommandContext, args []string) resp.Value {
+	a, err := parseGeoSearch("GEOSEARCHSTORE", args[2:], true)
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	n, err := ctx.Storage().GeoSearchStore(args[0], args[1], a.query, a.storeDist, a.unit)
+	if err != nil {
+		return storageError("GEOSEARCHSTORE", err)
+	}
+	return resp.NewIntValue(int64(n))
+}
+
+func init() {
+	engine.RegisterCommand("GEOADD", -4, true, handleGeoAdd)
+	engine.RegisterCommand("GEOPOS", -1, false, handleGeoPos)
+	engine.RegisterCommand("GEODIST", -3, false, handleGeoDist)
+	engine.RegisterCommand("GEOHASH", -1, false, handleGeoHash)
+	engine.RegisterCommand("GEOSEARCH", -6, false, handleGeoSearch)
+	engine.RegisterCommand("GEOSEARCHSTORE", -7, true, handleGeoSearchStore)
+}
@@ -3,6 +3,9 @@ package commands
 import (
 	"errors"
 	"log"
+	"math"
+	"strconv"
+	"strings"
 
 	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/engine"
 	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/resp"
@@ -10,10 +13,10 @@ import (
 )
 
 func handleHSet(ctx *engine.CommandContext, args []string) resp.Value {
-	if len(args) != 3 {
-		return errWrongArgs()
+	if len(args)%2 == 0 {
+		return errWrongArgsFor("hset")
 	}
-	isNew, err := ctx.Storage().HSet(args[0], args[1], args[2])
+	added, err := ctx.Storage().HSet(args[0], args[1:]...)
 	if err != nil {
 		switch {
 		case errors.Is(err, storage.ErrWrongType):
@@ -23,7 +26,29 @@ func handleHSet(ctx *engine.CommandContext, args []string) resp.Value {
 			return resp.NewErrorValue("ERR internal error")
 		}
 	}
-	return resp.NewIntValue(int64(isNew))
+	return resp.NewIntValue(int64(added))
+}
+
+func handleHMSet(ctx *engine.CommandContext, args []string) resp.Value {
+	if len(args)%2 == 0 {
+		return errWrongArgsFor("hmset")
+	}
+	if _, err := ctx.Storage().HSet(args[0], args[1:]...); err != nil {
+		return storageError("HMSET", err)
+	}
+	return resp.NewStringValue("OK")
+}
+
+func handleHSetNX(ctx *engine.CommandContext, args []string) resp.Value {
+	added, err := ctx.Storage().HSetNX(args[0], args[1], args[2])
+	if err != nil {
+		return storageError("HSETNX", err)
+	}
+	if !added {
+		ctx.SkipPropagation()
+		return resp.NewIntValue(0)
+	}
+	return resp.NewIntValue(1)
 }
 
 func handleHGet(ctx *engine.CommandContext, args []string) resp.Value {
@@ -67,8 +92,181 @@ func handleHGetAll(ctx *engine.CommandContext, args []string) resp.Value {
 	return resp.NewArrayValue(bulks)
 }
 
+func handleHScan(ctx *engine.CommandContext, args []string) resp.Value {
+	if len(args) < 2 {
+		return errWrongArgs()
+	}
+	opts, err := parseScanArgs(args[1:], false)
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	flat, next, err := ctx.Storage().HScan(args[0], opts.cursor, opts.count, opts.pattern)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrWrongType):
+			return resp.NewErrorValue("WRONGTYPE Operation against a key holding the wrong kind of value")
+		default:
+			log.Printf("internal error in HSCAN: %v", err)
+			return resp.NewErrorValue("ERR internal error")
+		}
+	}
+	return scanReply(next, flat)
+}
+
+func handleHMGet(ctx *engine.CommandContext, args []string) resp.Value {
+	values, found, err := ctx.Storage().HMGet(args[0], args[1:]...)
+	if err != nil {
+		return storageError("HMGET", err)
+	}
+	reply := make([]resp.Value, len(values))
+	for i, v := range values {
+		if found[i] {
+			reply[i] = resp.NewBulkValue(v)
+		} else {
+			reply[i] = resp.NewNullValue()
+		}
+	}
+	return resp.NewArrayValue(reply)
+}
+
+func handleHDel(ctx *engine.CommandContext, args []string) resp.Value {
+	deleted, err := ctx.Storage().HDel(args[0], args[1:]...)
+	if err != nil {
+		return storageError("HDEL", err)
+	}
+	if deleted == 0 {
+		ctx.SkipPropagation()
+	}
+	return resp.NewIntValue(int64(deleted))
+}
+
+func handleHExists(ctx *engine.CommandContext, args []string) resp.Value {
+	_, exists, err := ctx.Storage().HGet(args[0], args[1])
+	if err != nil {
+		return storageError("HEXISTS", err)
+	}
+	if exists {
+		return resp.NewIntValue(1)
+	}
+	return resp.NewIntValue(0)
+}
+
+func handleHLen(ctx *engine.CommandContext, args []string) resp.Value {
+	n, err := ctx.Storage().HLen(args[0])
+	if err != nil {
+		return storageError("HLEN", err)
+	}
+	return resp.NewIntValue(int64(n))
+}
+
+// hashHalf replies with the fields (offset 0) or the values (offset 1) of
+// the hash at key.
+func hashHalf(ctx *engine.CommandContext, cmdName, key string, offset int) resp.Value {
+	flat, err := ctx.Storage().HGetAll(key)
+	if err != nil {
+		return storageError(cmdName, err)
+	}
+	half := make([]resp.Value, 0, len(flat)/2)
+	for i := offset; i < len(flat); i += 2 {
+		half = append(half, resp.NewBulkValue(flat[i]))
+	}
+	return resp.NewArrayValue(half)
+}
+
+func handleHKeys(ctx *engine.CommandContext, args []string) resp.Value {
+	return hashHalf(ctx, "HKEYS", args[0], 0)
+}
+
+func handleHVals(ctx *engine.CommandContext, args []string) resp.Value {
+	return hashHalf(ctx, "HVALS", args[0], 1)
+}
+
+func handleHStrLen(ctx *engine.CommandContext, args []string) resp.Value {
+	val, _, err := ctx.Storage().HGet(args[0], args[1])
+	if err != nil {
+		return storageError("HSTRLEN", err)
+	}
+	return resp.NewIntValue(int64(len(val)))
+}
+
+func handleHIncrBy(ctx *engine.CommandContext, args []string) resp.Value {
+	delta, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return resp.NewErrorValue(errNotInteger.Error())
+	}
+	result, err := ctx.Storage().HIncrBy(args[0], args[1], delta)
+	if err != nil {
+		return storageError("HINCRBY", err)
+	}
+	return resp.NewIntValue(result)
+}
+
+func handleHIncrByFloat(ctx *engine.CommandContext, args []string) resp.Value {
+	delta, err := strconv.ParseFloat(args[2], 64)
+	if err != nil || math.IsNaN(delta) || math.IsInf(delta, 0) {
+		return resp.NewErrorValue("ERR value is not a valid float")
+	}
+	result, err := ctx.Storage().HIncrByFloat(args[0], args[1], delta)
+	if err != nil {
+		return storageError("HINCRBYFLOAT", err)
+	}
+	// logged as the result for the same reason as INCRBYFLOAT, with
+	// KEEPTTL since HSET would clear the TTL of the field on replay
+	ctx.Propagate("HSETEX", args[0], "KEEPTTL", "FIELDS", "1", args[1], result)
+	return resp.NewBulkValue(result)
+}
+
+func handleHRandField(ctx *engine.CommandContext, args []string) resp.Value {
+	if len(args) > 3 || len(args) == 3 && !strings.EqualFold(args[2], "WITHVALUES") {
+		return resp.NewErrorValue(errSyntax.Error())
+	}
+	count, withCount := 1, len(args) >= 2
+	if withCount {
+		var err error
+		if count, err = strconv.Atoi(args[1]); err != nil {
+			return resp.NewErrorValue(errNotInteger.Error())
+		}
+		if count < -maxRandCount {
+			return resp.NewErrorValue(errOutOfRange.Error())
+		}
+	}
+
+	// a negative count allows the same field to be returned several times
+	fields, values, err := ctx.Storage().HRandField(args[0], max(count, -count), count > 0)
+	if err != nil {
+		return storageError("HRANDFIELD", err)
+	}
+	switch {
+	case len(args) == 3:
+		reply := make([]resp.Value, 0, 2*len(fields))
+		for i := range fields {
+			reply = append(reply, resp.NewBulkValue(fields[i]), resp.NewBulkValue(values[i]))
+		}
+		return resp.NewArrayValue(reply)
+	case withCount:
+		return bulkArray(fields)
+	case len(fields) == 0:
+		return resp.NewNullValue()
+	default:
+		return resp.NewBulkValue(fields[0])
+	}
+}
+
 func init() {
-	engine.RegisterCommand("HSET", 3, true, handleHSet)
+	engine.RegisterCommand("HSET", -3, true, handleHSet)
+	engine.RegisterCommand("HMSET", -3, true, handleHMSet)
+	engine.RegisterCommand("HSETNX", 3, true, handleHSetNX)
+	engine.RegisterCommand("HMGET", -2, false, handleHMGet)
+	engine.RegisterCommand("HDEL", -2, true, handleHDel, engine.FlagAllowOOM)
+	engine.RegisterCommand("HEXISTS", 2, false, handleHExists)
+	engine.RegisterCommand("HLEN", 1, false, handleHLen)
+	engine.RegisterCommand("HKEYS", 1, false, handleHKeys)
+	engine.RegisterCommand("HVALS", 1, false, handleHVals)
+	engine.RegisterCommand("HSTRLEN", 2, false, handleHStrLen)
+	engine.RegisterCommand("HINCRBY", 3, true, handleHIncrBy)
+	engine.RegisterCommand("HINCRBYFLOAT", 3, true, handleHIncrByFloat)
+	engine.RegisterCommand("HRANDFIELD", -1, false, handleHRandField)
 	engine.RegisterCommand("HGET", 2, false, handleHGet)
 	engine.RegisterCommand("HGETALL", 1, false, handleHGetAll)
+	engine.RegisterCommand("HSCAN", -2, false, handleHScan)
 }
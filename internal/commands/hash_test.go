@@ -0,0 +1,36 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/engine"
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/storage"
+)
+
+func TestHRandField_Count(t *testing.T) {
+	ctx := engine.NewCommandContext(storage.NewDatabases(1, 4), nil)
+	ctx.Storage().HSet("h", "a", "1", "b", "2")
+	tests := []struct {
+		args []string
+		n    int
+		err  string
+	}{
+		{[]string{"2"}, 2, ""},
+		{[]string{"9223372036854775807", "WITHVALUES"}, 4, ""},
+		{[]string{"-5", "WITHVALUES"}, 10, ""},
+		{[]string{"-1000000000000"}, 0, errOutOfRange.Error()},
+		{[]string{"-9223372036854775808", "WITHVALUES"}, 0, errOutOfRange.Error()},
+	}
+	for _, tt := range tests {
+		reply := engine.DispatchCommand(ctx, "HRANDFIELD", append([]string{"h"}, tt.args...))
+		if tt.err != "" {
+			if reply.Str() != tt.err {
+				t.Fatalf("%q: got %q; want %q", tt.args, reply.Marshal(), tt.err)
+			}
+			continue
+		}
+		if got := len(reply.Array()); got != tt.n {
+			t.Fatalf("%q: got %d elements; want %d", tt.args, got, tt.n)
+		}
+	}
+}
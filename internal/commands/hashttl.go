@@ -0,0 +1,303 @@
+package commands
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/engine"
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/resp"
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/storage"
+)
+
+// parseFields parses the trailing "FIELDS numfields field [field ...]"
+// argument of the hash field expiration commands. With pairs, every field
+// is followed by its value.
+func parseFields(args []string, pairs bool) ([]string, error) {
+	if len(args) < 2 || !strings.EqualFold(args[0], "FIELDS") {
+		return nil, errors.New("ERR Mandatory argument FIELDS is missing or not at the right position")
+	}
+	numFields, err := strconv.Atoi(args[1])
+	if err != nil || numFields <= 0 {
+		return nil, errors.New("ERR Parameter `numFields` should be greater than 0")
+	}
+	per := 1
+	if pairs {
+		per = 2
+	}
+	if len(args)-2 != numFields*per {
+		return nil, errors.New("ERR The `numfields` parameter must match the number of arguments")
+	}
+	return args[2:], nil
+}
+
+func intArray[T int | int64](values []T) resp.Value {
+	reply := make([]resp.Value, len(values))
+	for i, v := range values {
+		reply[i] = resp.NewIntValue(int64(v))
+	}
+	return resp.NewArrayValue(reply)
+}
+
+// handleHExpire implements HEXPIRE key time [NX|XX|GT|LT] FIELDS numfields
+// field [field ...] and its variants. Changes are logged to the AOF as
+// HPEXPIREAT with an absolute time, and fields deleted by a time in the past
+// as HDEL.
+func handleHExpire(ctx *engine.CommandContext, cmdName string, args []string, unit time.Duration, absolute bool) resp.Value {
+	when, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return resp.NewErrorValue(errNotInteger.Error())
+	}
+	rest := args[2:]
+	var cond storage.ExpireCondition
+	if !strings.EqualFold(rest[0], "FIELDS") {
+		if cond, err = parseExpireCondition(rest[:1]); err != nil {
+			return resp.NewErrorValue(err.Error())
+		}
+		rest = rest[1:]
+	}
+	fields, err := parseFields(rest, false)
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	whenMilli, ok := toUnixMilli(when, unit, absolute)
+	if when < 0 || !ok {
+		return resp.NewErrorValue(errInvalidExpire(cmdName).Error())
+	}
+
+	results, err := ctx.Storage().HExpireAt(args[0], whenMilli, cond, fields...)
+	if err != nil {
+		return storageError(cmdName, err)
+	}
+
+	var updated, deleted []string
+	for i, r := range results {
+		switch r {
+		case storage.FieldUpdated:
+			updated = append(updated, fields[i])
+		case storage.FieldDeleted:
+			deleted = append(deleted, fields[i])
+		}
+	}
+	ctx.SkipPropagation()
+	if len(updated) > 0 {
+		ctx.Propagate("HPEXPIREAT", append([]string{args[0], strconv.FormatInt(whenMilli, 10), "FIELDS", strconv.Itoa(len(updated))}, updated...)...)
+	}
+	if len(deleted) > 0 {
+		ctx.Propagate("HDEL", append([]string{args[0]}, deleted...)...)
+	}
+	return intArray(results)
+}
+
+func wrapHandleHExpire(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleHExpire(ctx, "HEXPIRE", args, time.Second, false)
+}
+
+func wrapHandleHPExpire(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleHExpire(ctx, "HPEXPIRE", args, time.Millisecond, false)
+}
+
+func wrapHandleHExpireAt(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleHExpire(ctx, "HEXPIREAT", args, time.Second, true)
+}
+
+func wrapHandleHPExpireAt(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleHExpire(ctx, "HPEXPIREAT", args, time.Millisecond, true)
+}
+
+// handleHTTL implements HTTL, HPTTL, HEXPIRETIME and HPEXPIRETIME, which
+// differ in unit and in whether they answer with a time or a duration.
+func handleHTTL(ctx *engine.CommandContext, cmdName string, args []string, unit time.Duration, absolute bool) resp.Value {
+	fields, err := parseFields(args[1:], false)
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	results, err := ctx.Storage().HExpireTime(args[0], fields...)
+	if err != nil {
+		return storageError(cmdName, err)
+	}
+	now := time.Now().UnixMilli()
+	for i, at := range results {
+		if at < 0 {
+			continue
+		}
+		if !absolute {
+			at = max(at-now, 0)
+		}
+		if unit == time.Second {
+			at /= 1000
+		}
+		results[i] = at
+	}
+	return intArray(results)
+}
+
+func wrapHandleHTTL(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleHTTL(ctx, "HTTL", args, time.Second, false)
+}
+
+func wrapHandleHPTTL(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleHTTL(ctx, "HPTTL", args, time.Millisecond, false)
+}
+
+func wrapHandleHExpireTime(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleHTTL(ctx, "HEXPIRETIME", args, time.Second, true)
+}
+
+func wrapHandleHPExpireTime(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleHTTL(ctx, "HPEXPIRETIME", args, time.Millisecond, true)
+}
+
+func handleHPersist(ctx *engine.CommandContext, args []string) resp.Value {
+	fields, err := parseFields(args[1:], false)
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	results, err := ctx.Storage().HPersist(args[0], fields...)
+	if err != nil {
+		return storageError("HPERSIST", err)
+	}
+	if !slices.Contains(results, storage.FieldUpdated) {
+		ctx.SkipPropagation()
+	}
+	return intArray(results)
+}
+
+// handleHGetEx implements HGETEX key [EX|PX|EXAT|PXAT time | PERSIST]
+// FIELDS numfields field [field ...].
+func handleHGetEx(ctx *engine.CommandContext, args []string) resp.Value {
+	var expireAt int64
+	persist := false
+	rest := args[1:]
+	for len(rest) > 0 && !strings.EqualFold(rest[0], "FIELDS") {
+		switch opt := strings.ToUpper(rest[0]); opt {
+		case "PERSIST":
+			if expireAt != 0 || persist {
+				return resp.NewErrorValue(errSyntax.Error())
+			}
+			persist = true
+			rest = rest[1:]
+		case "EX", "PX", "EXAT", "PXAT":
+			if expireAt != 0 || persist || len(rest) < 2 {
+				return resp.NewErrorValue(errSyntax.Error())
+			}
+			var err error
+			if expireAt, err = parseExpireOption("hgetex", opt, rest[1]); err != nil {
+				return resp.NewErrorValue(err.Error())
+			}
+			rest = rest[2:]
+		default:
+			return resp.NewErrorValue(errSyntax.Error())
+		}
+	}
+	fields, err := parseFields(rest, false)
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+
+	values, found, err := ctx.Storage().HGetEx(args[0], expireAt, persist, fields...)
+	if err != nil {
+		return storageError("HGETEX", err)
+	}
+
+	reply := make([]resp.Value, len(values))
+	var existing []string
+	for i, v := range values {
+		if found[i] {
+			reply[i] = resp.NewBulkValue(v)
+			existing = append(existing, fields[i])
+		} else {
+			reply[i] = resp.NewNullValue()
+		}
+	}
+
+	ctx.SkipPropagation()
+	switch {
+	case len(existing) == 0:
+	case persist:
+		ctx.Propagate("HPERSIST", append([]string{args[0], "FIELDS", strconv.Itoa(len(existing))}, existing...)...)
+	case expireAt != 0 && expireAt <= time.Now().UnixMilli():
+		ctx.Propagate("HDEL", append([]string{args[0]}, existing...)...)
+	case expireAt != 0:
+		ctx.Propagate("HPEXPIREAT", append([]string{args[0], strconv.FormatInt(expireAt, 10), "FIELDS", strconv.Itoa(len(existing))}, existing...)...)
+	}
+	return resp.NewArrayValue(reply)
+}
+
+// handleHSetEx implements HSETEX key [FNX|FXX] [EX|PX|EXAT|PXAT time |
+// KEEPTTL] FIELDS numfields field value [field value ...]. A relative
+// expiration is logged to the AOF as PXAT.
+func handleHSetEx(ctx *engine.CommandContext, args []string) resp.Value {
+	var opts storage.HSetExOptions
+	rest := args[1:]
+	for len(rest) > 0 && !strings.EqualFold(rest[0], "FIELDS") {
+		switch opt := strings.ToUpper(rest[0]); opt {
+		case "FNX", "FXX":
+			if opts.Cond != storage.SetAlways {
+				return resp.NewErrorValue(errSyntax.Error())
+			}
+			opts.Cond = storage.SetNX
+			if opt == "FXX" {
+				opts.Cond = storage.SetXX
+			}
+			rest = rest[1:]
+		case "KEEPTTL":
+			if opts.ExpireAt != 0 || opts.KeepTTL {
+				return resp.NewErrorValue(errSyntax.Error())
+			}
+			opts.KeepTTL = true
+			rest = rest[1:]
+		case "EX", "PX", "EXAT", "PXAT":
+			if opts.ExpireAt != 0 || opts.KeepTTL || len(rest) < 2 {
+				return resp.NewErrorValue(errSyntax.Error())
+			}
+			var err error
+			if opts.ExpireAt, err = parseExpireOption("hsetex", opt, rest[1]); err != nil {
+				return resp.NewErrorValue(err.Error())
+			}
+			rest = rest[2:]
+		default:
+			return resp.NewErrorValue(errSyntax.Error())
+		}
+	}
+	pairs, err := parseFields(rest, true)
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+
+	applied, err := ctx.Storage().HSetEx(args[0], opts, pairs...)
+	if err != nil {
+		return storageError("HSETEX", err)
+	}
+	if !applied {
+		ctx.SkipPropagation()
+		return resp.NewIntValue(0)
+	}
+
+	logged := []string{args[0]}
+	switch {
+	case opts.KeepTTL:
+		logged = append(logged, "KEEPTTL")
+	case opts.ExpireAt != 0:
+		logged = append(logged, "PXAT", strconv.FormatInt(opts.ExpireAt, 10))
+	}
+	logged = append(logged, "FIELDS", strconv.Itoa(len(pairs)/2))
+	ctx.Propagate("HSETEX", append(logged, pairs...)...)
+	return resp.NewIntValue(1)
+}
+
+func init() {
+	engine.RegisterCommand("HEXPIRE", -5, true, wrapHandleHExpire)
+	engine.RegisterCommand("HPEXPIRE", -5, true, wrapHandleHPExpire)
+	engine.RegisterCommand("HEXPIREAT", -5, true, wrapHandleHExpireAt)
+	engine.RegisterCommand("HPEXPIREAT", -5, true, wrapHandleHPExpireAt)
+	engine.RegisterCommand("HTTL", -4, false, wrapHandleHTTL)
+	engine.RegisterCommand("HPTTL", -4, false, wrapHandleHPTTL)
+	engine.RegisterCommand("HEXPIRETIME", -4, false, wrapHandleHExpireTime)
+	engine.RegisterCommand("HPEXPIRETIME", -4, false, wrapHandleHPExpireTime)
+	engine.RegisterCommand("HPERSIST", -4, true, handleHPersist, engine.FlagAllowOOM)
+	engine.RegisterCommand("HGETEX", -4, true, handleHGetEx)
+	engine.RegisterCommand("HSETEX", -5, true, handleHSetEx)
+}
@@ -0,0 +1,41 @@
+package commands
+
+import (
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/engine"
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/resp"
+)
+
+func handlePFAdd(ctx *engine.CommandContext, args []string) resp.Value {
+	updated, err := ctx.Storage().PFAdd(args[0], args[1:]...)
+	if err != nil {
+		return storageError("PFADD", err)
+	}
+	if !updated {
+		ctx.SkipPropagation()
+		return resp.NewIntValue(0)
+	}
+	return resp.NewIntValue(1)
+}
+
+// handlePFCount implements PFCOUNT key [key ...]; several keys are counted
+// as their union.
+func handlePFCount(ctx *engine.CommandContext, args []string) resp.Value {
+	n, err := ctx.Storage().PFCount(args...)
+	if err != nil {
+		return storageError("PFCOUNT", err)
+	}
+	return resp.NewIntValue(n)
+}
+
+func handlePFMerge(ctx *engine.CommandContext, args []string) resp.Value {
+	if err := ctx.Storage().PFMerge(args[0], args[1:]...); err != nil {
+		return storageError("PFMERGE", err)
+	}
+	return resp.NewStringValue("OK")
+}
+
+func init() {
+	engine.RegisterCommand("PFADD", -1, true, handlePFAdd)
+	engine.RegisterCommand("PFCOUNT", -1, false, handlePFCount)
+	engine.RegisterCommand("PFMERGE", -1, true, handlePFMerge)
+}
@@ -0,0 +1,93 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/engine"
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/resp"
+)
+
+func humanBytes(n int64) string {
+	const units = "KMGTPE"
+	if n < 1024 {
+		return fmt.Sprintf("%dB", n)
+	}
+	value := float64(n)
+	i := -1
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.2f%c", value, units[i])
+}
+
+func infoMemory(ctx *engine.CommandContext) string {
+	dbs := ctx.Databases()
+	used, limit := dbs.UsedMemory(), dbs.MaxMemory()
+	var b strings.Builder
+	b.WriteString("# Memory\r\n")
+	fmt.Fprintf(&b, "used_memory:%d\r\n", used)
+	fmt.Fprintf(&b, "used_memory_human:%s\r\n", humanBytes(used))
+	fmt.Fprintf(&b, "maxmemory:%d\r\n", limit)
+	fmt.Fprintf(&b, "maxmemory_human:%s\r\n", humanBytes(limit))
+	fmt.Fprintf(&b, "maxmemory_policy:%s\r\n", dbs.EvictionPolicy())
+	return b.String()
+}
+
+func infoStats(ctx *engine.CommandContext) string {
+	stats := ctx.Databases().Stats()
+	var b strings.Builder
+	b.WriteString("# Stats\r\n")
+	fmt.Fprintf(&b, "expired_keys:%d\r\n", stats.ExpiredKeys())
+	fmt.Fprintf(&b, "expired_subkeys:%d\r\n", stats.ExpiredSubkeys())
+	fmt.Fprintf(&b, "expired_stale_perc:%.2f\r\n", stats.ExpiredStalePerc())
+	fmt.Fprintf(&b, "expired_time_cap_reached_count:%d\r\n", stats.ExpiredTimeCapReached())
+	fmt.Fprintf(&b, "evicted_keys:%d\r\n", stats.EvictedKeys())
+	return b.String()
+}
+
+func infoKeyspace(ctx *engine.CommandContext) string {
+	dbs := ctx.Databases()
+	var b strings.Builder
+	b.WriteString("# Keyspace\r\n")
+	for i := 0; i < dbs.Len(); i++ {
+		keys, expires := dbs.DB(i).KeyCounts()
+		if keys == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "db%d:keys=%d,expires=%d\r\n", i, keys, expires)
+	}
+	return b.String()
+}
+
+var infoSections = []struct {
+	name  string
+	build func(ctx *engine.CommandContext) string
+}{
+	{"memory", infoMemory},
+	{"stats", infoStats},
+	{"keyspace", infoKeyspace},
+}
+
+func handleInfo(ctx *engine.CommandContext, args []string) resp.Value {
+	if len(args) > 1 {
+		return errWrongArgs()
+	}
+	section := "all"
+	if len(args) == 1 {
+		section = strings.ToLower(args[0])
+	}
+
+	parts := make([]string, 0, len(infoSections))
+	for _, s := range infoSections {
+		if section == "all" || section == "default" || section == s.name {
+			parts = append(parts, s.build(ctx))
+		}
+	}
+	return resp.NewBulkValue(strings.Join(parts, "\r\n"))
+}
+
+func init() {
+	engine.RegisterCommand("INFO", 0, false, handleInfo)
+}
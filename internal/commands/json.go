@@ -0,0 +1,245 @@
+package commands
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/engine"
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/resp"
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/storage"
+)
+
+// jsonPathArg parses the optional path at args[i], which defaults to the
+// legacy root.
+func jsonPathArg(args []string, i int) (*storage.JSONPath, error) {
+	if i < len(args) {
+		return storage.ParseJSONPath(args[i])
+	}
+	return storage.ParseJSONPath(".")
+}
+
+// lengthsReply replies with the lengths the JSON commands return for each
+// value a path selected, nil for the values of the wrong type.
+func lengthsReply(lens []int) resp.Value {
+	reply := make([]resp.Value, len(lens))
+	for i, n := range lens {
+		reply[i] = resp.NewNullValue()
+		if n >= 0 {
+			reply[i] = resp.NewIntValue(int64(n))
+		}
+	}
+	return resp.NewArrayValue(reply)
+}
+
+// handleJSONSet implements JSON.SET key path value [NX|XX].
+func handleJSONSet(ctx *engine.CommandContext, args []string) resp.Value {
+	if len(args) > 4 {
+		return resp.NewErrorValue(errSyntax.Error())
+	}
+	cond := storage.SetAlways
+	if len(args) == 4 {
+		switch strings.ToUpper(args[3]) {
+		case "NX":
+			cond = storage.SetNX
+		case "XX":
+			cond = storage.SetXX
+		default:
+			return resp.NewErrorValue(errSyntax.Error())
+		}
+	}
+	path, err := storage.ParseJSONPath(args[1])
+	if err != nil {
+		return storageError("JSON.SET", err)
+	}
+	value, err := storage.ParseJSON(args[2])
+	if err != nil {
+		return storageError("JSON.SET", err)
+	}
+	applied, err := ctx.Storage().JSONSet(args[0], path, value, cond)
+	if err != nil {
+		return storageError("JSON.SET", err)
+	}
+	if !applied {
+		ctx.SkipPropagation()
+		return resp.NewNullValue()
+	}
+	return resp.NewStringValue("OK")
+}
+
+// handleJSONGet implements JSON.GET key [INDENT indent] [NEWLINE newline]
+// [SPACE space] [path ...].
+func handleJSONGet(ctx *engine.CommandContext, args []string) resp.Value {
+	var format storage.JSONFormat
+	i := 1
+options:
+	for ; i+1 < len(args); i += 2 {
+		switch strings.ToUpper(args[i]) {
+		case "INDENT":
+			format.Indent = args[i+1]
+		case "NEWLINE":
+			format.Newline = args[i+1]
+		case "SPACE":
+			format.Space = args[i+1]
+		default:
+			break options
+		}
+	}
+	var paths []*storage.JSONPath
+	for ; i < len(args) || len(paths) == 0; i++ {
+		path, err := jsonPathArg(args, i)
+		if err != nil {
+			return storageError("JSON.GET", err)
+		}
+		paths = append(paths, path)
+	}
+	result, exists, err := ctx.Storage().JSONGet(args[0], paths, format)
+	if err != nil {
+		return storageError("JSON.GET", err)
+	}
+	if !exists {
+		return resp.NewNullValue()
+	}
+	return resp.NewBulkValue(result)
+}
+
+func handleJSONDel(ctx *engine.CommandContext, args []string) resp.Value {
+	if len(args) > 2 {
+		return errWrongArgsFor("json.del")
+	}
+	path, err := jsonPathArg(args, 1)
+	if err != nil {
+		return storageError("JSON.DEL", err)
+	}
+	n, err := ctx.Storage().JSONDel(args[0], path)
+	if err != nil {
+		return storageError("JSON.DEL", err)
+	}
+	if n == 0 {
+		ctx.SkipPropagation()
+	}
+	return resp.NewIntValue(int64(n))
+}
+
+func handleJSONType(ctx *engine.CommandContext, args []string) resp.Value {
+	if len(args) > 2 {
+		return errWrongArgsFor("json.type")
+	}
+	path, err := jsonPathArg(args, 1)
+	if err != nil {
+		return storageError("JSON.TYPE", err)
+	}
+	types, exists, err := ctx.Storage().JSONType(args[0], path)
+	if err != nil {
+		return storageError("JSON.TYPE", err)
+	}
+	switch {
+	case !exists:
+		return resp.NewNullValue()
+	case !path.Legacy():
+		return bulkArray(types)
+	case len(types) == 0:
+		return resp.NewNullValue()
+	}
+	return resp.NewStringValue(types[0])
+}
+
+// handleJSONArrAppend implements JSON.ARRAPPEND key path value [value ...].
+func handleJSONArrAppend(ctx *engine.CommandContext, args []string) resp.Value {
+	path, err := storage.ParseJSONPath(args[1])
+	if err != nil {
+		return storageError("JSON.ARRAPPEND", err)
+	}
+	values := make([]*storage.JSONValue, len(args)-2)
+	for i, arg := range args[2:] {
+		if values[i], err = storage.ParseJSON(arg); err != nil {
+			return storageError("JSON.ARRAPPEND", err)
+		}
+	}
+	lens, err := ctx.Storage().JSONArrAppend(args[0], path, values...)
+	if err != nil {
+		return storageError("JSON.ARRAPPEND", err)
+	}
+	if !slices.ContainsFunc(lens, func(n int) bool { return n >= 0 }) {
+		ctx.SkipPropagation()
+	}
+	if path.Legacy() {
+		return resp.NewIntValue(int64(lens[0]))
+	}
+	return lengthsReply(lens)
+}
+
+func handleJSONNumIncrBy(ctx *engine.CommandContext, args []string) resp.Value {
+	path, err := storage.ParseJSONPath(args[1])
+	if err != nil {
+		return storageError("JSON.NUMINCRBY", err)
+	}
+	by, err := storage.ParseJSON(args[2])
+	if err != nil {
+		return storageError("JSON.NUMINCRBY", err)
+	}
+	result, err := ctx.Storage().JSONNumIncrBy(args[0], path, by)
+	if err != nil {
+		return storageError("JSON.NUMINCRBY", err)
+	}
+	return resp.NewBulkValue(result)
+}
+
+func handleJSONObjKeys(ctx *engine.CommandContext, args []string) resp.Value {
+	if len(args) > 2 {
+		return errWrongArgsFor("json.objkeys")
+	}
+	path, err := jsonPathArg(args, 1)
+	if err != nil {
+		return storageError("JSON.OBJKEYS", err)
+	}
+	keys, exists, err := ctx.Storage().JSONObjKeys(args[0], path)
+	if err != nil {
+		return storageError("JSON.OBJKEYS", err)
+	}
+	if !exists {
+		return resp.NewNullValue()
+	}
+	if path.Legacy() {
+		return bulkArray(keys[0])
+	}
+	reply := make([]resp.Value, len(keys))
+	for i, k := range keys {
+		reply[i] = resp.NewNullValue()
+		if k != nil {
+			reply[i] = bulkArray(k)
+		}
+	}
+	return resp.NewArrayValue(reply)
+}
+
+func handleJSONStrLen(ctx *engine.CommandContext, args []string) resp.Value {
+	if len(args) > 2 {
+		return errWrongArgsFor("json.strlen")
+	}
+	path, err := jsonPathArg(args, 1)
+	if err != nil {
+		return storageError("JSON.STRLEN", err)
+	}
+	lens, exists, err := ctx.Storage().JSONStrLen(args[0], path)
+	if err != nil {
+		return storageError("JSON.STRLEN", err)
+	}
+	switch {
+	case !exists:
+		return resp.NewNullValue()
+	case path.Legacy():
+		return resp.NewIntValue(int64(lens[0]))
+	}
+	return lengthsReply(lens)
+}
+
+func init() {
+	engine.RegisterCommand("JSON.SET", -3, true, handleJSONSet)
+	engine.RegisterCommand("JSON.GET", -1, false, handleJSONGet)
+	engine.RegisterCommand("JSON.DEL", -1, true, handleJSONDel, engine.FlagAllowOOM)
+	engine.RegisterCommand("JSON.TYPE", -1, false, handleJSONType)
+	engine.RegisterCommand("JSON.ARRAPPEND", -3, true, handleJSONArrAppend)
+	engine.RegisterCommand("JSON.NUMINCRBY", 3, true, handleJSONNumIncrBy)
+	engine.RegisterCommand("JSON.OBJKEYS", -1, false, handleJSONObjKeys)
+	engine.RegisterCommand("JSON.STRLEN", -1, false, handleJSONStrLen)
+}
@@ -1,18 +1,20 @@
 package commands
 
 import (
+	"errors"
+	"log"
+	"strconv"
+
 	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/engine"
 	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/resp"
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/storage"
 )
 
 func handleKeys(ctx *engine.CommandContext, args []string) resp.Value {
 	if len(args) != 1 {
 		return errWrongArgs()
 	}
-	matches, err := ctx.Storage().Keys(args[0])
-	if err != nil {
-		return resp.NewErrorValue("ERR invalid pattern")
-	}
+	matches := ctx.Storage().Keys(args[0])
 	values := make([]resp.Value, len(matches))
 	for i, m := range matches {
 		values[i] = resp.NewBulkValue(m)
@@ -28,7 +30,34 @@ func handleFlushdb(ctx *engine.CommandContext, args []string) resp.Value {
 	return resp.NewStringValue("OK")
 }
 
+func handleMove(ctx *engine.CommandContext, args []string) resp.Value {
+	if len(args) != 2 {
+		return errWrongArgs()
+	}
+	dst, err := strconv.Atoi(args[1])
+	if err != nil {
+		return resp.NewErrorValue("ERR value is not an integer or out of range")
+	}
+	moved, err := ctx.Databases().Move(args[0], ctx.SelectedDB(), dst)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrDBIndex):
+			return resp.NewErrorValue("ERR DB index is out of range")
+		case errors.Is(err, storage.ErrSameDB):
+			return resp.NewErrorValue("ERR source and destination objects are the same")
+		default:
+			log.Printf("internal error in MOVE: %v", err)
+			return resp.NewErrorValue("ERR internal error")
+		}
+	}
+	if moved {
+		return resp.NewIntValue(1)
+	}
+	return resp.NewIntValue(0)
+}
+
 func init() {
 	engine.RegisterCommand("KEYS", 1, false, handleKeys)
-	engine.RegisterCommand("FLUSHDB", 0, true, handleFlushdb)
+	engine.RegisterCommand("FLUSHDB", 0, true, handleFlushdb, engine.FlagAllowOOM)
+	engine.RegisterCommand("MOVE", 2, true, handleMove, engine.FlagAllowOOM)
 }
@@ -0,0 +1,143 @@
+package commands
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/engine"
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/resp"
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/storage"
+)
+
+type lcsMatch struct {
+	aStart, aEnd int
+	bStart, bEnd int
+}
+
+// lcs computes the longest common subsequence of a and b with the classic
+// dynamic programming table, then walks it back from the end collecting the
+// subsequence and the ranges of contiguous matches, last match first.
+func lcs(a, b string) (string, []lcsMatch) {
+	width := len(b) + 1
+	table := make([]uint32, (len(a)+1)*width)
+	at := func(i, j int) uint32 { return table[i*width+j] }
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			if a[i-1] == b[j-1] {
+				table[i*width+j] = at(i-1, j-1) + 1
+			} else {
+				table[i*width+j] = max(at(i-1, j), at(i, j-1))
+			}
+		}
+	}
+
+	result := make([]byte, at(len(a), len(b)))
+	idx := len(result)
+	var matches []lcsMatch
+	var cur lcsMatch
+	inRange := false
+	i, j := len(a), len(b)
+	for i > 0 && j > 0 {
+		emit := false
+		if a[i-1] == b[j-1] {
+			result[idx-1] = a[i-1]
+			if !inRange {
+				cur = lcsMatch{aStart: i - 1, aEnd: i - 1, bStart: j - 1, bEnd: j - 1}
+				inRange = true
+			} else if cur.aStart == i && cur.bStart == j {
+				cur.aStart--
+				cur.bStart--
+			} else {
+				emit = true
+			}
+			if cur.aStart == 0 || cur.bStart == 0 {
+				emit = true
+			}
+			idx--
+			i--
+			j--
+		} else {
+			if at(i-1, j) > at(i, j-1) {
+				i--
+			} else {
+				j--
+			}
+			emit = inRange
+		}
+		if emit {
+			matches = append(matches, cur)
+			inRange = false
+		}
+	}
+	return string(result), matches
+}
+
+func handleLCS(ctx *engine.CommandContext, args []string) resp.Value {
+	if len(args) < 2 {
+		return errWrongArgs()
+	}
+	var getLen, getIdx, withMatchLen bool
+	minMatchLen := 0
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "LEN":
+			getLen = true
+		case "IDX":
+			getIdx = true
+		case "WITHMATCHLEN":
+			withMatchLen = true
+		case "MINMATCHLEN":
+			if i+1 >= len(args) {
+				return resp.NewErrorValue(errSyntax.Error())
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				return resp.NewErrorValue(errNotInteger.Error())
+			}
+			minMatchLen = max(n, 0)
+			i++
+		default:
+			return resp.NewErrorValue(errSyntax.Error())
+		}
+	}
+	if getLen && getIdx {
+		return resp.NewErrorValue("ERR If you want both the length and indexes, please just use IDX.")
+	}
+
+	values, err := ctx.Storage().GetStrings(args[0], args[1])
+	if errors.Is(err, storage.ErrWrongType) {
+		return resp.NewErrorValue("ERR The specified keys must contain string values")
+	}
+	if err != nil {
+		return storageError("LCS", err)
+	}
+
+	subsequence, matches := lcs(values[0], values[1])
+	switch {
+	case getLen:
+		return resp.NewIntValue(int64(len(subsequence)))
+	case !getIdx:
+		return resp.NewBulkValue(subsequence)
+	}
+
+	rangeValue := func(start, end int) resp.Value {
+		return resp.NewArrayValue([]resp.Value{resp.NewIntValue(int64(start)), resp.NewIntValue(int64(end))})
+	}
+	reply := []resp.Value{}
+	for _, m := range matches {
+		matchLen := m.aEnd - m.aStart + 1
+		if matchLen < minMatchLen {
+			continue
+		}
+		item := []resp.Value{rangeValue(m.aStart, m.aEnd), rangeValue(m.bStart, m.bEnd)}
+		if withMatchLen {
+			item = append(item, resp.NewIntValue(int64(matchLen)))
+		}
+		reply = append(reply, resp.NewArrayValue(item))
+	}
+	return resp.NewArrayValue([]resp.Value{
+		resp.NewBulkValue("matches"), resp.NewArrayValue(reply),
+		resp.NewBulkValue("len"), resp.NewIntValue(int64(len(subsequence))),
+	})
+}
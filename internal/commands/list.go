@@ -4,6 +4,7 @@ import (
 	"errors"
 	"log"
 	"strconv"
+	"strings"
 
 	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/engine"
 	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/resp"
@@ -46,32 +47,82 @@ func handleRPush(ctx *engine.CommandContext, args []string) resp.Value {
 	return handlePush(ctx, args, false)
 }
 
+func handlePushX(ctx *engine.CommandContext, args []string, isLeft bool) resp.Value {
+	var (
+		n   int
+		err error
+	)
+	if isLeft {
+		n, err = ctx.Storage().LPushX(args[0], args[1:]...)
+	} else {
+		n, err = ctx.Storage().RPushX(args[0], args[1:]...)
+	}
+	if err != nil {
+		return storageError("PUSHX", err)
+	}
+	if n == 0 {
+		ctx.SkipPropagation()
+	}
+	return resp.NewIntValue(int64(n))
+}
+
+func handleLPushX(ctx *engine.CommandContext, args []string) resp.Value {
+	return handlePushX(ctx, args, true)
+}
+
+func handleRPushX(ctx *engine.CommandContext, args []string) resp.Value {
+	return handlePushX(ctx, args, false)
+}
+
+// parsePopCount parses the optional COUNT argument of LPOP, RPOP, LMPOP and
+// friends.
+func parsePopCount(arg string) (int, error) {
+	count, err := strconv.Atoi(arg)
+	if err != nil || count < 0 {
+		return 0, errors.New("ERR value is out of range, must be positive")
+	}
+	return count, nil
+}
+
 func handlePop(ctx *engine.CommandContext, args []string, isLeft bool) resp.Value {
-	if len(args) != 1 {
+	if len(args) < 1 || len(args) > 2 {
 		return errWrongArgs()
 	}
 
+	count, withCount := 1, len(args) == 2
+	if withCount {
+		var err error
+		if count, err = parsePopCount(args[1]); err != nil {
+			return resp.NewErrorValue(err.Error())
+		}
+	}
+
 	var (
-		popped string
+		popped []string
 		err    error
 	)
-
 	if isLeft {
-		popped, err = ctx.Storage().LPop(args[0])
+		popped, err = ctx.Storage().LPop(args[0], count)
 	} else {
-		popped, err = ctx.Storage().RPop(args[0])
+		popped, err = ctx.Storage().RPop(args[0], count)
 	}
-
 	if err != nil {
-		switch {
-		case errors.Is(err, storage.ErrWrongType):
-			return resp.NewErrorValue("WRONGTYPE Operation against a key holding the wrong kind of value")
-		default:
-			log.Printf("internal error in INCR: %v", err)
-			return resp.NewErrorValue("ERR internal error")
-		}
+		return storageError("POP", err)
+	}
+	if len(popped) == 0 {
+		ctx.SkipPropagation()
+	}
+
+	switch {
+	case !withCount && len(popped) == 0:
+		return resp.NewNullValue()
+	case !withCount:
+		return resp.NewBulkValue(popped[0])
+	case popped == nil:
+		return resp.NewNullValue()
+	default:
+		return bulkArray(popped)
 	}
-	return resp.NewBulkValue(popped)
 }
 
 func handleLPop(ctx *engine.CommandContext, args []string) resp.Value {
@@ -82,6 +133,15 @@ func handleRPop(ctx *engine.CommandContext, args []string) resp.Value {
 	return handlePop(ctx, args, false)
 }
 
+// bulkArray replies with values as an array of bulk strings.
+func bulkArray(values []string) resp.Value {
+	bulks := make([]resp.Value, len(values))
+	for i, v := range values {
+		bulks[i] = resp.NewBulkValue(v)
+	}
+	return resp.NewArrayValue(bulks)
+}
+
 func handleLLen(ctx *engine.CommandContext, args []string) resp.Value {
 	if len(args) != 1 {
 		return errWrongArgs()
@@ -134,11 +194,340 @@ func handleLRange(ctx *engine.CommandContext, args []string) resp.Value {
 	return resp.NewArrayValue(bulks)
 }
 
+func handleLIndex(ctx *engine.CommandContext, args []string) resp.Value {
+	idx, err := strconv.Atoi(args[1])
+	if err != nil {
+		return resp.NewErrorValue(errNotInteger.Error())
+	}
+	val, exists, err := ctx.Storage().LIndex(args[0], idx)
+	if err != nil {
+		return storageError("LINDEX", err)
+	}
+	if !exists {
+		return resp.NewNullValue()
+	}
+	return resp.NewBulkValue(val)
+}
+
+func handleLSet(ctx *engine.CommandContext, args []string) resp.Value {
+	idx, err := strconv.Atoi(args[1])
+	if err != nil {
+		return resp.NewErrorValue(errNotInteger.Error())
+	}
+	if err := ctx.Storage().LSet(args[0], idx, args[2]); err != nil {
+		return storageError("LSET", err)
+	}
+	return resp.NewStringValue("OK")
+}
+
+func handleLInsert(ctx *engine.CommandContext, args []string) resp.Value {
+	var before bool
+	switch strings.ToUpper(args[1]) {
+	case "BEFORE":
+		before = true
+	case "AFTER":
+	default:
+		return resp.NewErrorValue(errSyntax.Error())
+	}
+	n, err := ctx.Storage().LInsert(args[0], before, args[2], args[3])
+	if err != nil {
+		return storageError("LINSERT", err)
+	}
+	if n <= 0 {
+		ctx.SkipPropagation()
+	}
+	return resp.NewIntValue(int64(n))
+}
+
+func handleLRem(ctx *engine.CommandContext, args []string) resp.Value {
+	count, err := strconv.Atoi(args[1])
+	if err != nil {
+		return resp.NewErrorValue(errNotInteger.Error())
+	}
+	removed, err := ctx.Storage().LRem(args[0], count, args[2])
+	if err != nil {
+		return storageError("LREM", err)
+	}
+	if removed == 0 {
+		ctx.SkipPropagation()
+	}
+	return resp.NewIntValue(int64(removed))
+}
+
+func handleLTrim(ctx *engine.CommandContext, args []string) resp.Value {
+	start, err := strconv.Atoi(args[1])
+	if err != nil {
+		return resp.NewErrorValue(errNotInteger.Error())
+	}
+	stop, err := strconv.Atoi(args[2])
+	if err != nil {
+		return resp.NewErrorValue(errNotInteger.Error())
+	}
+	if err := ctx.Storage().LTrim(args[0], start, stop); err != nil {
+		return storageError("LTRIM", err)
+	}
+	return resp.NewStringValue("OK")
+}
+
+func handleLPos(ctx *engine.CommandContext, args []string) resp.Value {
+	rank, count, maxLen := 1, 0, 0
+	withCount := false
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return resp.NewErrorValue(errSyntax.Error())
+		}
+		n, err := strconv.Atoi(args[i+1])
+		if err != nil {
+			return resp.NewErrorValue(errNotInteger.Error())
+		}
+		switch strings.ToUpper(args[i]) {
+		case "RANK":
+			if n == 0 {
+				return resp.NewErrorValue("ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list")
+			}
+			rank = n
+		case "COUNT":
+			if n < 0 {
+				return resp.NewErrorValue("ERR COUNT can't be negative")
+			}
+			count, withCount = n, true
+		case "MAXLEN":
+			if n < 0 {
+				return resp.NewErrorValue("ERR MAXLEN can't be negative")
+			}
+			maxLen = n
+		default:
+			return resp.NewErrorValue(errSyntax.Error())
+		}
+	}
+	if !withCount {
+		count = 1
+	}
+
+	positions, err := ctx.Storage().LPos(args[0], args[1], rank, count, maxLen)
+	if err != nil {
+		return storageError("LPOS", err)
+	}
+	if withCount {
+		reply := make([]resp.Value, len(positions))
+		for i, p := range positions {
+			reply[i] = resp.NewIntValue(int64(p))
+		}
+		return resp.NewArrayValue(reply)
+	}
+	if len(positions) == 0 {
+		return resp.NewNullValue()
+	}
+	return resp.NewIntValue(int64(positions[0]))
+}
+
+// parseListEnd parses a LEFT or RIGHT argument and reports whether it's LEFT.
+func parseListEnd(arg string) (bool, error) {
+	switch strings.ToUpper(arg) {
+	case "LEFT":
+		return true, nil
+	case "RIGHT":
+		return false, nil
+	default:
+		return false, errSyntax
+	}
+}
+
+func doMove(ctx *engine.CommandContext, src, dst string, fromLeft, toLeft bool) resp.Value {
+	moved, exists, err := ctx.Storage().LMove(src, dst, fromLeft, toLeft)
+	if err != nil {
+		return storageError("LMOVE", err)
+	}
+	if !exists {
+		ctx.SkipPropagation()
+		return resp.NewNullValue()
+	}
+	return resp.NewBulkValue(moved)
+}
+
+func handleLMove(ctx *engine.CommandContext, args []string) resp.Value {
+	fromLeft, err := parseListEnd(args[2])
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	toLeft, err := parseListEnd(args[3])
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	return doMove(ctx, args[0], args[1], fromLeft, toLeft)
+}
+
+func handleRPopLPush(ctx *engine.CommandContext, args []string) resp.Value {
+	return doMove(ctx, args[0], args[1], false, true)
+}
+
+// parseMPopArgs parses "numkeys key [key ...] where [COUNT count]", the tail
+// shared by LMPOP, ZMPOP and their blocking variants. parseWhere parses the
+// end to pop from, LEFT|RIGHT for lists or MIN|MAX for sorted sets, and
+// reports whether it is the first one.
+func parseMPopArgs(args []string, parseWhere func(string) (bool, error)) (keys []string, first bool, count int, err error) {
+	numKeys, err := strconv.Atoi(args[0])
+	if err != nil {
+		return nil, false, 0, errNotInteger
+	}
+	if numKeys <= 0 {
+		return nil, false, 0, errors.New("ERR numkeys should be greater than 0")
+	}
+	if len(args) < numKeys+2 {
+		return nil, false, 0, errSyntax
+	}
+	keys = args[1 : numKeys+1]
+	if first, err = parseWhere(args[numKeys+1]); err != nil {
+		return nil, false, 0, err
+	}
+
+	count = 1
+	rest := args[numKeys+2:]
+	switch {
+	case len(rest) == 0:
+	case len(rest) == 2 && strings.EqualFold(rest[0], "COUNT"):
+		count, err = strconv.Atoi(rest[1])
+		if err != nil || count <= 0 {
+			return nil, false, 0, errors.New("ERR count should be greater than 0")
+		}
+	default:
+		return nil, false, 0, errSyntax
+	}
+	return keys, first, count, nil
+}
+
+// mpopReply builds the [key, [values...]] reply of LMPOP and propagates the
+// pop as a plain LPOP or RPOP with a count.
+func mpopReply(ctx *engine.CommandContext, key string, left bool, popped []string) resp.Value {
+	if key == "" {
+		ctx.SkipPropagation()
+		return resp.NewNullValue()
+	}
+	cmd := "RPOP"
+	if left {
+		cmd = "LPOP"
+	}
+	ctx.Propagate(cmd, key, strconv.Itoa(len(popped)))
+	return resp.NewArrayValue([]resp.Value{resp.NewBulkValue(key), bulkArray(popped)})
+}
+
+func handleLMPop(ctx *engine.CommandContext, args []string) resp.Value {
+	keys, left, count, err := parseMPopArgs(args, parseListEnd)
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	key, popped, err := ctx.Storage().LMPop(keys, left, count)
+	if err != nil {
+		return storageError("LMPOP", err)
+	}
+	return mpopReply(ctx, key, left, popped)
+}
+
+func handleBPop(ctx *engine.CommandContext, args []string, isLeft bool) resp.Value {
+	keys := args[:len(args)-1]
+	timeout, err := parseTimeout(args[len(args)-1])
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	return block(ctx, "BPOP", keys, timeout, func() (resp.Value, bool, error) {
+		key, popped, err := ctx.Storage().LMPop(keys, isLeft, 1)
+		if err != nil || key == "" {
+			return resp.Value{}, false, err
+		}
+		if isLeft {
+			ctx.Propagate("LPOP", key)
+		} else {
+			ctx.Propagate("RPOP", key)
+		}
+		return resp.NewArrayValue([]resp.Value{resp.NewBulkValue(key), resp.NewBulkValue(popped[0])}), true, nil
+	})
+}
+
+func handleBLPop(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleBPop(ctx, args, true)
+}
+
+func handleBRPop(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleBPop(ctx, args, false)
+}
+
+func doBlockingMove(ctx *engine.CommandContext, src, dst string, fromLeft, toLeft bool, timeoutArg string) resp.Value {
+	timeout, err := parseTimeout(timeoutArg)
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	return block(ctx, "BLMOVE", []string{src}, timeout, func() (resp.Value, bool, error) {
+		moved, exists, err := ctx.Storage().LMove(src, dst, fromLeft, toLeft)
+		if err != nil || !exists {
+			return resp.Value{}, false, err
+		}
+		from, to := "RIGHT", "RIGHT"
+		if fromLeft {
+			from = "LEFT"
+		}
+		if toLeft {
+			to = "LEFT"
+		}
+		ctx.Propagate("LMOVE", src, dst, from, to)
+		return resp.NewBulkValue(moved), true, nil
+	})
+}
+
+func handleBLMove(ctx *engine.CommandContext, args []string) resp.Value {
+	fromLeft, err := parseListEnd(args[2])
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	toLeft, err := parseListEnd(args[3])
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	return doBlockingMove(ctx, args[0], args[1], fromLeft, toLeft, args[4])
+}
+
+func handleBRPopLPush(ctx *engine.CommandContext, args []string) resp.Value {
+	return doBlockingMove(ctx, args[0], args[1], false, true, args[2])
+}
+
+func handleBLMPop(ctx *engine.CommandContext, args []string) resp.Value {
+	timeout, err := parseTimeout(args[0])
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	keys, left, count, err := parseMPopArgs(args[1:], parseListEnd)
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	return block(ctx, "BLMPOP", keys, timeout, func() (resp.Value, bool, error) {
+		key, popped, err := ctx.Storage().LMPop(keys, left, count)
+		if err != nil || key == "" {
+			return resp.Value{}, false, err
+		}
+		return mpopReply(ctx, key, left, popped), true, nil
+	})
+}
+
 func init() {
 	engine.RegisterCommand("LPUSH", -2, true, handleLPush)
 	engine.RegisterCommand("RPUSH", -2, true, handleRPush)
-	engine.RegisterCommand("LPOP", 1, true, handleLPop)
-	engine.RegisterCommand("RPOP", 1, true, handleRPop)
+	engine.RegisterCommand("LPUSHX", -2, true, handleLPushX)
+	engine.RegisterCommand("RPUSHX", -2, true, handleRPushX)
+	engine.RegisterCommand("LPOP", -1, true, handleLPop, engine.FlagAllowOOM)
+	engine.RegisterCommand("RPOP", -1, true, handleRPop, engine.FlagAllowOOM)
 	engine.RegisterCommand("LLEN", 1, false, handleLLen)
 	engine.RegisterCommand("LRANGE", 3, false, handleLRange)
+	engine.RegisterCommand("LINDEX", 2, false, handleLIndex)
+	engine.RegisterCommand("LSET", 3, true, handleLSet)
+	engine.RegisterCommand("LINSERT", 4, true, handleLInsert)
+	engine.RegisterCommand("LREM", 3, true, handleLRem, engine.FlagAllowOOM)
+	engine.RegisterCommand("LTRIM", 3, true, handleLTrim, engine.FlagAllowOOM)
+	engine.RegisterCommand("LPOS", -2, false, handleLPos)
+	engine.RegisterCommand("LMOVE", 4, true, handleLMove)
+	engine.RegisterCommand("RPOPLPUSH", 2, true, handleRPopLPush)
+	engine.RegisterCommand("LMPOP", -3, true, handleLMPop, engine.FlagAllowOOM)
+	engine.RegisterCommand("BLPOP", -2, true, handleBLPop, engine.FlagAllowOOM)
+	engine.RegisterCommand("BRPOP", -2, true, handleBRPop, engine.FlagAllowOOM)
+	engine.RegisterCommand("BLMOVE", 5, true, handleBLMove)
+	engine.RegisterCommand("BRPOPLPUSH", 3, true, handleBRPopLPush)
+	engine.RegisterCommand("BLMPOP", -4, true, handleBLMPop, engine.FlagAllowOOM)
 }
@@ -0,0 +1,206 @@
+package commands
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/engine"
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/resp"
+)
+
+func helpReply(lines ...string) resp.Value {
+	values := make([]resp.Value, len(lines))
+	for i, line := range lines {
+		values[i] = resp.NewStringValue(line)
+	}
+	return resp.NewArrayValue(values)
+}
+
+func errUnknownSubcommand(cmd, sub string) resp.Value {
+	return resp.NewErrorValue(fmt.Sprintf("ERR unknown subcommand '%s'. Try %s HELP.", sub, cmd))
+}
+
+func handleObject(ctx *engine.CommandContext, args []string) resp.Value {
+	sub := strings.ToUpper(args[0])
+	if sub == "HELP" && len(args) == 1 {
+		return helpReply(
+			"OBJECT <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"ENCODING <key>",
+			"    Return the kind of internal representation used in order to store the value",
+			"    associated with a <key>.",
+			"FREQ <key>",
+			"    Return the access frequency index of the <key>. The returned integer is",
+			"    proportional to the logarithm of the recent access frequency of the key.",
+			"IDLETIME <key>",
+			"    Return the idle time of the <key>, that is the approximated number of",
+			"    seconds elapsed since the last access to the key.",
+			"REFCOUNT <key>",
+			"    Return the number of references of the value associated with the specified",
+			"    <key>.",
+			"HELP",
+			"    Print this help.",
+		)
+	}
+	if len(args) != 2 {
+		return errUnknownSubcommand("OBJECT", args[0])
+	}
+
+	switch sub {
+	case "ENCODING", "FREQ", "IDLETIME", "REFCOUNT":
+	default:
+		return errUnknownSubcommand("OBJECT", args[0])
+	}
+	info, exists := ctx.Storage().Object(args[1])
+	if !exists {
+		return resp.NewNullValue()
+	}
+	switch sub {
+	case "ENCODING":
+		return resp.NewBulkValue(info.Encoding)
+	case "FREQ":
+		return resp.NewIntValue(int64(info.Freq))
+	case "IDLETIME":
+		return resp.NewIntValue(int64(info.Idle.Seconds()))
+	default:
+		// values are never shared between keys
+		return resp.NewIntValue(1)
+	}
+}
+
+func handleMemory(ctx *engine.CommandContext, args []string) resp.Value {
+	switch sub := strings.ToUpper(args[0]); {
+	case sub == "HELP" && len(args) == 1:
+		return helpReply(
+			"MEMORY <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"DOCTOR",
+			"    Return memory problems reports.",
+			"STATS",
+			"    Return information about the memory usage of the server.",
+			"USAGE <key> [SAMPLES <count>]",
+			"    Return memory in bytes used by <key> and its value. Nested values are",
+			"    sampled up to <count> times (default: 5, 0 means sample all).",
+			"HELP",
+			"    Print this help.",
+		)
+	case sub == "USAGE" && len(args) >= 2:
+		return memoryUsage(ctx, args[1:])
+	case sub == "STATS" && len(args) == 1:
+		return memoryStats(ctx)
+	case sub == "DOCTOR" && len(args) == 1:
+		return resp.NewBulkValue(memoryDoctor(ctx))
+	default:
+		return errUnknownSubcommand("MEMORY", args[0])
+	}
+}
+
+// memoryUsage accepts SAMPLES for compatibility only: container sizes are
+// tracked incrementally, so the estimate is exact without sampling.
+func memoryUsage(ctx *engine.CommandContext, args []string) resp.Value {
+	for i := 1; i < len(args); i++ {
+		if !strings.EqualFold(args[i], "SAMPLES") || i+1 >= len(args) {
+			return resp.NewErrorValue(errSyntax.Error())
+		}
+		if n, err := strconv.ParseInt(args[i+1], 10, 64); err != nil || n < 0 {
+			return resp.NewErrorValue("ERR value is not an integer or out of range")
+		}
+		i++
+	}
+	usage, exists := ctx.Storage().MemoryUsage(args[0])
+	if !exists {
+		return resp.NewNullValue()
+	}
+	return resp.NewIntValue(usage)
+}
+
+func memoryStats(ctx *engine.CommandContext) resp.Value {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	dbs := ctx.Databases()
+	dataset := dbs.UsedMemory()
+	var values []resp.Value
+	add := func(name string, v resp.Value) {
+		values = append(values, resp.NewBulkValue(name), v)
+	}
+	add("total.allocated", resp.NewIntValue(int64(ms.HeapAlloc)))
+
+	var keys int
+	var overhead int64
+	for i := 0; i < dbs.Len(); i++ {
+		db := dbs.DB(i)
+		n, _ := db.KeyCounts()
+		if n == 0 {
+			continue
+		}
+		keys += n
+		main, expires := db.Overhead()
+		overhead += main + expires
+		add(fmt.Sprintf("db.%d", i), resp.NewArrayValue([]resp.Value{
+			resp.NewBulkValue("overhead.hashtable.main"), resp.NewIntValue(main),
+			resp.NewBulkValue("overhead.hashtable.expires"), resp.NewIntValue(expires),
+		}))
+	}
+	add("overhead.total", resp.NewIntValue(overhead))
+	add("keys.count", resp.NewIntValue(int64(keys)))
+	bytesPerKey := int64(0)
+	if keys > 0 {
+		bytesPerKey = dataset / int64(keys)
+	}
+	add("keys.bytes-per-key", resp.NewIntValue(bytesPerKey))
+	add("dataset.bytes", resp.NewIntValue(dataset))
+	add("dataset.percentage", resp.NewBulkValue(formatPercent(dataset, int64(ms.HeapAlloc))))
+	add("fragmentation", resp.NewBulkValue(strconv.FormatFloat(fragmentation(&ms), 'f', 4, 64)))
+	return resp.NewArrayValue(values)
+}
+
+func formatPercent(part, total int64) string {
+	if total == 0 {
+		return "0"
+	}
+	return strconv.FormatFloat(float64(part)*100/float64(total), 'f', 4, 64)
+}
+
+// fragmentation is the ratio of the heap spans in use to the bytes of live
+// objects they hold.
+func fragmentation(ms *runtime.MemStats) float64 {
+	if ms.HeapAlloc == 0 {
+		return 0
+	}
+	return float64(ms.HeapInuse) / float64(ms.HeapAlloc)
+}
+
+const (
+	doctorMinDataset     = 5 << 20
+	doctorMaxFragment    = 1.4
+	doctorMaxMemoryRatio = 0.9
+)
+
+func memoryDoctor(ctx *engine.CommandContext) string {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	dbs := ctx.Databases()
+	used, limit := dbs.UsedMemory(), dbs.MaxMemory()
+
+	if used < doctorMinDataset {
+		return "Hi Sam, this instance is empty or is using very little memory, my issues detector can't be used in these conditions. Please, leave for your mission on Earth and fill it with some data. The new Sam and I will be back to our programming as soon as I finished rebooting."
+	}
+
+	var issues []string
+	if f := fragmentation(&ms); f > doctorMaxFragment {
+		issues = append(issues, fmt.Sprintf(" * High fragmentation: the heap holds %.2f times the memory in use. The Go runtime will return the unused spans to the OS over time.", f))
+	}
+	if limit > 0 && float64(used) > float64(limit)*doctorMaxMemoryRatio {
+		issues = append(issues, fmt.Sprintf(" * Close to maxmemory: the dataset uses %s of the %s limit. Writes will start evicting keys or failing with OOM according to the '%s' policy.", humanBytes(used), humanBytes(limit), dbs.EvictionPolicy()))
+	}
+	if len(issues) == 0 {
+		return "Hi Sam, I can't find any memory issue in your instance. I can only account for what occurs on this base."
+	}
+	return "Sam, I detected a few issues in this Redis instance memory implants:\n\n" + strings.Join(issues, "\n\n") + "\n\nI'm here to keep you safe, Sam. I want to help you.\n"
+}
+
+func init() {
+	engine.RegisterCommand("OBJECT", -1, false, handleObject)
+	engine.RegisterCommand("MEMORY", -1, false, handleMemory)
+}
@@ -0,0 +1,83 @@
+package commands
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/engine"
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/resp"
+)
+
+var errInvalidCursor = errors.New("ERR invalid cursor")
+
+type scanArgs struct {
+	cursor  uint64
+	count   int
+	pattern string
+	typ     string
+}
+
+func parseScanArgs(args []string, allowType bool) (scanArgs, error) {
+	opts := scanArgs{count: 10, pattern: "*"}
+
+	cursor, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return opts, errInvalidCursor
+	}
+	opts.cursor = cursor
+
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return opts, errSyntax
+		}
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			opts.pattern = args[i+1]
+		case "COUNT":
+			count, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				return opts, errors.New("ERR value is not an integer or out of range")
+			}
+			if count < 1 {
+				return opts, errSyntax
+			}
+			opts.count = count
+		case "TYPE":
+			if !allowType {
+				return opts, errSyntax
+			}
+			opts.typ = strings.ToLower(args[i+1])
+		default:
+			return opts, errSyntax
+		}
+	}
+	return opts, nil
+}
+
+func scanReply(cursor uint64, items []string) resp.Value {
+	bulks := make([]resp.Value, len(items))
+	for i, item := range items {
+		bulks[i] = resp.NewBulkValue(item)
+	}
+	return resp.NewArrayValue([]resp.Value{
+		resp.NewBulkValue(strconv.FormatUint(cursor, 10)),
+		resp.NewArrayValue(bulks),
+	})
+}
+
+func handleScan(ctx *engine.CommandContext, args []string) resp.Value {
+	if len(args) < 1 {
+		return errWrongArgs()
+	}
+	opts, err := parseScanArgs(args, true)
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	keys, next := ctx.Storage().Scan(opts.cursor, opts.count, opts.pattern, opts.typ)
+	return scanReply(next, keys)
+}
+
+func init() {
+	engine.RegisterCommand("SCAN", -1, false, handleScan)
+}
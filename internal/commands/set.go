@@ -3,6 +3,8 @@ package commands
 import (
 	"errors"
 	"log"
+	"strconv"
+	"strings"
 
 	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/engine"
 	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/resp"
@@ -88,9 +90,228 @@ func handleSIsMember(ctx *engine.CommandContext, args []string) resp.Value {
 	return resp.NewIntValue(0)
 }
 
+func handleSScan(ctx *engine.CommandContext, args []string) resp.Value {
+	if len(args) < 2 {
+		return errWrongArgs()
+	}
+	opts, err := parseScanArgs(args[1:], false)
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	members, next, err := ctx.Storage().SScan(args[0], opts.cursor, opts.count, opts.pattern)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrWrongType):
+			return resp.NewErrorValue("WRONGTYPE Operation against a key holding the wrong kind of value")
+		default:
+			log.Printf("internal error in SSCAN: %v", err)
+			return resp.NewErrorValue("ERR internal error")
+		}
+	}
+	return scanReply(next, members)
+}
+
+func handleSCard(ctx *engine.CommandContext, args []string) resp.Value {
+	n, err := ctx.Storage().SCard(args[0])
+	if err != nil {
+		return storageError("SCARD", err)
+	}
+	return resp.NewIntValue(int64(n))
+}
+
+func handleSMIsMember(ctx *engine.CommandContext, args []string) resp.Value {
+	found, err := ctx.Storage().SMIsMember(args[0], args[1:]...)
+	if err != nil {
+		return storageError("SMISMEMBER", err)
+	}
+	reply := make([]resp.Value, len(found))
+	for i, ok := range found {
+		reply[i] = resp.NewIntValue(0)
+		if ok {
+			reply[i] = resp.NewIntValue(1)
+		}
+	}
+	return resp.NewArrayValue(reply)
+}
+
+// handleSPop is logged to the AOF as an SREM of the popped members, since
+// replaying the random pick wouldn't pop the same ones.
+func handleSPop(ctx *engine.CommandContext, args []string) resp.Value {
+	if len(args) > 2 {
+		return resp.NewErrorValue(errSyntax.Error())
+	}
+	count, withCount := 1, len(args) == 2
+	if withCount {
+		var err error
+		if count, err = parsePopCount(args[1]); err != nil {
+			return resp.NewErrorValue(err.Error())
+		}
+	}
+
+	popped, err := ctx.Storage().SPop(args[0], count)
+	if err != nil {
+		return storageError("SPOP", err)
+	}
+	if len(popped) == 0 {
+		ctx.SkipPropagation()
+	} else {
+		ctx.Propagate("SREM", append([]string{args[0]}, popped...)...)
+	}
+
+	switch {
+	case withCount:
+		return bulkArray(popped)
+	case len(popped) == 0:
+		return resp.NewNullValue()
+	default:
+		return resp.NewBulkValue(popped[0])
+	}
+}
+
+// maxRandCount bounds the negative counts of SRANDMEMBER and HRANDFIELD,
+// whose replies repeat members and are built in memory in full.
+const maxRandCount = 1 << 24
+
+func handleSRandMember(ctx *engine.CommandContext, args []string) resp.Value {
+	if len(args) > 2 {
+		return resp.NewErrorValue(errSyntax.Error())
+	}
+	count, withCount := 1, len(args) == 2
+	if withCount {
+		var err error
+		if count, err = strconv.Atoi(args[1]); err != nil {
+			return resp.NewErrorValue(errNotInteger.Error())
+		}
+		if count < -maxRandCount {
+			return resp.NewErrorValue(errOutOfRange.Error())
+		}
+	}
+
+	// a negative count allows the same member to be returned several times
+	members, err := ctx.Storage().SRandMember(args[0], max(count, -count), count > 0)
+	if err != nil {
+		return storageError("SRANDMEMBER", err)
+	}
+	switch {
+	case withCount:
+		return bulkArray(members)
+	case len(members) == 0:
+		return resp.NewNullValue()
+	default:
+		return resp.NewBulkValue(members[0])
+	}
+}
+
+func handleSMove(ctx *engine.CommandContext, args []string) resp.Value {
+	moved, err := ctx.Storage().SMove(args[0], args[1], args[2])
+	if err != nil {
+		return storageError("SMOVE", err)
+	}
+	if !moved {
+		ctx.SkipPropagation()
+		return resp.NewIntValue(0)
+	}
+	return resp.NewIntValue(1)
+}
+
+func handleSetOp(ctx *engine.CommandContext, cmdName string, op storage.SetOp, keys []string) resp.Value {
+	members, err := ctx.Storage().SetOperation(op, keys...)
+	if err != nil {
+		return storageError(cmdName, err)
+	}
+	return bulkArray(members)
+}
+
+func handleSetOpStore(ctx *engine.CommandContext, cmdName string, op storage.SetOp, args []string) resp.Value {
+	n, err := ctx.Storage().SetOperationStore(op, args[0], args[1:]...)
+	if err != nil {
+		return storageError(cmdName, err)
+	}
+	return resp.NewIntValue(int64(n))
+}
+
+func handleSInter(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleSetOp(ctx, "SINTER", storage.SetInter, args)
+}
+
+func handleSUnion(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleSetOp(ctx, "SUNION", storage.SetUnion, args)
+}
+
+func handleSDiff(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleSetOp(ctx, "SDIFF", storage.SetDiff, args)
+}
+
+func handleSInterStore(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleSetOpStore(ctx, "SINTERSTORE", storage.SetInter, args)
+}
+
+func handleSUnionStore(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleSetOpStore(ctx, "SUNIONSTORE", storage.SetUnion, args)
+}
+
+func handleSDiffStore(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleSetOpStore(ctx, "SDIFFSTORE", storage.SetDiff, args)
+}
+
+// parseNumKeys parses the "numkeys key [key ...]" prefix of commands like
+// SINTERCARD and returns the keys and the remaining arguments.
+func parseNumKeys(args []string) (keys, rest []string, err error) {
+	numKeys, err := strconv.Atoi(args[0])
+	if err != nil {
+		return nil, nil, errNotInteger
+	}
+	if numKeys <= 0 {
+		return nil, nil, errors.New("ERR numkeys should be greater than 0")
+	}
+	if numKeys > len(args)-1 {
+		return nil, nil, errors.New("ERR Number of keys can't be greater than number of args")
+	}
+	return args[1 : numKeys+1], args[numKeys+1:], nil
+}
+
+func handleSInterCard(ctx *engine.CommandContext, args []string) resp.Value {
+	keys, rest, err := parseNumKeys(args)
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	limit := 0
+	switch {
+	case len(rest) == 0:
+	case len(rest) == 2 && strings.EqualFold(rest[0], "LIMIT"):
+		if limit, err = strconv.Atoi(rest[1]); err != nil {
+			return resp.NewErrorValue(errNotInteger.Error())
+		}
+		if limit < 0 {
+			return resp.NewErrorValue("ERR LIMIT can't be negative")
+		}
+	default:
+		return resp.NewErrorValue(errSyntax.Error())
+	}
+
+	n, err := ctx.Storage().SInterCard(limit, keys...)
+	if err != nil {
+		return storageError("SINTERCARD", err)
+	}
+	return resp.NewIntValue(int64(n))
+}
+
 func init() {
 	engine.RegisterCommand("SADD", -2, true, handleSAdd)
-	engine.RegisterCommand("SREM", -2, true, handleSRem)
+	engine.RegisterCommand("SREM", -2, true, handleSRem, engine.FlagAllowOOM)
 	engine.RegisterCommand("SMEMBERS", 1, false, handleSMembers)
 	engine.RegisterCommand("SISMEMBER", 2, false, handleSIsMember)
+	engine.RegisterCommand("SSCAN", -2, false, handleSScan)
+	engine.RegisterCommand("SCARD", 1, false, handleSCard)
+	engine.RegisterCommand("SMISMEMBER", -2, false, handleSMIsMember)
+	engine.RegisterCommand("SPOP", -1, true, handleSPop, engine.FlagAllowOOM)
+	engine.RegisterCommand("SRANDMEMBER", -1, false, handleSRandMember)
+	engine.RegisterCommand("SMOVE", 3, true, handleSMove, engine.FlagAllowOOM)
+	engine.RegisterCommand("SINTER", -1, false, handleSInter)
+	engine.RegisterCommand("SUNION", -1, false, handleSUnion)
+	engine.RegisterCommand("SDIFF", -1, false, handleSDiff)
+	engine.RegisterCommand("SINTERSTORE", -2, true, handleSInterStore)
+	engine.RegisterCommand("SUNIONSTORE", -2, true, handleSUnionStore)
+	engine.RegisterCommand("SDIFFSTORE", -2, true, handleSDiffStore)
+	engine.RegisterCommand("SINTERCARD", -2, false, handleSInterCard)
 }
@@ -0,0 +1,37 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/engine"
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/storage"
+)
+
+func TestSRandMember_Count(t *testing.T) {
+	ctx := engine.NewCommandContext(storage.NewDatabases(1, 4), nil)
+	ctx.Storage().SAdd("s", "a", "b")
+	tests := []struct {
+		count string
+		n     int
+		err   string
+	}{
+		{"2", 2, ""},
+		{"9223372036854775807", 2, ""},
+		{"-5", 5, ""},
+		{"-1000000000000", 0, errOutOfRange.Error()},
+		{"-9223372036854775808", 0, errOutOfRange.Error()},
+		{"x", 0, errNotInteger.Error()},
+	}
+	for _, tt := range tests {
+		reply := engine.DispatchCommand(ctx, "SRANDMEMBER", []string{"s", tt.count})
+		if tt.err != "" {
+			if reply.Str() != tt.err {
+				t.Fatalf("count %s: got %q; want %q", tt.count, reply.Marshal(), tt.err)
+			}
+			continue
+		}
+		if got := len(reply.Array()); got != tt.n {
+			t.Fatalf("count %s: got %d members; want %d", tt.count, got, tt.n)
+		}
+	}
+}
@@ -0,0 +1,429 @@
+package commands
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/engine"
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/resp"
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/storage"
+)
+
+var (
+	errStreamID      = errors.New("ERR Invalid stream ID specified as stream command argument")
+	errStreamTrimBy  = errors.New("ERR syntax error, MAXLEN and MINID options at the same time are not compatible")
+	errStreamLimit   = errors.New("ERR syntax error, LIMIT cannot be used without the special ~ option")
+	errStreamMaxLen  = errors.New("ERR The MAXLEN argument must be >= 0.")
+	errStreamLimitLo = errors.New("ERR The LIMIT argument must be >= 0.")
+)
+
+// parseStreamID parses "ms-seq", or "ms" alone with missingSeq as the
+// sequence number.
+func parseStreamID(arg string, missingSeq uint64) (storage.StreamID, error) {
+	msPart, seqPart, hasSeq := strings.Cut(arg, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return storage.StreamID{}, errStreamID
+	}
+	seq := missingSeq
+	if hasSeq {
+		if seq, err = strconv.ParseUint(seqPart, 10, 64); err != nil {
+			return storage.StreamID{}, errStreamID
+		}
+	}
+	return storage.StreamID{Ms: ms, Seq: seq}, nil
+}
+
+// parseRangeID parses an end of an XRANGE interval: "-", "+", an ID or an
+// ID prefixed with "(" to exclude it. A missing sequence number is the
+// lowest one for the start and the highest one for the end.
+func parseRangeID(arg string, isEnd bool) (storage.StreamID, error) {
+	exclusive := len(arg) > 1 && arg[0] == '('
+	if exclusive {
+		arg = arg[1:]
+	}
+	var id storage.StreamID
+	var err error
+	switch {
+	case arg == "-":
+	case arg == "+":
+		id = storage.MaxStreamID
+	case isEnd:
+		id, err = parseStreamID(arg, storage.MaxStreamID.Seq)
+	default:
+		id, err = parseStreamID(arg, 0)
+	}
+	if err != nil || !exclusive {
+		return id, err
+	}
+	ok := false
+	if isEnd {
+		if id, ok = id.Prev(); !ok {
+			return id, errors.New("ERR invalid end ID for the interval")
+		}
+	} else if id, ok = id.Next(); !ok {
+		return id, errors.New("ERR invalid start ID for the interval")
+	}
+	return id, nil
+}
+
+func streamEntryReply(e storage.StreamEntry) resp.Value {
+	fields := resp.NewNullValue()
+	if e.Fields != nil {
+		fields = bulkArray(e.Fields)
+	}
+	return resp.NewArrayValue([]resp.Value{resp.NewBulkValue(e.ID.String()), fields})
+}
+
+func streamEntriesReply(entries []storage.StreamEntry) resp.Value {
+	reply := make([]resp.Value, len(entries))
+	for i, e := range entries {
+		reply[i] = streamEntryReply(e)
+	}
+	return resp.NewArrayValue(reply)
+}
+
+// parseStreamTrim parses the options XADD and XTRIM share: [MAXLEN|MINID
+// [=|~] threshold] [LIMIT count], and [NOMKSTREAM] for XADD, which stops at
+// the first argument that isn't one of them and returns the rest.
+func parseStreamTrim(args []string, xadd bool) (t storage.StreamTrim, noMkStream bool, rest []string, err error) {
+	limit := int64(-1)
+	i := 0
+options:
+	for ; i < len(args); i++ {
+		left := len(args) - i - 1
+		switch opt := strings.ToUpper(args[i]); {
+		case xadd && opt == "NOMKSTREAM":
+			noMkStream = true
+		case (opt == "MAXLEN" || opt == "MINID") && left >= 1:
+			if t.By != storage.TrimNone {
+				return t, false, nil, errStreamTrimBy
+			}
+			i++
+			if args[i] == "~" || args[i] == "=" {
+				if left < 2 {
+					return t, false, nil, errSyntax
+				}
+				t.Approx = args[i] == "~"
+				i++
+			}
+			if opt == "MINID" {
+				t.By = storage.TrimMinID
+				if t.MinID, err = parseStreamID(args[i], 0); err != nil {
+					return t, false, nil, err
+				}
+				continue
+			}
+			t.By = storage.TrimMaxLen
+			if t.MaxLen, err = strconv.ParseInt(args[i], 10, 64); err != nil {
+				return t, false, nil, errNotInteger
+			}
+			if t.MaxLen < 0 {
+				return t, false, nil, errStreamMaxLen
+			}
+		case opt == "LIMIT" && left >= 1:
+			i++
+			if limit, err = strconv.ParseInt(args[i], 10, 64); err != nil {
+				return t, false, nil, errNotInteger
+			}
+			if limit < 0 {
+				return t, false, nil, errStreamLimitLo
+			}
+		case xadd:
+			break options
+		default:
+			return t, false, nil, errSyntax
+		}
+	}
+	if limit >= 0 && !t.Approx {
+		return t, false, nil, errStreamLimit
+	}
+	t.Limit = limit
+	return t, noMkStream, args[i:], nil
+}
+
+// trimArgs writes an exact trim the way XADD and XTRIM take it.
+func trimArgs(t storage.StreamTrim) []string {
+	switch t.By {
+	case storage.TrimMaxLen:
+		return []string{"MAXLEN", "=", strconv.FormatInt(t.MaxLen, 10)}
+	case storage.TrimMinID:
+		return []string{"MINID", "=", t.MinID.String()}
+	default:
+		return nil
+	}
+}
+
+// handleXAdd implements XADD key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold
+// [LIMIT count]] *|id field value [field value ...]. It is logged to the
+// AOF with the ID it generated and an exact trim.
+func handleXAdd(ctx *engine.CommandContext, args []string) resp.Value {
+	trim, noMkStream, rest, err := parseStreamTrim(args[1:], true)
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	if len(rest) < 3 || len(rest)%2 == 0 {
+		return errWrongArgsFor("xadd")
+	}
+	a := storage.XAddArgs{NoMkStream: noMkStream, Trim: trim, Fields: rest[1:]}
+	switch idArg := rest[0]; {
+	case idArg == "*":
+		a.AutoID = true
+	case strings.HasSuffix(idArg, "-*"):
+		a.AutoSeq = true
+		ms, err := strconv.ParseUint(strings.TrimSuffix(idArg, "-*"), 10, 64)
+		if err != nil {
+			return resp.NewErrorValue(errStreamID.Error())
+		}
+		a.ID.Ms = ms
+	default:
+		if a.ID, err = parseStreamID(idArg, 0); err != nil {
+			return resp.NewErrorValue(err.Error())
+		}
+	}
+
+	id, exact, added, err := ctx.Storage().XAdd(args[0], a)
+	if err != nil {
+		return storageError("XADD", err)
+	}
+	if !added {
+		ctx.SkipPropagation()
+		return resp.NewNullValue()
+	}
+	logged := []string{args[0]}
+	if noMkStream {
+		logged = append(logged, "NOMKSTREAM")
+	}
+	logged = append(logged, trimArgs(exact)...)
+	logged = append(logged, id.String())
+	ctx.Propagate("XADD", append(logged, a.Fields...)...)
+	return resp.NewBulkValue(id.String())
+}
+
+// handleXTrim implements XTRIM key MAXLEN|MINID [=|~] threshold [LIMIT
+// count]. An approximate trim is logged to the AOF as an exact one.
+func handleXTrim(ctx *engine.CommandContext, args []string) resp.Value {
+	trim, _, _, err := parseStreamTrim(args[1:], false)
+	if err == nil && trim.By == storage.TrimNone {
+		err = errSyntax
+	}
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	removed, exact, err := ctx.Storage().XTrim(args[0], trim)
+	if err != nil {
+		return storageError("XTRIM", err)
+	}
+	switch {
+	case removed == 0:
+		ctx.SkipPropagation()
+	case trim.Approx:
+		ctx.Propagate("XTRIM", append([]string{args[0]}, trimArgs(exact)...)...)
+	}
+	return resp.NewIntValue(int64(removed))
+}
+
+func handleXLen(ctx *engine.CommandContext, args []string) resp.Value {
+	n, err := ctx.Storage().XLen(args[0])
+	if err != nil {
+		return storageError("XLEN", err)
+	}
+	return resp.NewIntValue(int64(n))
+}
+
+func parseStreamIDs(args []string) ([]storage.StreamID, error) {
+	ids := make([]storage.StreamID, len(args))
+	for i, arg := range args {
+		var err error
+		if ids[i], err = parseStreamID(arg, 0); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+func handleXDel(ctx *engine.CommandContext, args []string) resp.Value {
+	ids, err := parseStreamIDs(args[1:])
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	n, err := ctx.Storage().XDel(args[0], ids...)
+	if err != nil {
+		return storageError("XDEL", err)
+	}
+	return resp.NewIntValue(int64(n))
+}
+
+// handleXRange implements XRANGE key start end [COUNT count] and, if rev,
+// XREVRANGE key end start [COUNT count].
+func handleXRange(ctx *engine.CommandContext, cmdName string, args []string, rev bool) resp.Value {
+	startArg, endArg := args[1], args[2]
+	if rev {
+		startArg, endArg = endArg, startArg
+	}
+	start, err := parseRangeID(startArg, false)
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	end, err := parseRangeID(endArg, true)
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	count := int64(-1)
+	switch {
+	case len(args) == 3:
+	case len(args) == 5 && strings.EqualFold(args[3], "COUNT"):
+		if count, err = strconv.ParseInt(args[4], 10, 64); err != nil {
+			return resp.NewErrorValue(errNotInteger.Error())
+		}
+		count = max(count, 0)
+	default:
+		return resp.NewErrorValue(errSyntax.Error())
+	}
+	entries, err := ctx.Storage().XRange(args[0], start, end, rev, int(count))
+	if err != nil {
+		return storageError(cmdName, err)
+	}
+	return streamEntriesReply(entries)
+}
+
+func handleXRangeAsc(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleXRange(ctx, "XRANGE", args, false)
+}
+
+func handleXRevRange(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleXRange(ctx, "XREVRANGE", args, true)
+}
+
+// xreadArgs are the parsed arguments of XREAD and XREADGROUP.
+type xreadArgs struct {
+	group, consumer string
+	count           int
+	block           bool
+	timeout         time.Duration
+	noAck           bool
+	keys, ids       []string
+}
+
+// parseXRead parses "[COUNT count] [BLOCK milliseconds] STREAMS key [key
+// ...] id [id ...]", preceded by "GROUP group consumer" and with [NOACK]
+// for XREADGROUP.
+func parseXRead(cmdName string, args []string, group bool) (xreadArgs, error) {
+	var a xreadArgs
+	i := 0
+	for ; i < len(args); i++ {
+		left := len(args) - i - 1
+		switch opt := strings.ToUpper(args[i]); {
+		case opt == "STREAMS":
+			streams := args[i+1:]
+			if len(streams) == 0 || len(streams)%2 != 0 {
+				return a, errors.New("ERR Unbalanced '" + strings.ToLower(cmdName) + "' list of streams: for each stream key an ID or '$' must be specified.")
+			}
+			a.keys, a.ids = streams[:len(streams)/2], streams[len(streams)/2:]
+			if group && a.group == "" {
+				return a, errors.New("ERR Missing GROUP option for XREADGROUP")
+			}
+			return a, nil
+		case opt == "COUNT" && left >= 1:
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return a, errNotInteger
+			}
+			a.count = int(max(n, 0))
+			i++
+		case opt == "BLOCK" && left >= 1:
+			ms, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return a, errors.New("ERR timeout is not an integer or out of range")
+			}
+			if ms < 0 {
+				return a, errors.New("ERR timeout is negative")
+			}
+			a.block, a.timeout = true, time.Duration(ms)*time.Millisecond
+			i++
+		case opt == "GROUP" && group && left >= 2:
+			a.group, a.consumer = args[i+1], args[i+2]
+			i += 2
+		case opt == "GROUP" && !group:
+			return a, errors.New("ERR The GROUP option is only supported by XREADGROUP. You called XREAD instead.")
+		case opt == "NOACK" && group:
+			a.noAck = true
+		default:
+			return a, errSyntax
+		}
+	}
+	return a, errSyntax
+}
+
+func streamReadsReply(reads []storage.StreamRead) resp.Value {
+	reply := make([]resp.Value, len(reads))
+	for i, r := range reads {
+		reply[i] = resp.NewArrayValue([]resp.Value{resp.NewBulkValue(r.Key), streamEntriesReply(r.Entries)})
+	}
+	return resp.NewArrayValue(reply)
+}
+
+// handleXRead implements XREAD [COUNT count] [BLOCK milliseconds] STREAMS
+// key [key ...] id [id ...]. "$" reads only entries added after the call.
+func handleXRead(ctx *engine.CommandContext, args []string) resp.Value {
+	a, err := parseXRead("XREAD", args, false)
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	ids := make([]storage.StreamID, len(a.ids))
+	last := false
+	for i, arg := range a.ids {
+		switch arg {
+		case "$":
+			last = true
+		case ">":
+			return resp.NewErrorValue("ERR The > ID can be specified only when calling XREADGROUP using the GROUP <group> <consumer> option.")
+		default:
+			if ids[i], err = parseStreamID(arg, 0); err != nil {
+				return resp.NewErrorValue(err.Error())
+			}
+		}
+	}
+	if last {
+		lastIDs, err := ctx.Storage().XLastIDs(a.keys)
+		if err != nil {
+			return storageError("XREAD", err)
+		}
+		for i, arg := range a.ids {
+			if arg == "$" {
+				ids[i] = lastIDs[i]
+			}
+		}
+	}
+
+	try := func() (resp.Value, bool, error) {
+		reads, err := ctx.Storage().XRead(a.keys, ids, a.count)
+		if err != nil || len(reads) == 0 {
+			return resp.Value{}, false, err
+		}
+		return streamReadsReply(reads), true, nil
+	}
+	if !a.block {
+		reply, served, err := try()
+		switch {
+		case err != nil:
+			return storageError("XREAD", err)
+		case !served:
+			return resp.NewNullValue()
+		}
+		return reply
+	}
+	return block(ctx, "XREAD", a.keys, a.timeout, try)
+}
+
+func init() {
+	engine.RegisterCommand("XADD", -4, true, handleXAdd)
+	engine.RegisterCommand("XTRIM", -3, true, handleXTrim, engine.FlagAllowOOM)
+	engine.RegisterCommand("XLEN", 1, false, handleXLen)
+	engine.RegisterCommand("XDEL", -2, true, handleXDel, engine.FlagAllowOOM)
+	engine.RegisterCommand("XRANGE", -3, false, handleXRangeAsc)
+	engine.RegisterCommand("XREVRANGE", -3, false, handleXRevRange)
+	engine.RegisterCommand("XREAD", -3, false, handleXRead)
+}
@@ -0,0 +1,673 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/engine"
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/resp"
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/storage"
+)
+
+var errEntriesRead = errors.New("ERR value for ENTRIESREAD must be positive or -1")
+
+// groupError is storageError for the consumer group commands, which name the
+// key and the group when the group is missing.
+func groupError(cmdName, key, group string, err error) resp.Value {
+	if !errors.Is(err, storage.ErrNoGroup) {
+		return storageError(cmdName, err)
+	}
+	switch cmdName {
+	case "XGROUP", "XINFO":
+		return resp.NewErrorValue(fmt.Sprintf("NOGROUP No such consumer group '%s' for key name '%s'", group, key))
+	case "XREADGROUP":
+		return resp.NewErrorValue(fmt.Sprintf("NOGROUP No such key '%s' or consumer group '%s' in XREADGROUP with GROUP option", key, group))
+	default:
+		return resp.NewErrorValue(fmt.Sprintf("NOGROUP No such key '%s' or consumer group '%s'", key, group))
+	}
+}
+
+func idsReply(ids []storage.StreamID) resp.Value {
+	reply := make([]resp.Value, len(ids))
+	for i, id := range ids {
+		reply[i] = resp.NewBulkValue(id.String())
+	}
+	return resp.NewArrayValue(reply)
+}
+
+func formatInt(n int64) string { return strconv.FormatInt(n, 10) }
+
+// parseGroupID parses the ID a group delivers entries after, "$" meaning
+// the last one of the stream.
+func parseGroupID(arg string) (id storage.StreamID, last bool, err error) {
+	if arg == "$" {
+		return id, true, nil
+	}
+	id, err = parseStreamID(arg, 0)
+	return id, false, err
+}
+
+func parseEntriesRead(arg string) (int64, error) {
+	n, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return 0, errNotInteger
+	}
+	if n < -1 {
+		return 0, errEntriesRead
+	}
+	return n, nil
+}
+
+// handleXGroup implements XGROUP CREATE key group id|$ [MKSTREAM]
+// [ENTRIESREAD n], SETID key group id|$ [ENTRIESREAD n], DESTROY key group,
+// CREATECONSUMER key group consumer and DELCONSUMER key group consumer.
+func handleXGroup(ctx *engine.CommandContext, args []string) resp.Value {
+	sub := strings.ToUpper(args[0])
+	switch {
+	case sub == "HELP" && len(args) == 1:
+		return helpReply(
+			"XGROUP <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"CREATE <key> <groupname> <id|$> [option]",
+			"    Create a new consumer group. Options are:",
+			"    * MKSTREAM",
+			"      Create the empty stream if it does not exist.",
+			"    * ENTRIESREAD entries_read",
+			"      Set the group's entries_read counter (internal use).",
+			"CREATECONSUMER <key> <groupname> <consumer>",
+			"    Create a new consumer in the specified group.",
+			"DELCONSUMER <key> <groupname> <consumer>",
+			"    Remove the specified consumer.",
+			"DESTROY <key> <groupname>",
+			"    Remove the specified group.",
+			"SETID <key> <groupname> <id|$> [ENTRIESREAD entries_read]",
+			"    Set the current group ID and entries_read counter.",
+			"HELP",
+			"    Print this help.",
+		)
+	case (sub == "CREATE" && len(args) >= 4 && len(args) <= 7) || (sub == "SETID" && (len(args) == 4 || len(args) == 6)):
+		key, group := args[1], args[2]
+		id, last, err := parseGroupID(args[3])
+		if err != nil {
+			return resp.NewErrorValue(err.Error())
+		}
+		mkStream, entriesRead := false, int64(-1)
+		for i := 4; i < len(args); i++ {
+			switch opt := strings.ToUpper(args[i]); {
+			case opt == "MKSTREAM" && sub == "CREATE":
+				mkStream = true
+			case opt == "ENTRIESREAD" && i+1 < len(args):
+				if entriesRead, err = parseEntriesRead(args[i+1]); err != nil {
+					return resp.NewErrorValue(err.Error())
+				}
+				i++
+			default:
+				return resp.NewErrorValue(errSyntax.Error())
+			}
+		}
+		if sub == "CREATE" {
+			err = ctx.Storage().XGroupCreate(key, group, id, last, mkStream, entriesRead)
+		} else {
+			err = ctx.Storage().XGroupSetID(key, group, id, last, entriesRead)
+		}
+		if err != nil {
+			return groupError("XGROUP", key, group, err)
+		}
+		return resp.NewStringValue("OK")
+	case sub == "DESTROY" && len(args) == 3:
+		destroyed, err := ctx.Storage().XGroupDestroy(args[1], args[2])
+		if err != nil {
+			return groupError("XGROUP", args[1], args[2], err)
+		}
+		if !destroyed {
+			ctx.SkipPropagation()
+			return resp.NewIntValue(0)
+		}
+		return resp.NewIntValue(1)
+	case sub == "CREATECONSUMER" && len(args) == 4:
+		created, err := ctx.Storage().XGroupCreateConsumer(args[1], args[2], args[3])
+		if err != nil {
+			return groupError("XGROUP", args[1], args[2], err)
+		}
+		if !created {
+			ctx.SkipPropagation()
+			return resp.NewIntValue(0)
+		}
+		return resp.NewIntValue(1)
+	case sub == "DELCONSUMER" && len(args) == 4:
+		pending, err := ctx.Storage().XGroupDelConsumer(args[1], args[2], args[3])
+		if err != nil {
+			return groupError("XGROUP", args[1], args[2], err)
+		}
+		return resp.NewIntValue(int64(pending))
+	default:
+		return errUnknownSubcommand("XGROUP", args[0])
+	}
+}
+
+// propagateClaim logs that an entry was handed to a consumer, as the XCLAIM
+// that makes a replay end up in the same state.
+func propagateClaim(ctx *engine.CommandContext, key, group, consumer string, id storage.StreamID, deliveryTime, deliveries int64, lastID storage.StreamID) {
+	ctx.Propagate("XCLAIM", key, group, consumer, "0", id.String(),
+		"TIME", formatInt(deliveryTime), "RETRYCOUNT", formatInt(deliveries),
+		"FORCE", "JUSTID", "LASTID", lastID.String())
+}
+
+// handleXReadGroup implements XREADGROUP GROUP group consumer [COUNT count]
+// [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]. ">" reads
+// entries never delivered to the group, other IDs the pending history of
+// the consumer, and only a read of new entries may block. The reads are
+// logged to the AOF as XCLAIM and XGROUP SETID so that a replay doesn't
+// depend on timing.
+func handleXReadGroup(ctx *engine.CommandContext, args []string) resp.Value {
+	a, err := parseXRead("XREADGROUP", args, true)
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	ra := storage.XReadGroupArgs{
+		Group:    a.group,
+		Consumer: a.consumer,
+		Keys:     a.keys,
+		IDs:      make([]storage.StreamID, len(a.ids)),
+		New:      make([]bool, len(a.ids)),
+		Count:    a.count,
+		NoAck:    a.noAck,
+	}
+	history := false
+	for i, arg := range a.ids {
+		switch arg {
+		case ">":
+			ra.New[i] = true
+		case "$":
+			return resp.NewErrorValue("ERR The $ ID is meaningless in the context of XREADGROUP: you want to read the history of this consumer by specifying a proper ID, or use the > ID to get new messages. The $ ID would just return an empty result set.")
+		default:
+			history = true
+			if ra.IDs[i], err = parseStreamID(arg, 0); err != nil {
+				return resp.NewErrorValue(err.Error())
+			}
+		}
+	}
+
+	try := func() (resp.Value, bool, error) {
+		reads, created, err := ctx.Storage().XReadGroup(ra)
+		if errors.Is(err, storage.ErrNoGroup) {
+			return groupError("XREADGROUP", missingGroupKey(ctx, a.keys, a.group), a.group, err), true, nil
+		}
+		if err != nil {
+			return resp.Value{}, false, err
+		}
+		if created {
+			for _, key := range a.keys {
+				ctx.Propagate("XGROUP", "CREATECONSUMER", key, a.group, a.consumer)
+			}
+		}
+		if len(reads) == 0 {
+			return resp.Value{}, false, nil
+		}
+		streamReads := make([]storage.StreamRead, len(reads))
+		for i, r := range reads {
+			streamReads[i] = r.StreamRead
+			for j, e := range r.Entries {
+				// a deleted entry can't be claimed, so its history read isn't logged
+				if r.Deliveries != nil && e.Fields != nil {
+					propagateClaim(ctx, r.Key, a.group, a.consumer, e.ID, r.Time, r.Deliveries[j], r.LastID)
+				}
+			}
+			if ra.New[slices.Index(a.keys, r.Key)] {
+				ctx.Propagate("XGROUP", "SETID", r.Key, a.group, r.LastID.String(), "ENTRIESREAD", formatInt(r.EntriesRead))
+			}
+		}
+		ctx.SkipPropagation()
+		return streamReadsReply(streamReads), true, nil
+	}
+	if !a.block || history {
+		reply, served, err := try()
+		switch {
+		case err != nil:
+			return storageError("XREADGROUP", err)
+		case !served:
+			ctx.SkipPropagation()
+			return resp.NewNullValue()
+		}
+		return reply
+	}
+	return block(ctx, "XREADGROUP", a.keys, a.timeout, try)
+}
+
+// missingGroupKey returns the first of keys with no stream holding group.
+func missingGroupKey(ctx *engine.CommandContext, keys []string, group string) string {
+	for _, key := range keys {
+		if _, err := ctx.Storage().XPending(key, group); errors.Is(err, storage.ErrNoGroup) {
+			return key
+		}
+	}
+	return keys[0]
+}
+
+func handleXAck(ctx *engine.CommandContext, args []string) resp.Value {
+	ids, err := parseStreamIDs(args[2:])
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	n, err := ctx.Storage().XAck(args[0], args[1], ids...)
+	if err != nil {
+		return storageError("XACK", err)
+	}
+	return resp.NewIntValue(int64(n))
+}
+
+// handleXPending implements XPENDING key group, which summarizes the
+// pending entries of group, and XPENDING key group [IDLE min-idle-time]
+// start end count [consumer], which lists them.
+func handleXPending(ctx *engine.CommandContext, args []string) resp.Value {
+	key, group := args[0], args[1]
+	if len(args) == 2 {
+		sum, err := ctx.Storage().XPending(key, group)
+		if err != nil {
+			return groupError("XPENDING", key, group, err)
+		}
+		if sum.Count == 0 {
+			null := resp.NewNullValue()
+			return resp.NewArrayValue([]resp.Value{resp.NewIntValue(0), null, null, null})
+		}
+		consumers := make([]resp.Value, len(sum.Consumers))
+		for i, c := range sum.Consumers {
+			consumers[i] = resp.NewArrayValue([]resp.Value{resp.NewBulkValue(c.Name), resp.NewBulkValue(strconv.Itoa(c.Count))})
+		}
+		return resp.NewArrayValue([]resp.Value{
+			resp.NewIntValue(int64(sum.Count)),
+			resp.NewBulkValue(sum.Min.String()),
+			resp.NewBulkValue(sum.Max.String()),
+			resp.NewArrayValue(consumers),
+		})
+	}
+
+	rest := args[2:]
+	minIdle := int64(0)
+	if len(rest) > 1 && strings.EqualFold(rest[0], "IDLE") {
+		var err error
+		if minIdle, err = strconv.ParseInt(rest[1], 10, 64); err != nil {
+			return resp.NewErrorValue(errNotInteger.Error())
+		}
+		rest = rest[2:]
+	}
+	if len(rest) != 3 && len(rest) != 4 {
+		return resp.NewErrorValue(errSyntax.Error())
+	}
+	start, err := parseRangeID(rest[0], false)
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	end, err := parseRangeID(rest[1], true)
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	count, err := strconv.ParseInt(rest[2], 10, 64)
+	if err != nil {
+		return resp.NewErrorValue(errNotInteger.Error())
+	}
+	consumer := ""
+	if len(rest) == 4 {
+		consumer = rest[3]
+	}
+	entries, err := ctx.Storage().XPendingRange(key, group, minIdle, start, end, int(max(count, 0)), consumer)
+	if err != nil {
+		return groupError("XPENDING", key, group, err)
+	}
+	now := time.Now().UnixMilli()
+	reply := make([]resp.Value, len(entries))
+	for i, pe := range entries {
+		reply[i] = resp.NewArrayValue([]resp.Value{
+			resp.NewBulkValue(pe.ID.String()),
+			resp.NewBulkValue(pe.Consumer),
+			resp.NewIntValue(now - pe.DeliveryTime),
+			resp.NewIntValue(pe.Deliveries),
+		})
+	}
+	return resp.NewArrayValue(reply)
+}
+
+func parseMinIdle(cmdName, arg string) (int64, error) {
+	n, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("ERR Invalid min-idle-time argument for %s", cmdName)
+	}
+	return max(n, 0), nil
+}
+
+// propagateClaims logs a claim as one XCLAIM per claimed entry and an XACK
+// of the pending entries it dropped. A claim that changed nothing else is
+// logged as the consumer it created or the last delivered ID it set.
+func propagateClaims(ctx *engine.CommandContext, key string, a storage.XClaimArgs, res storage.ClaimResult, setLastID bool) {
+	for _, c := range res.Claimed {
+		propagateClaim(ctx, key, a.Group, a.Consumer, c.ID, c.DeliveryTime, c.Deliveries, res.LastID)
+	}
+	if len(res.Deleted) > 0 {
+		acked := []string{key, a.Group}
+		for _, id := range res.Deleted {
+			acked = append(acked, id.String())
+		}
+		ctx.Propagate("XACK", acked...)
+	}
+	if len(res.Claimed) == 0 {
+		if res.Created {
+			ctx.Propagate("XGROUP", "CREATECONSUMER", key, a.Group, a.Consumer)
+		}
+		if setLastID {
+			ctx.Propagate("XGROUP", "SETID", key, a.Group, res.LastID.String(), "ENTRIESREAD", formatInt(res.EntriesRead))
+		}
+	}
+	ctx.SkipPropagation()
+}
+
+func claimedReply(claimed []storage.Claimed, justID bool) resp.Value {
+	reply := make([]resp.Value, len(claimed))
+	for i, c := range claimed {
+		if justID {
+			reply[i] = resp.NewBulkValue(c.ID.String())
+		} else {
+			reply[i] = streamEntryReply(c.StreamEntry)
+		}
+	}
+	return resp.NewArrayValue(reply)
+}
+
+// handleXClaim implements XCLAIM key group consumer min-idle-time id [id
+// ...] [IDLE ms] [TIME unix-time-milliseconds] [RETRYCOUNT count] [FORCE]
+// [JUSTID] [LASTID lastid].
+func handleXClaim(ctx *engine.CommandContext, args []string) resp.Value {
+	key := args[0]
+	a := storage.XClaimArgs{Group: args[1], Consumer: args[2], Time: -1, RetryCount: -1}
+	var err error
+	if a.MinIdle, err = parseMinIdle("XCLAIM", args[3]); err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	i := 4
+	for ; i < len(args); i++ {
+		id, err := parseStreamID(args[i], 0)
+		if err != nil {
+			break
+		}
+		a.IDs = append(a.IDs, id)
+	}
+	if len(a.IDs) == 0 {
+		return resp.NewErrorValue(errStreamID.Error())
+	}
+	setLastID := false
+	for ; i < len(args); i++ {
+		left := len(args) - i - 1
+		switch opt := strings.ToUpper(args[i]); {
+		case opt == "FORCE":
+			a.Force = true
+		case opt == "JUSTID":
+			a.JustID = true
+		case (opt == "IDLE" || opt == "TIME" || opt == "RETRYCOUNT") && left >= 1:
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return resp.NewErrorValue(fmt.Sprintf("ERR Invalid %s option argument for XCLAIM", opt))
+			}
+			switch opt {
+			case "IDLE":
+				a.Time = time.Now().UnixMilli() - n
+			case "TIME":
+				a.Time = n
+			default:
+				a.RetryCount = n
+			}
+			i++
+		case opt == "LASTID" && left >= 1:
+			if a.LastID, err = parseStreamID(args[i+1], 0); err != nil {
+				return resp.NewErrorValue(err.Error())
+			}
+			setLastID = true
+			i++
+		default:
+			return resp.NewErrorValue(fmt.Sprintf("ERR Unrecognized XCLAIM option '%s'", args[i]))
+		}
+	}
+	a.Time = max(a.Time, -1)
+
+	res, err := ctx.Storage().XClaim(key, a)
+	if err != nil {
+		return groupError("XCLAIM", key, a.Group, err)
+	}
+	propagateClaims(ctx, key, a, res, setLastID)
+	return claimedReply(res.Claimed, a.JustID)
+}
+
+// handleXAutoClaim implements XAUTOCLAIM key group consumer min-idle-time
+// start [COUNT count] [JUSTID]. It replies with the ID to resume from, the
+// claimed entries and the pending IDs it dropped as their entries are gone.
+func handleXAutoClaim(ctx *engine.CommandContext, args []string) resp.Value {
+	key := args[0]
+	a := storage.XClaimArgs{Group: args[1], Consumer: args[2], Count: 100}
+	var err error
+	if a.MinIdle, err = parseMinIdle("XAUTOCLAIM", args[3]); err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	if a.Start, err = parseRangeID(args[4], false); err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	for i := 5; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); {
+		case opt == "JUSTID":
+			a.JustID = true
+		case opt == "COUNT" && i+1 < len(args):
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return resp.NewErrorValue(errNotInteger.Error())
+			}
+			// like Redis, cap count so that ten times it still fits
+			if n < 1 || n > math.MaxInt64/10 {
+				return resp.NewErrorValue("ERR COUNT must be > 0")
+			}
+			a.Count = int(n)
+			i++
+		default:
+			return resp.NewErrorValue(errSyntax.Error())
+		}
+	}
+
+	res, err := ctx.Storage().XAutoClaim(key, a)
+	if err != nil {
+		return groupError("XAUTOCLAIM", key, a.Group, err)
+	}
+	propagateClaims(ctx, key, a, res, false)
+	return resp.NewArrayValue([]resp.Value{
+		resp.NewBulkValue(res.Next.String()),
+		claimedReply(res.Claimed, a.JustID),
+		idsReply(res.Deleted),
+	})
+}
+
+func idOrNull(id storage.StreamID, known bool) resp.Value {
+	if !known {
+		return resp.NewNullValue()
+	}
+	return resp.NewBulkValue(id.String())
+}
+
+func intOrNull(n int64, known bool) resp.Value {
+	if !known {
+		return resp.NewNullValue()
+	}
+	return resp.NewIntValue(n)
+}
+
+func entryOrNull(e *storage.StreamEntry) resp.Value {
+	if e == nil {
+		return resp.NewNullValue()
+	}
+	return streamEntryReply(*e)
+}
+
+// fieldsReply replies with field names and values in turn, the way XINFO
+// describes things.
+func fieldsReply(kv ...any) resp.Value {
+	reply := make([]resp.Value, len(kv))
+	for i, v := range kv {
+		switch v := v.(type) {
+		case string:
+			reply[i] = resp.NewBulkValue(v)
+		case int:
+			reply[i] = resp.NewIntValue(int64(v))
+		case int64:
+			reply[i] = resp.NewIntValue(v)
+		case resp.Value:
+			reply[i] = v
+		}
+	}
+	return resp.NewArrayValue(reply)
+}
+
+func pendingReply(entries []storage.PendingEntry, withConsumer bool) resp.Value {
+	reply := make([]resp.Value, len(entries))
+	for i, pe := range entries {
+		item := []resp.Value{resp.NewBulkValue(pe.ID.String())}
+		if withConsumer {
+			item = append(item, resp.NewBulkValue(pe.Consumer))
+		}
+		item = append(item, resp.NewIntValue(pe.DeliveryTime), resp.NewIntValue(pe.Deliveries))
+		reply[i] = resp.NewArrayValue(item)
+	}
+	return resp.NewArrayValue(reply)
+}
+
+func xinfoStreamReply(info storage.StreamInfo, full bool) resp.Value {
+	head := []any{
+		"length", info.Length,
+		"radix-tree-keys", info.Nodes,
+		"radix-tree-nodes", info.Nodes,
+		"last-generated-id", info.LastID.String(),
+		"max-deleted-entry-id", info.MaxDeletedID.String(),
+		"entries-added", info.EntriesAdded,
+		"recorded-first-entry-id", info.FirstID.String(),
+	}
+	if !full {
+		return fieldsReply(append(head,
+			"groups", info.Groups,
+			"first-entry", entryOrNull(info.First),
+			"last-entry", entryOrNull(info.Last),
+		)...)
+	}
+	groups := make([]resp.Value, len(info.GroupList))
+	for i, g := range info.GroupList {
+		consumers := make([]resp.Value, len(g.ConsumerList))
+		for j, c := range g.ConsumerList {
+			consumers[j] = fieldsReply(
+				"name", c.Name,
+				"seen-time", c.SeenTime,
+				"active-time", c.ActiveTime,
+				"pel-count", c.Pending,
+				"pending", pendingReply(c.Entries, false),
+			)
+		}
+		groups[i] = fieldsReply(
+			"name", g.Name,
+			"last-delivered-id", g.LastID.String(),
+			"entries-read", intOrNull(g.EntriesRead, g.EntriesRead >= 0),
+			"lag", intOrNull(g.Lag, g.LagKnown),
+			"pel-count", g.Pending,
+			"pending", pendingReply(g.Entries, true),
+			"consumers", resp.NewArrayValue(consumers),
+		)
+	}
+	return fieldsReply(append(head,
+		"entries", streamEntriesReply(info.Entries),
+		"groups", resp.NewArrayValue(groups),
+	)...)
+}
+
+// handleXInfo implements XINFO STREAM key [FULL [COUNT count]], XINFO
+// GROUPS key and XINFO CONSUMERS key group.
+func handleXInfo(ctx *engine.CommandContext, args []string) resp.Value {
+	sub := strings.ToUpper(args[0])
+	switch {
+	case sub == "HELP" && len(args) == 1:
+		return helpReply(
+			"XINFO <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"CONSUMERS <key> <groupname>",
+			"    Show consumers of <groupname>.",
+			"GROUPS <key>",
+			"    Show the stream consumer groups.",
+			"STREAM <key> [FULL [COUNT <count>]",
+			"    Show information about the stream.",
+			"HELP",
+			"    Print this help.",
+		)
+	case sub == "STREAM" && len(args) >= 2:
+		full, count := false, int64(10)
+		switch {
+		case len(args) == 2:
+		case len(args) == 3 && strings.EqualFold(args[2], "FULL"):
+			full = true
+		case len(args) == 5 && strings.EqualFold(args[2], "FULL") && strings.EqualFold(args[3], "COUNT"):
+			full = true
+			var err error
+			if count, err = strconv.ParseInt(args[4], 10, 64); err != nil {
+				return resp.NewErrorValue(errNotInteger.Error())
+			}
+			count = max(count, 0)
+		default:
+			return resp.NewErrorValue(errSyntax.Error())
+		}
+		info, err := ctx.Storage().XInfoStream(args[1], full, int(count))
+		if err != nil {
+			return storageError("XINFO", err)
+		}
+		return xinfoStreamReply(info, full)
+	case sub == "GROUPS" && len(args) == 2:
+		groups, err := ctx.Storage().XInfoGroups(args[1])
+		if err != nil {
+			return storageError("XINFO", err)
+		}
+		reply := make([]resp.Value, len(groups))
+		for i, g := range groups {
+			reply[i] = fieldsReply(
+				"name", g.Name,
+				"consumers", g.Consumers,
+				"pending", g.Pending,
+				"last-delivered-id", g.LastID.String(),
+				"entries-read", intOrNull(g.EntriesRead, g.EntriesRead >= 0),
+				"lag", intOrNull(g.Lag, g.LagKnown),
+			)
+		}
+		return resp.NewArrayValue(reply)
+	case sub == "CONSUMERS" && len(args) == 3:
+		consumers, err := ctx.Storage().XInfoConsumers(args[1], args[2])
+		if err != nil {
+			return groupError("XINFO", args[1], args[2], err)
+		}
+		now := time.Now().UnixMilli()
+		reply := make([]resp.Value, len(consumers))
+		for i, c := range consumers {
+			inactive := int64(-1)
+			if c.ActiveTime >= 0 {
+				inactive = now - c.ActiveTime
+			}
+			reply[i] = fieldsReply(
+				"name", c.Name,
+				"pending", c.Pending,
+				"idle", now-c.SeenTime,
+				"inactive", inactive,
+			)
+		}
+		return resp.NewArrayValue(reply)
+	default:
+		return errUnknownSubcommand("XINFO", args[0])
+	}
+}
+
+func init() {
+	engine.RegisterCommand("XGROUP", -1, true, handleXGroup, engine.FlagAllowOOM)
+	engine.RegisterCommand("XREADGROUP", -6, true, handleXReadGroup, engine.FlagAllowOOM)
+	engine.RegisterCommand("XACK", -3, true, handleXAck, engine.FlagAllowOOM)
+	engine.RegisterCommand("XPENDING", -2, false, handleXPending)
+	engine.RegisterCommand("XCLAIM", -5, true, handleXClaim, engine.FlagAllowOOM)
+	engine.RegisterCommand("XAUTOCLAIM", -5, true, handleXAutoClaim, engine.FlagAllowOOM)
+	engine.RegisterCommand("XINFO", -1, false, handleXInfo)
+}
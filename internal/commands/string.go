@@ -3,7 +3,10 @@ package commands
 import (
 	"errors"
 	"log"
+	"math"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/engine"
 	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/resp"
@@ -27,12 +30,137 @@ func handleEcho(ctx *engine.CommandContext, args []string) resp.Value {
 	return errWrongArgs()
 }
 
+// parseSetArgs parses the options of SET after the key and value.
+func parseSetArgs(args []string) (storage.SetOptions, error) {
+	var opts storage.SetOptions
+	hasExpire := false
+	for i := 0; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); opt {
+		case "NX", "XX":
+			if opts.Cond != storage.SetAlways {
+				return opts, errSyntax
+			}
+			opts.Cond = storage.SetNX
+			if opt == "XX" {
+				opts.Cond = storage.SetXX
+			}
+		case "GET":
+			opts.Get = true
+		case "KEEPTTL":
+			if hasExpire {
+				return opts, errSyntax
+			}
+			opts.KeepTTL = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if hasExpire || opts.KeepTTL || i+1 >= len(args) {
+				return opts, errSyntax
+			}
+			expireAt, err := parseExpireOption("set", opt, args[i+1])
+			if err != nil {
+				return opts, err
+			}
+			opts.ExpireAt, hasExpire = expireAt, true
+			i++
+		default:
+			return opts, errSyntax
+		}
+	}
+	return opts, nil
+}
+
+// doSet runs SET with opts and logs it to the AOF as a plain SET with an
+// absolute PXAT, so that replaying it neither depends on the time nor on
+// what the key held before.
+func doSet(ctx *engine.CommandContext, key, value string, opts storage.SetOptions) (old string, hadOld, applied bool, err error) {
+	old, hadOld, applied, err = ctx.Storage().SetWithOptions(key, value, opts)
+	if err != nil {
+		return "", false, false, err
+	}
+	switch {
+	case !applied:
+		ctx.SkipPropagation()
+	case opts.ExpireAt != 0 && opts.ExpireAt <= time.Now().UnixMilli():
+		ctx.Propagate("DEL", key)
+	case opts.ExpireAt != 0:
+		ctx.Propagate("SET", key, value, "PXAT", strconv.FormatInt(opts.ExpireAt, 10))
+	case opts.KeepTTL:
+		ctx.Propagate("SET", key, value, "KEEPTTL")
+	default:
+		ctx.Propagate("SET", key, value)
+	}
+	return old, hadOld, applied, nil
+}
+
 func handleSet(ctx *engine.CommandContext, args []string) resp.Value {
-	if len(args) == 2 {
-		ctx.Storage().Set(args[0], args[1])
+	if len(args) < 2 {
+		return errWrongArgs()
+	}
+	opts, err := parseSetArgs(args[2:])
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	old, hadOld, applied, err := doSet(ctx, args[0], args[1], opts)
+	switch {
+	case err != nil:
+		return storageError("SET", err)
+	case opts.Get && hadOld:
+		return resp.NewBulkValue(old)
+	case opts.Get, !applied:
+		return resp.NewNullValue()
+	default:
 		return resp.NewStringValue("OK")
 	}
-	return errWrongArgs()
+}
+
+func handleSetNX(ctx *engine.CommandContext, args []string) resp.Value {
+	if len(args) != 2 {
+		return errWrongArgs()
+	}
+	_, _, applied, err := doSet(ctx, args[0], args[1], storage.SetOptions{Cond: storage.SetNX})
+	if err != nil {
+		return storageError("SETNX", err)
+	}
+	if applied {
+		return resp.NewIntValue(1)
+	}
+	return resp.NewIntValue(0)
+}
+
+func handleSetEx(ctx *engine.CommandContext, cmdName, opt string, args []string) resp.Value {
+	if len(args) != 3 {
+		return errWrongArgs()
+	}
+	expireAt, err := parseExpireOption(cmdName, opt, args[1])
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	if _, _, _, err := doSet(ctx, args[0], args[2], storage.SetOptions{ExpireAt: expireAt}); err != nil {
+		return storageError(cmdName, err)
+	}
+	return resp.NewStringValue("OK")
+}
+
+func wrapHandleSetEx(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleSetEx(ctx, "setex", "EX", args)
+}
+
+func wrapHandlePSetEx(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleSetEx(ctx, "psetex", "PX", args)
+}
+
+func handleGetSet(ctx *engine.CommandContext, args []string) resp.Value {
+	if len(args) != 2 {
+		return errWrongArgs()
+	}
+	old, hadOld, _, err := doSet(ctx, args[0], args[1], storage.SetOptions{Get: true})
+	switch {
+	case err != nil:
+		return storageError("GETSET", err)
+	case hadOld:
+		return resp.NewBulkValue(old)
+	default:
+		return resp.NewNullValue()
+	}
 }
 
 func handleGet(ctx *engine.CommandContext, args []string) resp.Value {
@@ -56,6 +184,167 @@ func handleGet(ctx *engine.CommandContext, args []string) resp.Value {
 	return resp.NewBulkValue(val)
 }
 
+func handleGetDel(ctx *engine.CommandContext, args []string) resp.Value {
+	if len(args) != 1 {
+		return errWrongArgs()
+	}
+	val, exists, err := ctx.Storage().GetDel(args[0])
+	if err != nil {
+		return storageError("GETDEL", err)
+	}
+	if !exists {
+		ctx.SkipPropagation()
+		return resp.NewNullValue()
+	}
+	ctx.Propagate("DEL", args[0])
+	return resp.NewBulkValue(val)
+}
+
+func handleGetEx(ctx *engine.CommandContext, args []string) resp.Value {
+	if len(args) < 1 {
+		return errWrongArgs()
+	}
+	var expireAt int64
+	persist := false
+	for i := 1; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); opt {
+		case "PERSIST":
+			if expireAt != 0 {
+				return resp.NewErrorValue(errSyntax.Error())
+			}
+			persist = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if expireAt != 0 || persist || i+1 >= len(args) {
+				return resp.NewErrorValue(errSyntax.Error())
+			}
+			var err error
+			if expireAt, err = parseExpireOption("getex", opt, args[i+1]); err != nil {
+				return resp.NewErrorValue(err.Error())
+			}
+			i++
+		default:
+			return resp.NewErrorValue(errSyntax.Error())
+		}
+	}
+
+	val, exists, err := ctx.Storage().GetEx(args[0], expireAt, persist)
+	if err != nil {
+		return storageError("GETEX", err)
+	}
+	switch {
+	case !exists || expireAt == 0 && !persist:
+		ctx.SkipPropagation()
+	case expireAt != 0 && expireAt <= time.Now().UnixMilli():
+		ctx.Propagate("DEL", args[0])
+	case expireAt != 0:
+		ctx.Propagate("PEXPIREAT", args[0], strconv.FormatInt(expireAt, 10))
+	default:
+		ctx.Propagate("PERSIST", args[0])
+	}
+	if !exists {
+		return resp.NewNullValue()
+	}
+	return resp.NewBulkValue(val)
+}
+
+func handleMGet(ctx *engine.CommandContext, args []string) resp.Value {
+	if len(args) < 1 {
+		return errWrongArgs()
+	}
+	values, found := ctx.Storage().MGet(args...)
+	reply := make([]resp.Value, len(values))
+	for i, v := range values {
+		if found[i] {
+			reply[i] = resp.NewBulkValue(v)
+		} else {
+			reply[i] = resp.NewNullValue()
+		}
+	}
+	return resp.NewArrayValue(reply)
+}
+
+func handleMSet(ctx *engine.CommandContext, args []string) resp.Value {
+	if len(args) < 2 || len(args)%2 != 0 {
+		return errWrongArgsFor("mset")
+	}
+	ctx.Storage().MSet(args, false)
+	return resp.NewStringValue("OK")
+}
+
+func handleMSetNX(ctx *engine.CommandContext, args []string) resp.Value {
+	if len(args) < 2 || len(args)%2 != 0 {
+		return errWrongArgsFor("msetnx")
+	}
+	if !ctx.Storage().MSet(args, true) {
+		ctx.SkipPropagation()
+		return resp.NewIntValue(0)
+	}
+	return resp.NewIntValue(1)
+}
+
+func handleStrLen(ctx *engine.CommandContext, args []string) resp.Value {
+	if len(args) != 1 {
+		return errWrongArgs()
+	}
+	n, err := ctx.Storage().StrLen(args[0])
+	if err != nil {
+		return storageError("STRLEN", err)
+	}
+	return resp.NewIntValue(int64(n))
+}
+
+func handleGetRange(ctx *engine.CommandContext, args []string) resp.Value {
+	if len(args) != 3 {
+		return errWrongArgs()
+	}
+	start, err1 := strconv.ParseInt(args[1], 10, 64)
+	end, err2 := strconv.ParseInt(args[2], 10, 64)
+	if err1 != nil || err2 != nil {
+		return resp.NewErrorValue(errNotInteger.Error())
+	}
+	sub, err := ctx.Storage().GetRange(args[0], start, end)
+	if err != nil {
+		return storageError("GETRANGE", err)
+	}
+	return resp.NewBulkValue(sub)
+}
+
+func handleSetRange(ctx *engine.CommandContext, args []string) resp.Value {
+	if len(args) != 3 {
+		return errWrongArgs()
+	}
+	offset, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return resp.NewErrorValue(errNotInteger.Error())
+	}
+	if offset < 0 {
+		return resp.NewErrorValue("ERR offset is out of range")
+	}
+	n, err := ctx.Storage().SetRange(args[0], offset, args[2])
+	if err != nil {
+		return storageError("SETRANGE", err)
+	}
+	return resp.NewIntValue(int64(n))
+}
+
+func handleIncrByFloat(ctx *engine.CommandContext, args []string) resp.Value {
+	if len(args) != 2 {
+		return errWrongArgs()
+	}
+	delta, err := strconv.ParseFloat(args[1], 64)
+	if err != nil || math.IsNaN(delta) || math.IsInf(delta, 0) {
+		return resp.NewErrorValue("ERR value is not a valid float")
+	}
+	result, err := ctx.Storage().IncrByFloat(args[0], delta)
+	if err != nil {
+		return storageError("INCRBYFLOAT", err)
+	}
+	// the result is logged rather than the increment, so that replaying
+	// the AOF can't accumulate floating point errors differently
+	ctx.Propagate("SET", args[0], result, "KEEPTTL")
+	return resp.NewBulkValue(result)
+}
+
 func handleDel(ctx *engine.CommandContext, args []string) resp.Value {
 	if len(args) == 0 {
 		return errWrongArgs()
@@ -149,14 +438,28 @@ func handleAppend(ctx *engine.CommandContext, args []string) resp.Value {
 func init() {
 	engine.RegisterCommand("PING", 0, false, handlePing)
 	engine.RegisterCommand("ECHO", 1, false, handleEcho)
-	engine.RegisterCommand("SET", 2, true, handleSet)
+	engine.RegisterCommand("SET", -2, true, handleSet)
+	engine.RegisterCommand("SETNX", 2, true, handleSetNX)
+	engine.RegisterCommand("SETEX", 3, true, wrapHandleSetEx)
+	engine.RegisterCommand("PSETEX", 3, true, wrapHandlePSetEx)
+	engine.RegisterCommand("GETSET", 2, true, handleGetSet)
 	engine.RegisterCommand("GET", 1, false, handleGet)
-	engine.RegisterCommand("DEL", -1, true, handleDel)
+	engine.RegisterCommand("GETDEL", 1, true, handleGetDel, engine.FlagAllowOOM)
+	engine.RegisterCommand("GETEX", -1, true, handleGetEx)
+	engine.RegisterCommand("MGET", -1, false, handleMGet)
+	engine.RegisterCommand("MSET", -2, true, handleMSet)
+	engine.RegisterCommand("MSETNX", -2, true, handleMSetNX)
+	engine.RegisterCommand("STRLEN", 1, false, handleStrLen)
+	engine.RegisterCommand("GETRANGE", 3, false, handleGetRange)
+	engine.RegisterCommand("SETRANGE", 3, true, handleSetRange)
+	engine.RegisterCommand("DEL", -1, true, handleDel, engine.FlagAllowOOM)
 	engine.RegisterCommand("TYPE", 1, false, handleType)
 	engine.RegisterCommand("EXISTS", -1, false, handleExists)
 	engine.RegisterCommand("INCR", 1, true, handleIncr)
 	engine.RegisterCommand("DECR", 1, true, handleDecr)
 	engine.RegisterCommand("INCRBY", 2, true, handleIncrBy)
 	engine.RegisterCommand("DECRBY", 2, true, handleDecrBy)
+	engine.RegisterCommand("INCRBYFLOAT", 2, true, handleIncrByFloat)
 	engine.RegisterCommand("APPEND", 2, true, handleAppend)
+	engine.RegisterCommand("LCS", -2, false, handleLCS)
 }
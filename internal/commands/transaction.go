@@ -20,6 +20,10 @@ func handleExec(ctx *engine.CommandContext, args []string) resp.Value {
 	if !ctx.InTransaction() {
 		return resp.NewErrorValue("ERR EXEC without MULTI")
 	}
+	if ctx.TransactionAborted() {
+		ctx.DiscardTransaction()
+		return resp.NewErrorValue("EXECABORT Transaction discarded because of previous errors.")
+	}
 	results := ctx.ExecuteTransaction()
 	return resp.NewArrayValue(results)
 }
@@ -0,0 +1,45 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/engine"
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/storage"
+)
+
+func TestMulti_RejectsWritesUnderOOM(t *testing.T) {
+	dbs := storage.NewDatabases(1, 4)
+	ctx := engine.NewCommandContext(dbs, nil)
+	ctx.Storage().Set("k", "v")
+	dbs.SetMaxMemory(1, storage.NoEviction)
+
+	engine.DispatchCommand(ctx, "MULTI", nil)
+	if reply := engine.DispatchCommand(ctx, "GET", []string{"k"}); reply.Str() != "QUEUED" {
+		t.Fatalf("GET: got %q; want QUEUED", reply.Marshal())
+	}
+	if reply := engine.DispatchCommand(ctx, "SET", []string{"k", "w"}); !strings.HasPrefix(reply.Str(), "OOM ") {
+		t.Fatalf("SET: got %q; want an OOM error", reply.Marshal())
+	}
+	// DEL may still run under OOM, but the transaction is already aborted
+	if reply := engine.DispatchCommand(ctx, "DEL", []string{"k"}); reply.Str() != "QUEUED" {
+		t.Fatalf("DEL: got %q; want QUEUED", reply.Marshal())
+	}
+	want := "EXECABORT Transaction discarded because of previous errors."
+	if reply := engine.DispatchCommand(ctx, "EXEC", nil); reply.Str() != want {
+		t.Fatalf("EXEC: got %q; want %q", reply.Marshal(), want)
+	}
+	if ctx.InTransaction() {
+		t.Fatalf("transaction is still open after EXECABORT")
+	}
+	if v, ok, _ := ctx.Storage().Get("k"); !ok || v != "v" {
+		t.Fatalf("k is %q, %v after EXECABORT; want \"v\"", v, ok)
+	}
+
+	// the next transaction starts clean
+	engine.DispatchCommand(ctx, "MULTI", nil)
+	engine.DispatchCommand(ctx, "GET", []string{"k"})
+	if reply := engine.DispatchCommand(ctx, "EXEC", nil); len(reply.Array()) != 1 {
+		t.Fatalf("EXEC: got %q; want one reply", reply.Marshal())
+	}
+}
@@ -0,0 +1,617 @@
+package commands
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/engine"
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/resp"
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/storage"
+)
+
+var (
+	errNotFloat      = errors.New("ERR value is not a valid float")
+	errScoreRange    = errors.New("ERR min or max is not a float")
+	errLexRange      = errors.New("ERR min or max not valid string range item")
+	errZAddNXXX      = errors.New("ERR XX and NX options at the same time are not compatible")
+	errZAddGTLTNX    = errors.New("ERR GT, LT, and/or NX options at the same time are not compatible")
+	errZAddIncrPairs = errors.New("ERR INCR option supports a single increment-element pair")
+)
+
+func parseScore(arg string) (float64, error) {
+	score, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, errNotFloat
+	}
+	return score, nil
+}
+
+// formatScore formats a score the way Redis replies with it: like %.17g with
+// the shortest digits that read back as the same number.
+func formatScore(score float64) string {
+	switch {
+	case math.IsInf(score, 1):
+		return "inf"
+	case math.IsInf(score, -1):
+		return "-inf"
+	}
+	if exp := math.Floor(math.Log10(math.Abs(score))); score == 0 || (exp >= -4 && exp < 17) {
+		return strconv.FormatFloat(score, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(score, 'g', -1, 64)
+}
+
+// parseScoreBound parses a score range end such as 1.5, (1.5 or -inf.
+func parseScoreBound(arg string) (storage.ScoreBound, error) {
+	var b storage.ScoreBound
+	if strings.HasPrefix(arg, "(") {
+		b.Exclusive = true
+		arg = arg[1:]
+	}
+	var err error
+	if b.Value, err = parseScore(arg); err != nil {
+		return b, errScoreRange
+	}
+	return b, nil
+}
+
+// parseLexBound parses a lexicographical range end: "-", "+", or a string
+// prefixed with "[" for an inclusive or "(" for an exclusive bound.
+func parseLexBound(arg string) (storage.LexBound, error) {
+	switch {
+	case arg == "-":
+		return storage.LexBound{Inf: -1}, nil
+	case arg == "+":
+		return storage.LexBound{Inf: 1}, nil
+	case strings.HasPrefix(arg, "["):
+		return storage.LexBound{Value: arg[1:]}, nil
+	case strings.HasPrefix(arg, "("):
+		return storage.LexBound{Value: arg[1:], Exclusive: true}, nil
+	default:
+		return storage.LexBound{}, errLexRange
+	}
+}
+
+func zmembersReply(members []storage.ZMember, withScores bool) resp.Value {
+	reply := make([]resp.Value, 0, len(members))
+	for _, m := range members {
+		reply = append(reply, resp.NewBulkValue(m.Member))
+		if withScores {
+			reply = append(reply, resp.NewBulkValue(formatScore(m.Score)))
+		}
+	}
+	return resp.NewArrayValue(reply)
+}
+
+// handleZAdd implements ZADD key [NX|XX] [GT|LT] [CH] [INCR] score member
+// [score member ...].
+func handleZAdd(ctx *engine.CommandContext, args []string) resp.Value {
+	var flags storage.ZAddFlags
+	ch := false
+	i := 1
+options:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			flags |= storage.ZAddNX
+		case "XX":
+			flags |= storage.ZAddXX
+		case "GT":
+			flags |= storage.ZAddGT
+		case "LT":
+			flags |= storage.ZAddLT
+		case "CH":
+			ch = true
+		case "INCR":
+			flags |= storage.ZAddIncr
+		default:
+			break options
+		}
+	}
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return resp.NewErrorValue(errSyntax.Error())
+	}
+	switch {
+	case flags&storage.ZAddNX != 0 && flags&storage.ZAddXX != 0:
+		return resp.NewErrorValue(errZAddNXXX.Error())
+	case flags&storage.ZAddGT != 0 && flags&storage.ZAddLT != 0,
+		flags&storage.ZAddNX != 0 && flags&(storage.ZAddGT|storage.ZAddLT) != 0:
+		return resp.NewErrorValue(errZAddGTLTNX.Error())
+	case flags&storage.ZAddIncr != 0 && len(pairs) > 2:
+		return resp.NewErrorValue(errZAddIncrPairs.Error())
+	}
+
+	members := make([]storage.ZMember, 0, len(pairs)/2)
+	for j := 0; j < len(pairs); j += 2 {
+		score, err := parseScore(pairs[j])
+		if err != nil {
+			return resp.NewErrorValue(err.Error())
+		}
+		members = append(members, storage.ZMember{Member: pairs[j+1], Score: score})
+	}
+
+	if flags&storage.ZAddIncr != 0 {
+		score, applied, err := ctx.Storage().ZIncrBy(args[0], flags&^storage.ZAddIncr, members[0].Member, members[0].Score)
+		if err != nil {
+			return storageError("ZADD", err)
+		}
+		if !applied {
+			return resp.NewNullValue()
+		}
+		return resp.NewBulkValue(formatScore(score))
+	}
+
+	added, changed, err := ctx.Storage().ZAdd(args[0], flags, members...)
+	if err != nil {
+		return storageError("ZADD", err)
+	}
+	if ch {
+		return resp.NewIntValue(int64(added + changed))
+	}
+	return resp.NewIntValue(int64(added))
+}
+
+func handleZIncrBy(ctx *engine.CommandContext, args []string) resp.Value {
+	delta, err := parseScore(args[1])
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	score, _, err := ctx.Storage().ZIncrBy(args[0], 0, args[2], delta)
+	if err != nil {
+		return storageError("ZINCRBY", err)
+	}
+	return resp.NewBulkValue(formatScore(score))
+}
+
+func handleZRem(ctx *engine.CommandContext, args []string) resp.Value {
+	removed, err := ctx.Storage().ZRem(args[0], args[1:]...)
+	if err != nil {
+		return storageError("ZREM", err)
+	}
+	return resp.NewIntValue(int64(removed))
+}
+
+func handleZScore(ctx *engine.CommandContext, args []string) resp.Value {
+	score, found, err := ctx.Storage().ZScore(args[0], args[1])
+	if err != nil {
+		return storageError("ZSCORE", err)
+	}
+	if !found {
+		return resp.NewNullValue()
+	}
+	return resp.NewBulkValue(formatScore(score))
+}
+
+func handleZMScore(ctx *engine.CommandContext, args []string) resp.Value {
+	scores, found, err := ctx.Storage().ZMScore(args[0], args[1:]...)
+	if err != nil {
+		return storageError("ZMSCORE", err)
+	}
+	reply := make([]resp.Value, len(scores))
+	for i, score := range scores {
+		reply[i] = resp.NewNullValue()
+		if found[i] {
+			reply[i] = resp.NewBulkValue(formatScore(score))
+		}
+	}
+	return resp.NewArrayValue(reply)
+}
+
+func handleZCard(ctx *engine.CommandContext, args []string) resp.Value {
+	n, err := ctx.Storage().ZCard(args[0])
+	if err != nil {
+		return storageError("ZCARD", err)
+	}
+	return resp.NewIntValue(int64(n))
+}
+
+func handleZCount(ctx *engine.CommandContext, args []string) resp.Value {
+	lo, err := parseScoreBound(args[1])
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	hi, err := parseScoreBound(args[2])
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	n, err := ctx.Storage().ZCount(args[0], lo, hi)
+	if err != nil {
+		return storageError("ZCOUNT", err)
+	}
+	return resp.NewIntValue(int64(n))
+}
+
+// handleZRank implements ZRANK and ZREVRANK key member [WITHSCORE].
+func handleZRank(ctx *engine.CommandContext, cmdName string, args []string, rev bool) resp.Value {
+	withScore := false
+	switch {
+	case len(args) == 2:
+	case len(args) == 3 && strings.EqualFold(args[2], "WITHSCORE"):
+		withScore = true
+	default:
+		return resp.NewErrorValue(errSyntax.Error())
+	}
+	rank, score, found, err := ctx.Storage().ZRank(args[0], args[1], rev)
+	if err != nil {
+		return storageError(cmdName, err)
+	}
+	switch {
+	case !found:
+		return resp.NewNullValue()
+	case withScore:
+		return resp.NewArrayValue([]resp.Value{resp.NewIntValue(int64(rank)), resp.NewBulkValue(formatScore(score))})
+	default:
+		return resp.NewIntValue(int64(rank))
+	}
+}
+
+func handleZRankAsc(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleZRank(ctx, "ZRANK", args, false)
+}
+
+func handleZRevRank(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleZRank(ctx, "ZREVRANK", args, true)
+}
+
+// parseZRange parses "start stop [BYSCORE|BYLEX] [REV] [LIMIT offset count]
+// [WITHSCORES]" as ZRANGE takes it. The older range commands preset by and
+// rev, and don't accept the keywords that would change them.
+func parseZRange(args []string, by storage.ZRangeBy, rev, preset bool) (r storage.ZRange, withScores bool, err error) {
+	r = storage.ZRange{By: by, Rev: rev, Count: -1}
+	limit := false
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); {
+		case opt == "WITHSCORES":
+			withScores = true
+		case opt == "LIMIT" && i+2 < len(args):
+			if r.Offset, err = strconv.Atoi(args[i+1]); err != nil {
+				return r, false, errNotInteger
+			}
+			if r.Count, err = strconv.Atoi(args[i+2]); err != nil {
+				return r, false, errNotInteger
+			}
+			limit = true
+			i += 2
+		case opt == "BYSCORE" && !preset:
+			r.By = storage.ZByScore
+		case opt == "BYLEX" && !preset:
+			r.By = storage.ZByLex
+		case opt == "REV" && !preset:
+			r.Rev = true
+		default:
+			return r, false, errSyntax
+		}
+	}
+	switch {
+	case limit && r.By == storage.ZByRank:
+		return r, false, errors.New("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	case withScores && r.By == storage.ZByLex:
+		return r, false, errors.New("ERR syntax error, WITHSCORES not supported in combination with BYLEX")
+	}
+
+	// reversed score and lex ranges are written from max to min
+	lo, hi := args[0], args[1]
+	if r.Rev && r.By != storage.ZByRank {
+		lo, hi = hi, lo
+	}
+	switch r.By {
+	case storage.ZByRank:
+		if r.Start, err = strconv.Atoi(lo); err != nil {
+			return r, false, errNotInteger
+		}
+		if r.Stop, err = strconv.Atoi(hi); err != nil {
+			return r, false, errNotInteger
+		}
+	case storage.ZByScore:
+		if r.Min, err = parseScoreBound(lo); err != nil {
+			return r, false, err
+		}
+		if r.Max, err = parseScoreBound(hi); err != nil {
+			return r, false, err
+		}
+	case storage.ZByLex:
+		if r.MinLex, err = parseLexBound(lo); err != nil {
+			return r, false, err
+		}
+		if r.MaxLex, err = parseLexBound(hi); err != nil {
+			return r, false, err
+		}
+	}
+	return r, withScores, nil
+}
+
+func doZRange(ctx *engine.CommandContext, cmdName string, args []string, by storage.ZRangeBy, rev, preset bool) resp.Value {
+	r, withScores, err := parseZRange(args[1:], by, rev, preset)
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	members, err := ctx.Storage().ZRange(args[0], r)
+	if err != nil {
+		return storageError(cmdName, err)
+	}
+	return zmembersReply(members, withScores)
+}
+
+func handleZRange(ctx *engine.CommandContext, args []string) resp.Value {
+	return doZRange(ctx, "ZRANGE", args, storage.ZByRank, false, false)
+}
+
+func handleZRevRange(ctx *engine.CommandContext, args []string) resp.Value {
+	return doZRange(ctx, "ZREVRANGE", args, storage.ZByRank, true, true)
+}
+
+func handleZRangeByScore(ctx *engine.CommandContext, args []string) resp.Value {
+	return doZRange(ctx, "ZRANGEBYSCORE", args, storage.ZByScore, false, true)
+}
+
+func handleZRevRangeByScore(ctx *engine.CommandContext, args []string) resp.Value {
+	return doZRange(ctx, "ZREVRANGEBYSCORE", args, storage.ZByScore, true, true)
+}
+
+func handleZRangeByLex(ctx *engine.CommandContext, args []string) resp.Value {
+	return doZRange(ctx, "ZRANGEBYLEX", args, storage.ZByLex, false, true)
+}
+
+func handleZRevRangeByLex(ctx *engine.CommandContext, args []string) resp.Value {
+	return doZRange(ctx, "ZREVRANGEBYLEX", args, storage.ZByLex, true, true)
+}
+
+// handleZSetOpStore implements ZUNIONSTORE, ZINTERSTORE and ZDIFFSTORE dest
+// numkeys key [key ...], the first two with [WEIGHTS weight [weight ...]]
+// [AGGREGATE SUM|MIN|MAX].
+func handleZSetOpStore(ctx *engine.CommandContext, cmdName string, op storage.SetOp, args []string) resp.Value {
+	keys, rest, err := parseNumKeys(args[1:])
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	var weights []float64
+	agg := storage.ZAggSum
+	for len(rest) > 0 {
+		switch opt := strings.ToUpper(rest[0]); {
+		case opt == "WEIGHTS" && op != storage.SetDiff && len(rest) > len(keys):
+			weights = make([]float64, len(keys))
+			for i := range keys {
+				if weights[i], err = parseScore(rest[1+i]); err != nil {
+					return resp.NewErrorValue("ERR weight value is not a float")
+				}
+			}
+			rest = rest[1+len(keys):]
+		case opt == "AGGREGATE" && op != storage.SetDiff && len(rest) > 1:
+			switch strings.ToUpper(rest[1]) {
+			case "SUM":
+				agg = storage.ZAggSum
+			case "MIN":
+				agg = storage.ZAggMin
+			case "MAX":
+				agg = storage.ZAggMax
+			default:
+				return resp.NewErrorValue(errSyntax.Error())
+			}
+			rest = rest[2:]
+		default:
+			return resp.NewErrorValue(errSyntax.Error())
+		}
+	}
+
+	n, err := ctx.Storage().ZSetOperationStore(op, args[0], keys, weights, agg)
+	if err != nil {
+		return storageError(cmdName, err)
+	}
+	return resp.NewIntValue(int64(n))
+}
+
+func handleZUnionStore(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleZSetOpStore(ctx, "ZUNIONSTORE", storage.SetUnion, args)
+}
+
+func handleZInterStore(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleZSetOpStore(ctx, "ZINTERSTORE", storage.SetInter, args)
+}
+
+func handleZDiffStore(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleZSetOpStore(ctx, "ZDIFFSTORE", storage.SetDiff, args)
+}
+
+// handleZRangeStore implements ZRANGESTORE dst src min max, with the options
+// of ZRANGE but WITHSCORES.
+func handleZRangeStore(ctx *engine.CommandContext, args []string) resp.Value {
+	r, withScores, err := parseZRange(args[2:], storage.ZByRank, false, false)
+	if err == nil && withScores {
+		err = errSyntax
+	}
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	n, err := ctx.Storage().ZRangeStore(args[0], args[1], r)
+	if err != nil {
+		return storageError("ZRANGESTORE", err)
+	}
+	return resp.NewIntValue(int64(n))
+}
+
+// handleZRemRange implements ZREMRANGEBYRANK, ZREMRANGEBYSCORE and
+// ZREMRANGEBYLEX key min max.
+func handleZRemRange(ctx *engine.CommandContext, cmdName string, args []string, by storage.ZRangeBy) resp.Value {
+	r, _, err := parseZRange(args[1:3], by, false, true)
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	removed, err := ctx.Storage().ZRemRange(args[0], r)
+	if err != nil {
+		return storageError(cmdName, err)
+	}
+	return resp.NewIntValue(int64(removed))
+}
+
+func handleZRemRangeByRank(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleZRemRange(ctx, "ZREMRANGEBYRANK", args, storage.ZByRank)
+}
+
+func handleZRemRangeByScore(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleZRemRange(ctx, "ZREMRANGEBYSCORE", args, storage.ZByScore)
+}
+
+func handleZRemRangeByLex(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleZRemRange(ctx, "ZREMRANGEBYLEX", args, storage.ZByLex)
+}
+
+// handleZPop implements ZPOPMIN and ZPOPMAX key [count].
+func handleZPop(ctx *engine.CommandContext, cmdName string, args []string, highest bool) resp.Value {
+	if len(args) > 2 {
+		return resp.NewErrorValue(errSyntax.Error())
+	}
+	count := 1
+	if len(args) == 2 {
+		var err error
+		if count, err = strconv.Atoi(args[1]); err != nil {
+			return resp.NewErrorValue(errNotInteger.Error())
+		}
+		if count < 0 {
+			return resp.NewErrorValue("ERR value is out of range, must be positive")
+		}
+	}
+	popped, err := ctx.Storage().ZPop(args[0], highest, count)
+	if err != nil {
+		return storageError(cmdName, err)
+	}
+	if len(popped) == 0 {
+		ctx.SkipPropagation()
+	}
+	return zmembersReply(popped, true)
+}
+
+func handleZPopMin(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleZPop(ctx, "ZPOPMIN", args, false)
+}
+
+func handleZPopMax(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleZPop(ctx, "ZPOPMAX", args, true)
+}
+
+func parseZSetEnd(arg string) (bool, error) {
+	switch strings.ToUpper(arg) {
+	case "MIN":
+		return true, nil
+	case "MAX":
+		return false, nil
+	default:
+		return false, errSyntax
+	}
+}
+
+// zmpopReply builds the [key, [[member, score] ...]] reply of ZMPOP and
+// propagates the pop as a plain ZPOPMIN or ZPOPMAX with a count.
+func zmpopReply(ctx *engine.CommandContext, key string, highest bool, popped []storage.ZMember) resp.Value {
+	if key == "" {
+		ctx.SkipPropagation()
+		return resp.NewNullValue()
+	}
+	cmd := "ZPOPMIN"
+	if highest {
+		cmd = "ZPOPMAX"
+	}
+	ctx.Propagate(cmd, key, strconv.Itoa(len(popped)))
+	pairs := make([]resp.Value, len(popped))
+	for i, m := range popped {
+		pairs[i] = zmembersReply([]storage.ZMember{m}, true)
+	}
+	return resp.NewArrayValue([]resp.Value{resp.NewBulkValue(key), resp.NewArrayValue(pairs)})
+}
+
+func handleZMPop(ctx *engine.CommandContext, args []string) resp.Value {
+	keys, lowest, count, err := parseMPopArgs(args, parseZSetEnd)
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	key, popped, err := ctx.Storage().ZMPop(keys, !lowest, count)
+	if err != nil {
+		return storageError("ZMPOP", err)
+	}
+	return zmpopReply(ctx, key, !lowest, popped)
+}
+
+// handleBZPop implements BZPOPMIN and BZPOPMAX key [key ...] timeout, which
+// are logged to the AOF as ZPOPMIN or ZPOPMAX of the key served.
+func handleBZPop(ctx *engine.CommandContext, cmdName string, args []string, highest bool) resp.Value {
+	keys := args[:len(args)-1]
+	timeout, err := parseTimeout(args[len(args)-1])
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	return block(ctx, cmdName, keys, timeout, func() (resp.Value, bool, error) {
+		key, popped, err := ctx.Storage().ZMPop(keys, highest, 1)
+		if err != nil || key == "" {
+			return resp.Value{}, false, err
+		}
+		if highest {
+			ctx.Propagate("ZPOPMAX", key)
+		} else {
+			ctx.Propagate("ZPOPMIN", key)
+		}
+		return resp.NewArrayValue([]resp.Value{
+			resp.NewBulkValue(key),
+			resp.NewBulkValue(popped[0].Member),
+			resp.NewBulkValue(formatScore(popped[0].Score)),
+		}), true, nil
+	})
+}
+
+func handleBZPopMin(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleBZPop(ctx, "BZPOPMIN", args, false)
+}
+
+func handleBZPopMax(ctx *engine.CommandContext, args []string) resp.Value {
+	return handleBZPop(ctx, "BZPOPMAX", args, true)
+}
+
+func handleBZMPop(ctx *engine.CommandContext, args []string) resp.Value {
+	timeout, err := parseTimeout(args[0])
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	keys, lowest, count, err := parseMPopArgs(args[1:], parseZSetEnd)
+	if err != nil {
+		return resp.NewErrorValue(err.Error())
+	}
+	return block(ctx, "BZMPOP", keys, timeout, func() (resp.Value, bool, error) {
+		key, popped, err := ctx.Storage().ZMPop(keys, !lowest, count)
+		if err != nil || key == "" {
+			return resp.Value{}, false, err
+		}
+		return zmpopReply(ctx, key, !lowest, popped), true, nil
+	})
+}
+
+func init() {
+	engine.RegisterCommand("ZADD", -3, true, handleZAdd)
+	engine.RegisterCommand("ZINCRBY", 3, true, handleZIncrBy)
+	engine.RegisterCommand("ZREM", -2, true, handleZRem, engine.FlagAllowOOM)
+	engine.RegisterCommand("ZSCORE", 2, false, handleZScore)
+	engine.RegisterCommand("ZMSCORE", -2, false, handleZMScore)
+	engine.RegisterCommand("ZCARD", 1, false, handleZCard)
+	engine.RegisterCommand("ZCOUNT", 3, false, handleZCount)
+	engine.RegisterCommand("ZRANK", -2, false, handleZRankAsc)
+	engine.RegisterCommand("ZREVRANK", -2, false, handleZRevRank)
+	engine.RegisterCommand("ZRANGE", -3, false, handleZRange)
+	engine.RegisterCommand("ZREVRANGE", -3, false, handleZRevRange)
+	engine.RegisterCommand("ZRANGEBYSCORE", -3, false, handleZRangeByScore)
+	engine.RegisterCommand("ZREVRANGEBYSCORE", -3, false, handleZRevRangeByScore)
+	engine.RegisterCommand("ZRANGEBYLEX", -3, false, handleZRangeByLex)
+	engine.RegisterCommand("ZREVRANGEBYLEX", -3, false, handleZRevRangeByLex)
+	engine.RegisterCommand("ZUNIONSTORE", -3, true, handleZUnionStore)
+	engine.RegisterCommand("ZINTERSTORE", -3, true, handleZInterStore)
+	engine.RegisterCommand("ZDIFFSTORE", -3, true, handleZDiffStore)
+	engine.RegisterCommand("ZRANGESTORE", -4, true, handleZRangeStore)
+	engine.RegisterCommand("ZREMRANGEBYRANK", 3, true, handleZRemRangeByRank, engine.FlagAllowOOM)
+	engine.RegisterCommand("ZREMRANGEBYSCORE", 3, true, handleZRemRangeByScore, engine.FlagAllowOOM)
+	engine.RegisterCommand("ZREMRANGEBYLEX", 3, true, handleZRemRangeByLex, engine.FlagAllowOOM)
+	engine.RegisterCommand("ZPOPMIN", -1, true, handleZPopMin, engine.FlagAllowOOM)
+	engine.RegisterCommand("ZPOPMAX", -1, true, handleZPopMax, engine.FlagAllowOOM)
+	engine.RegisterCommand("ZMPOP", -3, true, handleZMPop, engine.FlagAllowOOM)
+	engine.RegisterCommand("BZPOPMIN", -2, true, handleBZPopMin, engine.FlagAllowOOM)
+	engine.RegisterCommand("BZPOPMAX", -2, true, handleBZPopMax, engine.FlagAllowOOM)
+	engine.RegisterCommand("BZMPOP", -4, true, handleBZMPop, engine.FlagAllowOOM)
+}
@@ -7,16 +7,22 @@ import (
 )
 
 type CommandContext struct {
-	storage       *storage.KV
+	dbs           *storage.Databases
+	db            int
 	inTransaction bool
 	queued        []func() resp.Value
+	txAborted     bool
 	aof           *persistence.AOF
 	inReplay      bool
+	propagated    [][]string
+	rewritten     bool
+	done          <-chan struct{}
 }
 
-func NewCommandContext(storage *storage.KV, aof *persistence.AOF) *CommandContext {
+func NewCommandContext(dbs *storage.Databases, aof *persistence.AOF) *CommandContext {
 	return &CommandContext{
-		storage:       storage,
+		dbs:           dbs,
+		db:            0,
 		inTransaction: false,
 		queued:        make([]func() resp.Value, 0),
 		aof:           aof,
@@ -25,19 +31,74 @@ func NewCommandContext(storage *storage.KV, aof *persistence.AOF) *CommandContex
 }
 
 func (c *CommandContext) Storage() *storage.KV {
-	return c.storage
+	return c.dbs.DB(c.db)
+}
+
+func (c *CommandContext) Databases() *storage.Databases {
+	return c.dbs
+}
+
+func (c *CommandContext) SelectedDB() int {
+	return c.db
+}
+
+func (c *CommandContext) SelectDB(index int) error {
+	if index < 0 || index >= c.dbs.Len() {
+		return storage.ErrDBIndex
+	}
+	c.db = index
+	return nil
 }
 
 func (c *CommandContext) InReplay() bool {
 	return c.inReplay
 }
 
+// StartReplay marks the context as replaying the AOF, which also keeps keys
+// from expiring until EndReplay.
 func (c *CommandContext) StartReplay() {
 	c.inReplay = true
+	c.dbs.SetLoading(true)
 }
 
 func (c *CommandContext) EndReplay() {
 	c.inReplay = false
+	c.dbs.SetLoading(false)
+}
+
+// Propagate replaces what the running command writes to the AOF, e.g. to log
+// a relative expire as an absolute one. Calling it several times logs
+// several commands.
+func (c *CommandContext) Propagate(cmdName string, args ...string) {
+	c.propagated = append(c.propagated, append([]string{cmdName}, args...))
+	c.rewritten = true
+}
+
+// SkipPropagation keeps the running command out of the AOF, for writes that
+// turned out to change nothing.
+func (c *CommandContext) SkipPropagation() {
+	c.rewritten = true
+}
+
+func (c *CommandContext) resetPropagation() {
+	c.propagated = c.propagated[:0]
+	c.rewritten = false
+}
+
+// SetDone sets the channel that is closed once the client disconnects or
+// the server shuts down, releasing a blocked command.
+func (c *CommandContext) SetDone(done <-chan struct{}) {
+	c.done = done
+}
+
+func (c *CommandContext) Done() <-chan struct{} {
+	return c.done
+}
+
+// CanBlock reports whether a blocking command may wait for data. Inside
+// MULTI/EXEC and during AOF replay it must answer right away instead.
+func (c *CommandContext) CanBlock() bool {
+	return !c.inTransaction && !c.inReplay
 }
 
 func (c *CommandContext) InTransaction() bool {
@@ -46,14 +107,26 @@ func (c *CommandContext) InTransaction() bool {
 
 func (c *CommandContext) BeginTransaction() {
 	c.inTransaction = true
+	c.txAborted = false
 	c.queued = c.queued[:0]
 }
 
 func (c *CommandContext) DiscardTransaction() {
 	c.inTransaction = false
+	c.txAborted = false
 	c.queued = c.queued[:0]
 }
 
+// AbortTransaction marks the open transaction so that EXEC discards it
+// instead of running the queued commands.
+func (c *CommandContext) AbortTransaction() {
+	c.txAborted = true
+}
+
+func (c *CommandContext) TransactionAborted() bool {
+	return c.txAborted
+}
+
 func (c *CommandContext) EnqueueCommand(fn func() resp.Value) {
 	c.queued = append(c.queued, fn)
 }
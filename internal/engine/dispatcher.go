@@ -5,7 +5,9 @@ import (
 	"log"
 	"strings"
 
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/persistence"
 	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/resp"
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/storage"
 )
 
 func DispatchCommand(ctx *CommandContext, cmdName string, args []string) resp.Value {
@@ -23,18 +25,63 @@ func DispatchCommand(ctx *CommandContext, cmdName string, args []string) resp.Va
 		return resp.NewErrorValue(fmt.Sprintf("ERR wrong number of arguments for '%s' command", cmdName))
 	}
 
-	if !ctx.InReplay() && cmd.isWrite {
-		log.Println("Appened to AOF")
-		if err := ctx.aof.Append(cmdName, args); err != nil {
-			log.Println("AOF append failed:", err)
+	checkMemory := func() error {
+		if ctx.InReplay() || !cmd.isWrite || cmd.flags&FlagAllowOOM != 0 {
+			return nil
+		}
+		return ctx.Databases().FreeMemoryIfNeeded()
+	}
+
+	run := func() resp.Value {
+		if err := checkMemory(); err != nil {
+			return resp.NewErrorValue("OOM " + err.Error() + ".")
+		}
+		ctx.resetPropagation()
+		result := cmd.handler(ctx, args)
+		if !ctx.InReplay() && cmd.isWrite && result.Typ() != "error" {
+			appendToAOF(ctx, cmdName, args)
 		}
+		return result
 	}
 
 	if ctx.InTransaction() && cmdName != "MULTI" && cmdName != "EXEC" && cmdName != "DISCARD" {
-		ctx.EnqueueCommand(func() resp.Value {
-			return cmd.handler(ctx, args)
-		})
+		// Like Redis, a write that doesn't fit under maxmemory is refused
+		// when it's queued, and the whole transaction fails at EXEC.
+		if err := checkMemory(); err != nil {
+			ctx.AbortTransaction()
+			return resp.NewErrorValue("OOM " + err.Error() + ".")
+		}
+		ctx.EnqueueCommand(run)
 		return resp.NewStringValue("QUEUED")
 	}
-	return cmd.handler(ctx, args)
+	return run()
+}
+
+func appendToAOF(ctx *CommandContext, cmdName string, args []string) {
+	log.Println("Appened to AOF")
+	if !ctx.rewritten {
+		if err := ctx.aof.Append(ctx.db, cmdName, args); err != nil {
+			log.Println("AOF append failed:", err)
+		}
+		return
+	}
+	for _, cmd := range ctx.propagated {
+		if err := ctx.aof.Append(ctx.db, cmd[0], cmd[1:]); err != nil {
+			log.Println("AOF append failed:", err)
+		}
+	}
+}
+
+// LogKeyspaceDeletions appends a DEL to the AOF for every key that expires
+// or is evicted, like Redis does, so that replaying the log removes the key
+// at the same point and later writes don't find the old value.
+func LogKeyspaceDeletions(dbs *storage.Databases, aof *persistence.AOF) {
+	dbs.OnKeyspaceEvent(func(db int, event, key string) {
+		if event != "expired" && event != "evicted" {
+			return
+		}
+		if err := aof.Append(db, "DEL", []string{key}); err != nil {
+			log.Println("AOF append failed:", err)
+		}
+	})
 }
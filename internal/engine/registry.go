@@ -9,10 +9,19 @@ import (
 
 type CommandHandler func(ctx *CommandContext, args []string) resp.Value
 
+type CommandFlag int
+
+const (
+	// FlagAllowOOM marks write commands that may run while used memory is
+	// over maxmemory, because they never grow the dataset.
+	FlagAllowOOM CommandFlag = 1 << iota
+)
+
 type Command struct {
 	name    string
 	arity   int
 	isWrite bool
+	flags   CommandFlag
 	handler CommandHandler
 }
 
@@ -22,7 +31,7 @@ func AllCommands() map[string]*Command {
 	return registry
 }
 
-func RegisterCommand(name string, arity int, isWrite bool, handler CommandHandler) {
+func RegisterCommand(name string, arity int, isWrite bool, handler CommandHandler, flags ...CommandFlag) {
 	name = strings.ToUpper(name)
 	if name == "" {
 		panic("command name cannot be empty")
@@ -33,7 +42,11 @@ func RegisterCommand(name string, arity int, isWrite bool, handler CommandHandle
 	if _, exists := registry[name]; exists {
 		panic(fmt.Sprintf("command %q already registered", name))
 	}
-	registry[name] = &Command{name: name, arity: arity, isWrite: isWrite, handler: handler}
+	cmd := &Command{name: name, arity: arity, isWrite: isWrite, handler: handler}
+	for _, f := range flags {
+		cmd.flags |= f
+	}
+	registry[name] = cmd
 }
 
 func GetCommand(name string) (*Command, bool) {
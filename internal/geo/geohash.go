@@ -0,0 +1,215 @@
+// Package geo implements the 52-bit geohash Redis uses to keep coordinates
+// as sorted set scores, and the distance math of its GEO commands.
+package geo
+
+import (
+	"math"
+	"slices"
+)
+
+const (
+	// Step is the number of bits each coordinate gets in a hash.
+	Step = 26
+
+	LonMin = -180.0
+	LonMax = 180.0
+	// The latitude is limited to what EPSG:3857 maps, like in Redis.
+	LatMin = -85.05112878
+	LatMax = 85.05112878
+
+	// EarthRadius is the one Redis uses, in meters.
+	EarthRadius = 6372797.560856
+
+	mercatorMax = 20037726.37
+)
+
+const base32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// Valid reports whether the coordinates can be encoded.
+func Valid(lon, lat float64) bool {
+	return lon >= LonMin && lon <= LonMax && lat >= LatMin && lat <= LatMax
+}
+
+// cellIndex returns which of the 2^step slices of [lo, hi] v falls in.
+func cellIndex(v, lo, hi float64, step uint) uint32 {
+	i := (v - lo) / (hi - lo) * float64(uint64(1)<<step)
+	return uint32(min(i, float64(uint64(1)<<step-1)))
+}
+
+// interleave spreads the bits of lat over the even bits of the result and
+// those of lon over the odd ones, so the longitude comes first.
+func interleave(lat, lon uint32) uint64 {
+	return spread(lat) | spread(lon)<<1
+}
+
+func spread(v uint32) uint64 {
+	x := uint64(v)
+	x = (x | x<<16) & 0x0000FFFF0000FFFF
+	x = (x | x<<8) & 0x00FF00FF00FF00FF
+	x = (x | x<<4) & 0x0F0F0F0F0F0F0F0F
+	x = (x | x<<2) & 0x3333333333333333
+	x = (x | x<<1) & 0x5555555555555555
+	return x
+}
+
+func squash(x uint64) uint32 {
+	x &= 0x5555555555555555
+	x = (x | x>>1) & 0x3333333333333333
+	x = (x | x>>2) & 0x0F0F0F0F0F0F0F0F
+	x = (x | x>>4) & 0x00FF00FF00FF00FF
+	x = (x | x>>8) & 0x0000FFFF0000FFFF
+	x = (x | x>>16) & 0x00000000FFFFFFFF
+	return uint32(x)
+}
+
+// Encode returns the 52-bit hash of valid coordinates.
+func Encode(lon, lat float64) uint64 {
+	return interleave(cellIndex(lat, LatMin, LatMax, Step), cellIndex(lon, LonMin, LonMax, Step))
+}
+
+// Decode returns the center of the area a hash stands for.
+func Decode(hash uint64) (lon, lat float64) {
+	latIdx, lonIdx := squash(hash), squash(hash>>1)
+	lon = cellCenter(lonIdx, LonMin, LonMax, Step)
+	lat = cellCenter(latIdx, LatMin, LatMax, Step)
+	return min(max(lon, LonMin), LonMax), min(max(lat, LatMin), LatMax)
+}
+
+func cellCenter(i uint32, lo, hi float64, step uint) float64 {
+	size := (hi - lo) / float64(uint64(1)<<step)
+	return lo + (float64(i)+0.5)*size
+}
+
+// String returns the standard 11 character geohash of a hash. Since the
+// standard one spans latitudes from -90 to 90, the coordinates are encoded
+// again, and the last character is always '0' as 52 bits only fill ten.
+func String(hash uint64) string {
+	lon, lat := Decode(hash)
+	bits := interleave(cellIndex(lat, -90, 90, Step), cellIndex(lon, LonMin, LonMax, Step))
+	buf := make([]byte, 11)
+	for i := range buf {
+		idx := uint64(0)
+		if i < 10 {
+			idx = bits >> (52 - (i+1)*5) & 0x1f
+		}
+		buf[i] = base32[idx]
+	}
+	return string(buf)
+}
+
+func radians(deg float64) float64 { return deg * math.Pi / 180 }
+func degrees(rad float64) float64 { return rad * 180 / math.Pi }
+
+// Distance returns the great-circle distance in meters between two points,
+// using the haversine formula.
+func Distance(lon1, lat1, lon2, lat2 float64) float64 {
+	lat1r, lat2r := radians(lat1), radians(lat2)
+	u := math.Sin((lat2r - lat1r) / 2)
+	v := math.Sin(radians(lon2-lon1) / 2)
+	return 2 * EarthRadius * math.Asin(math.Sqrt(u*u+math.Cos(lat1r)*math.Cos(lat2r)*v*v))
+}
+
+// Shape is the area of a search around a center: a Width by Height box if
+// either is set, else a circle of Radius. All lengths are in meters.
+type Shape struct {
+	Radius        float64
+	Width, Height float64
+}
+
+// Contains reports whether the point lies in the shape centered at lon, lat
+// and returns its distance from the center.
+func (s Shape) Contains(lon, lat, plon, plat float64) (float64, bool) {
+	if !s.box() {
+		d := Distance(lon, lat, plon, plat)
+		return d, d <= s.Radius
+	}
+	// the cheaper latitude check goes first
+	if EarthRadius*math.Abs(radians(plat)-radians(lat)) > s.Height/2 {
+		return 0, false
+	}
+	if Distance(plon, plat, lon, plat) > s.Width/2 {
+		return 0, false
+	}
+	return Distance(lon, lat, plon, plat), true
+}
+
+func (s Shape) box() bool { return s.Width > 0 || s.Height > 0 }
+
+// reach is the distance from the center to the farthest point of the shape.
+func (s Shape) reach() float64 {
+	if !s.box() {
+		return s.Radius
+	}
+	return math.Hypot(s.Width/2, s.Height/2)
+}
+
+// Range is a half-open interval [Min, Max) of hashes.
+type Range struct{ Min, Max uint64 }
+
+// estimateStep picks the coarsest cells that are still small enough for a
+// search reaching meters far, as Redis's geohashEstimateStepsByRadius does.
+func estimateStep(meters, lat float64) uint {
+	if meters == 0 {
+		return Step
+	}
+	step := 1
+	for meters < mercatorMax {
+		meters *= 2
+		step++
+	}
+	step -= 2
+	// cells narrow towards the poles
+	if lat > 66 || lat < -66 {
+		step--
+		if lat > 80 || lat < -80 {
+			step--
+		}
+	}
+	return uint(min(max(step, 1), Step))
+}
+
+// Areas returns the hash ranges covering the shape centered at lon, lat:
+// the cell of the center and its eight neighbours, at a size where those
+// nine cells hold the bounding box of the shape.
+func Areas(lon, lat float64, s Shape) []Range {
+	reach := s.reach()
+	latDelta := degrees(reach / EarthRadius)
+	lonDelta := degrees(reach / EarthRadius / math.Cos(radians(min(math.Abs(lat)+latDelta, 89.9))))
+	boxLatMin, boxLatMax := max(lat-latDelta, LatMin), min(lat+latDelta, LatMax)
+
+	step := estimateStep(reach, lat)
+	var lonIdx, latIdx uint32
+	for {
+		cells := uint64(1) << step
+		lonIdx, latIdx = cellIndex(lon, LonMin, LonMax, step), cellIndex(lat, LatMin, LatMax, step)
+		lonSize, latSize := (LonMax-LonMin)/float64(cells), (LatMax-LatMin)/float64(cells)
+		cellLon, cellLat := LonMin+float64(lonIdx)*lonSize, LatMin+float64(latIdx)*latSize
+		covered := cellLon-lonSize <= lon-lonDelta && cellLon+2*lonSize >= lon+lonDelta &&
+			(latIdx == 0 || cellLat-latSize <= boxLatMin) &&
+			(uint64(latIdx) == cells-1 || cellLat+2*latSize >= boxLatMax)
+		if covered || step == 1 {
+			break
+		}
+		step--
+	}
+
+	cells := int64(1) << step
+	shift := 2 * (Step - step)
+	var ranges []Range
+	for dy := int64(-1); dy <= 1; dy++ {
+		y := int64(latIdx) + dy
+		if y < 0 || y >= cells {
+			continue
+		}
+		for dx := int64(-1); dx <= 1; dx++ {
+			// the longitude wraps around the antimeridian
+			x := (int64(lonIdx) + dx + cells) % cells
+			hash := interleave(uint32(y), uint32(x))
+			r := Range{hash << shift, (hash + 1) << shift}
+			if !slices.Contains(ranges, r) {
+				ranges = append(ranges, r)
+			}
+		}
+	}
+	return ranges
+}
@@ -0,0 +1,68 @@
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	// the hashes and positions Redis reports for its GEOADD example
+	tests := []struct {
+		lon, lat float64
+		hash     uint64
+		str      string
+	}{
+		{13.361389, 38.115556, 3479099956230698, "sqc8b49rny0"},
+		{15.087269, 37.502669, 3479447370796909, "sqdtr74hyu0"},
+	}
+	for _, tt := range tests {
+		hash := Encode(tt.lon, tt.lat)
+		if hash != tt.hash {
+			t.Errorf("Encode(%v, %v) = %d; want %d", tt.lon, tt.lat, hash, tt.hash)
+		}
+		if lon, lat := Decode(hash); math.Abs(lon-tt.lon) > 1e-5 || math.Abs(lat-tt.lat) > 1e-5 {
+			t.Errorf("Decode(%d) = %v, %v; want about %v, %v", hash, lon, lat, tt.lon, tt.lat)
+		}
+		if s := String(hash); s != tt.str {
+			t.Errorf("String(%d) = %q; want %q", hash, s, tt.str)
+		}
+	}
+}
+
+func TestDistance(t *testing.T) {
+	d := Distance(13.36138933897018433, 38.11555639549629859, 15.08726745843887329, 37.50266842333161321)
+	if math.Abs(d-166274.1516) > 0.001 {
+		t.Fatalf("got %v; want 166274.1516", d)
+	}
+}
+
+func TestAreas_CoverShape(t *testing.T) {
+	centers := [][2]float64{{0, 0}, {179.99, 10}, {-179.99, -10}, {13.4, 84.9}, {2.35, 48.85}}
+	shapes := []Shape{{Radius: 10}, {Radius: 5000}, {Radius: 800000}, {Width: 3000, Height: 90000}}
+	for _, c := range centers {
+		for _, s := range shapes {
+			areas := Areas(c[0], c[1], s)
+			// walk the edge of the shape, where a miss would show first
+			for deg := 0.0; deg < 360; deg += 5 {
+				dist := s.reach() * 0.999
+				lat := c[1] + degrees(dist/EarthRadius*math.Cos(radians(deg)))
+				lon := c[0] + degrees(dist/EarthRadius*math.Sin(radians(deg))/math.Cos(radians(c[1])))
+				lon = math.Mod(lon+540, 360) - 180
+				if !Valid(lon, lat) {
+					continue
+				}
+				if _, in := s.Contains(c[0], c[1], lon, lat); !in {
+					continue
+				}
+				hash := Encode(lon, lat)
+				covered := false
+				for _, a := range areas {
+					covered = covered || (hash >= a.Min && hash < a.Max)
+				}
+				if !covered {
+					t.Fatalf("center %v shape %+v: %v, %v is not covered", c, s, lon, lat)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package glob
+
+// Match reports whether str matches the Redis glob-style pattern. It follows
+// the semantics of Redis stringmatchlen: '*', '?', character classes with
+// ranges and negation ('[a-z]', '[^x]') and backslash escaping. Unlike
+// path.Match no character is treated as a separator and malformed patterns
+// never fail, they simply match literally as far as possible.
+func Match(pattern, str string) bool {
+	skipLongerMatches := false
+	return match(pattern, str, &skipLongerMatches, 0)
+}
+
+func match(pattern, str string, skipLongerMatches *bool, nesting int) bool {
+	// protect against abusive patterns like "*a*a*a*..."
+	if nesting > 1000 {
+		return false
+	}
+
+	p, s := 0, 0
+	for p < len(pattern) && s < len(str) {
+		switch pattern[p] {
+		case '*':
+			for p+1 < len(pattern) && pattern[p+1] == '*' {
+				p++
+			}
+			if p+1 == len(pattern) {
+				return true
+			}
+			for s < len(str) {
+				if match(pattern[p+1:], str[s:], skipLongerMatches, nesting+1) {
+					return true
+				}
+				// a deeper '*' already failed on the whole remainder, so
+				// trying longer prefixes here can't succeed either
+				if *skipLongerMatches {
+					return false
+				}
+				s++
+			}
+			*skipLongerMatches = true
+			return false
+		case '?':
+			s++
+		case '[':
+			p++
+			not := p < len(pattern) && pattern[p] == '^'
+			if not {
+				p++
+			}
+			matched := false
+			for {
+				if p >= len(pattern) {
+					// unterminated class, step back so the outer loop ends on the last byte
+					p--
+					break
+				}
+				if pattern[p] == '\\' && len(pattern)-p >= 2 {
+					p++
+					if pattern[p] == str[s] {
+						matched = true
+					}
+				} else if pattern[p] == ']' {
+					break
+				} else if len(pattern)-p >= 3 && pattern[p+1] == '-' {
+					start, end := pattern[p], pattern[p+2]
+					if start > end {
+						start, end = end, start
+					}
+					p += 2
+					if str[s] >= start && str[s] <= end {
+						matched = true
+					}
+				} else if pattern[p] == str[s] {
+					matched = true
+				}
+				p++
+			}
+			if not {
+				matched = !matched
+			}
+			if !matched {
+				return false
+			}
+			s++
+		case '\\':
+			if len(pattern)-p >= 2 {
+				p++
+			}
+			fallthrough
+		default:
+			if pattern[p] != str[s] {
+				return false
+			}
+			s++
+		}
+		p++
+	}
+	if s == len(str) {
+		for p < len(pattern) && pattern[p] == '*' {
+			p++
+		}
+	}
+	return p == len(pattern) && s == len(str)
+}
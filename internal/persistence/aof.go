@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"io"
 	"os"
+	"strconv"
 	"sync"
 
 	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/resp"
@@ -15,6 +16,7 @@ type AOF struct {
 	writer *resp.Writer
 	buf    *bytes.Buffer
 	path   string
+	db     int
 }
 
 func NewAOF(path string) (*AOF, error) {
@@ -28,13 +30,24 @@ func NewAOF(path string) (*AOF, error) {
 		writer: w,
 		buf:    &bytes.Buffer{},
 		path:   path,
+		db:     -1,
 	}, nil
 }
 
-func (aof *AOF) Append(cmdName string, args []string) error {
+func (aof *AOF) Append(db int, cmdName string, args []string) error {
 	aof.mu.Lock()
 	defer aof.mu.Unlock()
 
+	if db != aof.db {
+		if err := aof.appendCommand("SELECT", []string{strconv.Itoa(db)}); err != nil {
+			return err
+		}
+		aof.db = db
+	}
+	return aof.appendCommand(cmdName, args)
+}
+
+func (aof *AOF) appendCommand(cmdName string, args []string) error {
 	array := make([]resp.Value, len(args)+1)
 	array[0] = resp.NewBulkValue(cmdName)
 	for i, arg := range args {
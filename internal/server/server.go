@@ -1,6 +1,7 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -15,36 +16,71 @@ import (
 	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/storage"
 )
 
-func handleConnection(conn net.Conn, storage *storage.KV, aof *persistence.AOF, shutdown <-chan struct{}) {
-	defer conn.Close()
-	fmt.Println("Accepted connection from", conn.RemoteAddr())
-
-	ctx := engine.NewCommandContext(storage, aof)
+type request struct {
+	value resp.Value
+	err   error
+}
 
+// readRequests reads commands off the connection until the client goes
+// away, then closes disconnected. It runs apart from the command loop so a
+// disconnect is noticed while a command is blocked.
+func readRequests(conn net.Conn, requests chan<- request, disconnected chan<- struct{}, done <-chan struct{}) {
+	defer close(disconnected)
 	respReader := resp.NewReader(conn)
-	respWriter := resp.NewWriter(conn)
 	for {
-		conn.SetReadDeadline(time.Now().Add(time.Second))
 		v, err := respReader.Read()
-		nerr, ok := err.(net.Error)
+		var nerr net.Error
 		switch {
-		case ok && nerr.Timeout():
-			select {
-			case <-shutdown:
-				return
-			default:
-				continue
-			}
 		case err == io.EOF:
 			log.Println("Connection closed by", conn.RemoteAddr())
 			return
-		case err != nil:
-			log.Println("Error reading from connection:", err)
+		case errors.Is(err, net.ErrClosed), errors.As(err, &nerr):
+			return
+		}
+		select {
+		case requests <- request{v, err}:
+		case <-done:
+			return
+		}
+	}
+}
+
+func handleConnection(conn net.Conn, dbs *storage.Databases, aof *persistence.AOF, shutdown <-chan struct{}) {
+	defer conn.Close()
+	fmt.Println("Accepted connection from", conn.RemoteAddr())
+
+	// done is closed when the client disconnects or the server shuts down
+	disconnected := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-shutdown:
+		case <-disconnected:
+		}
+		close(done)
+	}()
+
+	ctx := engine.NewCommandContext(dbs, aof)
+	ctx.SetDone(done)
+
+	requests := make(chan request)
+	go readRequests(conn, requests, disconnected, done)
+
+	respWriter := resp.NewWriter(conn)
+	for {
+		var req request
+		select {
+		case <-done:
+			return
+		case req = <-requests:
+		}
+		if req.err != nil {
+			log.Println("Error reading from connection:", req.err)
 			respWriter.Write(resp.NewErrorValue("ERR invalid command"))
 			continue
 		}
 
-		cmd, args, err := resp.ParseCommand(v)
+		cmd, args, err := resp.ParseCommand(req.value)
 		if err != nil {
 			log.Println("Error parsing the command:", err)
 			respWriter.Write(resp.NewErrorValue("ERR invalid command"))
@@ -58,17 +94,17 @@ func handleConnection(conn net.Conn, storage *storage.KV, aof *persistence.AOF,
 }
 
 type Server struct {
-	listener        net.Listener
-	storage         *storage.KV
-	aof             *persistence.AOF
-	wg              sync.WaitGroup
-	shutdown        chan struct{}
-	addr            string
-	cleanupInterval time.Duration
+	listener       net.Listener
+	dbs            *storage.Databases
+	aof            *persistence.AOF
+	wg             sync.WaitGroup
+	shutdown       chan struct{}
+	addr           string
+	expireInterval time.Duration
 }
 
-func New(addr string, storage *storage.KV, aof *persistence.AOF, cleanupInterval time.Duration) *Server {
-	return &Server{storage: storage, aof: aof, addr: addr, shutdown: make(chan struct{}, 1), cleanupInterval: cleanupInterval}
+func New(addr string, dbs *storage.Databases, aof *persistence.AOF, expireInterval time.Duration) *Server {
+	return &Server{dbs: dbs, aof: aof, addr: addr, shutdown: make(chan struct{}, 1), expireInterval: expireInterval}
 }
 
 func (s *Server) Start() {
@@ -79,8 +115,9 @@ func (s *Server) Start() {
 	}
 
 	s.ReplayAOF()
+	engine.LogKeyspaceDeletions(s.dbs, s.aof)
 	go s.FlushAOF()
-	go s.storage.Cleanup(s.cleanupInterval, s.shutdown)
+	go s.dbs.ActiveExpire(s.expireInterval, s.shutdown)
 
 	for {
 		conn, err := s.listener.Accept()
@@ -97,7 +134,7 @@ func (s *Server) Start() {
 		s.wg.Add(1)
 		go func() {
 			defer s.wg.Done()
-			handleConnection(conn, s.storage, s.aof, s.shutdown)
+			handleConnection(conn, s.dbs, s.aof, s.shutdown)
 		}()
 	}
 }
@@ -113,7 +150,7 @@ func (s *Server) Shutdown() {
 
 func (s *Server) ReplayAOF() {
 	log.Println("Starting Replay AOF")
-	ctx := engine.NewCommandContext(s.storage, s.aof)
+	ctx := engine.NewCommandContext(s.dbs, s.aof)
 	ctx.StartReplay()
 
 	cmdCh := make(chan persistence.ReplayCommand, 10)
@@ -127,6 +164,7 @@ func (s *Server) ReplayAOF() {
 		log.Printf("Dispatching %v %v", cmd.Name, cmd.Args)
 		engine.DispatchCommand(ctx, cmd.Name, cmd.Args)
 	}
+	ctx.EndReplay()
 	log.Println("Replay AOF finished")
 }
 
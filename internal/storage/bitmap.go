@@ -0,0 +1,396 @@
+package storage
+
+import (
+	"math"
+	"math/bits"
+)
+
+// MaxBitOffset is the highest bit a bitmap command may address, the last bit
+// of a string of maxStringSize bytes.
+const MaxBitOffset = maxStringSize*8 - 1
+
+func getBit(b string, offset uint64) int {
+	idx := offset >> 3
+	if idx >= uint64(len(b)) {
+		return 0
+	}
+	return int(b[idx]>>(7-offset&7)) & 1
+}
+
+func setBit(b []byte, offset uint64, bit int) {
+	mask := byte(1) << (7 - offset&7)
+	if bit == 1 {
+		b[offset>>3] |= mask
+	} else {
+		b[offset>>3] &^= mask
+	}
+}
+
+// SetBit sets the bit at offset, growing the string if needed, and returns
+// the previous value of the bit.
+func (s *KV) SetBit(key string, offset uint64, bit int) (int, error) {
+	var old int
+	err := s.update([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			e = newStringEntry("")
+			tx.set(key, e)
+		}
+		b, err := e.mutableBytes(int(offset>>3) + 1)
+		if err != nil {
+			return err
+		}
+		old = int(b[offset>>3]>>(7-offset&7)) & 1
+		setBit(b, offset, bit)
+		return nil
+	})
+	return old, err
+}
+
+func (s *KV) GetBit(key string, offset uint64) (int, error) {
+	var bit int
+	err := s.view([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		b, err := e.view()
+		bit = getBit(b, offset)
+		return err
+	})
+	return bit, err
+}
+
+// BitRange selects part of a string for BITCOUNT and BITPOS. Start and End
+// count bytes, or bits if Bit is set, and may be negative to count from the
+// end. With Set unset the whole string is used.
+type BitRange struct {
+	Start, End  int64
+	Set, HasEnd bool
+	Bit         bool
+}
+
+// bits resolves the range against a string of n bytes into inclusive bit
+// offsets. It returns false if the range is empty.
+func (r BitRange) bits(n int) (first, last uint64, ok bool) {
+	total := int64(n)
+	if r.Bit {
+		total *= 8
+	}
+	start, end := int64(0), total-1
+	if r.Set {
+		start = r.Start
+		if r.HasEnd {
+			end = r.End
+		}
+		if start < 0 && end < 0 && start > end {
+			return 0, 0, false
+		}
+		if start < 0 {
+			start = max(total+start, 0)
+		}
+		if end < 0 {
+			end = max(total+end, 0)
+		}
+		end = min(end, total-1)
+	}
+	if total == 0 || start > end {
+		return 0, 0, false
+	}
+	if !r.Bit {
+		return uint64(start) * 8, uint64(end)*8 + 7, true
+	}
+	return uint64(start), uint64(end), true
+}
+
+// BitCount counts the bits set to 1 in the given range.
+func (s *KV) BitCount(key string, r BitRange) (int64, error) {
+	var count int64
+	err := s.view([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		b, err := e.view()
+		if err != nil {
+			return err
+		}
+		first, last, ok := r.bits(len(b))
+		if !ok {
+			return nil
+		}
+		for i := first >> 3; i <= last>>3; i++ {
+			count += int64(bits.OnesCount8(b[i]))
+		}
+		// drop the bits of the first and last bytes that are outside the range
+		count -= int64(bits.OnesCount8(b[first>>3] >> (8 - first&7)))
+		count -= int64(bits.OnesCount8(b[last>>3] << (last&7 + 1)))
+		return nil
+	})
+	return count, err
+}
+
+// BitPos returns the position of the first bit set to bit in the given
+// range, or -1. When looking for a 0 bit without an explicit end, the string
+// is considered padded with zeros, so the bit right after it is returned.
+func (s *KV) BitPos(key string, bit int, r BitRange) (int64, error) {
+	pos := int64(-1)
+	err := s.view([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			if bit == 0 {
+				pos = 0
+			}
+			return nil
+		}
+		b, err := e.view()
+		if err != nil {
+			return err
+		}
+		first, last, ok := r.bits(len(b))
+		if !ok {
+			return nil
+		}
+		for i := first; i <= last; i++ {
+			// skip whole bytes that can't contain the bit
+			if i&7 == 0 && i+7 <= last && (bit == 1 && b[i>>3] == 0 || bit == 0 && b[i>>3] == 0xFF) {
+				i += 7
+				continue
+			}
+			if getBit(b, i) == bit {
+				pos = int64(i)
+				return nil
+			}
+		}
+		if bit == 0 && !r.HasEnd {
+			pos = int64(last) + 1
+		}
+		return nil
+	})
+	return pos, err
+}
+
+type BitOp int
+
+const (
+	BitAnd BitOp = iota
+	BitOr
+	BitXor
+	BitNot
+)
+
+// BitOp stores the result of op applied to the strings at keys into dest
+// and returns its length. Missing keys count as empty strings, and shorter
+// strings are padded with zero bytes. An empty result deletes dest.
+func (s *KV) BitOp(op BitOp, dest string, keys ...string) (int, error) {
+	var n int
+	err := s.update(append([]string{dest}, keys...), func(tx *txn) error {
+		srcs := make([]string, len(keys))
+		for i, key := range keys {
+			if e := tx.lookup(key); e != nil {
+				var err error
+				if srcs[i], err = e.view(); err != nil {
+					return err
+				}
+			}
+			n = max(n, len(srcs[i]))
+		}
+
+		result := make([]byte, n)
+		for i := range result {
+			byteAt := func(src string) byte {
+				if i < len(src) {
+					return src[i]
+				}
+				return 0
+			}
+			v := byteAt(srcs[0])
+			for _, src := range srcs[1:] {
+				switch op {
+				case BitAnd:
+					v &= byteAt(src)
+				case BitOr:
+					v |= byteAt(src)
+				case BitXor:
+					v ^= byteAt(src)
+				}
+			}
+			if op == BitNot {
+				v = ^v
+			}
+			result[i] = v
+		}
+
+		tx.lookup(dest)
+		if n == 0 {
+			tx.delete(dest)
+			return nil
+		}
+		tx.set(dest, &entry{typ: stringType, data: result})
+		return nil
+	})
+	return n, err
+}
+
+type BitFieldKind int
+
+const (
+	BitFieldGet BitFieldKind = iota
+	BitFieldSet
+	BitFieldIncrBy
+)
+
+type BitFieldOverflow int
+
+const (
+	OverflowWrap BitFieldOverflow = iota
+	OverflowSat
+	OverflowFail
+)
+
+type BitFieldOp struct {
+	Kind     BitFieldKind
+	Signed   bool
+	Bits     int
+	Offset   uint64
+	Value    int64
+	Overflow BitFieldOverflow
+}
+
+// BitFieldResult is the reply to one BITFIELD operation. Nil is set when an
+// operation was skipped because it would overflow with OVERFLOW FAIL.
+type BitFieldResult struct {
+	Value int64
+	Nil   bool
+}
+
+func getBitField(b string, offset uint64, width int, signed bool) int64 {
+	var v uint64
+	for i := 0; i < width; i++ {
+		v = v<<1 | uint64(getBit(b, offset+uint64(i)))
+	}
+	if signed && width < 64 && v&(1<<(width-1)) != 0 {
+		v |= math.MaxUint64 << width
+	}
+	return int64(v)
+}
+
+func setBitField(b []byte, offset uint64, width int, value int64) {
+	for i := 0; i < width; i++ {
+		setBit(b, offset+uint64(i), int(uint64(value)>>(width-1-i))&1)
+	}
+}
+
+// applyOverflow returns value+incr as a field of the given width and
+// signedness, handled according to overflow. It returns false if the
+// operation must fail.
+func applyOverflow(value, incr int64, width int, signed bool, overflow BitFieldOverflow) (int64, bool) {
+	var minV, maxV int64
+	if signed {
+		maxV = math.MaxInt64
+		if width < 64 {
+			maxV = 1<<(width-1) - 1
+		}
+		minV = -maxV - 1
+	} else {
+		maxV = 1<<width - 1
+	}
+
+	sum := value + incr
+	overflowed := incr > 0 && (sum < value || sum > maxV)
+	underflowed := incr < 0 && (sum > value || sum < minV)
+	if incr == 0 {
+		// SET: an unsigned field reads the value as uint64, so negative
+		// values are too large rather than too small
+		overflowed, underflowed = value > maxV || !signed && value < 0, signed && value < minV
+	}
+	if !overflowed && !underflowed {
+		return sum, true
+	}
+
+	switch overflow {
+	case OverflowFail:
+		return 0, false
+	case OverflowSat:
+		if overflowed {
+			return maxV, true
+		}
+		return minV, true
+	default:
+		wrapped := uint64(sum)
+		if width < 64 {
+			wrapped &= 1<<width - 1
+			if signed && wrapped&(1<<(width-1)) != 0 {
+				wrapped |= math.MaxUint64 << width
+			}
+		}
+		return int64(wrapped), true
+	}
+}
+
+// BitField runs ops in order on the string at key as one atomic operation.
+// The string is only created or grown if ops contains writes.
+func (s *KV) BitField(key string, ops []BitFieldOp) ([]BitFieldResult, error) {
+	results := make([]BitFieldResult, 0, len(ops))
+	var writeEnd uint64
+	for _, op := range ops {
+		if op.Kind != BitFieldGet {
+			writeEnd = max(writeEnd, op.Offset+uint64(op.Bits))
+		}
+	}
+
+	run := s.view
+	if writeEnd > 0 {
+		run = s.update
+	}
+	err := run([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil && writeEnd > 0 {
+			e = newStringEntry("")
+			tx.set(key, e)
+		}
+		var b []byte
+		if writeEnd > 0 {
+			var err error
+			if b, err = e.mutableBytes(int((writeEnd + 7) / 8)); err != nil {
+				return err
+			}
+		}
+		view := func() (string, error) {
+			if e == nil {
+				return "", nil
+			}
+			return e.view()
+		}
+
+		for _, op := range ops {
+			current, err := view()
+			if err != nil {
+				return err
+			}
+			old := getBitField(current, op.Offset, op.Bits, op.Signed)
+			switch op.Kind {
+			case BitFieldGet:
+				results = append(results, BitFieldResult{Value: old})
+			case BitFieldSet:
+				value, ok := applyOverflow(op.Value, 0, op.Bits, op.Signed, op.Overflow)
+				if !ok {
+					results = append(results, BitFieldResult{Nil: true})
+					continue
+				}
+				setBitField(b, op.Offset, op.Bits, value)
+				results = append(results, BitFieldResult{Value: old})
+			case BitFieldIncrBy:
+				value, ok := applyOverflow(old, op.Value, op.Bits, op.Signed, op.Overflow)
+				if !ok {
+					results = append(results, BitFieldResult{Nil: true})
+					continue
+				}
+				setBitField(b, op.Offset, op.Bits, value)
+				results = append(results, BitFieldResult{Value: value})
+			}
+		}
+		return nil
+	})
+	return results, err
+}
@@ -0,0 +1,52 @@
+package storage
+
+import "testing"
+
+func TestBitCountAndBitPosRanges(t *testing.T) {
+	kv := NewKV()
+	kv.Set("k", "\x00\xff\xf0")
+
+	if n, _ := kv.BitCount("k", BitRange{}); n != 12 {
+		t.Fatalf("BITCOUNT: got %d; want 12", n)
+	}
+	if n, _ := kv.BitCount("k", BitRange{Start: 4, End: 11, Set: true, HasEnd: true, Bit: true}); n != 4 {
+		t.Fatalf("BITCOUNT BIT: got %d; want 4", n)
+	}
+	if pos, _ := kv.BitPos("k", 1, BitRange{}); pos != 8 {
+		t.Fatalf("BITPOS 1: got %d; want 8", pos)
+	}
+	if pos, _ := kv.BitPos("k", 0, BitRange{Start: 1, Set: true}); pos != 20 {
+		t.Fatalf("BITPOS 0 from byte 1: got %d; want 20", pos)
+	}
+	if pos, _ := kv.BitPos("k", 0, BitRange{Start: 1, End: 1, Set: true, HasEnd: true}); pos != -1 {
+		t.Fatalf("BITPOS 0 with an explicit end: got %d; want -1", pos)
+	}
+}
+
+func TestApplyOverflow(t *testing.T) {
+	tests := []struct {
+		value, incr int64
+		bits        int
+		signed      bool
+		overflow    BitFieldOverflow
+		want        int64
+		ok          bool
+	}{
+		{127, 1, 8, true, OverflowWrap, -128, true},
+		{127, 1, 8, true, OverflowSat, 127, true},
+		{127, 1, 8, true, OverflowFail, 0, false},
+		{-128, -1, 8, true, OverflowSat, -128, true},
+		{255, 1, 8, false, OverflowWrap, 0, true},
+		{0, -1, 8, false, OverflowSat, 0, true},
+		{-1, 0, 8, false, OverflowSat, 255, true},
+		{-1, 0, 8, false, OverflowWrap, 255, true},
+		{1, 2, 63, false, OverflowWrap, 3, true},
+	}
+	for _, tt := range tests {
+		got, ok := applyOverflow(tt.value, tt.incr, tt.bits, tt.signed, tt.overflow)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("applyOverflow(%d, %d, %d, %v, %d) = %d, %v; want %d, %v",
+				tt.value, tt.incr, tt.bits, tt.signed, tt.overflow, got, ok, tt.want, tt.ok)
+		}
+	}
+}
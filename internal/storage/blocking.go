@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// Waiter is a client blocked on a set of keys, e.g. by BLPOP. Its Ready
+// channel fires when one of the keys may have received data; the client
+// then retries its command and, whatever the outcome, eventually calls
+// Unblock.
+type Waiter struct {
+	db    int
+	keys  []string
+	ready chan struct{}
+}
+
+func (w *Waiter) Ready() <-chan struct{} {
+	return w.ready
+}
+
+type blockedKey struct {
+	db  int
+	key string
+}
+
+// blocked keeps the waiters of every key in arrival order. Only the first
+// waiter of a key is woken; it hands the key over to the next one when it
+// unblocks, so clients are served in FIFO order. Streams are the exception:
+// reading doesn't consume them, so all their waiters are woken together.
+type blocked struct {
+	mu      sync.Mutex
+	waiters map[blockedKey][]*Waiter
+	// count lets writes skip the map while nobody is blocked.
+	count atomic.Int64
+}
+
+func newBlocked() *blocked {
+	return &blocked{waiters: make(map[blockedKey][]*Waiter)}
+}
+
+// Block registers a waiter for keys of database db. The caller must try its
+// command after Block and before waiting, so that no write is missed.
+func (d *Databases) Block(db int, keys []string) *Waiter {
+	w := &Waiter{db: db, keys: keys, ready: make(chan struct{}, 1)}
+	b := d.blocked
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, key := range keys {
+		bk := blockedKey{db, key}
+		if !slices.Contains(b.waiters[bk], w) {
+			b.waiters[bk] = append(b.waiters[bk], w)
+		}
+	}
+	b.count.Add(1)
+	return w
+}
+
+// Unblock removes the waiter and wakes the next waiter of every key that
+// still holds data.
+func (d *Databases) Unblock(w *Waiter) {
+	b := d.blocked
+	b.mu.Lock()
+	for _, key := range w.keys {
+		bk := blockedKey{w.db, key}
+		waiters := slices.DeleteFunc(b.waiters[bk], func(x *Waiter) bool { return x == w })
+		if len(waiters) == 0 {
+			delete(b.waiters, bk)
+		} else {
+			b.waiters[bk] = waiters
+		}
+	}
+	b.count.Add(-1)
+	b.mu.Unlock()
+
+	d.DB(w.db).signalReady(w.keys)
+}
+
+// signalReady wakes the first waiter of every key in keys that exists, or
+// all of them for a stream.
+func (s *KV) signalReady(keys []string) {
+	b := s.blocked
+	if b.count.Load() == 0 {
+		return
+	}
+	db := int(s.index.Load())
+
+	var waited []string
+	b.mu.Lock()
+	for _, key := range keys {
+		if len(b.waiters[blockedKey{db, key}]) > 0 {
+			waited = append(waited, key)
+		}
+	}
+	b.mu.Unlock()
+	if len(waited) == 0 {
+		return
+	}
+
+	var ready []string
+	streams := map[string]bool{}
+	s.view(waited, func(tx *txn) error {
+		for _, key := range waited {
+			if e := tx.peek(key); e != nil {
+				ready = append(ready, key)
+				streams[key] = e.typ == streamType
+			}
+		}
+		return nil
+	})
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, key := range ready {
+		waiters := b.waiters[blockedKey{db, key}]
+		if !streams[key] && len(waiters) > 0 {
+			waiters = waiters[:1]
+		}
+		for _, w := range waiters {
+			select {
+			case w.ready <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// signalAll wakes the first waiter of every key of the database, after the
+// whole keyspace changed under it.
+func (s *KV) signalAll() {
+	b := s.blocked
+	if b.count.Load() == 0 {
+		return
+	}
+	db := int(s.index.Load())
+	var keys []string
+	b.mu.Lock()
+	for bk := range b.waiters {
+		if bk.db == db {
+			keys = append(keys, bk.key)
+		}
+	}
+	b.mu.Unlock()
+	s.signalReady(keys)
+}
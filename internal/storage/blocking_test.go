@@ -0,0 +1,65 @@
+package storage
+
+import "testing"
+
+func isReady(w *Waiter) bool {
+	select {
+	case <-w.Ready():
+		return true
+	default:
+		return false
+	}
+}
+
+func TestBlock_WakesWaitersInOrder(t *testing.T) {
+	dbs := NewDatabases(2, 4)
+	first := dbs.Block(0, []string{"q"})
+	second := dbs.Block(0, []string{"other", "q"})
+
+	dbs.DB(0).RPush("q", "a", "b")
+	if !isReady(first) || isReady(second) {
+		t.Fatalf("expected only the first waiter to be woken")
+	}
+
+	// the first waiter takes its element and hands the key over
+	dbs.DB(0).LPop("q", 1)
+	dbs.Unblock(first)
+	if !isReady(second) {
+		t.Fatalf("expected the second waiter to be woken once the first left")
+	}
+	dbs.DB(0).LPop("q", 1)
+	dbs.Unblock(second)
+}
+
+func TestBlock_IgnoresOtherDatabasesAndEmptyKeys(t *testing.T) {
+	dbs := NewDatabases(2, 4)
+	w := dbs.Block(0, []string{"q"})
+	defer dbs.Unblock(w)
+
+	dbs.DB(1).RPush("q", "a")
+	dbs.DB(0).LPop("q", 1)
+	if isReady(w) {
+		t.Fatalf("waiter woken by a write that left no data in its database")
+	}
+
+	if _, err := dbs.Move("q", 1, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !isReady(w) {
+		t.Fatalf("expected MOVE to wake the waiter")
+	}
+}
+
+func TestBlock_SwapWakesWaiters(t *testing.T) {
+	dbs := NewDatabases(2, 4)
+	dbs.DB(1).RPush("q", "a")
+	w := dbs.Block(0, []string{"q"})
+	defer dbs.Unblock(w)
+
+	if err := dbs.Swap(0, 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !isReady(w) {
+		t.Fatalf("expected SWAPDB to wake the waiter")
+	}
+}
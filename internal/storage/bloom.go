@@ -0,0 +1,238 @@
+package storage
+
+import (
+	"math"
+	"unsafe"
+)
+
+// Defaults of a Bloom filter that BF.ADD creates, as in RedisBloom.
+const (
+	BloomDefaultErrorRate = 0.01
+	BloomDefaultCapacity  = 100
+	BloomDefaultExpansion = 2
+)
+
+// bloomLayer is one fixed size Bloom filter of a scalable chain.
+type bloomLayer struct {
+	bits      []uint64
+	nbits     uint64
+	hashes    int
+	capacity  int64
+	errorRate float64
+	items     int64
+}
+
+// bloomFilter is a scalable Bloom filter: once the last layer holds as many
+// items as it was sized for, a new one with expansion times the capacity
+// and half the error rate is added, so the overall error rate stays under
+// the requested one. expansion is 0 for a filter that doesn't scale.
+type bloomFilter struct {
+	layers    []*bloomLayer
+	expansion int
+	items     int64
+	bytes     int64
+}
+
+var (
+	bloomFilterSize = int64(unsafe.Sizeof(bloomFilter{}))
+	bloomLayerSize  = int64(unsafe.Sizeof(bloomLayer{}))
+)
+
+// bloomBits returns the bits and hash functions a filter of capacity items
+// with the given error rate needs, failing if that is more than the largest
+// string could hold.
+func bloomBits(capacity int64, errorRate float64) (nbits uint64, hashes int, err error) {
+	bitsPerItem := -math.Log(errorRate) / (math.Ln2 * math.Ln2)
+	total := float64(capacity) * bitsPerItem
+	if total > maxStringSize*8 {
+		return 0, 0, ErrFilterTooLarge
+	}
+	return max(uint64(total), 1), int(math.Ceil(math.Ln2 * bitsPerItem)), nil
+}
+
+func newBloomFilter(errorRate float64, capacity int64, expansion int) (*bloomFilter, error) {
+	bf := &bloomFilter{expansion: expansion}
+	if err := bf.addLayer(capacity, errorRate); err != nil {
+		return nil, err
+	}
+	return bf, nil
+}
+
+func (bf *bloomFilter) addLayer(capacity int64, errorRate float64) error {
+	nbits, hashes, err := bloomBits(capacity, errorRate)
+	if err != nil {
+		return err
+	}
+	l := &bloomLayer{
+		bits:      make([]uint64, (nbits+63)/64),
+		nbits:     nbits,
+		hashes:    hashes,
+		capacity:  capacity,
+		errorRate: errorRate,
+	}
+	bf.layers = append(bf.layers, l)
+	bf.bytes += bloomLayerSize + int64(len(l.bits))*8
+	return nil
+}
+
+// bloomHash returns the two hashes whose combinations a + i*b give the bit
+// positions of an item, the way RedisBloom computes them.
+func bloomHash(item string) (a, b uint64) {
+	a = murmurHash64A(item, 0xc6a4a7935bd1e995)
+	return a, murmurHash64A(item, a)
+}
+
+func (l *bloomLayer) test(a, b uint64) bool {
+	for i := range uint64(l.hashes) {
+		bit := (a + i*b) % l.nbits
+		if l.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (l *bloomLayer) add(a, b uint64) {
+	for i := range uint64(l.hashes) {
+		bit := (a + i*b) % l.nbits
+		l.bits[bit/64] |= 1 << (bit % 64)
+	}
+	l.items++
+}
+
+func (bf *bloomFilter) exists(item string) bool {
+	a, b := bloomHash(item)
+	for _, l := range bf.layers {
+		if l.test(a, b) {
+			return true
+		}
+	}
+	return false
+}
+
+// add adds item unless it may be there already, growing the filter first
+// if its last layer is full. It reports whether item was added.
+func (bf *bloomFilter) add(item string) (bool, error) {
+	if bf.exists(item) {
+		return false, nil
+	}
+	last := bf.layers[len(bf.layers)-1]
+	if last.items >= last.capacity {
+		if bf.expansion == 0 {
+			return false, ErrBloomFull
+		}
+		if last.capacity > math.MaxInt64/int64(bf.expansion) {
+			return false, ErrFilterTooLarge
+		}
+		if err := bf.addLayer(last.capacity*int64(bf.expansion), last.errorRate/2); err != nil {
+			return false, err
+		}
+		last = bf.layers[len(bf.layers)-1]
+	}
+	last.add(bloomHash(item))
+	bf.items++
+	return true, nil
+}
+
+func (bf *bloomFilter) memUsage() int64 { return bloomFilterSize + bf.bytes }
+
+// lookupBloom returns the Bloom filter at key, or nil if there is none.
+func (tx *txn) lookupBloom(key string) (*bloomFilter, error) {
+	e := tx.lookup(key)
+	if e == nil {
+		return nil, nil
+	}
+	if e.typ != bloomType {
+		return nil, ErrWrongType
+	}
+	return e.bloom(), nil
+}
+
+// BFReserve creates an empty Bloom filter for capacity items with the
+// given error rate. expansion is 0 for a filter that doesn't scale.
+func (s *KV) BFReserve(key string, errorRate float64, capacity int64, expansion int) error {
+	return s.update([]string{key}, func(tx *txn) error {
+		if tx.lookup(key) != nil {
+			return ErrItemExists
+		}
+		bf, err := newBloomFilter(errorRate, capacity, expansion)
+		if err != nil {
+			return err
+		}
+		tx.set(key, &entry{typ: bloomType, data: bf})
+		return nil
+	})
+}
+
+// BFAdd adds items to the Bloom filter at key, creating it with the
+// defaults if needed, and reports which of them were added. If a filter
+// that doesn't scale fills up, it returns what was added so far and
+// ErrBloomFull.
+func (s *KV) BFAdd(key string, items ...string) ([]bool, error) {
+	var added []bool
+	err := s.update([]string{key}, func(tx *txn) error {
+		bf, err := tx.lookupBloom(key)
+		if err != nil {
+			return err
+		}
+		if bf == nil {
+			if bf, err = newBloomFilter(BloomDefaultErrorRate, BloomDefaultCapacity, BloomDefaultExpansion); err != nil {
+				return err
+			}
+			tx.set(key, &entry{typ: bloomType, data: bf})
+		}
+		for _, item := range items {
+			ok, err := bf.add(item)
+			if err != nil {
+				return err
+			}
+			added = append(added, ok)
+		}
+		return nil
+	})
+	return added, err
+}
+
+// BFExists reports which items may be in the Bloom filter at key.
+func (s *KV) BFExists(key string, items ...string) ([]bool, error) {
+	found := make([]bool, len(items))
+	err := s.view([]string{key}, func(tx *txn) error {
+		bf, err := tx.lookupBloom(key)
+		if bf == nil {
+			return err
+		}
+		for i, item := range items {
+			found[i] = bf.exists(item)
+		}
+		return nil
+	})
+	return found, err
+}
+
+// BloomInfo describes a Bloom filter. Expansion is 0 if it doesn't scale.
+type BloomInfo struct {
+	Capacity  int64
+	Size      int64
+	Filters   int
+	Items     int64
+	Expansion int
+}
+
+func (s *KV) BFInfo(key string) (BloomInfo, error) {
+	var info BloomInfo
+	err := s.view([]string{key}, func(tx *txn) error {
+		bf, err := tx.lookupBloom(key)
+		if err == nil && bf == nil {
+			err = ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		info = BloomInfo{Size: bf.memUsage(), Filters: len(bf.layers), Items: bf.items, Expansion: bf.expansion}
+		for _, l := range bf.layers {
+			info.Capacity += l.capacity
+		}
+		return nil
+	})
+	return info, err
+}
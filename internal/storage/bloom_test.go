@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestBloomScaling(t *testing.T) {
+	kv := NewKV()
+	if err := kv.BFReserve("bf", 0.01, 100, 2); err != nil {
+		t.Fatal(err)
+	}
+	var items []string
+	for i := 0; i < 1000; i++ {
+		items = append(items, "item:"+strconv.Itoa(i))
+	}
+	if _, err := kv.BFAdd("bf", items...); err != nil {
+		t.Fatal(err)
+	}
+	found, err := kv.BFExists("bf", items...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slices.Contains(found, false) {
+		t.Fatal("an added item was not found")
+	}
+	info, _ := kv.BFInfo("bf")
+	if info.Filters < 4 || info.Capacity < 1000 {
+		t.Fatalf("got %d filters with a capacity of %d; want the filter to have grown", info.Filters, info.Capacity)
+	}
+
+	var others []string
+	for i := 0; i < 10000; i++ {
+		others = append(others, "other:"+strconv.Itoa(i))
+	}
+	found, _ = kv.BFExists("bf", others...)
+	falsePositives := 0
+	for _, f := range found {
+		if f {
+			falsePositives++
+		}
+	}
+	if falsePositives > 200 {
+		t.Errorf("got %d false positives out of 10000; want about 1%%", falsePositives)
+	}
+}
+
+func TestBloomNonScaling(t *testing.T) {
+	kv := NewKV()
+	if err := kv.BFReserve("bf", 0.01, 2, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := kv.BFReserve("bf", 0.01, 2, 0); err != ErrItemExists {
+		t.Fatalf("got %v; want ErrItemExists", err)
+	}
+	added, err := kv.BFAdd("bf", "a", "b", "a", "c")
+	if err != ErrBloomFull {
+		t.Fatalf("got %v; want ErrBloomFull", err)
+	}
+	if !slices.Equal(added, []bool{true, true, false}) {
+		t.Fatalf("got %v; want the first two items added", added)
+	}
+	if _, err := kv.BFInfo("missing"); err != ErrNotFound {
+		t.Fatalf("got %v; want ErrNotFound", err)
+	}
+	if found, err := kv.BFExists("missing", "a"); err != nil || found[0] {
+		t.Fatalf("got %v, %v for a missing filter", found, err)
+	}
+}
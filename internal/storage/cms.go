@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"encoding/binary"
+	"math"
+	"unsafe"
+)
+
+// countMinSketch counts items in depth rows of width counters, each row
+// indexed by its own hash, and estimates a count as the smallest of the
+// counters an item maps to: never too low, and too high only by what the
+// items sharing those counters added.
+type countMinSketch struct {
+	width, depth int
+	counters     []uint32
+	count        int64
+}
+
+var cmsSize = int64(unsafe.Sizeof(countMinSketch{}))
+
+// murmurHash2 is the 32 bit hash RedisBloom indexes sketch rows with, the
+// row number being the seed.
+func murmurHash2(data string, seed uint32) uint32 {
+	const m = 0x5bd1e995
+	const r = 24
+	h := seed ^ uint32(len(data))
+	for ; len(data) >= 4; data = data[4:] {
+		k := binary.LittleEndian.Uint32([]byte(data[:4]))
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+	if len(data) > 0 {
+		for i := len(data) - 1; i >= 0; i-- {
+			h ^= uint32(data[i]) << (8 * i)
+		}
+		h *= m
+	}
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return h
+}
+
+func newCountMinSketch(width, depth int) (*countMinSketch, error) {
+	if int64(width)*int64(depth) > maxStringSize/4 {
+		return nil, ErrFilterTooLarge
+	}
+	return &countMinSketch{width: width, depth: depth, counters: make([]uint32, width*depth)}, nil
+}
+
+// cell returns the index of the counter of item in row.
+func (c *countMinSketch) cell(item string, row int) int {
+	return row*c.width + int(murmurHash2(item, uint32(row))%uint32(c.width))
+}
+
+func (c *countMinSketch) query(item string) int64 {
+	least := uint32(math.MaxUint32)
+	for row := range c.depth {
+		least = min(least, c.counters[c.cell(item, row)])
+	}
+	return int64(least)
+}
+
+// canIncr reports whether adding n, which isn't negative, to the counters
+// of item and to the total count keeps them in range.
+func (c *countMinSketch) canIncr(item string, n int64) bool {
+	if c.count > math.MaxInt64-n {
+		return false
+	}
+	for row := range c.depth {
+		if n > math.MaxUint32-int64(c.counters[c.cell(item, row)]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *countMinSketch) incr(item string, n int64) {
+	for row := range c.depth {
+		c.counters[c.cell(item, row)] += uint32(n)
+	}
+	c.count += n
+}
+
+func (c *countMinSketch) memUsage() int64 { return cmsSize + int64(len(c.counters))*4 }
+
+// lookupCMS returns the sketch at key, failing with ErrCMSNoKey if there is
+// none.
+func (tx *txn) lookupCMS(key string) (*countMinSketch, error) {
+	e := tx.lookup(key)
+	if e == nil {
+		return nil, ErrCMSNoKey
+	}
+	if e.typ != cmsType {
+		return nil, ErrWrongType
+	}
+	return e.cms(), nil
+}
+
+func (s *KV) CMSInitByDim(key string, width, depth int) error {
+	return s.update([]string{key}, func(tx *txn) error {
+		if tx.lookup(key) != nil {
+			return ErrCMSKeyExists
+		}
+		c, err := newCountMinSketch(width, depth)
+		if err != nil {
+			return err
+		}
+		tx.set(key, &entry{typ: cmsType, data: c})
+		return nil
+	})
+}
+
+// CMSIncrBy adds incrs[i] to the count of items[i] and returns the new
+// estimates. Nothing is added if any counter would overflow.
+func (s *KV) CMSIncrBy(key string, items []string, incrs []int64) ([]int64, error) {
+	var counts []int64
+	err := s.update([]string{key}, func(tx *txn) error {
+		c, err := tx.lookupCMS(key)
+		if err != nil {
+			return err
+		}
+		for i, item := range items {
+			if !c.canIncr(item, incrs[i]) {
+				for j := range i {
+					c.incr(items[j], -incrs[j])
+				}
+				return ErrCMSOverflow
+			}
+			c.incr(item, incrs[i])
+		}
+		for _, item := range items {
+			counts = append(counts, c.query(item))
+		}
+		return nil
+	})
+	return counts, err
+}
+
+func (s *KV) CMSQuery(key string, items ...string) ([]int64, error) {
+	var counts []int64
+	err := s.view([]string{key}, func(tx *txn) error {
+		c, err := tx.lookupCMS(key)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			counts = append(counts, c.query(item))
+		}
+		return nil
+	})
+	return counts, err
+}
+
+// CMSMerge overwrites the sketch at dst with the sum of the sketches at
+// srcs, each multiplied by its weight. All of them must have the same
+// dimensions.
+func (s *KV) CMSMerge(dst string, srcs []string, weights []int64) error {
+	return s.update(append([]string{dst}, srcs...), func(tx *txn) error {
+		d, err := tx.lookupCMS(dst)
+		if err != nil {
+			return err
+		}
+		sketches := make([]*countMinSketch, len(srcs))
+		for i, key := range srcs {
+			if sketches[i], err = tx.lookupCMS(key); err != nil {
+				return err
+			}
+			if sketches[i].width != d.width || sketches[i].depth != d.depth {
+				return ErrCMSDims
+			}
+		}
+		merged := make([]uint32, len(d.counters))
+		var count int64
+		for j := range merged {
+			// the float sum only guards the exact one against wrapping around
+			var sum int64
+			var approx float64
+			for i, c := range sketches {
+				sum += int64(c.counters[j]) * weights[i]
+				if approx += float64(c.counters[j]) * float64(weights[i]); math.Abs(approx) > 1<<62 {
+					return ErrCMSOverflow
+				}
+			}
+			if sum < 0 || sum > math.MaxUint32 {
+				return ErrCMSOverflow
+			}
+			merged[j] = uint32(sum)
+		}
+		var approx float64
+		for i, c := range sketches {
+			count += c.count * weights[i]
+			if approx += float64(c.count) * float64(weights[i]); math.Abs(approx) > 1<<62 {
+				return ErrCMSOverflow
+			}
+		}
+		d.counters, d.count = merged, count
+		return nil
+	})
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestCMSIncrQuery(t *testing.T) {
+	kv := NewKV()
+	if _, err := kv.CMSIncrBy("cms", []string{"a"}, []int64{1}); err != ErrCMSNoKey {
+		t.Fatalf("got %v; want ErrCMSNoKey", err)
+	}
+	if err := kv.CMSInitByDim("cms", 2000, 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := kv.CMSInitByDim("cms", 2000, 5); err != ErrCMSKeyExists {
+		t.Fatalf("got %v; want ErrCMSKeyExists", err)
+	}
+	counts, err := kv.CMSIncrBy("cms", []string{"a", "b", "a"}, []int64{3, 4, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(counts, []int64{5, 4, 5}) {
+		t.Fatalf("got %v; want [5 4 5]", counts)
+	}
+	if _, err := kv.CMSIncrBy("cms", []string{"b", "a"}, []int64{1, math.MaxUint32}); err != ErrCMSOverflow {
+		t.Fatalf("got %v; want ErrCMSOverflow", err)
+	}
+	if _, err := kv.CMSIncrBy("cms", []string{"a"}, []int64{math.MaxInt64}); err != ErrCMSOverflow {
+		t.Fatalf("got %v; want ErrCMSOverflow", err)
+	}
+	if counts, _ := kv.CMSQuery("cms", "a", "b", "c"); !slices.Equal(counts, []int64{5, 4, 0}) {
+		t.Fatalf("got %v after an overflow; want [5 4 0]", counts)
+	}
+}
+
+func TestCMSMerge(t *testing.T) {
+	kv := NewKV()
+	for _, key := range []string{"a", "b", "dst"} {
+		kv.CMSInitByDim(key, 1000, 4)
+	}
+	kv.CMSIncrBy("a", []string{"x", "y"}, []int64{2, 1})
+	kv.CMSIncrBy("b", []string{"x"}, []int64{5})
+	if err := kv.CMSMerge("dst", []string{"a", "b"}, []int64{1, 3}); err != nil {
+		t.Fatal(err)
+	}
+	if counts, _ := kv.CMSQuery("dst", "x", "y"); !slices.Equal(counts, []int64{17, 1}) {
+		t.Fatalf("got %v; want [17 1]", counts)
+	}
+
+	kv.CMSInitByDim("small", 10, 4)
+	if err := kv.CMSMerge("dst", []string{"small"}, []int64{1}); err != ErrCMSDims {
+		t.Fatalf("got %v; want ErrCMSDims", err)
+	}
+	if err := kv.CMSMerge("dst", []string{"a"}, []int64{-1}); err != ErrCMSOverflow {
+		t.Fatalf("got %v; want ErrCMSOverflow", err)
+	}
+}
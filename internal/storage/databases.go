@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+type Databases struct {
+	mu      sync.RWMutex
+	dbs     []*KV
+	stats   *Stats
+	events  *events
+	blocked *blocked
+	limits  *EncodingLimits
+
+	maxMemory atomic.Int64
+	policy    atomic.Int32
+
+	// evictMu serialises eviction and guards the fields below.
+	evictMu      sync.Mutex
+	evictionPool []evictionCandidate
+	nextEvictDB  int
+}
+
+func NewDatabases(n, shardCount int) *Databases {
+	stats := &Stats{}
+	events := &events{}
+	blocked := newBlocked()
+	limits := DefaultEncodingLimits()
+	dbs := make([]*KV, n)
+	for i := range dbs {
+		dbs[i] = newKV(shardCount, stats, events, blocked, &limits)
+		dbs[i].index.Store(int64(i))
+	}
+	return &Databases{dbs: dbs, stats: stats, events: events, blocked: blocked, limits: &limits}
+}
+
+// SetEncodingLimits replaces the compact encoding thresholds of every
+// database. It must be called before the databases are in use.
+func (d *Databases) SetEncodingLimits(limits EncodingLimits) {
+	*d.limits = limits
+}
+
+// SetLoading stops keys from expiring while the AOF is replayed.
+func (d *Databases) SetLoading(loading bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, db := range d.dbs {
+		db.loading.Store(loading)
+	}
+}
+
+func (d *Databases) Stats() *Stats {
+	return d.stats
+}
+
+func (d *Databases) Len() int {
+	return len(d.dbs)
+}
+
+func (d *Databases) valid(index int) bool {
+	return index >= 0 && index < len(d.dbs)
+}
+
+func (d *Databases) DB(index int) *KV {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.dbs[index]
+}
+
+func (d *Databases) Swap(i, j int) error {
+	if !d.valid(i) || !d.valid(j) {
+		return ErrDBIndex
+	}
+	d.mu.Lock()
+	d.dbs[i], d.dbs[j] = d.dbs[j], d.dbs[i]
+	d.dbs[i].index.Store(int64(i))
+	d.dbs[j].index.Store(int64(j))
+	d.mu.Unlock()
+
+	// clients blocked on either database now see different data
+	d.DB(i).signalAll()
+	d.DB(j).signalAll()
+	return nil
+}
+
+func (d *Databases) Move(key string, src, dst int) (bool, error) {
+	moved, err := d.move(key, src, dst)
+	if moved {
+		d.DB(dst).signalReady([]string{key})
+	}
+	return moved, err
+}
+
+func (d *Databases) move(key string, src, dst int) (bool, error) {
+	if !d.valid(src) || !d.valid(dst) {
+		return false, ErrDBIndex
+	}
+	if src == dst {
+		return false, ErrSameDB
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	from, to := d.dbs[src], d.dbs[dst]
+	fromTx := &txn{kv: from, writable: true, shards: from.shardIndexes([]string{key})}
+	toTx := &txn{kv: to, writable: true, shards: to.shardIndexes([]string{key})}
+	first, second := fromTx, toTx
+	if src > dst {
+		first, second = toTx, fromTx
+	}
+	first.lock()
+	defer first.unlock()
+	second.lock()
+	defer second.unlock()
+
+	e := fromTx.lookup(key)
+	if e == nil || toTx.lookup(key) != nil {
+		return false, nil
+	}
+
+	expireAt, hasTTL := fromTx.expireAt(key)
+	fromTx.delete(key)
+	toTx.set(key, e)
+	if hasTTL {
+		toTx.setExpireAt(key, expireAt)
+	}
+	return true, nil
+}
+
+func (d *Databases) FlushAll() {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, db := range d.dbs {
+		db.Flushdb()
+	}
+}
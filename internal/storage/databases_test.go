@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMove(t *testing.T) {
+	expireAt := time.Now().Add(time.Hour).UnixMilli()
+	tests := []struct {
+		name     string
+		src, dst int
+		// dstValue is set at the key in dst before the move when not empty
+		dstValue string
+		moved    bool
+		err      error
+		// wantSrc and wantDst are the values left at the key, "" if none
+		wantSrc, wantDst string
+	}{
+		{name: "missing in dst", src: 0, dst: 1, moved: true, wantDst: "v"},
+		{name: "exists in dst", src: 0, dst: 1, dstValue: "other", wantSrc: "v", wantDst: "other"},
+		{name: "to a lower db", src: 1, dst: 0, moved: true, wantDst: "v"},
+		{name: "same db", src: 0, dst: 0, err: ErrSameDB, wantSrc: "v", wantDst: "v"},
+		{name: "bad db", src: 0, dst: 2, err: ErrDBIndex, wantSrc: "v"},
+	}
+	for _, tt := range tests {
+		dbs := NewDatabases(2, 4)
+		dbs.DB(tt.src).Set("k", "v")
+		dbs.DB(tt.src).ExpireAt("k", expireAt, 0)
+		if tt.dstValue != "" {
+			dbs.DB(tt.dst).Set("k", tt.dstValue)
+		}
+
+		moved, err := dbs.Move("k", tt.src, tt.dst)
+		if moved != tt.moved || !errors.Is(err, tt.err) {
+			t.Fatalf("%s: got %v, %v; want %v, %v", tt.name, moved, err, tt.moved, tt.err)
+		}
+		if got, _, _ := dbs.DB(tt.src).Get("k"); got != tt.wantSrc {
+			t.Fatalf("%s: got %q in the source db; want %q", tt.name, got, tt.wantSrc)
+		}
+		if !dbs.valid(tt.dst) {
+			continue
+		}
+		if got, _, _ := dbs.DB(tt.dst).Get("k"); got != tt.wantDst {
+			t.Fatalf("%s: got %q in the destination db; want %q", tt.name, got, tt.wantDst)
+		}
+		wantTTL := int64(-1)
+		if tt.moved || tt.src == tt.dst {
+			wantTTL = expireAt
+		}
+		if got := dbs.DB(tt.dst).ExpireTime("k"); got != wantTTL {
+			t.Fatalf("%s: got expire time %d in the destination db; want %d", tt.name, got, wantTTL)
+		}
+	}
+}
+
+func TestSwap_KeepsTTLsAndWakesWaiters(t *testing.T) {
+	dbs := NewDatabases(3, 4)
+	expireAt := time.Now().Add(time.Hour).UnixMilli()
+	dbs.DB(0).RPush("q", "a")
+	dbs.DB(0).ExpireAt("q", expireAt, 0)
+	dbs.DB(1).Set("s", "v")
+	dbs.DB(1).ExpireAt("s", expireAt+1, 0)
+	w := dbs.Block(1, []string{"q"})
+	defer dbs.Unblock(w)
+	other := dbs.Block(2, []string{"q"})
+	defer dbs.Unblock(other)
+
+	if err := dbs.Swap(0, 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !isReady(w) {
+		t.Fatalf("expected the waiter on the swapped db to be woken")
+	}
+	if isReady(other) {
+		t.Fatalf("waiter on a db that wasn't swapped was woken")
+	}
+	if got := dbs.DB(1).ExpireTime("q"); got != expireAt {
+		t.Fatalf("got expire time %d for q; want %d", got, expireAt)
+	}
+	if got := dbs.DB(0).ExpireTime("s"); got != expireAt+1 {
+		t.Fatalf("got expire time %d for s; want %d", got, expireAt+1)
+	}
+	if n := dbs.DB(0).Exists("q") + dbs.DB(1).Exists("s"); n != 0 {
+		t.Fatalf("keys left behind in their old db")
+	}
+
+	if err := dbs.Swap(0, 3); !errors.Is(err, ErrDBIndex) {
+		t.Fatalf("got %v; want %v", err, ErrDBIndex)
+	}
+}
@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"hash/maphash"
+	"math/bits"
+	"math/rand/v2"
+	"unsafe"
+)
+
+const dictMinSize = 4
+
+var dictSeed = maphash.MakeSeed()
+
+type dictEntry[V any] struct {
+	key   string
+	value V
+}
+
+// dict is a chained hash table with power-of-two bucket count. Unlike a Go map
+// it exposes its buckets, which makes stateless cursor scans possible.
+type dict[V any] struct {
+	buckets   [][]dictEntry[V]
+	count     int
+	bytes     int64
+	valueSize func(V) int64
+}
+
+func newDict[V any]() *dict[V] {
+	return &dict[V]{buckets: make([][]dictEntry[V], dictMinSize)}
+}
+
+func (d *dict[V]) bucketIndex(key string) uint64 {
+	return maphash.String(dictSeed, key) & uint64(len(d.buckets)-1)
+}
+
+func (d *dict[V]) len() int {
+	return d.count
+}
+
+func (d *dict[V]) get(key string) (V, bool) {
+	for _, de := range d.buckets[d.bucketIndex(key)] {
+		if de.key == key {
+			return de.value, true
+		}
+	}
+	var zero V
+	return zero, false
+}
+
+func (d *dict[V]) set(key string, value V) (added bool) {
+	idx := d.bucketIndex(key)
+	bucket := d.buckets[idx]
+	for i := range bucket {
+		if bucket[i].key == key {
+			d.bytes += d.sizeOf(value) - d.sizeOf(bucket[i].value)
+			bucket[i].value = value
+			return false
+		}
+	}
+	d.buckets[idx] = append(bucket, dictEntry[V]{key: key, value: value})
+	d.count++
+	d.bytes += int64(len(key)) + d.sizeOf(value)
+	if d.count > len(d.buckets) {
+		d.resize(len(d.buckets) * 2)
+	}
+	return true
+}
+
+func (d *dict[V]) delete(key string) bool {
+	idx := d.bucketIndex(key)
+	bucket := d.buckets[idx]
+	for i := range bucket {
+		if bucket[i].key == key {
+			d.bytes -= int64(len(key)) + d.sizeOf(bucket[i].value)
+			last := len(bucket) - 1
+			bucket[i] = bucket[last]
+			bucket[last] = dictEntry[V]{}
+			d.buckets[idx] = bucket[:last]
+			d.count--
+			if len(d.buckets) > dictMinSize && d.count < len(d.buckets)/8 {
+				d.resize(len(d.buckets) / 2)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+func (d *dict[V]) clear() {
+	d.buckets = make([][]dictEntry[V], dictMinSize)
+	d.count = 0
+	d.bytes = 0
+}
+
+func (d *dict[V]) sizeOf(value V) int64 {
+	if d.valueSize == nil {
+		return 0
+	}
+	return d.valueSize(value)
+}
+
+// memUsage estimates the memory held by the table, the entries and the bytes
+// of keys and, when valueSize is set, of values.
+func (d *dict[V]) memUsage() int64 {
+	var de dictEntry[V]
+	return int64(unsafe.Sizeof(*d)) +
+		int64(len(d.buckets))*int64(unsafe.Sizeof(d.buckets[0])) +
+		int64(d.count)*int64(unsafe.Sizeof(de)) +
+		d.bytes
+}
+
+func (d *dict[V]) resize(size int) {
+	old := d.buckets
+	d.buckets = make([][]dictEntry[V], size)
+	for _, bucket := range old {
+		for _, de := range bucket {
+			idx := d.bucketIndex(de.key)
+			d.buckets[idx] = append(d.buckets[idx], de)
+		}
+	}
+}
+
+func (d *dict[V]) forEach(fn func(key string, value V) bool) {
+	for _, bucket := range d.buckets {
+		for _, de := range bucket {
+			if !fn(de.key, de.value) {
+				return
+			}
+		}
+	}
+}
+
+// scan visits one bucket and returns the cursor of the next one, or 0 when
+// the iteration is complete. The cursor is incremented on its reversed bits,
+// so every element present for the whole iteration is visited even if the
+// table grows or shrinks between calls.
+func (d *dict[V]) scan(cursor uint64, fn func(key string, value V)) uint64 {
+	if d.count == 0 {
+		return 0
+	}
+	mask := uint64(len(d.buckets) - 1)
+	for _, de := range d.buckets[cursor&mask] {
+		fn(de.key, de.value)
+	}
+	cursor |= ^mask
+	cursor = bits.Reverse64(cursor)
+	cursor++
+	return bits.Reverse64(cursor)
+}
+
+// random returns a random entry of a non-empty dict. Entries in sparse
+// buckets are somewhat more likely to be picked, as in Redis.
+func (d *dict[V]) random() (string, V) {
+	for {
+		bucket := d.buckets[rand.IntN(len(d.buckets))]
+		if len(bucket) > 0 {
+			de := bucket[rand.IntN(len(bucket))]
+			return de.key, de.value
+		}
+	}
+}
+
+// sample visits up to n entries starting from a random bucket. It is cheap
+// rather than uniform, which is all the expire and eviction cycles need.
+func (d *dict[V]) sample(n int, fn func(key string, value V)) {
+	if d.count == 0 {
+		return
+	}
+	mask := len(d.buckets) - 1
+	idx := rand.IntN(len(d.buckets))
+	visited := 0
+	for steps := min(n*10, len(d.buckets)); steps > 0 && visited < n; steps-- {
+		for _, de := range d.buckets[idx&mask] {
+			fn(de.key, de.value)
+			visited++
+			if visited >= n {
+				return
+			}
+		}
+		idx++
+	}
+}
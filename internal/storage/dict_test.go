@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestDict_SetGetDelete(t *testing.T) {
+	d := newDict[string]()
+	for i := 0; i < 1000; i++ {
+		if !d.set(strconv.Itoa(i), "v"+strconv.Itoa(i)) {
+			t.Fatalf("expected key %d to be added", i)
+		}
+	}
+	if d.set("10", "updated") {
+		t.Fatalf("expected existing key to be updated, not added")
+	}
+	if v, ok := d.get("10"); !ok || v != "updated" {
+		t.Fatalf("got %q, %v; want %q, true", v, ok, "updated")
+	}
+	for i := 0; i < 990; i++ {
+		if !d.delete(strconv.Itoa(i)) {
+			t.Fatalf("expected key %d to be deleted", i)
+		}
+	}
+	if d.len() != 10 {
+		t.Fatalf("expected 10 keys left, got %d", d.len())
+	}
+	if _, ok := d.get("5"); ok {
+		t.Fatalf("deleted key is still present")
+	}
+}
+
+func TestDict_ScanSurvivesResize(t *testing.T) {
+	d := newDict[struct{}]()
+	for i := 0; i < 500; i++ {
+		d.set("stable"+strconv.Itoa(i), struct{}{})
+	}
+
+	seen := make(map[string]bool)
+	cursor := uint64(0)
+	step := 0
+	for {
+		cursor = d.scan(cursor, func(key string, _ struct{}) {
+			seen[key] = true
+		})
+		// grow and shrink the table while the iteration is in progress
+		switch {
+		case step < 50:
+			for j := 0; j < 40; j++ {
+				d.set("extra"+strconv.Itoa(step*40+j), struct{}{})
+			}
+		case step < 100:
+			for j := 0; j < 40; j++ {
+				d.delete("extra" + strconv.Itoa((step-50)*40+j))
+			}
+		}
+		step++
+		if cursor == 0 {
+			break
+		}
+	}
+
+	for i := 0; i < 500; i++ {
+		if !seen["stable"+strconv.Itoa(i)] {
+			t.Fatalf("key stable%d was not returned by the scan", i)
+		}
+	}
+}
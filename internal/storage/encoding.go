@@ -0,0 +1,49 @@
+package storage
+
+// EncodingLimits are the thresholds under which collections keep a compact
+// encoding. They mirror the redis.conf options of the same names.
+type EncodingLimits struct {
+	HashMaxListpackEntries int
+	HashMaxListpackValue   int
+	SetMaxIntsetEntries    int
+	SetMaxListpackEntries  int
+	SetMaxListpackValue    int
+	ZsetMaxListpackEntries int
+	ZsetMaxListpackValue   int
+	// ListMaxListpackSize is a number of elements when positive. Values
+	// from -1 to -5 limit the encoded size to 4, 8, 16, 32 or 64 KB.
+	ListMaxListpackSize int
+	// StreamNodeMaxBytes and StreamNodeMaxEntries fill the nodes of a
+	// stream; 0 lifts the limit.
+	StreamNodeMaxBytes   int
+	StreamNodeMaxEntries int
+	// HLLSparseMaxBytes is the size past which a HyperLogLog switches to
+	// the dense encoding.
+	HLLSparseMaxBytes int
+}
+
+func DefaultEncodingLimits() EncodingLimits {
+	return EncodingLimits{
+		HashMaxListpackEntries: 128,
+		HashMaxListpackValue:   64,
+		SetMaxIntsetEntries:    512,
+		SetMaxListpackEntries:  128,
+		SetMaxListpackValue:    64,
+		ZsetMaxListpackEntries: 128,
+		ZsetMaxListpackValue:   64,
+		ListMaxListpackSize:    -2,
+		StreamNodeMaxBytes:     4096,
+		StreamNodeMaxEntries:   100,
+		HLLSparseMaxBytes:      3000,
+	}
+}
+
+// listFits reports whether a list of n elements taking size bytes may use
+// the listpack encoding.
+func (lim *EncodingLimits) listFits(n, size int) bool {
+	if lim.ListMaxListpackSize > 0 {
+		return n <= lim.ListMaxListpackSize
+	}
+	level := min(max(-lim.ListMaxListpackSize, 1), 5)
+	return size <= 4096<<(level-1)
+}
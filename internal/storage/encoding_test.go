@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestListpack_InsertReplaceDelete(t *testing.T) {
+	lp := newListpack("b", "d")
+	lp.insert(0, "a")
+	lp.insert(2, "c")
+	lp.insert(lp.len(), "e", "")
+	if got, want := lp.values(), []string{"a", "b", "c", "d", "e", ""}; !slices.Equal(got, want) {
+		t.Fatalf("got %q; want %q", got, want)
+	}
+	lp.replace(1, string(make([]byte, 300)))
+	lp.delete(2, 2)
+	if lp.len() != 4 || len(lp.at(1)) != 300 || lp.at(2) != "e" {
+		t.Fatalf("unexpected contents %q", lp.values())
+	}
+	if i := lp.index("e", 1); i != 2 {
+		t.Fatalf("got index %d; want 2", i)
+	}
+}
+
+func TestIntset_UpgradeKeepsOrder(t *testing.T) {
+	is := newIntset()
+	values := []int64{5, -3, 1 << 40, 70000, 0, -1 << 20}
+	for _, v := range values {
+		if !is.add(v) {
+			t.Fatalf("expected %d to be added", v)
+		}
+	}
+	if is.add(5) {
+		t.Fatalf("expected duplicate to be rejected")
+	}
+	if is.width != 8 {
+		t.Fatalf("got width %d; want 8", is.width)
+	}
+	slices.Sort(values)
+	for i, v := range values {
+		if got := is.get(i); got != v {
+			t.Fatalf("element %d is %d; want %d", i, got, v)
+		}
+	}
+	if !is.remove(70000) || is.contains(70000) || is.len() != len(values)-1 {
+		t.Fatalf("remove failed")
+	}
+}
+
+func TestSetEncodingConversions(t *testing.T) {
+	lim := DefaultEncodingLimits()
+	lim.SetMaxIntsetEntries = 4
+	lim.SetMaxListpackEntries = 6
+
+	e := newSetEntry(&lim, "1", "2", "3")
+	if enc := e.encoding(); enc != "intset" {
+		t.Fatalf("got %s; want intset", enc)
+	}
+	// "01" isn't the canonical form of an integer, so it must not be
+	// merged with "1"
+	e.SAdd(&lim, "01")
+	if enc := e.encoding(); enc != "listpack" {
+		t.Fatalf("got %s; want listpack", enc)
+	}
+	for i := 0; i < 3; i++ {
+		e.SAdd(&lim, "m"+strconv.Itoa(i))
+	}
+	if enc := e.encoding(); enc != "hashtable" {
+		t.Fatalf("got %s; want hashtable", enc)
+	}
+	if n, _ := e.SLen(); n != 7 {
+		t.Fatalf("got %d members; want 7", n)
+	}
+}
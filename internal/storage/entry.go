@@ -1,5 +1,14 @@
 package storage
 
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"unsafe"
+)
+
 type entryType int
 
 const (
@@ -7,92 +16,220 @@ const (
 	listType
 	setType
 	hashType
+	zsetType
+	streamType
+	bloomType
+	cmsType
+	jsonType
 )
 
 type entry struct {
 	typ  entryType
 	data any
+	// fieldExpires holds the expiration times of hash fields that have one
+	fieldExpires *dict[int64]
+
+	// access metadata for the LRU and LFU eviction policies
+	lastAccess atomic.Int64
+	lfu        atomic.Uint32
+
+	// memory accounting, see txn.charge and txn.release
+	accounted int64
+	live      bool
 }
 
 func newStringEntry(s string) *entry {
 	return &entry{typ: stringType, data: s}
 }
 
-func newListEntry(l []string) *entry {
-	return &entry{typ: listType, data: l}
+func newListEntry(lim *EncodingLimits, values []string) *entry {
+	return &entry{typ: listType, data: newListStore(lim, values)}
 }
 
-func newSetEntry(members ...string) *entry {
-	s := make(map[string]struct{})
-	for _, m := range members {
-		s[m] = struct{}{}
-	}
-	return &entry{typ: setType, data: s}
+func newSetEntry(lim *EncodingLimits, members ...string) *entry {
+	return &entry{typ: setType, data: newSetStore(lim, members)}
 }
 
 func newHashEntry() *entry {
-	m := make(map[string]string)
-	return &entry{typ: hashType, data: m}
+	return &entry{typ: hashType, data: listpackHash{newListpack()}}
+}
+
+func newZsetEntry() *entry {
+	return &entry{typ: zsetType, data: listpackZset{newListpack()}}
+}
+
+func newStreamEntry() *entry {
+	return &entry{typ: streamType, data: newStream()}
+}
+
+func (e *entry) typeName() string {
+	switch e.typ {
+	case stringType:
+		return "string"
+	case listType:
+		return "list"
+	case setType:
+		return "set"
+	case hashType:
+		return "hash"
+	case zsetType:
+		return "zset"
+	case streamType:
+		return "stream"
+	case bloomType:
+		// the names RedisBloom registers its types under
+		return "MBbloom--"
+	case cmsType:
+		return "CMSk-TYPE"
+	case jsonType:
+		return "ReJSON-RL"
+	default:
+		return "none"
+	}
 }
 
+// String returns a copy of the value. Strings are stored as a Go string
+// until a command modifies them in place, from then on as a []byte.
 func (e *entry) String() (string, error) {
 	if e.typ != stringType {
 		return "", ErrWrongType
 	}
-	return e.data.(string), nil
+	switch v := e.data.(type) {
+	case []byte:
+		return string(v), nil
+	default:
+		return v.(string), nil
+	}
 }
 
-func (e *entry) List() ([]string, error) {
-	if e.typ != listType {
-		return []string{}, ErrWrongType
+// view returns the value without copying it. The result aliases the
+// entry and is only valid while the shard lock is held.
+func (e *entry) view() (string, error) {
+	if e.typ != stringType {
+		return "", ErrWrongType
+	}
+	switch v := e.data.(type) {
+	case []byte:
+		return unsafe.String(unsafe.SliceData(v), len(v)), nil
+	default:
+		return v.(string), nil
 	}
-	return e.data.([]string), nil
 }
 
-func (e *entry) PushLeft(values ...string) (int, error) {
-	if e.typ != listType {
-		return 0, ErrWrongType
+func (e *entry) StrLen() (int, error) {
+	v, err := e.view()
+	return len(v), err
+}
+
+// mutableBytes switches the value to its []byte form, growing it with zero
+// bytes to at least size, and returns it for in-place modification. It must
+// only be called under a write lock.
+func (e *entry) mutableBytes(size int) ([]byte, error) {
+	if e.typ != stringType {
+		return nil, ErrWrongType
+	}
+	b, ok := e.data.([]byte)
+	if !ok {
+		b = []byte(e.data.(string))
 	}
-	e.data = append(values, e.data.([]string)...)
-	return len(e.data.([]string)), nil
+	if len(b) < size {
+		b = append(b, make([]byte, size-len(b))...)
+	}
+	e.data = b
+	return b, nil
+}
+
+// Append appends value in place, so that growing a string by small pieces
+// doesn't copy it every time.
+func (e *entry) Append(value string) (int, error) {
+	b, err := e.mutableBytes(0)
+	if err != nil {
+		return 0, err
+	}
+	b = append(b, value...)
+	e.data = b
+	return len(b), nil
+}
+
+func (e *entry) list() listStore {
+	return e.data.(listStore)
+}
+
+func (e *entry) set() setStore {
+	return e.data.(setStore)
+}
+
+func (e *entry) hash() hashStore {
+	return e.data.(hashStore)
+}
+
+func (e *entry) zset() zsetStore {
+	return e.data.(zsetStore)
+}
+
+func (e *entry) stream() *stream {
+	return e.data.(*stream)
+}
+
+func (e *entry) bloom() *bloomFilter {
+	return e.data.(*bloomFilter)
+}
+
+func (e *entry) cms() *countMinSketch {
+	return e.data.(*countMinSketch)
 }
 
-func (e *entry) PushRight(values ...string) (int, error) {
+func (e *entry) json() *jsonDoc {
+	return e.data.(*jsonDoc)
+}
+
+func (e *entry) PushLeft(lim *EncodingLimits, values ...string) (int, error) {
 	if e.typ != listType {
 		return 0, ErrWrongType
 	}
-	e.data = append(e.data.([]string), values...)
-	return len(e.data.([]string)), nil
+	l := e.growList(lim, values)
+	l.pushLeft(values...)
+	return l.len(), nil
 }
 
-func (e *entry) PopLeft() (string, error) {
+func (e *entry) PushRight(lim *EncodingLimits, values ...string) (int, error) {
 	if e.typ != listType {
-		return "", ErrWrongType
+		return 0, ErrWrongType
 	}
+	l := e.growList(lim, values)
+	l.pushRight(values...)
+	return l.len(), nil
+}
 
-	l := e.data.([]string)
-	if len(l) == 0 {
-		return "", nil
-	}
+// growList converts the list, if needed, so that it can take values.
+func (e *entry) growList(lim *EncodingLimits, values []string) listStore {
+	l := e.list()
+	l = convertListFor(lim, l, l.len()+len(values), l.size()+len(encodeListpackValues(values)))
+	e.data = l
+	return l
+}
 
-	popped := l[0]
-	e.data = l[1:]
-	return popped, nil
+// shrinkList gives a list that shrank the chance to go back to a listpack.
+func (e *entry) shrinkList(lim *EncodingLimits) {
+	l := e.list()
+	e.data = convertListFor(lim, l, l.len(), l.size())
 }
 
-func (e *entry) PopRight() (string, error) {
+func (e *entry) PopLeft(lim *EncodingLimits) (string, error) {
 	if e.typ != listType {
 		return "", ErrWrongType
 	}
+	popped, _ := e.list().popLeft()
+	e.shrinkList(lim)
+	return popped, nil
+}
 
-	l := e.data.([]string)
-	if len(l) == 0 {
-		return "", nil
+func (e *entry) PopRight(lim *EncodingLimits) (string, error) {
+	if e.typ != listType {
+		return "", ErrWrongType
 	}
-
-	lstIndex := len(l) - 1
-	popped := l[lstIndex]
-	e.data = l[:lstIndex]
+	popped, _ := e.list().popRight()
+	e.shrinkList(lim)
 	return popped, nil
 }
 
@@ -100,7 +237,7 @@ func (e *entry) LLen() (int, error) {
 	if e.typ != listType {
 		return 0, ErrWrongType
 	}
-	return len(e.data.([]string)), nil
+	return e.list().len(), nil
 }
 
 func adjustNegIndex(idx, length int) int {
@@ -111,45 +248,185 @@ func adjustNegIndex(idx, length int) int {
 	return idxAdj
 }
 
+// normalizeRange turns start and stop, counted from the end when negative,
+// into inclusive bounds within a list of length n. It returns false if the
+// range is empty.
+func normalizeRange(start, stop, n int) (int, int, bool) {
+	if start < 0 {
+		start = adjustNegIndex(start, n)
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start > stop || start >= n {
+		return 0, 0, false
+	}
+	return start, min(stop, n-1), true
+}
+
+// normalizeIndex turns an index counted from the end when negative into a
+// position in a list of length n, and reports whether it is in range.
+func normalizeIndex(idx, n int) (int, bool) {
+	if idx < 0 {
+		idx += n
+	}
+	return idx, idx >= 0 && idx < n
+}
+
 func (e *entry) LRange(start, stop int) ([]string, error) {
 	if e.typ != listType {
 		return []string{}, ErrWrongType
 	}
-
-	l := e.data.([]string)
-	if len(l) == 0 {
+	l := e.list()
+	start, stop, ok := normalizeRange(start, stop, l.len())
+	if !ok {
 		return []string{}, nil
 	}
+	return l.rangeItems(start, stop), nil
+}
 
-	startAdj := start
-	if start < 0 {
-		startAdj = adjustNegIndex(start, len(l))
+func (e *entry) LIndex(idx int) (string, bool, error) {
+	if e.typ != listType {
+		return "", false, ErrWrongType
+	}
+	l := e.list()
+	idx, ok := normalizeIndex(idx, l.len())
+	if !ok {
+		return "", false, nil
 	}
+	return l.index(idx), true, nil
+}
 
-	stopAdj := stop
-	if stop < 0 {
-		stopAdj = adjustNegIndex(stop, len(l))
+func (e *entry) LSet(lim *EncodingLimits, idx int, value string) error {
+	if e.typ != listType {
+		return ErrWrongType
 	}
+	idx, ok := normalizeIndex(idx, e.list().len())
+	if !ok {
+		return ErrOutOfRange
+	}
+	// growList counts one extra element, which is fine for a threshold check
+	e.growList(lim, []string{value}).set(idx, value)
+	e.shrinkList(lim)
+	return nil
+}
 
-	if startAdj > stopAdj || startAdj >= len(l) {
-		return []string{}, nil
+// LInsert inserts value before or after the first occurrence of pivot and
+// returns the new length, or -1 if pivot wasn't found.
+func (e *entry) LInsert(lim *EncodingLimits, before bool, pivot, value string) (int, error) {
+	if e.typ != listType {
+		return 0, ErrWrongType
 	}
+	pos := -1
+	e.list().forEach(func(i int, v string) bool {
+		if v == pivot {
+			pos = i
+			return false
+		}
+		return true
+	})
+	if pos < 0 {
+		return -1, nil
+	}
+	if !before {
+		pos++
+	}
+	l := e.growList(lim, []string{value})
+	l.insert(pos, value)
+	return l.len(), nil
+}
 
-	if stopAdj >= len(l) {
-		stopAdj = len(l) - 1
+// LRem removes up to count occurrences of value, scanning from the tail
+// when count is negative, or all of them when it is zero.
+func (e *entry) LRem(lim *EncodingLimits, count int, value string) (int, error) {
+	if e.typ != listType {
+		return 0, ErrWrongType
+	}
+	l := e.list()
+	var matches []int
+	collect := func(i int, v string) bool {
+		if v == value {
+			matches = append(matches, i)
+		}
+		return count == 0 || len(matches) < max(count, -count)
+	}
+	if count < 0 {
+		l.forEachReverse(collect)
+	} else {
+		l.forEach(collect)
+	}
+	// delete from the highest index so that the others stay valid
+	if count >= 0 {
+		slices.Reverse(matches)
+	}
+	for _, i := range matches {
+		l.delete(i, 1)
+	}
+	e.shrinkList(lim)
+	return len(matches), nil
+}
+
+// LTrim keeps only the elements between start and stop, both inclusive.
+func (e *entry) LTrim(lim *EncodingLimits, start, stop int) error {
+	if e.typ != listType {
+		return ErrWrongType
+	}
+	l := e.list()
+	n := l.len()
+	start, stop, ok := normalizeRange(start, stop, n)
+	if !ok {
+		l.delete(0, n)
+		return nil
 	}
-	return l[startAdj : stopAdj+1], nil
+	l.delete(stop+1, n-stop-1)
+	l.delete(0, start)
+	e.shrinkList(lim)
+	return nil
 }
 
-func (e *entry) SAdd(members ...string) (int, error) {
+// LPos returns the indexes of the elements equal to value. It skips the
+// first |rank|-1 matches, scanning from the tail when rank is negative,
+// stops after count matches unless count is 0, and compares at most maxLen
+// elements unless maxLen is 0.
+func (e *entry) LPos(value string, rank, count, maxLen int) ([]int, error) {
+	if e.typ != listType {
+		return nil, ErrWrongType
+	}
+	skip := max(rank, -rank) - 1
+	var positions []int
+	compared := 0
+	visit := func(i int, v string) bool {
+		if maxLen > 0 && compared >= maxLen {
+			return false
+		}
+		compared++
+		if v != value {
+			return true
+		}
+		if skip > 0 {
+			skip--
+			return true
+		}
+		positions = append(positions, i)
+		return count == 0 || len(positions) < count
+	}
+	if rank < 0 {
+		e.list().forEachReverse(visit)
+	} else {
+		e.list().forEach(visit)
+	}
+	return positions, nil
+}
+
+func (e *entry) SAdd(lim *EncodingLimits, members ...string) (int, error) {
 	if e.typ != setType {
 		return 0, ErrWrongType
 	}
-	set := e.data.(map[string]struct{})
+	set := convertSetFor(lim, e.set(), e.set().len()+len(members), members...)
+	e.data = set
 	cnt := 0
 	for _, m := range members {
-		if _, exists := set[m]; !exists {
-			set[m] = struct{}{}
+		if set.add(m) {
 			cnt++
 		}
 	}
@@ -161,11 +438,12 @@ func (e *entry) SMembers() ([]string, error) {
 		return []string{}, ErrWrongType
 	}
 
-	set := e.data.(map[string]struct{})
-	members := make([]string, 0, len(set))
-	for member := range set {
+	set := e.set()
+	members := make([]string, 0, set.len())
+	set.forEach(func(member string) bool {
 		members = append(members, member)
-	}
+		return true
+	})
 	return members, nil
 }
 
@@ -173,13 +451,7 @@ func (e *entry) SIsMember(member string) (bool, error) {
 	if e.typ != setType {
 		return false, ErrWrongType
 	}
-
-	set := e.data.(map[string]struct{})
-	_, exists := set[member]
-	if !exists {
-		return false, nil
-	}
-	return true, nil
+	return e.set().contains(member), nil
 }
 
 func (e *entry) SRem(members ...string) (int, error) {
@@ -187,10 +459,9 @@ func (e *entry) SRem(members ...string) (int, error) {
 		return 0, ErrWrongType
 	}
 	cnt := 0
-	set := e.data.(map[string]struct{})
+	set := e.set()
 	for _, m := range members {
-		if _, exists := set[m]; exists {
-			delete(set, m)
+		if set.remove(m) {
 			cnt++
 		}
 	}
@@ -201,31 +472,191 @@ func (e *entry) SLen() (int, error) {
 	if e.typ != setType {
 		return 0, ErrWrongType
 	}
-	return len(e.data.(map[string]struct{})), nil
+	return e.set().len(), nil
 }
 
-func (e *entry) HSet(field, value string) (bool, error) {
+// SRandMembers returns count random members. If distinct, no member is
+// returned twice and the result is capped at the size of the set.
+func (e *entry) SRandMembers(count int, distinct bool) ([]string, error) {
+	if e.typ != setType {
+		return nil, ErrWrongType
+	}
+	set := e.set()
+	if set.len() == 0 || count <= 0 {
+		return []string{}, nil
+	}
+	if !distinct {
+		members := make([]string, count)
+		for i := range members {
+			members[i] = set.random()
+		}
+		return members, nil
+	}
+
+	if count > set.len()/3 {
+		// a large share of the set: shuffling it is cheaper than retrying
+		members, _ := e.SMembers()
+		rand.Shuffle(len(members), func(i, j int) { members[i], members[j] = members[j], members[i] })
+		return members[:min(count, len(members))], nil
+	}
+	picked := make(map[string]struct{}, count)
+	members := make([]string, 0, count)
+	for len(members) < count {
+		m := set.random()
+		if _, dup := picked[m]; !dup {
+			picked[m] = struct{}{}
+			members = append(members, m)
+		}
+	}
+	return members, nil
+}
+
+// HSet sets the given field/value pairs and returns how many fields were
+// added rather than updated. The fields lose their TTL.
+func (e *entry) HSet(lim *EncodingLimits, pairs ...string) (int, error) {
+	added, err := e.hsetKeepTTL(lim, pairs...)
+	for i := 0; err == nil && i < len(pairs); i += 2 {
+		e.persistField(pairs[i])
+	}
+	return added, err
+}
+
+func (e *entry) hsetKeepTTL(lim *EncodingLimits, pairs ...string) (int, error) {
 	if e.typ != hashType {
-		return false, ErrWrongType
+		return 0, ErrWrongType
+	}
+	h := convertHashFor(lim, e.hash(), e.hash().len()+len(pairs)/2, pairs...)
+	e.data = h
+	added := 0
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if h.set(pairs[i], pairs[i+1]) {
+			added++
+		}
+	}
+	return added, nil
+}
+
+func (e *entry) HDel(fields ...string) (int, error) {
+	if e.typ != hashType {
+		return 0, ErrWrongType
+	}
+	deleted := 0
+	for _, f := range fields {
+		if e.hash().delete(f) {
+			e.persistField(f)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (e *entry) HLen() (int, error) {
+	if e.typ != hashType {
+		return 0, ErrWrongType
+	}
+	return e.hash().len(), nil
+}
+
+// HIncrBy adds delta to the integer stored in field, which starts at 0.
+func (e *entry) HIncrBy(lim *EncodingLimits, field string, delta int64) (int64, error) {
+	if e.typ != hashType {
+		return 0, ErrWrongType
+	}
+	var current int64
+	if val, exists := e.hash().get(field); exists {
+		var err error
+		if current, err = strconv.ParseInt(val, 10, 64); err != nil {
+			return 0, ErrHashNotInt
+		}
+	}
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		return 0, ErrOverflow
 	}
-	m := e.data.(map[string]string)
-	_, exists := m[field]
-	m[field] = value
-	return !exists, nil
+	current += delta
+	e.hsetKeepTTL(lim, field, strconv.FormatInt(current, 10))
+	return current, nil
+}
+
+// HIncrByFloat adds delta to the number stored in field and returns the
+// result formatted the way it is stored.
+func (e *entry) HIncrByFloat(lim *EncodingLimits, field string, delta float64) (string, error) {
+	if e.typ != hashType {
+		return "", ErrWrongType
+	}
+	var current float64
+	if val, exists := e.hash().get(field); exists {
+		var err error
+		current, err = strconv.ParseFloat(val, 64)
+		if err != nil || math.IsNaN(current) || math.IsInf(current, 0) {
+			return "", ErrHashNotFloat
+		}
+	}
+	sum := current + delta
+	if math.IsNaN(sum) || math.IsInf(sum, 0) {
+		return "", ErrNaN
+	}
+	result := strconv.FormatFloat(sum, 'f', -1, 64)
+	e.hsetKeepTTL(lim, field, result)
+	return result, nil
+}
+
+// HRandFields returns count random fields and their values. If distinct, no
+// field is returned twice and the result is capped at the size of the hash.
+func (e *entry) HRandFields(count int, distinct bool) (fields, values []string, err error) {
+	if e.typ != hashType {
+		return nil, nil, ErrWrongType
+	}
+	h := e.hash()
+	if h.len() == 0 || count <= 0 {
+		return []string{}, []string{}, nil
+	}
+	if !distinct {
+		fields, values = make([]string, count), make([]string, count)
+		for i := range fields {
+			fields[i], values[i] = h.random()
+		}
+		return fields, values, nil
+	}
+
+	if count > h.len()/3 {
+		// a large share of the hash: shuffling it is cheaper than retrying
+		flat, _ := e.HGetAll()
+		pairs := h.len()
+		perm := rand.Perm(pairs)[:min(count, pairs)]
+		for _, i := range perm {
+			fields = append(fields, flat[2*i])
+			values = append(values, flat[2*i+1])
+		}
+		return fields, values, nil
+	}
+	picked := make(map[string]struct{}, count)
+	for len(fields) < count {
+		f, v := h.random()
+		if _, dup := picked[f]; !dup {
+			picked[f] = struct{}{}
+			fields, values = append(fields, f), append(values, v)
+		}
+	}
+	return fields, values, nil
 }
 
 func (e *entry) HGet(field string) (string, bool, error) {
 	if e.typ != hashType {
 		return "", false, ErrWrongType
 	}
-	m := e.data.(map[string]string)
-	value, exists := m[field]
+	value, exists := e.hash().get(field)
 	return value, exists, nil
 }
 
-func (e *entry) HGetAll() (map[string]string, error) {
+func (e *entry) HGetAll() ([]string, error) {
 	if e.typ != hashType {
-		return map[string]string{}, ErrWrongType
+		return []string{}, ErrWrongType
 	}
-	return e.data.(map[string]string), nil
+	h := e.hash()
+	flat := make([]string, 0, h.len()*2)
+	h.forEach(func(field, value string) bool {
+		flat = append(flat, field, value)
+		return true
+	})
+	return flat, nil
 }
@@ -5,7 +5,49 @@ import (
 )
 
 var (
-	ErrNotInteger = errors.New("value is not an integer or out of range")
-	ErrOverflow   = errors.New("increment or decrement would overflow")
-	ErrWrongType  = errors.New("wrong type")
+	ErrNotInteger   = errors.New("value is not an integer or out of range")
+	ErrOverflow     = errors.New("increment or decrement would overflow")
+	ErrWrongType    = errors.New("wrong type")
+	ErrDBIndex      = errors.New("DB index is out of range")
+	ErrSameDB       = errors.New("source and destination objects are the same")
+	ErrOOM          = errors.New("command not allowed when used memory > 'maxmemory'")
+	ErrNotFloat     = errors.New("value is not a valid float")
+	ErrNaN          = errors.New("increment would produce NaN or Infinity")
+	ErrTooLarge     = errors.New("string exceeds maximum allowed size (proto-max-bulk-len)")
+	ErrNoSuchKey    = errors.New("no such key")
+	ErrOutOfRange   = errors.New("index out of range")
+	ErrHashNotInt   = errors.New("hash value is not an integer")
+	ErrHashNotFloat = errors.New("hash value is not a float")
+	ErrScoreNaN     = errors.New("resulting score is not a number (NaN)")
+	ErrGeoMember    = errors.New("could not decode requested zset member")
+
+	ErrStreamIDTooSmall = errors.New("The ID specified in XADD is equal or smaller than the target stream top item")
+	ErrStreamIDZero     = errors.New("The ID specified in XADD must be greater than 0-0")
+	ErrStreamExhausted  = errors.New("The stream has exhausted the last possible ID, unable to add more items")
+	ErrStreamKey        = errors.New("The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+	ErrBusyGroup        = errors.New("Consumer Group name already exists")
+	// ErrNoGroup is reported with the key and group names by each command.
+	ErrNoGroup = errors.New("no such consumer group")
+
+	ErrNotHLL     = errors.New("Key is not a valid HyperLogLog string value.")
+	ErrHLLCorrupt = errors.New("Corrupted HLL object detected")
+
+	ErrItemExists     = errors.New("item exists")
+	ErrNotFound       = errors.New("not found")
+	ErrBloomFull      = errors.New("non scaling filter is full")
+	ErrFilterTooLarge = errors.New("filter would exceed the maximum allowed size")
+	// The Count-Min Sketch errors are replied as they are, like RedisBloom.
+	ErrCMSKeyExists = errors.New("CMS: key already exists")
+	ErrCMSNoKey     = errors.New("CMS: key does not exist")
+	ErrCMSDims      = errors.New("CMS: width/depth is not equal")
+	ErrCMSOverflow  = errors.New("CMS: INCRBY overflow")
+
+	// ErrJSONInvalid, ErrJSONNoPath and ErrJSONType are returned wrapped,
+	// with what was wrong.
+	ErrJSONInvalid = errors.New("invalid JSON")
+	ErrJSONPath    = errors.New("invalid JSON path")
+	ErrJSONNoPath  = errors.New("path does not exist")
+	ErrJSONType    = errors.New("wrong type of path value")
+	ErrJSONNewRoot = errors.New("new objects must be created at the root")
+	ErrJSONNoKey   = errors.New("could not perform this operation on a key that doesn't exist")
 )
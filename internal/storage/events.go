@@ -0,0 +1,30 @@
+package storage
+
+import "sync"
+
+// EventListener receives keyspace events such as "expired". It is called
+// while the database is locked and must not call back into storage.
+type EventListener func(db int, event, key string)
+
+type events struct {
+	mu        sync.RWMutex
+	listeners []EventListener
+}
+
+func (ev *events) subscribe(fn EventListener) {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	ev.listeners = append(ev.listeners, fn)
+}
+
+func (ev *events) notify(s *KV, event, key string) {
+	ev.mu.RLock()
+	defer ev.mu.RUnlock()
+	for _, fn := range ev.listeners {
+		fn(int(s.index.Load()), event, key)
+	}
+}
+
+func (d *Databases) OnKeyspaceEvent(fn EventListener) {
+	d.events.subscribe(fn)
+}
@@ -0,0 +1,274 @@
+package storage
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"time"
+)
+
+type EvictionPolicy int32
+
+const (
+	NoEviction EvictionPolicy = iota
+	AllKeysLRU
+	VolatileLRU
+	AllKeysLFU
+	VolatileLFU
+	AllKeysRandom
+	VolatileRandom
+	VolatileTTL
+)
+
+var evictionPolicyNames = []string{
+	NoEviction:     "noeviction",
+	AllKeysLRU:     "allkeys-lru",
+	VolatileLRU:    "volatile-lru",
+	AllKeysLFU:     "allkeys-lfu",
+	VolatileLFU:    "volatile-lfu",
+	AllKeysRandom:  "allkeys-random",
+	VolatileRandom: "volatile-random",
+	VolatileTTL:    "volatile-ttl",
+}
+
+func ParseEvictionPolicy(name string) (EvictionPolicy, error) {
+	for p, n := range evictionPolicyNames {
+		if strings.EqualFold(name, n) {
+			return EvictionPolicy(p), nil
+		}
+	}
+	return NoEviction, fmt.Errorf("unknown eviction policy %q", name)
+}
+
+func (p EvictionPolicy) String() string {
+	return evictionPolicyNames[p]
+}
+
+func (p EvictionPolicy) volatile() bool {
+	return p == VolatileLRU || p == VolatileLFU || p == VolatileRandom || p == VolatileTTL
+}
+
+const (
+	evictionPoolSize      = 16
+	evictionSamplesPerDB  = 5
+	lfuInitVal            = 5
+	lfuLogFactor          = 10
+	lfuDecayTimeInMinutes = 1
+)
+
+// initAccess resets the access metadata of an entry that was just linked
+// into the keyspace. New keys start with a small LFU counter so they are not
+// evicted before they had a chance to be accessed.
+func (e *entry) initAccess() {
+	e.lastAccess.Store(time.Now().UnixMilli())
+	e.lfu.Store(lfuMinutes()<<8 | lfuInitVal)
+}
+
+// touch records an access for both the LRU and LFU policies.
+func (e *entry) touch() {
+	e.lastAccess.Store(time.Now().UnixMilli())
+	counter := lfuLogIncr(e.lfuCounter())
+	e.lfu.Store(lfuMinutes()<<8 | uint32(counter))
+}
+
+func (e *entry) idleTime() time.Duration {
+	return time.Duration(time.Now().UnixMilli()-e.lastAccess.Load()) * time.Millisecond
+}
+
+// lfuCounter returns the logarithmic access counter, decremented by one for
+// every lfuDecayTimeInMinutes since the last access.
+func (e *entry) lfuCounter() uint8 {
+	lfu := e.lfu.Load()
+	counter := lfu & 0xFF
+	elapsed := (lfuMinutes() - lfu>>8) & 0xFFFF
+	periods := elapsed / lfuDecayTimeInMinutes
+	if periods >= counter {
+		return 0
+	}
+	return uint8(counter - periods)
+}
+
+func lfuMinutes() uint32 {
+	return uint32(time.Now().Unix()/60) & 0xFFFF
+}
+
+// lfuLogIncr increments the counter with a probability that falls as the
+// counter grows, so 255 stands for about a million accesses.
+func lfuLogIncr(counter uint8) uint8 {
+	if counter == math.MaxUint8 {
+		return counter
+	}
+	base := max(int(counter)-lfuInitVal, 0)
+	if rand.Float64() < 1/float64(base*lfuLogFactor+1) {
+		counter++
+	}
+	return counter
+}
+
+type evictionCandidate struct {
+	score int64
+	db    *KV
+	key   string
+}
+
+func (d *Databases) SetMaxMemory(bytes int64, policy EvictionPolicy) {
+	d.maxMemory.Store(bytes)
+	d.policy.Store(int32(policy))
+}
+
+func (d *Databases) MaxMemory() int64 {
+	return d.maxMemory.Load()
+}
+
+func (d *Databases) EvictionPolicy() EvictionPolicy {
+	return EvictionPolicy(d.policy.Load())
+}
+
+// FreeMemoryIfNeeded evicts keys according to the eviction policy until used
+// memory is back under maxmemory. It returns ErrOOM if that is not possible.
+func (d *Databases) FreeMemoryIfNeeded() error {
+	limit := d.MaxMemory()
+	if limit == 0 || d.UsedMemory() <= limit {
+		return nil
+	}
+	policy := d.EvictionPolicy()
+	if policy == NoEviction {
+		return ErrOOM
+	}
+
+	d.evictMu.Lock()
+	defer d.evictMu.Unlock()
+
+	d.mu.RLock()
+	dbs := slices.Clone(d.dbs)
+	d.mu.RUnlock()
+
+	for d.UsedMemory() > limit {
+		var evicted bool
+		if policy == AllKeysRandom || policy == VolatileRandom {
+			evicted = d.evictRandom(dbs, policy)
+		} else {
+			evicted = d.evictFromPool(dbs, policy)
+		}
+		if !evicted {
+			return ErrOOM
+		}
+	}
+	return nil
+}
+
+func (d *Databases) evictRandom(dbs []*KV, policy EvictionPolicy) bool {
+	for range dbs {
+		db := dbs[d.nextEvictDB%len(dbs)]
+		d.nextEvictDB++
+		var keys []string
+		db.evictionSample(policy, 1, func(key string, e *entry, expireAt int64) {
+			keys = append(keys, key)
+		})
+		if len(keys) > 0 && db.evict(keys[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+// evictFromPool refills the eviction pool with samples from every database
+// and evicts the best candidate. The pool survives between calls so good
+// candidates found earlier are not lost, and candidates that were deleted or
+// recreated in the meantime are simply skipped.
+func (d *Databases) evictFromPool(dbs []*KV, policy EvictionPolicy) bool {
+	for _, db := range dbs {
+		db.evictionSample(policy, evictionSamplesPerDB, func(key string, e *entry, expireAt int64) {
+			d.addEvictionCandidate(evictionCandidate{score: evictionScore(policy, e, expireAt), db: db, key: key})
+		})
+	}
+	for len(d.evictionPool) > 0 {
+		best := d.evictionPool[len(d.evictionPool)-1]
+		d.evictionPool = d.evictionPool[:len(d.evictionPool)-1]
+		if best.db.evict(best.key) {
+			return true
+		}
+	}
+	return false
+}
+
+// addEvictionCandidate keeps the pool sorted by ascending score and at most
+// evictionPoolSize long.
+func (d *Databases) addEvictionCandidate(c evictionCandidate) {
+	for i, existing := range d.evictionPool {
+		if existing.db == c.db && existing.key == c.key {
+			d.evictionPool = slices.Delete(d.evictionPool, i, i+1)
+			break
+		}
+	}
+	idx, _ := slices.BinarySearchFunc(d.evictionPool, c.score, func(e evictionCandidate, score int64) int {
+		return cmp.Compare(e.score, score)
+	})
+	if len(d.evictionPool) == evictionPoolSize {
+		if idx == 0 {
+			return
+		}
+		d.evictionPool = d.evictionPool[1:]
+		idx--
+	}
+	d.evictionPool = slices.Insert(d.evictionPool, idx, c)
+}
+
+// evictionScore is higher for better eviction candidates.
+func evictionScore(policy EvictionPolicy, e *entry, expireAt int64) int64 {
+	switch policy {
+	case AllKeysLFU, VolatileLFU:
+		return math.MaxUint8 - int64(e.lfuCounter())
+	case VolatileTTL:
+		return math.MaxInt64 - expireAt
+	default:
+		return int64(e.idleTime())
+	}
+}
+
+// evictionSample visits up to n keys from a random non-empty shard. Volatile
+// policies only sample keys with a TTL.
+func (s *KV) evictionSample(policy EvictionPolicy, n int, fn func(key string, e *entry, expireAt int64)) {
+	start := rand.IntN(len(s.shards))
+	for i := range s.shards {
+		sh := s.shards[(start+i)%len(s.shards)]
+		sampled := 0
+		sh.mu.RLock()
+		if policy.volatile() {
+			sh.expires.sample(n, func(key string, expireAt int64) {
+				if e, exists := sh.data.get(key); exists {
+					fn(key, e, expireAt)
+					sampled++
+				}
+			})
+		} else {
+			sh.data.sample(n, func(key string, e *entry) {
+				fn(key, e, 0)
+				sampled++
+			})
+		}
+		sh.mu.RUnlock()
+		if sampled > 0 {
+			return
+		}
+	}
+}
+
+func (s *KV) evict(key string) bool {
+	evicted := false
+	s.update([]string{key}, func(tx *txn) error {
+		if tx.lookup(key) == nil {
+			return nil
+		}
+		evicted = tx.delete(key)
+		return nil
+	})
+	if evicted {
+		s.stats.evictedKeys.Add(1)
+		s.events.notify(s, "evicted", key)
+	}
+	return evicted
+}
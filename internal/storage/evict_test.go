@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestFreeMemoryIfNeeded_EvictsUntilUnderLimit(t *testing.T) {
+	dbs := NewDatabases(2, 4)
+	value := strings.Repeat("x", 100)
+	for i := 0; i < 1000; i++ {
+		dbs.DB(i%2).Set("key"+strconv.Itoa(i), value)
+	}
+	limit := dbs.UsedMemory() / 2
+	dbs.SetMaxMemory(limit, AllKeysLRU)
+
+	if err := dbs.FreeMemoryIfNeeded(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if used := dbs.UsedMemory(); used > limit {
+		t.Fatalf("used memory %d is still over the limit %d", used, limit)
+	}
+	if dbs.Stats().EvictedKeys() == 0 {
+		t.Fatalf("expected evicted keys to be counted")
+	}
+}
+
+func TestFreeMemoryIfNeeded_OOM(t *testing.T) {
+	dbs := NewDatabases(1, 4)
+	dbs.DB(0).Set("key", "value")
+	dbs.SetMaxMemory(1, NoEviction)
+	if err := dbs.FreeMemoryIfNeeded(); !errors.Is(err, ErrOOM) {
+		t.Fatalf("got %v; want ErrOOM", err)
+	}
+
+	// volatile policies can't evict keys without a TTL
+	dbs.SetMaxMemory(1, VolatileLRU)
+	if err := dbs.FreeMemoryIfNeeded(); !errors.Is(err, ErrOOM) {
+		t.Fatalf("got %v; want ErrOOM", err)
+	}
+	dbs.DB(0).Delete("key")
+	if used := dbs.UsedMemory(); used != 0 {
+		t.Fatalf("used memory is %d after deleting every key", used)
+	}
+}
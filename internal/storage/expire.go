@@ -0,0 +1,107 @@
+package storage
+
+import "time"
+
+const (
+	activeExpireKeysPerLoop     = 20
+	activeExpireAcceptableStale = 10
+	activeExpireCycleTimePerc   = 25
+)
+
+// ActiveExpire runs the active expire cycle every interval. Each cycle samples
+// random keys with a TTL in every database and deletes the expired ones,
+// repeating while more than activeExpireAcceptableStale percent of a sample
+// was expired and the cycle still fits in its CPU time budget.
+func (d *Databases) ActiveExpire(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	nextDB := 0
+	for {
+		select {
+		case <-ticker.C:
+			nextDB = d.activeExpireCycle(nextDB, interval*activeExpireCycleTimePerc/100)
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (d *Databases) activeExpireCycle(startDB int, timeLimit time.Duration) (nextDB int) {
+	start := time.Now()
+	totalSampled, totalExpired := 0, 0
+	defer func() {
+		if totalSampled > 0 {
+			d.stats.updateStalePerc(float64(totalExpired) / float64(totalSampled) * 100)
+		}
+	}()
+
+	for i := 0; i < len(d.dbs); i++ {
+		dbIndex := (startDB + i) % len(d.dbs)
+		db := d.DB(dbIndex)
+		for {
+			sampled, expired := db.expireSample(activeExpireKeysPerLoop)
+			totalSampled += sampled
+			totalExpired += expired
+			if time.Since(start) > timeLimit {
+				d.stats.expiredTimeCapReached.Add(1)
+				return dbIndex
+			}
+			if sampled == 0 || expired*100 <= sampled*activeExpireAcceptableStale {
+				break
+			}
+		}
+	}
+	return startDB
+}
+
+// expireSample samples up to n keys with a TTL, going through the shards
+// round-robin from where the last call stopped, so a sample only comes back
+// empty when no shard has keys with a TTL.
+func (s *KV) expireSample(n int) (sampled, expired int) {
+	for range len(s.shards) {
+		if sampled >= n {
+			break
+		}
+		sh := s.shards[(s.expireCursor.Add(1)-1)%uint64(len(s.shards))]
+		shSampled, shExpired := s.expireSampleShard(sh, n-sampled)
+		sampled += shSampled
+		expired += shExpired
+	}
+	return sampled, expired
+}
+
+func (s *KV) expireSampleShard(sh *shard, n int) (sampled, expired int) {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	now := time.Now().UnixMilli()
+	var expiredKeys []string
+	sh.expires.sample(n, func(key string, expireAt int64) {
+		sampled++
+		if expireAt <= now {
+			expiredKeys = append(expiredKeys, key)
+		}
+	})
+	for _, key := range expiredKeys {
+		if _, exists := sh.data.get(key); exists {
+			s.deleteExpired(sh, key)
+			expired++
+		}
+	}
+
+	// hashes whose next field TTL has passed count as one expired sample
+	var expiredHashes []string
+	sh.fieldExpires.sample(n, func(key string, next int64) {
+		sampled++
+		if next <= now {
+			expiredHashes = append(expiredHashes, key)
+		}
+	})
+	for _, key := range expiredHashes {
+		if e, exists := sh.data.get(key); exists {
+			s.expireFields(sh, key, e, now)
+			expired++
+		}
+	}
+	return sampled, expired
+}
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestActiveExpireCycle_FindsKeysInAnyShard(t *testing.T) {
+	dbs := NewDatabases(2, 16)
+	db := dbs.DB(1)
+	// every key with a TTL sits in the same shard, and the other shards
+	// hold only keys without one
+	target := db.shardIndex("k0")
+	expireAt := time.Now().Add(10 * time.Millisecond).UnixMilli()
+	volatile := 0
+	for i := 0; volatile < 50; i++ {
+		key := "k" + strconv.Itoa(i)
+		if db.shardIndex(key) != target {
+			db.Set(key, "v")
+			continue
+		}
+		db.SetWithOptions(key, "v", SetOptions{ExpireAt: expireAt})
+		volatile++
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	dbs.activeExpireCycle(0, time.Second)
+	if n := db.shards[target].expires.count; n != 0 {
+		t.Fatalf("active expire left %d of %d expired keys", n, volatile)
+	}
+	if got := dbs.Stats().ExpiredKeys(); got != int64(volatile) {
+		t.Fatalf("expired keys: got %d; want %d", got, volatile)
+	}
+}
+
+func TestOnKeyspaceEvent_Expired(t *testing.T) {
+	dbs := NewDatabases(2, 4)
+	var got []string
+	dbs.OnKeyspaceEvent(func(db int, event, key string) {
+		got = append(got, fmt.Sprintf("%d %s %s", db, event, key))
+	})
+	expireAt := time.Now().Add(10 * time.Millisecond).UnixMilli()
+	dbs.DB(1).Set("lazy", "v")
+	dbs.DB(1).ExpireAt("lazy", expireAt, 0)
+	dbs.DB(0).Set("active", "v")
+	dbs.DB(0).ExpireAt("active", expireAt, 0)
+	dbs.DB(0).Set("kept", "v")
+	time.Sleep(20 * time.Millisecond)
+
+	dbs.DB(1).Get("lazy")
+	dbs.activeExpireCycle(0, time.Second)
+	want := []string{"1 expired lazy", "0 expired active"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got events %q; want %q", got, want)
+	}
+}
+
+func TestExpireAt_Conditions(t *testing.T) {
+	now := time.Now()
+	current := now.Add(time.Hour).UnixMilli()
+	later := now.Add(2 * time.Hour).UnixMilli()
+	earlier := now.Add(30 * time.Minute).UnixMilli()
+	tests := []struct {
+		name    string
+		hasTTL  bool
+		at      int64
+		cond    ExpireCondition
+		applied bool
+	}{
+		{"none without TTL", false, later, 0, true},
+		{"none with TTL", true, earlier, 0, true},
+		{"NX without TTL", false, later, ExpireNX, true},
+		{"NX with TTL", true, later, ExpireNX, false},
+		{"XX without TTL", false, later, ExpireXX, false},
+		{"XX with TTL", true, later, ExpireXX, true},
+		// a key without a TTL never expires, so nothing is greater
+		{"GT without TTL", false, later, ExpireGT, false},
+		{"GT later", true, later, ExpireGT, true},
+		{"GT earlier", true, earlier, ExpireGT, false},
+		{"GT same", true, current, ExpireGT, false},
+		// and anything is less
+		{"LT without TTL", false, earlier, ExpireLT, true},
+		{"LT earlier", true, earlier, ExpireLT, true},
+		{"LT later", true, later, ExpireLT, false},
+		{"LT same", true, current, ExpireLT, false},
+		{"XX|GT later", true, later, ExpireXX | ExpireGT, true},
+		{"XX|LT without TTL", false, earlier, ExpireXX | ExpireLT, false},
+	}
+	for _, tt := range tests {
+		kv := NewKV()
+		want := int64(-1)
+		kv.Set("k", "v")
+		if tt.hasTTL {
+			kv.ExpireAt("k", current, 0)
+			want = current
+		}
+		if tt.applied {
+			want = tt.at
+		}
+
+		if applied := kv.ExpireAt("k", tt.at, tt.cond); applied != tt.applied {
+			t.Fatalf("%s: got applied %v; want %v", tt.name, applied, tt.applied)
+		}
+		if got := kv.ExpireTime("k"); got != want {
+			t.Fatalf("%s: got expire time %d; want %d", tt.name, got, want)
+		}
+	}
+}
+
+func TestExpireAt_PastTimeAndMissingKey(t *testing.T) {
+	kv := NewKV()
+	kv.Set("k", "v")
+	if !kv.ExpireAt("k", time.Now().UnixMilli()-1, ExpireNX) {
+		t.Fatalf("expected a time in the past to be applied")
+	}
+	if kv.Exists("k") != 0 {
+		t.Fatalf("expected a time in the past to delete the key")
+	}
+	if kv.ExpireAt("missing", time.Now().Add(time.Hour).UnixMilli(), 0) {
+		t.Fatalf("expected no TTL to be set on a missing key")
+	}
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/geo"
+)
+
+// GeoSort orders the results of a geo search by distance.
+type GeoSort int
+
+const (
+	GeoUnsorted GeoSort = iota
+	GeoAsc
+	GeoDesc
+)
+
+// GeoQuery selects the points of a sorted set, scored by their geohash, that
+// lie in Shape around the point of Member if FromMember, else around Lon,
+// Lat. Count caps the result, 0 meaning no cap; with Any the search stops
+// at the first Count points found instead of returning the nearest ones.
+type GeoQuery struct {
+	FromMember bool
+	Member     string
+	Lon, Lat   float64
+	Shape      geo.Shape
+	Sort       GeoSort
+	Count      int
+	Any        bool
+}
+
+// GeoMatch is a point found by a search and its distance in meters.
+type GeoMatch struct {
+	Member string
+	Score  float64
+	Dist   float64
+}
+
+func (tx *txn) geoSearch(key string, q GeoQuery) ([]GeoMatch, error) {
+	e := tx.lookup(key)
+	if e == nil {
+		return nil, nil
+	}
+	if e.typ != zsetType {
+		return nil, ErrWrongType
+	}
+	z := e.zset()
+	lon, lat := q.Lon, q.Lat
+	if q.FromMember {
+		score, ok := z.score(q.Member)
+		if !ok {
+			return nil, ErrGeoMember
+		}
+		lon, lat = geo.Decode(uint64(score))
+	}
+
+	var matches []GeoMatch
+	full := func() bool { return q.Any && len(matches) == q.Count }
+	for _, area := range geo.Areas(lon, lat, q.Shape) {
+		lo, hi := float64(area.Min), float64(area.Max)
+		start := z.partition(func(_ string, score float64) bool { return score < lo })
+		stop := z.partition(func(_ string, score float64) bool { return score < hi }) - 1
+		z.forRange(start, stop, false, func(member string, score float64) bool {
+			plon, plat := geo.Decode(uint64(score))
+			if dist, ok := q.Shape.Contains(lon, lat, plon, plat); ok {
+				matches = append(matches, GeoMatch{member, score, dist})
+			}
+			return !full()
+		})
+		if full() {
+			break
+		}
+	}
+
+	switch q.Sort {
+	case GeoAsc:
+		slices.SortStableFunc(matches, func(a, b GeoMatch) int { return cmp.Compare(a.Dist, b.Dist) })
+	case GeoDesc:
+		slices.SortStableFunc(matches, func(a, b GeoMatch) int { return cmp.Compare(b.Dist, a.Dist) })
+	}
+	if q.Count > 0 && len(matches) > q.Count {
+		matches = matches[:q.Count]
+	}
+	return matches, nil
+}
+
+// GeoSearch returns the points selected by q.
+func (s *KV) GeoSearch(key string, q GeoQuery) ([]GeoMatch, error) {
+	var matches []GeoMatch
+	err := s.view([]string{key}, func(tx *txn) error {
+		var err error
+		matches, err = tx.geoSearch(key, q)
+		return err
+	})
+	return matches, err
+}
+
+// GeoSearchStore stores the points of src selected by q into dst, keeping
+// their geohash as score or, if storeDist, their distance converted by
+// unit, and returns how many there are.
+func (s *KV) GeoSearchStore(dst, src string, q GeoQuery, storeDist bool, unit float64) (int, error) {
+	var n int
+	err := s.update([]string{dst, src}, func(tx *txn) error {
+		matches, err := tx.geoSearch(src, q)
+		if err != nil {
+			return err
+		}
+		members := make([]ZMember, len(matches))
+		for i, m := range matches {
+			members[i] = ZMember{m.Member, m.Score}
+			if storeDist {
+				members[i].Score = m.Dist / unit
+			}
+		}
+		n = len(members)
+		tx.storeZset(dst, members)
+		return nil
+	})
+	return n, err
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/geo"
+)
+
+func TestGeoSearch(t *testing.T) {
+	kv := NewKV()
+	point := func(member string, lon, lat float64) ZMember {
+		return ZMember{member, float64(geo.Encode(lon, lat))}
+	}
+	kv.ZAdd("sicily", 0,
+		point("Palermo", 13.361389, 38.115556),
+		point("Catania", 15.087269, 37.502669),
+		point("edge1", 12.758489, 38.788135),
+		point("edge2", 17.241510, 38.788135))
+
+	names := func(q GeoQuery) []string {
+		matches, err := kv.GeoSearch("sicily", q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, m := range matches {
+			got = append(got, m.Member)
+		}
+		return got
+	}
+	tests := []struct {
+		name string
+		q    GeoQuery
+		want []string
+	}{
+		{"radius", GeoQuery{Lon: 15, Lat: 37, Shape: geo.Shape{Radius: 200000}, Sort: GeoAsc}, []string{"Catania", "Palermo"}},
+		{"box", GeoQuery{Lon: 15, Lat: 37, Shape: geo.Shape{Width: 400000, Height: 400000}, Sort: GeoDesc}, []string{"edge1", "edge2", "Palermo", "Catania"}},
+		{"member count", GeoQuery{FromMember: true, Member: "Palermo", Shape: geo.Shape{Radius: 200000}, Sort: GeoAsc, Count: 2}, []string{"Palermo", "edge1"}},
+		{"empty", GeoQuery{Lon: 0, Lat: 0, Shape: geo.Shape{Radius: 1000}}, nil},
+	}
+	for _, tt := range tests {
+		if got := names(tt.q); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %q; want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := kv.GeoSearch("sicily", GeoQuery{FromMember: true, Member: "Rome"}); err != ErrGeoMember {
+		t.Fatalf("got %v; want ErrGeoMember", err)
+	}
+	if n, _ := kv.GeoSearchStore("near", "sicily", GeoQuery{Lon: 15, Lat: 37, Shape: geo.Shape{Radius: 100000}}, true, 1000); n != 1 {
+		t.Fatalf("got %d stored; want 1", n)
+	}
+	if score, _, _ := kv.ZScore("near", "Catania"); score < 56.44 || score > 56.45 {
+		t.Fatalf("got a stored distance of %v km; want about 56.44", score)
+	}
+}
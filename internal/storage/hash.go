@@ -0,0 +1,108 @@
+package storage
+
+import "math/rand/v2"
+
+// hashStore is implemented by every hash encoding.
+type hashStore interface {
+	len() int
+	get(field string) (string, bool)
+	set(field, value string) bool
+	delete(field string) bool
+	forEach(fn func(field, value string) bool)
+	// random returns a random field of a non-empty hash and its value.
+	random() (string, string)
+	memUsage() int64
+	encoding() string
+}
+
+// listpackHash keeps fields and values interleaved in one listpack.
+type listpackHash struct{ lp *listpack }
+
+func (h listpackHash) len() int { return h.lp.len() / 2 }
+
+func (h listpackHash) get(field string) (string, bool) {
+	i := h.lp.index(field, 2)
+	if i < 0 {
+		return "", false
+	}
+	return h.lp.at(i + 1), true
+}
+
+func (h listpackHash) set(field, value string) bool {
+	if i := h.lp.index(field, 2); i >= 0 {
+		h.lp.replace(i+1, value)
+		return false
+	}
+	h.lp.insert(h.lp.len(), field, value)
+	return true
+}
+
+func (h listpackHash) delete(field string) bool {
+	i := h.lp.index(field, 2)
+	if i < 0 {
+		return false
+	}
+	h.lp.delete(i, 2)
+	return true
+}
+
+func (h listpackHash) forEach(fn func(field, value string) bool) {
+	var field string
+	h.lp.forEach(func(i int, v string) bool {
+		if i%2 == 0 {
+			field = v
+			return true
+		}
+		return fn(field, v)
+	})
+}
+
+func (h listpackHash) random() (string, string) {
+	i := rand.IntN(h.len()) * 2
+	return h.lp.at(i), h.lp.at(i + 1)
+}
+
+func (h listpackHash) memUsage() int64  { return h.lp.memUsage() }
+func (h listpackHash) encoding() string { return "listpack" }
+
+type hashtableHash struct{ d *dict[string] }
+
+func newHashtableHash() hashtableHash {
+	d := newDict[string]()
+	d.valueSize = func(v string) int64 { return int64(len(v)) }
+	return hashtableHash{d}
+}
+
+func (h hashtableHash) len() int                        { return h.d.len() }
+func (h hashtableHash) get(field string) (string, bool) { return h.d.get(field) }
+func (h hashtableHash) set(field, value string) bool    { return h.d.set(field, value) }
+func (h hashtableHash) delete(field string) bool        { return h.d.delete(field) }
+func (h hashtableHash) memUsage() int64                 { return h.d.memUsage() }
+func (h hashtableHash) encoding() string                { return "hashtable" }
+
+func (h hashtableHash) random() (string, string) { return h.d.random() }
+
+func (h hashtableHash) forEach(fn func(field, value string) bool) {
+	h.d.forEach(fn)
+}
+
+// convertHashFor returns h, or h converted to a hashtable if it can't hold
+// size fields or one of the given strings. The conversion is never undone.
+func convertHashFor(lim *EncodingLimits, h hashStore, size int, adding ...string) hashStore {
+	if _, ok := h.(listpackHash); !ok {
+		return h
+	}
+	fits := size <= lim.HashMaxListpackEntries
+	for _, s := range adding {
+		fits = fits && len(s) <= lim.HashMaxListpackValue
+	}
+	if fits {
+		return h
+	}
+	to := newHashtableHash()
+	h.forEach(func(field, value string) bool {
+		to.set(field, value)
+		return true
+	})
+	return to
+}
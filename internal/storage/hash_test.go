@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestHDel_DeletesEmptyKey(t *testing.T) {
+	kv := NewKV()
+	kv.HSet("h", "a", "1", "b", "2")
+	if n, _ := kv.HDel("h", "a", "missing"); n != 1 {
+		t.Fatalf("got %d deleted; want 1", n)
+	}
+	if n, _ := kv.HDel("h", "b"); n != 1 {
+		t.Fatalf("got %d deleted; want 1", n)
+	}
+	if kv.Exists("h") != 0 {
+		t.Fatalf("expected the empty hash to be deleted")
+	}
+}
+
+func TestHIncrBy(t *testing.T) {
+	kv := NewKV()
+	if n, _ := kv.HIncrBy("h", "n", 5); n != 5 {
+		t.Fatalf("got %d; want 5", n)
+	}
+	if n, _ := kv.HIncrBy("h", "n", -7); n != -2 {
+		t.Fatalf("got %d; want -2", n)
+	}
+	kv.HSet("h", "s", "abc", "max", strconv.FormatInt(1<<63-1, 10))
+	if _, err := kv.HIncrBy("h", "s", 1); err != ErrHashNotInt {
+		t.Fatalf("expected ErrHashNotInt, got %v", err)
+	}
+	if _, err := kv.HIncrBy("h", "max", 1); err != ErrOverflow {
+		t.Fatalf("expected ErrOverflow, got %v", err)
+	}
+	if f, _ := kv.HIncrByFloat("h", "n", 0.5); f != "-1.5" {
+		t.Fatalf("got %q; want -1.5", f)
+	}
+}
+
+func TestHRandField(t *testing.T) {
+	kv := NewKV()
+	for i := 0; i < 300; i++ {
+		kv.HSet("h", "f"+strconv.Itoa(i), "v"+strconv.Itoa(i))
+	}
+	for _, count := range []int{1, 50, 300, 1000, math.MaxInt} {
+		fields, values, _ := kv.HRandField("h", count, true)
+		if len(fields) != min(count, 300) {
+			t.Fatalf("count %d: got %d fields", count, len(fields))
+		}
+		for i, f := range fields {
+			if values[i] != "v"+f[1:] {
+				t.Fatalf("field %q paired with value %q", f, values[i])
+			}
+		}
+		if len(slices.Compact(sorted(fields))) != len(fields) {
+			t.Fatalf("count %d: got repeated fields", count)
+		}
+	}
+}
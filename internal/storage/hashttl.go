@@ -0,0 +1,337 @@
+package storage
+
+import "time"
+
+// Per-field results of HEXPIRE and HPERSIST, as in Redis.
+const (
+	FieldNotFound   = -2
+	FieldNoTTL      = -1
+	FieldNotChanged = 0
+	FieldUpdated    = 1
+	FieldDeleted    = 2
+)
+
+func (e *entry) fieldExpireAt(field string) (int64, bool) {
+	if e.fieldExpires == nil {
+		return 0, false
+	}
+	return e.fieldExpires.get(field)
+}
+
+func (e *entry) setFieldExpireAt(field string, unixMilli int64) {
+	if e.fieldExpires == nil {
+		e.fieldExpires = newDict[int64]()
+	}
+	e.fieldExpires.set(field, unixMilli)
+}
+
+func (e *entry) persistField(field string) bool {
+	return e.fieldExpires != nil && e.fieldExpires.delete(field)
+}
+
+// nextFieldExpiry returns the earliest expiration time among the fields.
+func (e *entry) nextFieldExpiry() (int64, bool) {
+	if e.fieldExpires == nil || e.fieldExpires.len() == 0 {
+		return 0, false
+	}
+	var next int64
+	first := true
+	e.fieldExpires.forEach(func(_ string, at int64) bool {
+		if first || at < next {
+			next, first = at, false
+		}
+		return true
+	})
+	return next, true
+}
+
+// deleteExpiredFields deletes the fields whose time has come and returns
+// how many there were.
+func (e *entry) deleteExpiredFields(now int64) int {
+	if e.fieldExpires == nil {
+		return 0
+	}
+	var expired []string
+	e.fieldExpires.forEach(func(field string, at int64) bool {
+		if at <= now {
+			expired = append(expired, field)
+		}
+		return true
+	})
+	for _, field := range expired {
+		e.hash().delete(field)
+		e.fieldExpires.delete(field)
+	}
+	return len(expired)
+}
+
+// withoutExpiredFields returns a copy of the hash without the fields whose
+// time has come, or nil if none is left. Read-only txns see this copy, as
+// they can't delete the fields under their read locks.
+func (e *entry) withoutExpiredFields(now int64) *entry {
+	var h hashStore = listpackHash{newListpack()}
+	if _, ok := e.hash().(hashtableHash); ok {
+		h = newHashtableHash()
+	}
+	c := &entry{typ: hashType, data: h}
+	e.hash().forEach(func(field, value string) bool {
+		at, hasTTL := e.fieldExpireAt(field)
+		if hasTTL && at <= now {
+			return true
+		}
+		h.set(field, value)
+		if hasTTL {
+			c.setFieldExpireAt(field, at)
+		}
+		return true
+	})
+	if h.len() == 0 {
+		return nil
+	}
+	return c
+}
+
+// syncFieldExpires records in the shard when the next field of the hash at
+// key expires, which is where the active expire cycle looks for them.
+func (tx *txn) syncFieldExpires(key string, e *entry) {
+	sh := tx.shard(key)
+	next, ok := e.nextFieldExpiry()
+	if !ok {
+		e.fieldExpires = nil
+		sh.fieldExpires.delete(key)
+		return
+	}
+	sh.fieldExpires.set(key, next)
+}
+
+// expireFields deletes the expired fields of the hash at key, and the key
+// too if no field is left. It reports whether the key was deleted.
+func (s *KV) expireFields(sh *shard, key string, e *entry, now int64) bool {
+	n := e.deleteExpiredFields(now)
+	s.stats.expiredSubkeys.Add(int64(n))
+	if e.hash().len() == 0 {
+		sh.data.delete(key)
+		sh.expires.delete(key)
+		sh.fieldExpires.delete(key)
+		s.release(key, e)
+		return true
+	}
+	if next, ok := e.nextFieldExpiry(); ok {
+		sh.fieldExpires.set(key, next)
+	} else {
+		e.fieldExpires = nil
+		sh.fieldExpires.delete(key)
+	}
+	s.recharge(e)
+	return false
+}
+
+// HExpireAt sets the absolute expiration time of the given fields if cond
+// allows it, and returns one of the Field* results for each. A time that is
+// already in the past deletes the fields right away.
+func (s *KV) HExpireAt(key string, unixMilli int64, cond ExpireCondition, fields ...string) ([]int, error) {
+	results := make([]int, len(fields))
+	err := s.update([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			for i := range results {
+				results[i] = FieldNotFound
+			}
+			return nil
+		}
+		if e.typ != hashType {
+			return ErrWrongType
+		}
+
+		past := unixMilli <= time.Now().UnixMilli()
+		for i, field := range fields {
+			if _, exists := e.hash().get(field); !exists {
+				results[i] = FieldNotFound
+				continue
+			}
+			current, hasTTL := e.fieldExpireAt(field)
+			switch {
+			case cond&ExpireNX != 0 && hasTTL,
+				cond&ExpireXX != 0 && !hasTTL,
+				cond&ExpireGT != 0 && (!hasTTL || unixMilli <= current),
+				cond&ExpireLT != 0 && hasTTL && unixMilli >= current:
+				results[i] = FieldNotChanged
+			case past:
+				e.hash().delete(field)
+				e.persistField(field)
+				results[i] = FieldDeleted
+			default:
+				e.setFieldExpireAt(field, unixMilli)
+				results[i] = FieldUpdated
+			}
+		}
+		tx.syncFieldExpires(key, e)
+		if e.hash().len() == 0 {
+			tx.delete(key)
+		}
+		return nil
+	})
+	return results, err
+}
+
+// HExpireTime returns the absolute expiration time of each field in unix
+// milliseconds, FieldNoTTL if it has none or FieldNotFound.
+func (s *KV) HExpireTime(key string, fields ...string) ([]int64, error) {
+	results := make([]int64, len(fields))
+	err := s.view([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e != nil && e.typ != hashType {
+			return ErrWrongType
+		}
+		for i, field := range fields {
+			if e == nil {
+				results[i] = FieldNotFound
+				continue
+			}
+			if _, exists := e.hash().get(field); !exists {
+				results[i] = FieldNotFound
+				continue
+			}
+			at, hasTTL := e.fieldExpireAt(field)
+			if !hasTTL {
+				results[i] = FieldNoTTL
+				continue
+			}
+			results[i] = at
+		}
+		return nil
+	})
+	return results, err
+}
+
+// HPersist removes the TTL of the given fields and returns FieldUpdated,
+// FieldNoTTL or FieldNotFound for each.
+func (s *KV) HPersist(key string, fields ...string) ([]int, error) {
+	results := make([]int, len(fields))
+	err := s.update([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e != nil && e.typ != hashType {
+			return ErrWrongType
+		}
+		for i, field := range fields {
+			switch {
+			case e == nil:
+				results[i] = FieldNotFound
+			case !hasField(e, field):
+				results[i] = FieldNotFound
+			case e.persistField(field):
+				results[i] = FieldUpdated
+			default:
+				results[i] = FieldNoTTL
+			}
+		}
+		if e != nil {
+			tx.syncFieldExpires(key, e)
+		}
+		return nil
+	})
+	return results, err
+}
+
+func hasField(e *entry, field string) bool {
+	_, exists := e.hash().get(field)
+	return exists
+}
+
+// HGetEx returns the values of fields and then sets their expiration time
+// to expireAt, or removes it if persist. Fields expiring in the past are
+// deleted once read.
+func (s *KV) HGetEx(key string, expireAt int64, persist bool, fields ...string) ([]string, []bool, error) {
+	values := make([]string, len(fields))
+	found := make([]bool, len(fields))
+	err := s.update([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		if e.typ != hashType {
+			return ErrWrongType
+		}
+		past := expireAt != 0 && expireAt <= time.Now().UnixMilli()
+		for i, field := range fields {
+			if values[i], found[i] = e.hash().get(field); !found[i] {
+				continue
+			}
+			switch {
+			case persist:
+				e.persistField(field)
+			case past:
+				e.hash().delete(field)
+				e.persistField(field)
+			case expireAt != 0:
+				e.setFieldExpireAt(field, expireAt)
+			}
+		}
+		tx.syncFieldExpires(key, e)
+		if e.hash().len() == 0 {
+			tx.delete(key)
+		}
+		return nil
+	})
+	return values, found, err
+}
+
+// HSetExOptions controls HSetEx. Cond SetNX only sets the fields if none of
+// them exists and SetXX only if all of them do. Unless KeepTTL, the fields
+// get ExpireAt as their expiration time, or lose their TTL if it's 0.
+type HSetExOptions struct {
+	Cond     SetCondition
+	ExpireAt int64
+	KeepTTL  bool
+}
+
+// HSetEx sets the given field/value pairs and reports whether Cond allowed
+// it.
+func (s *KV) HSetEx(key string, opts HSetExOptions, pairs ...string) (bool, error) {
+	var applied bool
+	err := s.update([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e != nil && e.typ != hashType {
+			return ErrWrongType
+		}
+		existing := 0
+		for i := 0; e != nil && i+1 < len(pairs); i += 2 {
+			if hasField(e, pairs[i]) {
+				existing++
+			}
+		}
+		switch {
+		case opts.Cond == SetNX && existing > 0,
+			opts.Cond == SetXX && existing < len(pairs)/2:
+			return nil
+		}
+		applied = true
+
+		if e == nil {
+			e = newHashEntry()
+			tx.set(key, e)
+		}
+		if opts.KeepTTL {
+			e.hsetKeepTTL(s.limits, pairs...)
+		} else {
+			e.HSet(s.limits, pairs...)
+		}
+		if opts.ExpireAt != 0 {
+			past := opts.ExpireAt <= time.Now().UnixMilli()
+			for i := 0; i+1 < len(pairs); i += 2 {
+				if past {
+					e.hash().delete(pairs[i])
+					e.persistField(pairs[i])
+				} else {
+					e.setFieldExpireAt(pairs[i], opts.ExpireAt)
+				}
+			}
+		}
+		tx.syncFieldExpires(key, e)
+		if e.hash().len() == 0 {
+			tx.delete(key)
+		}
+		return nil
+	})
+	return applied, err
+}
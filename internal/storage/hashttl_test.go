@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHExpireAt_LazyExpiry(t *testing.T) {
+	kv := NewKV()
+	kv.HSet("h", "a", "1", "b", "2")
+	soon := time.Now().Add(20 * time.Millisecond).UnixMilli()
+	results, _ := kv.HExpireAt("h", soon, 0, "a", "missing")
+	if results[0] != FieldUpdated || results[1] != FieldNotFound {
+		t.Fatalf("got %v; want [1 -2]", results)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	if _, ok, _ := kv.HGet("h", "a"); ok {
+		t.Fatalf("expected the field to be expired")
+	}
+	if n, _ := kv.HLen("h"); n != 1 {
+		t.Fatalf("got %d fields; want 1", n)
+	}
+	if kv.stats.ExpiredSubkeys() != 1 {
+		t.Fatalf("got %d expired subkeys; want 1", kv.stats.ExpiredSubkeys())
+	}
+
+	kv.HExpireAt("h", time.Now().Add(20*time.Millisecond).UnixMilli(), 0, "b")
+	time.Sleep(30 * time.Millisecond)
+	if kv.Exists("h") != 0 {
+		t.Fatalf("expected the hash to be deleted with its last field")
+	}
+}
+
+func TestHExpireAt_PastTimeDeletes(t *testing.T) {
+	kv := NewKV()
+	kv.HSet("h", "a", "1", "b", "2")
+	results, _ := kv.HExpireAt("h", time.Now().UnixMilli()-1, 0, "a")
+	if results[0] != FieldDeleted {
+		t.Fatalf("got %d; want %d", results[0], FieldDeleted)
+	}
+	if n, _ := kv.HLen("h"); n != 1 {
+		t.Fatalf("got %d fields; want 1", n)
+	}
+}
+
+func TestHSet_ClearsFieldTTL(t *testing.T) {
+	kv := NewKV()
+	kv.HSet("h", "a", "1")
+	kv.HExpireAt("h", time.Now().Add(time.Hour).UnixMilli(), 0, "a")
+	kv.HSet("h", "a", "2")
+	if at, _ := kv.HExpireTime("h", "a"); at[0] != FieldNoTTL {
+		t.Fatalf("got %d; want %d", at[0], FieldNoTTL)
+	}
+
+	kv.HExpireAt("h", time.Now().Add(time.Hour).UnixMilli(), 0, "a")
+	kv.HSetEx("h", HSetExOptions{KeepTTL: true}, "a", "3")
+	if at, _ := kv.HExpireTime("h", "a"); at[0] < 0 {
+		t.Fatalf("expected KEEPTTL to retain the TTL, got %d", at[0])
+	}
+}
+
+func TestExpireSample_ExpiresFields(t *testing.T) {
+	// a single shard, so that the sample sees both keys
+	kv := NewDatabases(1, 1).DB(0)
+	soon := time.Now().Add(10 * time.Millisecond).UnixMilli()
+	kv.HSet("h", "a", "1", "b", "2")
+	kv.HExpireAt("h", soon, 0, "a")
+	kv.HSet("gone", "a", "1")
+	kv.HExpireAt("gone", soon, 0, "a")
+	time.Sleep(20 * time.Millisecond)
+
+	kv.expireSample(activeExpireKeysPerLoop)
+	if kv.stats.ExpiredSubkeys() != 2 {
+		t.Fatalf("got %d expired subkeys; want 2", kv.stats.ExpiredSubkeys())
+	}
+	if _, ok := kv.shards[kv.shardIndex("h")].fieldExpires.get("h"); ok {
+		t.Fatalf("expected no field expiry left for h")
+	}
+	if kv.Exists("gone") != 0 {
+		t.Fatalf("expected the emptied hash to be deleted")
+	}
+}
@@ -0,0 +1,533 @@
+package storage
+
+import (
+	"encoding/binary"
+	"math"
+	"slices"
+)
+
+// HyperLogLogs are strings in the format Redis uses, so that they can be
+// read with GET and restored with SET: a 16 byte header ("HYLL", the
+// encoding, three unused bytes and the cached cardinality, little endian
+// with the top bit set when stale) followed by 16384 registers of 6 bits.
+// The dense encoding stores every register; the sparse one run-length
+// encodes them with three opcodes and is used while the HLL is small:
+//
+//	ZERO  00xxxxxx          xxxxxx+1 registers set to 0
+//	XZERO 01xxxxxx yyyyyyyy xxxxxxyyyyyyyy+1 registers set to 0
+//	VAL   1vvvvvxx          xx+1 registers set to vvvvv+1
+const (
+	hllP         = 14
+	hllQ         = 64 - hllP
+	hllRegisters = 1 << hllP
+	hllBits      = 6
+	hllHdrSize   = 16
+	hllDenseSize = hllHdrSize + (hllRegisters*hllBits+7)/8
+
+	hllDense  = 0
+	hllSparse = 1
+
+	hllSparseValMax = 32
+	hllSparseValLen = 4
+	hllZeroLen      = 64
+	hllXZeroLen     = 16384
+)
+
+// hllEncoding checks that b is a HyperLogLog and returns its encoding. The
+// runs of a sparse one are checked too, failing with ErrHLLCorrupt, so that
+// every command reports a corrupted HLL the same way.
+func hllEncoding(b []byte) (int, error) {
+	if len(b) < hllHdrSize || string(b[:4]) != "HYLL" {
+		return 0, ErrNotHLL
+	}
+	switch b[4] {
+	case hllDense:
+		if len(b) != hllDenseSize {
+			return 0, ErrNotHLL
+		}
+		return hllDense, nil
+	case hllSparse:
+		return hllSparse, forEachSparseRun(b, func(int, int, uint8) {})
+	default:
+		return 0, ErrNotHLL
+	}
+}
+
+func newHLL() []byte {
+	b := make([]byte, hllHdrSize, hllHdrSize+2)
+	copy(b, "HYLL")
+	b[4] = hllSparse
+	return appendHLLZeros(b, hllRegisters)
+}
+
+func hllInvalidateCache(b []byte) { b[15] |= 0x80 }
+
+// hllCachedCount returns the cached cardinality unless it is stale.
+func hllCachedCount(b []byte) (int64, bool) {
+	if b[15]&0x80 != 0 {
+		return 0, false
+	}
+	return int64(binary.LittleEndian.Uint64(b[8:16])), true
+}
+
+func hllSetCache(b []byte, n int64) { binary.LittleEndian.PutUint64(b[8:16], uint64(n)) }
+
+// murmurHash64A is the hash Redis gives HyperLogLog elements.
+func murmurHash64A(data string, seed uint64) uint64 {
+	const m = 0xc6a4a7935bd1e995
+	const r = 47
+	h := seed ^ uint64(len(data))*m
+	for ; len(data) >= 8; data = data[8:] {
+		k := binary.LittleEndian.Uint64([]byte(data[:8]))
+		k *= m
+		k ^= k >> r
+		k *= m
+		h ^= k
+		h *= m
+	}
+	if len(data) > 0 {
+		for i := len(data) - 1; i >= 0; i-- {
+			h ^= uint64(data[i]) << (8 * i)
+		}
+		h *= m
+	}
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
+
+// hllPatLen returns the register an element goes to and the length of the
+// run of zeros that ends its hash, plus one.
+func hllPatLen(element string) (index int, count uint8) {
+	hash := murmurHash64A(element, 0xadc83b19)
+	index = int(hash & (hllRegisters - 1))
+	hash >>= hllP
+	hash |= 1 << hllQ
+	count = 1
+	for bit := uint64(1); hash&bit == 0; bit <<= 1 {
+		count++
+	}
+	return index, count
+}
+
+func hllDenseGet(regs []byte, i int) uint8 {
+	pos, shift := i*hllBits/8, uint(i*hllBits&7)
+	v := uint(regs[pos]) >> shift
+	if pos+1 < len(regs) {
+		v |= uint(regs[pos+1]) << (8 - shift)
+	}
+	return uint8(v & 63)
+}
+
+func hllDenseSet(regs []byte, i int, v uint8) {
+	pos, shift := i*hllBits/8, uint(i*hllBits&7)
+	regs[pos] &^= byte(63 << shift)
+	regs[pos] |= v << shift
+	if pos+1 < len(regs) {
+		regs[pos+1] &^= byte(63 >> (8 - shift))
+		regs[pos+1] |= v >> (8 - shift)
+	}
+}
+
+// forEachSparseRun calls fn for every run of registers of a sparse HLL. It
+// reports ErrHLLCorrupt if the runs don't cover all the registers.
+func forEachSparseRun(b []byte, fn func(first, n int, v uint8)) error {
+	idx := 0
+	for p := hllHdrSize; p < len(b); {
+		n, v, size := hllSparseOp(b[p:])
+		if size == 0 || idx+n > hllRegisters {
+			return ErrHLLCorrupt
+		}
+		fn(idx, n, v)
+		idx += n
+		p += size
+	}
+	if idx != hllRegisters {
+		return ErrHLLCorrupt
+	}
+	return nil
+}
+
+// hllSparseOp decodes the opcode at the start of ops into the run it
+// stands for and its size in bytes, 0 if it is truncated.
+func hllSparseOp(ops []byte) (n int, v uint8, size int) {
+	switch op := ops[0]; {
+	case op&0x80 != 0:
+		return int(op&3) + 1, (op>>2)&0x1f + 1, 1
+	case op&0x40 != 0:
+		if len(ops) < 2 {
+			return 0, 0, 0
+		}
+		return (int(op&0x3f)<<8 | int(ops[1])) + 1, 0, 2
+	default:
+		return int(op&0x3f) + 1, 0, 1
+	}
+}
+
+func appendHLLZeros(ops []byte, n int) []byte {
+	for n > 0 {
+		run := min(n, hllXZeroLen)
+		if run <= hllZeroLen {
+			ops = append(ops, byte(run-1))
+		} else {
+			ops = append(ops, 0x40|byte((run-1)>>8), byte(run-1))
+		}
+		n -= run
+	}
+	return ops
+}
+
+func appendHLLVal(ops []byte, v uint8, n int) []byte {
+	for n > 0 {
+		run := min(n, hllSparseValLen)
+		ops = append(ops, 0x80|(v-1)<<2|byte(run-1))
+		n -= run
+	}
+	return ops
+}
+
+// hllToDense converts a sparse HLL to the dense encoding.
+func hllToDense(b []byte) ([]byte, error) {
+	dense := make([]byte, hllDenseSize)
+	copy(dense, b[:hllHdrSize])
+	dense[4] = hllDense
+	regs := dense[hllHdrSize:]
+	err := forEachSparseRun(b, func(first, n int, v uint8) {
+		if v == 0 {
+			return
+		}
+		for i := first; i < first+n; i++ {
+			hllDenseSet(regs, i, v)
+		}
+	})
+	return dense, err
+}
+
+// hllSparseSet raises register index to count in a sparse HLL by splitting
+// the opcode covering it, like Redis's hllSparseSet. It returns the new
+// value and whether the register changed; ok is false if the value can't be
+// represented sparsely and the HLL must be converted first.
+func hllSparseSet(b []byte, index int, count uint8) (out []byte, changed, ok bool, err error) {
+	if count > hllSparseValMax {
+		return b, false, false, nil
+	}
+	first, p := 0, hllHdrSize
+	var n, size int
+	var v uint8
+	for ; p < len(b); p += size {
+		if n, v, size = hllSparseOp(b[p:]); size == 0 {
+			return b, false, false, ErrHLLCorrupt
+		}
+		if index < first+n {
+			break
+		}
+		first += n
+	}
+	if p >= len(b) {
+		return b, false, false, ErrHLLCorrupt
+	}
+	if v >= count {
+		return b, false, true, nil
+	}
+
+	repl := make([]byte, 0, 5)
+	left, right := index-first, first+n-1-index
+	if v == 0 {
+		repl = appendHLLZeros(repl, left)
+		repl = appendHLLVal(repl, count, 1)
+		repl = appendHLLZeros(repl, right)
+	} else {
+		repl = appendHLLVal(repl, v, left)
+		repl = appendHLLVal(repl, count, 1)
+		repl = appendHLLVal(repl, v, right)
+	}
+	out = slices.Replace(b, p, p+size, repl...)
+	return mergeHLLVals(out), true, true, nil
+}
+
+// mergeHLLVals joins consecutive VAL opcodes of the same value where they
+// fit in one, keeping the sparse encoding as short as Redis would.
+func mergeHLLVals(b []byte) []byte {
+	w, last := hllHdrSize, -1 // last is where the previous VAL was written
+	for p := hllHdrSize; p < len(b); {
+		n, v, size := hllSparseOp(b[p:])
+		if v != 0 && last >= 0 {
+			prev := b[last]
+			if (prev>>2)&0x1f+1 == v && int(prev&3)+1+n <= hllSparseValLen {
+				b[last] = appendHLLVal(nil, v, int(prev&3)+1+n)[0]
+				p += size
+				continue
+			}
+		}
+		last = -1
+		if v != 0 {
+			last = w
+		}
+		w += copy(b[w:], b[p:p+size])
+		p += size
+	}
+	return b[:w]
+}
+
+// hllAdd adds elements to the HLL b, converting it to the dense encoding
+// once the sparse one would exceed maxSparse bytes. It returns the new
+// value and whether any register changed.
+func hllAdd(b []byte, maxSparse int, elements ...string) ([]byte, bool, error) {
+	enc, err := hllEncoding(b)
+	if err != nil {
+		return b, false, err
+	}
+	updated := false
+	for _, element := range elements {
+		index, count := hllPatLen(element)
+		if enc == hllSparse {
+			out, changed, ok, err := hllSparseSet(b, index, count)
+			if err != nil {
+				return b, false, err
+			}
+			if ok {
+				// out may share memory with b, so b is not valid anymore
+				b, updated = out, updated || changed
+				if len(b) <= maxSparse {
+					continue
+				}
+			}
+			if b, err = hllToDense(b); err != nil {
+				return b, false, err
+			}
+			enc = hllDense
+		}
+		regs := b[hllHdrSize:]
+		if hllDenseGet(regs, index) < count {
+			hllDenseSet(regs, index, count)
+			updated = true
+		}
+	}
+	if updated {
+		hllInvalidateCache(b)
+	}
+	return b, updated, nil
+}
+
+// hllRegisterValues returns the registers of a HyperLogLog, one per byte.
+func hllRegisterValues(b []byte) ([]uint8, error) {
+	regs := make([]uint8, hllRegisters)
+	return regs, hllMaxInto(regs, b)
+}
+
+// hllMaxInto raises every register of regs to the one of the HLL b.
+func hllMaxInto(regs []uint8, b []byte) error {
+	enc, err := hllEncoding(b)
+	if err != nil {
+		return err
+	}
+	if enc == hllSparse {
+		return forEachSparseRun(b, func(first, n int, v uint8) {
+			for i := first; i < first+n; i++ {
+				regs[i] = max(regs[i], v)
+			}
+		})
+	}
+	dense := b[hllHdrSize:]
+	for i := range regs {
+		regs[i] = max(regs[i], hllDenseGet(dense, i))
+	}
+	return nil
+}
+
+// hllFromRegisters encodes registers as a sparse HLL if it fits in
+// maxSparse bytes, or else as a dense one.
+func hllFromRegisters(regs []uint8, maxSparse int) []byte {
+	b := newHLL()[:hllHdrSize]
+	hllInvalidateCache(b)
+	sparse := true
+	for i := 0; i < len(regs) && sparse; {
+		j := i
+		for j < len(regs) && regs[j] == regs[i] {
+			j++
+		}
+		if regs[i] == 0 {
+			b = appendHLLZeros(b, j-i)
+		} else {
+			b = appendHLLVal(b, regs[i], j-i)
+		}
+		sparse = regs[i] <= hllSparseValMax && len(b) <= maxSparse
+		i = j
+	}
+	if sparse {
+		return b
+	}
+	b = append(b[:hllHdrSize], make([]byte, hllDenseSize-hllHdrSize)...)
+	b[4] = hllDense
+	for i, v := range regs {
+		hllDenseSet(b[hllHdrSize:], i, v)
+	}
+	return b
+}
+
+func hllSigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y, z := 1.0, x
+	for {
+		x *= x
+		prev := z
+		z += x * y
+		y += y
+		if z == prev {
+			return z
+		}
+	}
+}
+
+func hllTau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y, z := 1.0, 1-x
+	for {
+		x = math.Sqrt(x)
+		prev := z
+		y *= 0.5
+		z -= (1 - x) * (1 - x) * y
+		if z == prev {
+			return z / 3
+		}
+	}
+}
+
+// hllEstimate estimates the cardinality from the registers with the
+// improved estimator of Otmar Ertl, which Redis uses as well.
+func hllEstimate(regs []uint8) int64 {
+	var histo [64]int
+	for _, v := range regs {
+		histo[v]++
+	}
+	const m = float64(hllRegisters)
+	z := m * hllTau((m-float64(histo[hllQ+1]))/m)
+	for j := hllQ; j >= 1; j-- {
+		z += float64(histo[j])
+		z *= 0.5
+	}
+	z += m * hllSigma(float64(histo[0])/m)
+	return int64(math.Round(0.5 / math.Ln2 * m * m / z))
+}
+
+// PFAdd adds elements to the HyperLogLog at key, creating it if needed. It
+// reports whether the estimate may have changed.
+func (s *KV) PFAdd(key string, elements ...string) (bool, error) {
+	var updated bool
+	err := s.update([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			e = &entry{typ: stringType, data: newHLL()}
+			tx.set(key, e)
+			updated = true
+		}
+		b, err := e.mutableBytes(0)
+		if err != nil {
+			return err
+		}
+		b, changed, err := hllAdd(b, s.limits.HLLSparseMaxBytes, elements...)
+		if err != nil {
+			return err
+		}
+		e.data = b
+		updated = updated || changed
+		return nil
+	})
+	return updated, err
+}
+
+// PFCount estimates the number of distinct elements added to the
+// HyperLogLogs at keys, missing keys counting as empty ones. The estimate
+// of a single key is cached in its header until the next change.
+func (s *KV) PFCount(keys ...string) (int64, error) {
+	var n int64
+	if len(keys) == 1 {
+		err := s.update(keys, func(tx *txn) error {
+			e := tx.lookup(keys[0])
+			if e == nil {
+				return nil
+			}
+			b, err := e.mutableBytes(0)
+			if err != nil {
+				return err
+			}
+			if _, err := hllEncoding(b); err != nil {
+				return err
+			}
+			if cached, ok := hllCachedCount(b); ok {
+				n = cached
+				return nil
+			}
+			regs, err := hllRegisterValues(b)
+			if err != nil {
+				return err
+			}
+			n = hllEstimate(regs)
+			hllSetCache(b, n)
+			return nil
+		})
+		return n, err
+	}
+
+	err := s.view(keys, func(tx *txn) error {
+		regs := make([]uint8, hllRegisters)
+		for _, key := range keys {
+			e := tx.lookup(key)
+			if e == nil {
+				continue
+			}
+			v, err := e.view()
+			if err != nil {
+				return err
+			}
+			if err := hllMaxInto(regs, []byte(v)); err != nil {
+				return err
+			}
+		}
+		n = hllEstimate(regs)
+		return nil
+	})
+	return n, err
+}
+
+// PFMerge stores at dst the union of the HyperLogLogs at dst and srcs. The
+// result stays sparse only if all of them were.
+func (s *KV) PFMerge(dst string, srcs ...string) error {
+	return s.update(append([]string{dst}, srcs...), func(tx *txn) error {
+		regs := make([]uint8, hllRegisters)
+		maxSparse := s.limits.HLLSparseMaxBytes
+		for _, key := range append([]string{dst}, srcs...) {
+			e := tx.lookup(key)
+			if e == nil {
+				continue
+			}
+			v, err := e.view()
+			if err != nil {
+				return err
+			}
+			b := []byte(v)
+			enc, err := hllEncoding(b)
+			if err != nil {
+				return err
+			}
+			if enc == hllDense {
+				maxSparse = 0
+			}
+			if err := hllMaxInto(regs, b); err != nil {
+				return err
+			}
+		}
+		merged := hllFromRegisters(regs, maxSparse)
+		if e := tx.lookup(dst); e != nil {
+			e.data = merged
+		} else {
+			tx.set(dst, &entry{typ: stringType, data: merged})
+		}
+		return nil
+	})
+}
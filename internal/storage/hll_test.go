@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestHLLSparseMatchesDense(t *testing.T) {
+	sparse, dense := newHLL(), newHLL()
+	for i := 0; i < 2000; i++ {
+		element := "e" + strconv.Itoa(i)
+		var err error
+		if sparse, _, err = hllAdd(sparse, math.MaxInt, element); err != nil {
+			t.Fatal(err)
+		}
+		if dense, _, err = hllAdd(dense, 0, element); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if enc, _ := hllEncoding(sparse); enc != hllSparse {
+		t.Fatal("the HLL was converted to dense")
+	}
+	if enc, _ := hllEncoding(dense); enc != hllDense {
+		t.Fatal("the HLL is still sparse")
+	}
+	sregs, err := hllRegisterValues(sparse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dregs, _ := hllRegisterValues(dense)
+	if !slices.Equal(sregs, dregs) {
+		t.Fatal("sparse and dense registers differ")
+	}
+	if back := hllFromRegisters(sregs, math.MaxInt); !slices.Equal(back[hllHdrSize:], sparse[hllHdrSize:]) {
+		t.Fatal("re-encoding the registers gave a different sparse HLL")
+	}
+}
+
+func TestPFCountAccuracy(t *testing.T) {
+	kv := NewKV()
+	added := 0
+	for _, n := range []int{10, 1000, 100000} {
+		var batch []string
+		for ; added < n; added++ {
+			batch = append(batch, "visitor:"+strconv.Itoa(added))
+		}
+		if _, err := kv.PFAdd("hll", batch...); err != nil {
+			t.Fatal(err)
+		}
+		got, err := kv.PFCount("hll")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the standard error is 0.81%; allow three times as much
+		if diff := math.Abs(float64(got)-float64(n)) / float64(n); diff > 0.0243 {
+			t.Errorf("estimated %d for %d elements", got, n)
+		}
+		if cached, _ := kv.PFCount("hll"); cached != got {
+			t.Errorf("cached count %d differs from %d", cached, got)
+		}
+	}
+	if updated, _ := kv.PFAdd("hll", "visitor:1"); updated {
+		t.Error("adding a known element reported a change")
+	}
+}
+
+func TestPFMerge(t *testing.T) {
+	kv := NewKV()
+	for i := 0; i < 500; i++ {
+		kv.PFAdd("a", strconv.Itoa(i))
+		kv.PFAdd("b", strconv.Itoa(i+250))
+	}
+	union, err := kv.PFCount("a", "b", "missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := kv.PFMerge("ab", "a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if merged, _ := kv.PFCount("ab"); merged != union || union < 740 || union > 760 {
+		t.Fatalf("got a merged count of %d and a union of %d; want about 750", merged, union)
+	}
+
+	kv.Set("str", "not an hll")
+	if _, err := kv.PFAdd("str", "x"); err != ErrNotHLL {
+		t.Fatalf("got %v; want ErrNotHLL", err)
+	}
+	if err := kv.PFMerge("ab", "str"); err != ErrNotHLL {
+		t.Fatalf("got %v; want ErrNotHLL", err)
+	}
+}
+
+func TestPFCount_CorruptSparse(t *testing.T) {
+	kv := NewKV()
+	kv.PFAdd("h", "a", "b")
+	if n, _ := kv.PFCount("h"); n != 2 {
+		t.Fatalf("got %d; want 2", n)
+	}
+	// one more register than there are, with the count still cached
+	kv.Append("h", "\x00")
+	if _, err := kv.PFCount("h"); err != ErrHLLCorrupt {
+		t.Fatalf("PFCOUNT: got %v; want ErrHLLCorrupt", err)
+	}
+	if _, err := kv.PFCount("h", "missing"); err != ErrHLLCorrupt {
+		t.Fatalf("PFCOUNT of several keys: got %v; want ErrHLLCorrupt", err)
+	}
+	if _, err := kv.PFAdd("h", "c"); err != ErrHLLCorrupt {
+		t.Fatalf("PFADD: got %v; want ErrHLLCorrupt", err)
+	}
+	if err := kv.PFMerge("dst", "h"); err != ErrHLLCorrupt {
+		t.Fatalf("PFMERGE: got %v; want ErrHLLCorrupt", err)
+	}
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+	"strconv"
+	"unsafe"
+)
+
+// intset is a sorted set of integers packed little-endian into a byte slice,
+// using the narrowest of 2, 4 or 8 bytes per element that fits every member.
+// Adding a wider integer upgrades the whole set.
+type intset struct {
+	width    int
+	contents []byte
+}
+
+func newIntset() *intset {
+	return &intset{width: 2}
+}
+
+// parseSetInteger reports whether member is the canonical decimal form of an
+// int64, which is what lets a set keep the intset encoding.
+func parseSetInteger(member string) (int64, bool) {
+	if len(member) == 0 || len(member) > 20 {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(member, 10, 64)
+	if err != nil || strconv.FormatInt(v, 10) != member {
+		return 0, false
+	}
+	return v, true
+}
+
+func intWidth(v int64) int {
+	switch {
+	case v >= math.MinInt16 && v <= math.MaxInt16:
+		return 2
+	case v >= math.MinInt32 && v <= math.MaxInt32:
+		return 4
+	default:
+		return 8
+	}
+}
+
+func (is *intset) len() int {
+	return len(is.contents) / is.width
+}
+
+func (is *intset) get(i int) int64 {
+	b := is.contents[i*is.width:]
+	switch is.width {
+	case 2:
+		return int64(int16(binary.LittleEndian.Uint16(b)))
+	case 4:
+		return int64(int32(binary.LittleEndian.Uint32(b)))
+	default:
+		return int64(binary.LittleEndian.Uint64(b))
+	}
+}
+
+func (is *intset) put(i int, v int64) {
+	b := is.contents[i*is.width:]
+	switch is.width {
+	case 2:
+		binary.LittleEndian.PutUint16(b, uint16(v))
+	case 4:
+		binary.LittleEndian.PutUint32(b, uint32(v))
+	default:
+		binary.LittleEndian.PutUint64(b, uint64(v))
+	}
+}
+
+func (is *intset) search(v int64) (int, bool) {
+	n := is.len()
+	i := sort.Search(n, func(i int) bool { return is.get(i) >= v })
+	return i, i < n && is.get(i) == v
+}
+
+func (is *intset) upgrade(width int) {
+	old := *is
+	is.width = width
+	is.contents = make([]byte, len(old.contents)/old.width*width)
+	for i := 0; i < old.len(); i++ {
+		is.put(i, old.get(i))
+	}
+}
+
+func (is *intset) add(v int64) bool {
+	if w := intWidth(v); w > is.width {
+		is.upgrade(w)
+	}
+	i, found := is.search(v)
+	if found {
+		return false
+	}
+	is.contents = append(is.contents, make([]byte, is.width)...)
+	copy(is.contents[(i+1)*is.width:], is.contents[i*is.width:])
+	is.put(i, v)
+	return true
+}
+
+func (is *intset) remove(v int64) bool {
+	i, found := is.search(v)
+	if !found {
+		return false
+	}
+	is.contents = append(is.contents[:i*is.width], is.contents[(i+1)*is.width:]...)
+	return true
+}
+
+func (is *intset) contains(v int64) bool {
+	_, found := is.search(v)
+	return found
+}
+
+func (is *intset) memUsage() int64 {
+	return int64(unsafe.Sizeof(*is)) + int64(cap(is.contents))
+}
@@ -0,0 +1,323 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+type jsonKind uint8
+
+const (
+	jsonNull jsonKind = iota
+	jsonBool
+	jsonInt
+	jsonFloat
+	jsonString
+	jsonArray
+	jsonObject
+)
+
+// jsonMaxDepth is how deeply arrays and objects may nest, as in RedisJSON.
+const jsonMaxDepth = 128
+
+// JSONValue is a parsed JSON value. Objects keep their keys in insertion
+// order, the way they are written back.
+type JSONValue struct {
+	kind jsonKind
+	b    bool
+	n    int64
+	f    float64
+	// s is the value of a string, or the digits of an integer too large
+	// for n, which is also kept in f for arithmetic
+	s string
+	// elems holds the elements of an array
+	elems  []*JSONValue
+	keys   []string
+	fields map[string]*JSONValue
+}
+
+// jsonDoc is the value of a JSON key. bytes is kept up to date by every
+// command that modifies the tree, so memory accounting doesn't walk it.
+type jsonDoc struct {
+	root  *JSONValue
+	bytes int64
+}
+
+var (
+	jsonDocSize   = int64(unsafe.Sizeof(jsonDoc{}))
+	jsonValueSize = int64(unsafe.Sizeof(JSONValue{}))
+	// jsonFieldSize is roughly what a key costs in the keys slice and the map
+	jsonFieldSize = int64(unsafe.Sizeof("")) + 32
+)
+
+func newJSONDoc(root *JSONValue) *jsonDoc {
+	return &jsonDoc{root: root, bytes: root.size()}
+}
+
+func (d *jsonDoc) memUsage() int64 { return jsonDocSize + d.bytes }
+
+// size estimates the bytes held by v and everything below it.
+func (v *JSONValue) size() int64 {
+	n := jsonValueSize + int64(len(v.s)) + int64(len(v.elems))*8
+	for _, c := range v.elems {
+		n += c.size()
+	}
+	for _, k := range v.keys {
+		n += jsonFieldSize + int64(len(k)) + v.fields[k].size()
+	}
+	return n
+}
+
+func (v *JSONValue) clone() *JSONValue {
+	c := *v
+	if v.elems != nil {
+		c.elems = make([]*JSONValue, len(v.elems))
+		for i, e := range v.elems {
+			c.elems[i] = e.clone()
+		}
+	}
+	if v.fields != nil {
+		c.keys = slices.Clone(v.keys)
+		c.fields = make(map[string]*JSONValue, len(v.fields))
+		for k, f := range v.fields {
+			c.fields[k] = f.clone()
+		}
+	}
+	return &c
+}
+
+// typeName is what JSON.TYPE reports for v.
+func (v *JSONValue) typeName() string {
+	switch v.kind {
+	case jsonBool:
+		return "boolean"
+	case jsonInt:
+		return "integer"
+	case jsonFloat:
+		if v.s != "" {
+			return "integer"
+		}
+		return "number"
+	case jsonString:
+		return "string"
+	case jsonArray:
+		return "array"
+	case jsonObject:
+		return "object"
+	default:
+		return "null"
+	}
+}
+
+func (v *JSONValue) isNumber() bool { return v.kind == jsonInt || v.kind == jsonFloat }
+
+func (v *JSONValue) float() float64 {
+	if v.kind == jsonInt {
+		return float64(v.n)
+	}
+	return v.f
+}
+
+// setField adds or replaces the field key of an object.
+func (v *JSONValue) setField(key string, f *JSONValue) {
+	if _, ok := v.fields[key]; !ok {
+		v.keys = append(v.keys, key)
+	}
+	v.fields[key] = f
+}
+
+func (v *JSONValue) deleteField(key string) {
+	delete(v.fields, key)
+	v.keys = slices.DeleteFunc(v.keys, func(k string) bool { return k == key })
+}
+
+// ParseJSON parses a single JSON value, failing with an error wrapping
+// ErrJSONInvalid.
+func ParseJSON(s string) (*JSONValue, error) {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	v, err := parseJSONValue(dec, 0)
+	if err == nil {
+		if _, err = dec.Token(); err == io.EOF {
+			return v, nil
+		}
+		if err == nil {
+			err = fmt.Errorf("trailing characters after the value")
+		}
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = fmt.Errorf("unexpected end of input")
+	}
+	return nil, fmt.Errorf("%w: %v", ErrJSONInvalid, err)
+}
+
+func parseJSONValue(dec *json.Decoder, depth int) (*JSONValue, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case nil:
+		return &JSONValue{kind: jsonNull}, nil
+	case bool:
+		return &JSONValue{kind: jsonBool, b: t}, nil
+	case string:
+		return &JSONValue{kind: jsonString, s: t}, nil
+	case json.Number:
+		return parseJSONNumber(t.String())
+	}
+	if depth == jsonMaxDepth {
+		return nil, fmt.Errorf("recursion limit exceeded")
+	}
+	if tok == json.Delim('[') {
+		v := &JSONValue{kind: jsonArray, elems: []*JSONValue{}}
+		for dec.More() {
+			elem, err := parseJSONValue(dec, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			v.elems = append(v.elems, elem)
+		}
+		_, err := dec.Token()
+		return v, err
+	}
+	v := &JSONValue{kind: jsonObject, fields: make(map[string]*JSONValue)}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		f, err := parseJSONValue(dec, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		v.setField(key.(string), f)
+	}
+	_, err = dec.Token()
+	return v, err
+}
+
+// parseJSONNumber keeps integers that fit in 64 bits exact and stores any
+// other number as a float. Larger integers are written back with the
+// digits they were given with.
+func parseJSONNumber(s string) (*JSONValue, error) {
+	integer := !strings.ContainsAny(s, ".eE")
+	if integer {
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return &JSONValue{kind: jsonInt, n: n}, nil
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, fmt.Errorf("number %s is out of range", s)
+	}
+	v := &JSONValue{kind: jsonFloat, f: f}
+	if integer {
+		v.s = s
+	}
+	return v, nil
+}
+
+// JSONFormat is how JSON.GET lays out what it returns: Indent is repeated
+// once per nesting level at the start of each line, Newline ends lines and
+// Space follows the colon after a key. The zero value writes compact JSON.
+type JSONFormat struct {
+	Indent, Newline, Space string
+}
+
+func (v *JSONValue) String() string {
+	return string(v.appendTo(nil, JSONFormat{}, 0))
+}
+
+func (v *JSONValue) appendTo(b []byte, f JSONFormat, depth int) []byte {
+	switch v.kind {
+	case jsonNull:
+		return append(b, "null"...)
+	case jsonBool:
+		return strconv.AppendBool(b, v.b)
+	case jsonInt:
+		return strconv.AppendInt(b, v.n, 10)
+	case jsonFloat:
+		if v.s != "" {
+			return append(b, v.s...)
+		}
+		return appendJSONFloat(b, v.f)
+	case jsonString:
+		return appendJSONString(b, v.s)
+	}
+	n := len(v.elems)
+	opening, closing := byte('['), byte(']')
+	if v.kind == jsonObject {
+		n = len(v.keys)
+		opening, closing = '{', '}'
+	}
+	b = append(b, opening)
+	for i := range n {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = append(b, f.Newline...)
+		for range depth + 1 {
+			b = append(b, f.Indent...)
+		}
+		if v.kind == jsonObject {
+			b = appendJSONString(b, v.keys[i])
+			b = append(b, ':')
+			b = append(b, f.Space...)
+			b = v.fields[v.keys[i]].appendTo(b, f, depth+1)
+			continue
+		}
+		b = v.elems[i].appendTo(b, f, depth+1)
+	}
+	if n > 0 {
+		b = append(b, f.Newline...)
+		for range depth {
+			b = append(b, f.Indent...)
+		}
+	}
+	return append(b, closing)
+}
+
+// appendJSONFloat writes a float so that it reads back as one: integral
+// values get a ".0" and very large or small ones an exponent.
+func appendJSONFloat(b []byte, f float64) []byte {
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-5 || abs >= 1e16) {
+		return strconv.AppendFloat(b, f, 'e', -1, 64)
+	}
+	start := len(b)
+	b = strconv.AppendFloat(b, f, 'f', -1, 64)
+	if !slices.Contains(b[start:], '.') {
+		b = append(b, ".0"...)
+	}
+	return b
+}
+
+// appendJSONString quotes s, which is valid UTF-8 since it was decoded
+// from JSON.
+func appendJSONString(b []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+	b = append(b, '"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			b = append(b, '\\', c)
+		case c == '\n':
+			b = append(b, `\n`...)
+		case c == '\r':
+			b = append(b, `\r`...)
+		case c == '\t':
+			b = append(b, `\t`...)
+		case c < 0x20:
+			b = append(b, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+		default:
+			b = append(b, c)
+		}
+	}
+	return append(b, '"')
+}
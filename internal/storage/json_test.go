@@ -0,0 +1,195 @@
+package storage
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func mustJSON(t *testing.T, s string) *JSONValue {
+	t.Helper()
+	v, err := ParseJSON(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func mustPath(t *testing.T, s string) *JSONPath {
+	t.Helper()
+	p, err := ParseJSONPath(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// checkJSONBytes checks that the byte count kept for the document at key
+// matches a recount.
+func checkJSONBytes(t *testing.T, kv *KV, key string) {
+	t.Helper()
+	kv.view([]string{key}, func(tx *txn) error {
+		if doc := tx.peek(key).json(); doc.bytes != doc.root.size() {
+			t.Errorf("kept %d bytes for %s; a recount gives %d", doc.bytes, key, doc.root.size())
+		}
+		return nil
+	})
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	for in, want := range map[string]string{
+		` {"b": [1, 2.50, -3e2, true, null], "a": "x\"é\n"} `: `{"b":[1,2.5,-300.0,true,null],"a":"x\"é\n"}`,
+		`{"a":1,"a":2}`:           `{"a":2}`,
+		`9223372036854775808`:     `9223372036854775808`,
+		`[-12345678901234567890]`: `[-12345678901234567890]`,
+		`1e19`:                    `1e+19`,
+		`[]`:                      `[]`,
+		`{"k":{}}`:                `{"k":{}}`,
+		`"\u0001<>"`:              `"\u0001<>"`,
+	} {
+		if got := mustJSON(t, in).String(); got != want {
+			t.Errorf("%s was written back as %s; want %s", in, got, want)
+		}
+	}
+	if typ := mustJSON(t, `12345678901234567890`).typeName(); typ != "integer" {
+		t.Errorf("got type %s for a large integer; want integer", typ)
+	}
+	for _, in := range []string{``, `{"a":}`, `[1] 2`, `1e400`, `{a:1}`} {
+		if _, err := ParseJSON(in); !errors.Is(err, ErrJSONInvalid) {
+			t.Errorf("parsing %q gave %v; want ErrJSONInvalid", in, err)
+		}
+	}
+}
+
+func TestJSONPathSyntax(t *testing.T) {
+	for _, p := range []string{"$", ".", "", "a.b", ".a[0]", "$..a", "$['a b'].c[*]", `$["x\"y"]`, "$.*", "[-1]"} {
+		if _, err := ParseJSONPath(p); err != nil {
+			t.Errorf("%q failed to parse: %v", p, err)
+		}
+	}
+	for _, p := range []string{"$.", "$..", "$[", "$[x]", "$['a'", "..a", "$a"} {
+		if _, err := ParseJSONPath(p); err != ErrJSONPath {
+			t.Errorf("%q parsed; want ErrJSONPath", p)
+		}
+	}
+}
+
+func TestJSONSetGet(t *testing.T) {
+	kv := NewKV()
+	if _, err := kv.JSONSet("doc", mustPath(t, "$.a"), mustJSON(t, "1"), SetAlways); err != ErrJSONNewRoot {
+		t.Fatalf("got %v; want ErrJSONNewRoot", err)
+	}
+	doc := `{"a":1,"b":{"a":"x","c":[1,2]},"d":[{"a":true}]}`
+	if ok, err := kv.JSONSet("doc", mustPath(t, "$"), mustJSON(t, doc), SetNX); !ok || err != nil {
+		t.Fatalf("got %v, %v; want the document to be created", ok, err)
+	}
+	get := func(format JSONFormat, paths ...string) string {
+		t.Helper()
+		var ps []*JSONPath
+		for _, p := range paths {
+			ps = append(ps, mustPath(t, p))
+		}
+		got, _, err := kv.JSONGet("doc", ps, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	for _, tc := range []struct {
+		paths []string
+		want  string
+	}{
+		{[]string{"."}, doc},
+		{[]string{"$..a"}, `[1,"x",true]`},
+		{[]string{"b.c[-1]"}, `2`},
+		{[]string{"$.nope"}, `[]`},
+		{[]string{".a", "$.b.c"}, `{".a":[1],"$.b.c":[[1,2]]}`},
+		{[]string{".a", "d[0].a"}, `{".a":1,"d[0].a":true}`},
+	} {
+		if got := get(JSONFormat{}, tc.paths...); got != tc.want {
+			t.Errorf("getting %v gave %s; want %s", tc.paths, got, tc.want)
+		}
+	}
+	if got, want := get(JSONFormat{Indent: "\t", Newline: "\n", Space: " "}, "$.b"), "[\n\t{\n\t\t\"a\": \"x\",\n\t\t\"c\": [\n\t\t\t1,\n\t\t\t2\n\t\t]\n\t}\n]"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+	if _, _, err := kv.JSONGet("doc", []*JSONPath{mustPath(t, ".nope")}, JSONFormat{}); !errors.Is(err, ErrJSONNoPath) {
+		t.Fatalf("got %v; want ErrJSONNoPath", err)
+	}
+
+	for _, tc := range []struct {
+		path, value string
+		cond        SetCondition
+		applied     bool
+	}{
+		{"$..a", `0`, SetAlways, true},
+		{"$.e", `{"f":[]}`, SetXX, false},
+		{"$.e", `{"f":[]}`, SetNX, true},
+		{"$.e", `1`, SetNX, false},
+		{"$.x.y", `1`, SetAlways, false},
+		{"$.d[*].g", `null`, SetAlways, true},
+	} {
+		ok, err := kv.JSONSet("doc", mustPath(t, tc.path), mustJSON(t, tc.value), tc.cond)
+		if err != nil || ok != tc.applied {
+			t.Errorf("setting %s to %s gave %v, %v; want %v", tc.path, tc.value, ok, err, tc.applied)
+		}
+	}
+	if got, want := get(JSONFormat{}, "$"), `[{"a":0,"b":{"a":0,"c":[1,2]},"d":[{"a":0,"g":null}],"e":{"f":[]}}]`; got != want {
+		t.Errorf("got %s; want %s", got, want)
+	}
+	checkJSONBytes(t, kv, "doc")
+}
+
+func TestJSONUpdates(t *testing.T) {
+	kv := NewKV()
+	kv.JSONSet("doc", mustPath(t, "."), mustJSON(t, `{"n":1,"f":1.5,"s":"abc","arr":[1],"o":{"arr":"no"}}`), SetAlways)
+
+	lens, err := kv.JSONArrAppend("doc", mustPath(t, "$..arr"), mustJSON(t, `2`), mustJSON(t, `[3]`))
+	if err != nil || !slices.Equal(lens, []int{3, -1}) {
+		t.Fatalf("got %v, %v; want [3 -1]", lens, err)
+	}
+	if _, err := kv.JSONArrAppend("doc", mustPath(t, ".o"), mustJSON(t, `1`)); !errors.Is(err, ErrJSONType) {
+		t.Fatalf("got %v; want ErrJSONType", err)
+	}
+	if _, err := kv.JSONArrAppend("missing", mustPath(t, "$"), mustJSON(t, `1`)); err != ErrJSONNoKey {
+		t.Fatalf("got %v; want ErrJSONNoKey", err)
+	}
+
+	for _, tc := range []struct{ path, by, want string }{
+		{"$.*", "2", `[3,3.5,null,null,null]`},
+		{".n", "-3", `0`},
+		{".f", "0.5", `4.0`},
+		{".n", "9223372036854775807", `9223372036854775807`},
+		{".n", "1", `9.223372036854776e+18`},
+	} {
+		got, err := kv.JSONNumIncrBy("doc", mustPath(t, tc.path), mustJSON(t, tc.by))
+		if err != nil || got != tc.want {
+			t.Errorf("incrementing %s by %s gave %s, %v; want %s", tc.path, tc.by, got, err, tc.want)
+		}
+	}
+	if _, err := kv.JSONNumIncrBy("doc", mustPath(t, ".s"), mustJSON(t, "1")); !errors.Is(err, ErrJSONType) {
+		t.Fatalf("got %v; want ErrJSONType", err)
+	}
+
+	if strs, _, _ := kv.JSONStrLen("doc", mustPath(t, "$.*")); !slices.Equal(strs, []int{-1, -1, 3, -1, -1}) {
+		t.Errorf("got string lengths %v", strs)
+	}
+	if keys, _, _ := kv.JSONObjKeys("doc", mustPath(t, ".")); !slices.Equal(keys[0], []string{"n", "f", "s", "arr", "o"}) {
+		t.Errorf("got keys %v", keys)
+	}
+	if types, _, _ := kv.JSONType("doc", mustPath(t, "$.*")); !slices.Equal(types, []string{"number", "number", "string", "array", "object"}) {
+		t.Errorf("got types %v", types)
+	}
+	checkJSONBytes(t, kv, "doc")
+
+	if n, _ := kv.JSONDel("doc", mustPath(t, "$.arr[*]")); n != 3 {
+		t.Errorf("deleted %d array elements; want 3", n)
+	}
+	if n, _ := kv.JSONDel("doc", mustPath(t, "$..arr")); n != 2 {
+		t.Errorf("deleted %d arr fields; want 2", n)
+	}
+	checkJSONBytes(t, kv, "doc")
+	if n, _ := kv.JSONDel("doc", mustPath(t, "$")); n != 1 || kv.Exists("doc") != 0 {
+		t.Errorf("deleting the root removed %d values and left the key", n)
+	}
+}
@@ -0,0 +1,378 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+// lookupJSON returns the document at key, or nil if there is none.
+func (tx *txn) lookupJSON(key string) (*jsonDoc, error) {
+	e := tx.lookup(key)
+	if e == nil {
+		return nil, nil
+	}
+	if e.typ != jsonType {
+		return nil, ErrWrongType
+	}
+	return e.json(), nil
+}
+
+// replace puts v where m was, keeping the byte count of the document.
+func (d *jsonDoc) replace(m jsonMatch, v *JSONValue) {
+	switch {
+	case m.parent == nil:
+		d.root = v
+	case m.parent.kind == jsonArray:
+		m.parent.elems[m.index] = v
+	default:
+		m.parent.fields[m.key] = v
+	}
+	d.bytes += v.size() - m.value.size()
+}
+
+// remove deletes what m selected and reports whether it was still there.
+// Array elements are found by identity, since deleting one shifts the
+// indexes of the others matched by the same path.
+func (d *jsonDoc) remove(m jsonMatch) bool {
+	p := m.parent
+	if p.kind == jsonArray {
+		i := slices.Index(p.elems, m.value)
+		if i < 0 {
+			return false
+		}
+		p.elems = slices.Delete(p.elems, i, i+1)
+		d.bytes -= 8 + m.value.size()
+		return true
+	}
+	if p.fields[m.key] != m.value {
+		return false
+	}
+	p.deleteField(m.key)
+	d.bytes -= jsonFieldSize + int64(len(m.key)) + m.value.size()
+	return true
+}
+
+// resync recounts the bytes of the document after a recursive path, whose
+// matches may be nested in one another, changed it.
+func (d *jsonDoc) resync(p *JSONPath) {
+	if p.recursive {
+		d.bytes = d.root.size()
+	}
+}
+
+// legacyMatches checks that a legacy path matched something and only
+// values of the wanted kind, jsonFloat standing for any number.
+func legacyMatches(p *JSONPath, matches []jsonMatch, kind jsonKind) error {
+	if len(matches) == 0 {
+		return fmt.Errorf("%w: %s", ErrJSONNoPath, p)
+	}
+	for _, m := range matches {
+		if m.value.kind != kind && !(kind == jsonFloat && m.value.isNumber()) {
+			return fmt.Errorf("%w - expected %s but found %s", ErrJSONType, jsonKindName(kind), m.value.typeName())
+		}
+	}
+	return nil
+}
+
+func jsonKindName(kind jsonKind) string {
+	if kind == jsonFloat {
+		return "a number"
+	}
+	return (&JSONValue{kind: kind}).typeName()
+}
+
+// JSONSet sets the values the path selects to value and reports whether
+// anything was set. A path that ends with .key that matches nothing adds
+// the key to the objects the rest of the path selects. A key that doesn't
+// exist can only be created at the root.
+func (s *KV) JSONSet(key string, path *JSONPath, value *JSONValue, cond SetCondition) (bool, error) {
+	var applied bool
+	err := s.update([]string{key}, func(tx *txn) error {
+		doc, err := tx.lookupJSON(key)
+		if err != nil {
+			return err
+		}
+		if doc == nil {
+			if cond == SetXX {
+				return nil
+			}
+			if !path.isRoot() {
+				return ErrJSONNewRoot
+			}
+			tx.set(key, &entry{typ: jsonType, data: newJSONDoc(value)})
+			applied = true
+			return nil
+		}
+		matches := path.eval(doc.root)
+		if len(matches) > 0 {
+			if cond == SetNX {
+				return nil
+			}
+			for i, m := range matches {
+				v := value
+				if i > 0 {
+					v = value.clone()
+				}
+				doc.replace(m, v)
+			}
+			doc.resync(path)
+			applied = true
+			return nil
+		}
+		if cond == SetXX {
+			return nil
+		}
+		parents, field := path.missingField(doc.root)
+		for i, p := range parents {
+			v := value
+			if i > 0 {
+				v = value.clone()
+			}
+			p.setField(field, v)
+			doc.bytes += jsonFieldSize + int64(len(field)) + v.size()
+		}
+		applied = len(parents) > 0
+		return nil
+	})
+	return applied, err
+}
+
+// JSONGet returns the values the paths select, written with the given
+// format. With a single path that is the value of a legacy path or an
+// array of the values of a JSONPath; with several, an object with the
+// result of each path. Legacy results are only used if all the paths are
+// legacy ones. exists is false if there is no document at key.
+func (s *KV) JSONGet(key string, paths []*JSONPath, format JSONFormat) (result string, exists bool, err error) {
+	err = s.view([]string{key}, func(tx *txn) error {
+		doc, err := tx.lookupJSON(key)
+		if err != nil || doc == nil {
+			return err
+		}
+		exists = true
+		legacy := true
+		for _, p := range paths {
+			legacy = legacy && p.legacy
+		}
+		results := make([]*JSONValue, len(paths))
+		for i, p := range paths {
+			matches := p.eval(doc.root)
+			if !legacy {
+				arr := &JSONValue{kind: jsonArray, elems: make([]*JSONValue, len(matches))}
+				for j, m := range matches {
+					arr.elems[j] = m.value
+				}
+				results[i] = arr
+				continue
+			}
+			if len(matches) == 0 {
+				return fmt.Errorf("%w: %s", ErrJSONNoPath, p)
+			}
+			results[i] = matches[0].value
+		}
+		out := results[0]
+		if len(paths) > 1 {
+			out = &JSONValue{kind: jsonObject, fields: make(map[string]*JSONValue)}
+			for i, p := range paths {
+				out.setField(p.text, results[i])
+			}
+		}
+		result = string(out.appendTo(nil, format, 0))
+		return nil
+	})
+	return result, exists, err
+}
+
+// JSONDel deletes the values the path selects and returns how many there
+// were. Deleting the root deletes the key.
+func (s *KV) JSONDel(key string, path *JSONPath) (int, error) {
+	var deleted int
+	err := s.update([]string{key}, func(tx *txn) error {
+		doc, err := tx.lookupJSON(key)
+		if err != nil || doc == nil {
+			return err
+		}
+		if path.isRoot() {
+			tx.delete(key)
+			deleted = 1
+			return nil
+		}
+		for _, m := range path.eval(doc.root) {
+			if doc.remove(m) {
+				deleted++
+			}
+		}
+		doc.resync(path)
+		return nil
+	})
+	return deleted, err
+}
+
+// jsonRead calls fn with the matches of path in the document at key, if
+// there is one.
+func (s *KV) jsonRead(key string, path *JSONPath, fn func([]jsonMatch) error) (exists bool, err error) {
+	err = s.view([]string{key}, func(tx *txn) error {
+		doc, err := tx.lookupJSON(key)
+		if err != nil || doc == nil {
+			return err
+		}
+		exists = true
+		return fn(path.eval(doc.root))
+	})
+	return exists, err
+}
+
+// JSONType returns the type names of the values the path selects.
+func (s *KV) JSONType(key string, path *JSONPath) ([]string, bool, error) {
+	var types []string
+	exists, err := s.jsonRead(key, path, func(matches []jsonMatch) error {
+		for _, m := range matches {
+			types = append(types, m.value.typeName())
+		}
+		return nil
+	})
+	return types, exists, err
+}
+
+// JSONStrLen returns the lengths of the strings the path selects, -1 for
+// the values that aren't strings.
+func (s *KV) JSONStrLen(key string, path *JSONPath) ([]int, bool, error) {
+	var lens []int
+	exists, err := s.jsonRead(key, path, func(matches []jsonMatch) error {
+		if path.legacy {
+			if err := legacyMatches(path, matches, jsonString); err != nil {
+				return err
+			}
+		}
+		for _, m := range matches {
+			n := -1
+			if m.value.kind == jsonString {
+				n = len(m.value.s)
+			}
+			lens = append(lens, n)
+		}
+		return nil
+	})
+	return lens, exists, err
+}
+
+// JSONObjKeys returns the keys of the objects the path selects, nil for
+// the values that aren't objects.
+func (s *KV) JSONObjKeys(key string, path *JSONPath) ([][]string, bool, error) {
+	var keys [][]string
+	exists, err := s.jsonRead(key, path, func(matches []jsonMatch) error {
+		if path.legacy {
+			if err := legacyMatches(path, matches, jsonObject); err != nil {
+				return err
+			}
+		}
+		for _, m := range matches {
+			var k []string
+			if m.value.kind == jsonObject {
+				k = slices.Clone(m.value.keys)
+			}
+			keys = append(keys, k)
+		}
+		return nil
+	})
+	return keys, exists, err
+}
+
+// JSONArrAppend appends values to the arrays the path selects and returns
+// their new lengths, -1 for the values that aren't arrays.
+func (s *KV) JSONArrAppend(key string, path *JSONPath, values ...*JSONValue) ([]int, error) {
+	var lens []int
+	err := s.update([]string{key}, func(tx *txn) error {
+		doc, err := tx.lookupJSON(key)
+		if err != nil {
+			return err
+		}
+		if doc == nil {
+			return ErrJSONNoKey
+		}
+		matches := path.eval(doc.root)
+		if path.legacy {
+			if err := legacyMatches(path, matches, jsonArray); err != nil {
+				return err
+			}
+		}
+		for i, m := range matches {
+			if m.value.kind != jsonArray {
+				lens = append(lens, -1)
+				continue
+			}
+			for _, v := range values {
+				if i > 0 {
+					v = v.clone()
+				}
+				m.value.elems = append(m.value.elems, v)
+				doc.bytes += 8 + v.size()
+			}
+			lens = append(lens, len(m.value.elems))
+		}
+		return nil
+	})
+	return lens, err
+}
+
+// jsonAdd returns a + b: an integer if both are and the sum fits, a float
+// otherwise.
+func jsonAdd(a, b *JSONValue) (*JSONValue, error) {
+	if a.kind == jsonInt && b.kind == jsonInt {
+		if sum := a.n + b.n; (sum > a.n) == (b.n > 0) {
+			return &JSONValue{kind: jsonInt, n: sum}, nil
+		}
+	}
+	sum := a.float() + b.float()
+	if math.IsInf(sum, 0) || math.IsNaN(sum) {
+		return nil, ErrNaN
+	}
+	return &JSONValue{kind: jsonFloat, f: sum}, nil
+}
+
+// JSONNumIncrBy adds by to the numbers the path selects. It returns the
+// new value for a legacy path, or else an array of the new values with
+// null for the values that aren't numbers, both as JSON.
+func (s *KV) JSONNumIncrBy(key string, path *JSONPath, by *JSONValue) (string, error) {
+	if !by.isNumber() {
+		return "", ErrNotFloat
+	}
+	var result string
+	err := s.update([]string{key}, func(tx *txn) error {
+		doc, err := tx.lookupJSON(key)
+		if err != nil {
+			return err
+		}
+		if doc == nil {
+			return ErrJSONNoKey
+		}
+		matches := path.eval(doc.root)
+		if path.legacy {
+			if err := legacyMatches(path, matches, jsonFloat); err != nil {
+				return err
+			}
+		}
+		// compute everything first so that an overflow changes nothing
+		sums := &JSONValue{kind: jsonArray, elems: make([]*JSONValue, len(matches))}
+		for i, m := range matches {
+			sums.elems[i] = &JSONValue{kind: jsonNull}
+			if m.value.isNumber() {
+				if sums.elems[i], err = jsonAdd(m.value, by); err != nil {
+					return err
+				}
+			}
+		}
+		for i, m := range matches {
+			if m.value.isNumber() {
+				*m.value = *sums.elems[i]
+			}
+		}
+		if path.legacy {
+			result = sums.elems[len(sums.elems)-1].String()
+		} else {
+			result = sums.String()
+		}
+		return nil
+	})
+	return result, err
+}
@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"strconv"
+	"strings"
+)
+
+type jsonStepOp int
+
+const (
+	jsonChild jsonStepOp = iota
+	jsonIndex
+	jsonWildcard
+)
+
+// jsonStep selects, from each value it is applied to, the field key, the
+// element index or every child. A recursive step is applied to the value
+// and to everything below it, like .. in JSONPath.
+type jsonStep struct {
+	op        jsonStepOp
+	key       string
+	index     int
+	recursive bool
+}
+
+// JSONPath is a parsed path into a JSON document. Two syntaxes are
+// understood: JSONPath proper, which starts with $ and may match any
+// number of values, and the legacy syntax of RedisJSON v1 (".", ".a.b",
+// "a[0]"), with which commands act on a single value and report a missing
+// one as an error. Both support .key, ['key'], [index] counted from the end
+// when negative, .* and [*], and JSONPath also .. for recursive descent.
+type JSONPath struct {
+	text      string
+	legacy    bool
+	steps     []jsonStep
+	recursive bool
+}
+
+// ParseJSONPath parses path, failing with ErrJSONPath.
+func ParseJSONPath(path string) (*JSONPath, error) {
+	p := &JSONPath{text: path}
+	rest, ok := strings.CutPrefix(path, "$")
+	if !ok {
+		p.legacy = true
+		switch {
+		case path == ".":
+			rest = ""
+		case path != "" && path[0] != '.' && path[0] != '[':
+			rest = "." + path
+		}
+	}
+	for rest != "" {
+		var step jsonStep
+		var err error
+		if step, rest, err = parseJSONStep(rest, p.legacy); err != nil {
+			return nil, err
+		}
+		p.recursive = p.recursive || step.recursive
+		p.steps = append(p.steps, step)
+	}
+	return p, nil
+}
+
+func parseJSONStep(s string, legacy bool) (jsonStep, string, error) {
+	var step jsonStep
+	if rest, ok := strings.CutPrefix(s, ".."); ok && !legacy {
+		step.recursive = true
+		if strings.HasPrefix(rest, "[") {
+			return parseJSONBracket(step, rest[1:])
+		}
+		s = "." + rest
+	}
+	if s[0] == '[' {
+		return parseJSONBracket(step, s[1:])
+	}
+	if s[0] != '.' {
+		return step, "", ErrJSONPath
+	}
+	end := strings.IndexAny(s[1:], ".[") + 1
+	if end == 0 {
+		end = len(s)
+	}
+	name := s[1:end]
+	switch name {
+	case "":
+		return step, "", ErrJSONPath
+	case "*":
+		step.op = jsonWildcard
+	default:
+		step.op, step.key = jsonChild, name
+	}
+	return step, s[end:], nil
+}
+
+// parseJSONBracket parses what follows a [: *], an index or a quoted key.
+func parseJSONBracket(step jsonStep, s string) (jsonStep, string, error) {
+	if rest, ok := strings.CutPrefix(s, "*]"); ok {
+		step.op = jsonWildcard
+		return step, rest, nil
+	}
+	if s != "" && (s[0] == '\'' || s[0] == '"') {
+		quote := s[0]
+		var key strings.Builder
+		for i := 1; i < len(s); i++ {
+			switch c := s[i]; {
+			case c == '\\' && i+1 < len(s):
+				i++
+				key.WriteByte(s[i])
+			case c == quote:
+				if i+1 == len(s) || s[i+1] != ']' {
+					return step, "", ErrJSONPath
+				}
+				step.op, step.key = jsonChild, key.String()
+				return step, s[i+2:], nil
+			default:
+				key.WriteByte(c)
+			}
+		}
+		return step, "", ErrJSONPath
+	}
+	end := strings.IndexByte(s, ']')
+	if end < 0 {
+		return step, "", ErrJSONPath
+	}
+	idx, err := strconv.Atoi(strings.TrimSpace(s[:end]))
+	if err != nil {
+		return step, "", ErrJSONPath
+	}
+	step.op, step.index = jsonIndex, idx
+	return step, s[end+1:], nil
+}
+
+func (p *JSONPath) String() string { return p.text }
+
+// Legacy reports whether the path uses the legacy syntax.
+func (p *JSONPath) Legacy() bool { return p.legacy }
+
+func (p *JSONPath) isRoot() bool { return len(p.steps) == 0 }
+
+// jsonMatch is a value a path selected, with where it sits: the key or
+// index under parent, which is nil for the root.
+type jsonMatch struct {
+	parent *JSONValue
+	key    string
+	index  int
+	value  *JSONValue
+}
+
+// apply appends to out what the step selects directly under v.
+func (st jsonStep) apply(v *JSONValue, out []jsonMatch) []jsonMatch {
+	switch {
+	case v.kind == jsonObject && st.op == jsonChild:
+		if f, ok := v.fields[st.key]; ok {
+			out = append(out, jsonMatch{parent: v, key: st.key, value: f})
+		}
+	case v.kind == jsonObject && st.op == jsonWildcard:
+		for _, k := range v.keys {
+			out = append(out, jsonMatch{parent: v, key: k, value: v.fields[k]})
+		}
+	case v.kind == jsonArray && st.op == jsonIndex:
+		if i, ok := normalizeIndex(st.index, len(v.elems)); ok {
+			out = append(out, jsonMatch{parent: v, index: i, value: v.elems[i]})
+		}
+	case v.kind == jsonArray && st.op == jsonWildcard:
+		for i, e := range v.elems {
+			out = append(out, jsonMatch{parent: v, index: i, value: e})
+		}
+	}
+	return out
+}
+
+// walk calls fn for v and every value below it, parents first.
+func (v *JSONValue) walk(fn func(*JSONValue)) {
+	fn(v)
+	for _, e := range v.elems {
+		e.walk(fn)
+	}
+	for _, k := range v.keys {
+		v.fields[k].walk(fn)
+	}
+}
+
+// evalJSONSteps returns the values the steps select in root, in document
+// order.
+func evalJSONSteps(steps []jsonStep, root *JSONValue) []jsonMatch {
+	matches := []jsonMatch{{value: root}}
+	for _, st := range steps {
+		var next []jsonMatch
+		for _, m := range matches {
+			if !st.recursive {
+				next = st.apply(m.value, next)
+				continue
+			}
+			m.value.walk(func(v *JSONValue) { next = st.apply(v, next) })
+		}
+		matches = next
+	}
+	return matches
+}
+
+func (p *JSONPath) eval(root *JSONValue) []jsonMatch {
+	return evalJSONSteps(p.steps, root)
+}
+
+// missingField returns the objects the path would add a field to if it
+// were set: when it ends with a plain .key, the objects the rest of the
+// path selects that don't have that key yet.
+func (p *JSONPath) missingField(root *JSONValue) ([]*JSONValue, string) {
+	if p.isRoot() {
+		return nil, ""
+	}
+	last := p.steps[len(p.steps)-1]
+	if last.op != jsonChild || last.recursive {
+		return nil, ""
+	}
+	var parents []*JSONValue
+	for _, m := range evalJSONSteps(p.steps[:len(p.steps)-1], root) {
+		if _, ok := m.value.fields[last.key]; m.value.kind == jsonObject && !ok {
+			parents = append(parents, m.value)
+		}
+	}
+	return parents, last.key
+}
@@ -0,0 +1,118 @@
+package storage
+
+// listStore is implemented by every list encoding.
+type listStore interface {
+	len() int
+	pushLeft(values ...string)
+	pushRight(values ...string)
+	popLeft() (string, bool)
+	popRight() (string, bool)
+	rangeItems(start, stop int) []string
+	// index, set, insert and delete take indexes already normalized to
+	// the list bounds; insert places v before index i, or at the tail for
+	// i == len.
+	index(i int) string
+	set(i int, v string)
+	insert(i int, v string)
+	delete(i, count int)
+	forEach(fn func(i int, v string) bool)
+	forEachReverse(fn func(i int, v string) bool)
+	size() int
+	memUsage() int64
+	encoding() string
+}
+
+type listpackList struct{ lp *listpack }
+
+func (l listpackList) len() int { return l.lp.len() }
+
+func (l listpackList) pushLeft(values ...string) {
+	for _, v := range values {
+		l.lp.insert(0, v)
+	}
+}
+
+func (l listpackList) pushRight(values ...string) {
+	l.lp.insert(l.lp.len(), values...)
+}
+
+func (l listpackList) popLeft() (string, bool) {
+	if l.lp.len() == 0 {
+		return "", false
+	}
+	v := l.lp.at(0)
+	l.lp.delete(0, 1)
+	return v, true
+}
+
+func (l listpackList) popRight() (string, bool) {
+	if l.lp.len() == 0 {
+		return "", false
+	}
+	last := l.lp.len() - 1
+	v := l.lp.at(last)
+	l.lp.delete(last, 1)
+	return v, true
+}
+
+func (l listpackList) rangeItems(start, stop int) []string {
+	items := make([]string, 0, stop-start+1)
+	l.lp.forEach(func(i int, v string) bool {
+		if i >= start {
+			items = append(items, v)
+		}
+		return i < stop
+	})
+	return items
+}
+
+func (l listpackList) index(i int) string                { return l.lp.at(i) }
+func (l listpackList) set(i int, v string)               { l.lp.replace(i, v) }
+func (l listpackList) insert(i int, v string)            { l.lp.insert(i, v) }
+func (l listpackList) delete(i, count int)               { l.lp.delete(i, count) }
+func (l listpackList) forEach(fn func(int, string) bool) { l.lp.forEach(fn) }
+
+func (l listpackList) forEachReverse(fn func(i int, v string) bool) {
+	values := l.lp.values()
+	for i := len(values) - 1; i >= 0; i-- {
+		if !fn(i, values[i]) {
+			return
+		}
+	}
+}
+
+func (l listpackList) size() int        { return l.lp.bytes() }
+func (l listpackList) memUsage() int64  { return l.lp.memUsage() }
+func (l listpackList) encoding() string { return "listpack" }
+
+func newListStore(lim *EncodingLimits, values []string) listStore {
+	var l listStore = listpackList{newListpack()}
+	l = convertListFor(lim, l, len(values), len(encodeListpackValues(values)))
+	l.pushRight(values...)
+	return l
+}
+
+// convertListFor returns l in the encoding that suits a list of n elements
+// taking size bytes. Both conversions reuse the listpack: it becomes the
+// only node of the quicklist, and a quicklist left with a single node gives
+// it back. That only happens once the list shrank to half the limits, so
+// pushing and popping around the threshold doesn't convert it back and forth.
+func convertListFor(lim *EncodingLimits, l listStore, n, size int) listStore {
+	switch l := l.(type) {
+	case listpackList:
+		if lim.listFits(n, size) {
+			return l
+		}
+		return newQuicklistFromListpack(lim, l.lp)
+	case *quicklist:
+		if l.nodes > 1 || !lim.listFits(n*2, size*2) {
+			return l
+		}
+		if l.head == nil {
+			return listpackList{newListpack()}
+		}
+		return listpackList{l.head.lp}
+	default:
+		return l
+	}
+}
@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestLMoveSameKey(t *testing.T) {
+	tests := []struct {
+		values           []string
+		fromLeft, toLeft bool
+		moved            string
+		want             []string
+	}{
+		{[]string{"a"}, false, true, "a", []string{"a"}},
+		{[]string{"a"}, true, false, "a", []string{"a"}},
+		{[]string{"a", "b", "c"}, false, true, "c", []string{"c", "a", "b"}},
+		{[]string{"a", "b", "c"}, true, false, "a", []string{"b", "c", "a"}},
+		{[]string{"a", "b", "c"}, true, true, "a", []string{"a", "b", "c"}},
+	}
+	for _, tt := range tests {
+		kv := NewKV()
+		kv.RPush("l", tt.values...)
+		moved, ok, err := kv.LMove("l", "l", tt.fromLeft, tt.toLeft)
+		if err != nil || !ok || moved != tt.moved {
+			t.Fatalf("%q from left %v to left %v: got %q, %v, %v; want %q", tt.values, tt.fromLeft, tt.toLeft, moved, ok, err, tt.moved)
+		}
+		got, _ := kv.LRange("l", 0, -1)
+		if !slices.Equal(got, tt.want) {
+			t.Fatalf("%q from left %v to left %v: list is %q; want %q", tt.values, tt.fromLeft, tt.toLeft, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"encoding/binary"
+	"unsafe"
+)
+
+// listpack stores a sequence of strings in one contiguous buffer, each one
+// prefixed with its uvarint length. Small collections pay for a single
+// allocation instead of a string header and a separate allocation per
+// element, at the cost of O(n) access, which is why collections switch to
+// a real data structure once they outgrow the EncodingLimits.
+type listpack struct {
+	buf []byte
+	n   int
+}
+
+func newListpack(values ...string) *listpack {
+	lp := &listpack{}
+	lp.insert(0, values...)
+	return lp
+}
+
+func (lp *listpack) len() int {
+	return lp.n
+}
+
+// next decodes the element at byte offset off and returns it together with
+// the offset of the following element.
+func (lp *listpack) next(off int) (string, int) {
+	size, n := binary.Uvarint(lp.buf[off:])
+	start := off + n
+	end := start + int(size)
+	return string(lp.buf[start:end]), end
+}
+
+// offset returns the byte offset of the element at index i, or the end of
+// the buffer for i == len.
+func (lp *listpack) offset(i int) int {
+	off := 0
+	for ; i > 0; i-- {
+		size, n := binary.Uvarint(lp.buf[off:])
+		off += n + int(size)
+	}
+	return off
+}
+
+func (lp *listpack) at(i int) string {
+	v, _ := lp.next(lp.offset(i))
+	return v
+}
+
+func (lp *listpack) forEach(fn func(i int, v string) bool) {
+	off := 0
+	for i := 0; i < lp.n; i++ {
+		var v string
+		v, off = lp.next(off)
+		if !fn(i, v) {
+			return
+		}
+	}
+}
+
+// index returns the position of the first element equal to v, looking only
+// at every step-th element, or -1.
+func (lp *listpack) index(v string, step int) int {
+	found := -1
+	lp.forEach(func(i int, elem string) bool {
+		if i%step == 0 && elem == v {
+			found = i
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+func (lp *listpack) values() []string {
+	values := make([]string, 0, lp.n)
+	lp.forEach(func(_ int, v string) bool {
+		values = append(values, v)
+		return true
+	})
+	return values
+}
+
+func encodeListpackValues(values []string) []byte {
+	var encoded []byte
+	for _, v := range values {
+		encoded = binary.AppendUvarint(encoded, uint64(len(v)))
+		encoded = append(encoded, v...)
+	}
+	return encoded
+}
+
+// insert places values before the element at index i, in their given order.
+func (lp *listpack) insert(i int, values ...string) {
+	if len(values) == 0 {
+		return
+	}
+	off := lp.offset(i)
+	lp.buf = append(lp.buf[:off], append(encodeListpackValues(values), lp.buf[off:]...)...)
+	lp.n += len(values)
+}
+
+func (lp *listpack) replace(i int, v string) {
+	start := lp.offset(i)
+	_, end := lp.next(start)
+	lp.buf = append(lp.buf[:start], append(encodeListpackValues([]string{v}), lp.buf[end:]...)...)
+}
+
+// delete removes count elements starting at index i.
+func (lp *listpack) delete(i, count int) {
+	start := lp.offset(i)
+	end := start
+	for j := 0; j < count; j++ {
+		_, end = lp.next(end)
+	}
+	lp.buf = append(lp.buf[:start], lp.buf[end:]...)
+	lp.n -= count
+}
+
+func (lp *listpack) bytes() int {
+	return len(lp.buf)
+}
+
+func (lp *listpack) memUsage() int64 {
+	return int64(unsafe.Sizeof(*lp)) + int64(cap(lp.buf))
+}
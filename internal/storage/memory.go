@@ -0,0 +1,98 @@
+package storage
+
+import "unsafe"
+
+var (
+	entrySize        = int64(unsafe.Sizeof(entry{}))
+	keyspaceSlotSize = int64(unsafe.Sizeof(dictEntry[*entry]{}))
+)
+
+// keyMemUsage is what a key costs besides its value: the slot in the
+// keyspace dict, the key bytes and the entry header.
+func keyMemUsage(key string) int64 {
+	return keyspaceSlotSize + int64(len(key)) + entrySize
+}
+
+// memUsage estimates the bytes held by the value of the entry. It is O(1) for
+// every type because containers keep their own byte counters.
+func (e *entry) memUsage() int64 {
+	switch e.typ {
+	case stringType:
+		if b, ok := e.data.([]byte); ok {
+			return int64(cap(b))
+		}
+		return int64(len(e.data.(string)))
+	case listType:
+		return e.list().memUsage()
+	case setType:
+		return e.set().memUsage()
+	case hashType:
+		if e.fieldExpires != nil {
+			return e.hash().memUsage() + e.fieldExpires.memUsage()
+		}
+		return e.hash().memUsage()
+	case zsetType:
+		return e.zset().memUsage()
+	case streamType:
+		return e.stream().memUsage()
+	case bloomType:
+		return e.bloom().memUsage()
+	case cmsType:
+		return e.cms().memUsage()
+	case jsonType:
+		return e.json().memUsage()
+	default:
+		return 0
+	}
+}
+
+// charge adds a key that was just linked into the keyspace to used memory.
+func (s *KV) charge(key string, e *entry) {
+	e.accounted = e.memUsage()
+	e.live = true
+	s.used.Add(keyMemUsage(key) + e.accounted)
+}
+
+// release removes a key that was just unlinked from the keyspace from used memory.
+func (s *KV) release(key string, e *entry) {
+	s.used.Add(-(keyMemUsage(key) + e.accounted))
+	e.accounted = 0
+	e.live = false
+}
+
+// recharge applies the size change of an entry that was modified in place.
+func (s *KV) recharge(e *entry) {
+	if !e.live {
+		return
+	}
+	current := e.memUsage()
+	s.used.Add(current - e.accounted)
+	e.accounted = current
+}
+
+func (s *KV) UsedMemory() int64 {
+	return s.used.Load()
+}
+
+func (d *Databases) UsedMemory() int64 {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	var used int64
+	for _, db := range d.dbs {
+		used += db.UsedMemory()
+	}
+	return used
+}
+
+// Overhead returns the memory taken by the main and expires tables of the
+// database, excluding the values they point to.
+func (s *KV) Overhead() (main, expires int64) {
+	s.viewAll(func(tx *txn) error {
+		for _, idx := range tx.shards {
+			main += s.shards[idx].data.memUsage() + int64(s.shards[idx].data.len())*entrySize
+			expires += s.shards[idx].expires.memUsage()
+		}
+		return nil
+	})
+	return main, expires
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"strconv"
+	"time"
+)
+
+// embstrSizeLimit is the longest string Redis stores in a single allocation
+// together with its object header.
+const embstrSizeLimit = 44
+
+type ObjectInfo struct {
+	Encoding string
+	Idle     time.Duration
+	Freq     int
+}
+
+// encoding names the representation of the value the way OBJECT ENCODING
+// reports it.
+func (e *entry) encoding() string {
+	switch e.typ {
+	case stringType:
+		s, ok := e.data.(string)
+		if !ok {
+			return "raw"
+		}
+		if len(s) <= 20 {
+			if n, err := strconv.ParseInt(s, 10, 64); err == nil && strconv.FormatInt(n, 10) == s {
+				return "int"
+			}
+		}
+		if len(s) <= embstrSizeLimit {
+			return "embstr"
+		}
+		return "raw"
+	case listType:
+		return e.list().encoding()
+	case setType:
+		return e.set().encoding()
+	case hashType:
+		// like Redis, a listpack with field TTLs is reported separately
+		if _, ok := e.hash().(listpackHash); ok && e.fieldExpires != nil {
+			return "listpackex"
+		}
+		return e.hash().encoding()
+	case zsetType:
+		return e.zset().encoding()
+	case streamType:
+		return "stream"
+	case bloomType, cmsType, jsonType:
+		return "raw"
+	default:
+		return "unknown"
+	}
+}
+
+// Object describes the value at key without counting as an access to it.
+func (s *KV) Object(key string) (ObjectInfo, bool) {
+	var info ObjectInfo
+	var exists bool
+	s.view([]string{key}, func(tx *txn) error {
+		e := tx.peek(key)
+		if e == nil {
+			return nil
+		}
+		exists = true
+		info = ObjectInfo{Encoding: e.encoding(), Idle: e.idleTime(), Freq: int(e.lfuCounter())}
+		return nil
+	})
+	return info, exists
+}
+
+// MemoryUsage estimates the bytes needed to store key and its value.
+func (s *KV) MemoryUsage(key string) (int64, bool) {
+	var usage int64
+	var exists bool
+	s.view([]string{key}, func(tx *txn) error {
+		e := tx.peek(key)
+		if e == nil {
+			return nil
+		}
+		exists = true
+		usage = keyMemUsage(key) + e.memUsage()
+		return nil
+	})
+	return usage, exists
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestObjectEncoding_Conversions(t *testing.T) {
+	lim := DefaultEncodingLimits()
+	lim.ListMaxListpackSize = 4
+	lim.SetMaxIntsetEntries = 4
+	lim.SetMaxListpackEntries = 6
+	lim.HashMaxListpackEntries = 4
+	lim.HashMaxListpackValue = 8
+	lim.ZsetMaxListpackEntries = 4
+	dbs := NewDatabases(1, 4)
+	dbs.SetEncodingLimits(lim)
+	kv := dbs.DB(0)
+
+	long := strings.Repeat("x", 9)
+	tests := []struct {
+		name string
+		key  string
+		op   func()
+		want string
+		// grows is set for the conversions to a larger encoding, which
+		// must be seen by MEMORY USAGE
+		grows bool
+	}{
+		{"integer string", "s", func() { kv.Set("s", "12345") }, "int", false},
+		{"short string", "s", func() { kv.Set("s", "abc") }, "embstr", false},
+		{"long string", "s", func() { kv.Set("s", strings.Repeat("x", 45)) }, "raw", true},
+		{"small list", "l", func() { kv.RPush("l", "a", "b", "c", "d") }, "listpack", false},
+		{"list over the size", "l", func() { kv.RPush("l", "e") }, "quicklist", true},
+		{"integer set", "set", func() { kv.SAdd("set", "1", "2", "3", "4") }, "intset", false},
+		{"set over the intset entries", "set", func() { kv.SAdd("set", "5") }, "listpack", true},
+		{"set with a string", "set2", func() { kv.SAdd("set2", "1", "a") }, "listpack", false},
+		{"set over the listpack entries", "set2", func() { kv.SAdd("set2", "b", "c", "d", "e", "f") }, "hashtable", true},
+		{"small hash", "h", func() { kv.HSet("h", "f", "v") }, "listpack", false},
+		{"hash with a field TTL", "h", func() {
+			kv.HExpireAt("h", time.Now().Add(time.Hour).UnixMilli(), 0, "f")
+		}, "listpackex", true},
+		{"hash over the value size", "h", func() { kv.HSet("h", "g", long) }, "hashtable", true},
+		{"small zset", "z", func() {
+			kv.ZAdd("z", 0, ZMember{"a", 1}, ZMember{"b", 2}, ZMember{"c", 3}, ZMember{"d", 4})
+		}, "listpack", false},
+		{"zset over the entries", "z", func() { kv.ZAdd("z", 0, ZMember{"e", 5}) }, "skiplist", true},
+	}
+	for _, tt := range tests {
+		before, _ := kv.MemoryUsage(tt.key)
+		tt.op()
+		info, ok := kv.Object(tt.key)
+		if !ok {
+			t.Fatalf("%s: key %s is missing", tt.name, tt.key)
+		}
+		if info.Encoding != tt.want {
+			t.Fatalf("%s: got encoding %s; want %s", tt.name, info.Encoding, tt.want)
+		}
+		after, _ := kv.MemoryUsage(tt.key)
+		if after <= 0 || tt.grows && after <= before {
+			t.Fatalf("%s: got memory usage %d, %d before", tt.name, after, before)
+		}
+	}
+}
+
+func TestObject_FreqAndIdle(t *testing.T) {
+	kv := NewKV()
+	kv.Set("k", "v")
+	time.Sleep(20 * time.Millisecond)
+
+	// OBJECT doesn't count as an access
+	for range 2 {
+		info, ok := kv.Object("k")
+		if !ok {
+			t.Fatalf("expected the key to exist")
+		}
+		if info.Freq != lfuInitVal || info.Idle < 20*time.Millisecond {
+			t.Fatalf("got freq %d and idle time %v; want %d and at least 20ms", info.Freq, info.Idle, lfuInitVal)
+		}
+	}
+
+	// the first access of a new key always increments its counter
+	kv.Get("k")
+	info, _ := kv.Object("k")
+	if info.Freq != lfuInitVal+1 || info.Idle >= 20*time.Millisecond {
+		t.Fatalf("got freq %d and idle time %v after an access", info.Freq, info.Idle)
+	}
+
+	if _, ok := kv.Object("missing"); ok {
+		t.Fatalf("expected no object for a missing key")
+	}
+	if _, ok := kv.MemoryUsage("missing"); ok {
+		t.Fatalf("expected no memory usage for a missing key")
+	}
+}
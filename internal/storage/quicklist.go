@@ -0,0 +1,310 @@
+package storage
+
+import "unsafe"
+
+type quicklistNode struct {
+	prev, next *quicklistNode
+	lp         *listpack
+}
+
+// quicklist is a doubly linked list of listpack nodes. Each node is filled up
+// to the list-max-listpack-size limit, so pushes and pops at both ends touch
+// one small node and ranges skip whole nodes instead of single elements.
+type quicklist struct {
+	head, tail *quicklistNode
+	count      int
+	nodes      int
+	// bytes is the size of the elements in all nodes, mem the memory held
+	// by the nodes, both kept up to date by every change
+	bytes int
+	mem   int64
+	lim   *EncodingLimits
+}
+
+var (
+	quicklistSize     = int64(unsafe.Sizeof(quicklist{}))
+	quicklistNodeSize = int64(unsafe.Sizeof(quicklistNode{}))
+)
+
+func newQuicklist(lim *EncodingLimits) *quicklist {
+	return &quicklist{lim: lim}
+}
+
+// newQuicklistFromListpack turns a listpack into the first node of a
+// quicklist without copying its elements.
+func newQuicklistFromListpack(lim *EncodingLimits, lp *listpack) *quicklist {
+	ql := newQuicklist(lim)
+	if lp.len() > 0 {
+		ql.linkBefore(nil, &quicklistNode{lp: lp})
+		ql.count = lp.len()
+	}
+	return ql
+}
+
+func (ql *quicklist) len() int {
+	return ql.count
+}
+
+// fits reports whether v can be added to node without exceeding the fill
+// limit. An empty node takes any element, however large.
+func (ql *quicklist) fits(node *quicklistNode, v string) bool {
+	if node == nil {
+		return false
+	}
+	if node.lp.len() == 0 {
+		return true
+	}
+	return ql.lim.listFits(node.lp.len()+1, node.lp.bytes()+len(encodeListpackValues([]string{v})))
+}
+
+func (ql *quicklist) linkBefore(next, node *quicklistNode) {
+	node.next = next
+	if next == nil {
+		node.prev = ql.tail
+		if ql.tail != nil {
+			ql.tail.next = node
+		}
+		ql.tail = node
+	} else {
+		node.prev = next.prev
+		if next.prev != nil {
+			next.prev.next = node
+		}
+		next.prev = node
+	}
+	if node.prev == nil {
+		ql.head = node
+	}
+	ql.nodes++
+	ql.bytes += node.lp.bytes()
+	ql.mem += quicklistNodeSize + node.lp.memUsage()
+}
+
+func (ql *quicklist) unlink(node *quicklistNode) {
+	if node.prev != nil {
+		node.prev.next = node.next
+	} else {
+		ql.head = node.next
+	}
+	if node.next != nil {
+		node.next.prev = node.prev
+	} else {
+		ql.tail = node.prev
+	}
+	node.prev, node.next = nil, nil
+	ql.nodes--
+	ql.bytes -= node.lp.bytes()
+	ql.mem -= quicklistNodeSize + node.lp.memUsage()
+}
+
+// edit applies fn to the listpack of a linked node, keeping the counters
+// of the quicklist in step.
+func (ql *quicklist) edit(node *quicklistNode, fn func(lp *listpack)) {
+	bytes, mem := node.lp.bytes(), node.lp.memUsage()
+	fn(node.lp)
+	ql.bytes += node.lp.bytes() - bytes
+	ql.mem += node.lp.memUsage() - mem
+}
+
+// pushLeft inserts values at the head one by one, so the last value ends up
+// first, like LPUSH.
+func (ql *quicklist) pushLeft(values ...string) {
+	for _, v := range values {
+		if !ql.fits(ql.head, v) {
+			ql.linkBefore(ql.head, &quicklistNode{lp: newListpack()})
+		}
+		ql.edit(ql.head, func(lp *listpack) { lp.insert(0, v) })
+		ql.count++
+	}
+}
+
+func (ql *quicklist) pushRight(values ...string) {
+	for _, v := range values {
+		if !ql.fits(ql.tail, v) {
+			ql.linkBefore(nil, &quicklistNode{lp: newListpack()})
+		}
+		ql.edit(ql.tail, func(lp *listpack) { lp.insert(lp.len(), v) })
+		ql.count++
+	}
+}
+
+// deleteAt removes the element at index i of node, dropping the node once it
+// is empty.
+func (ql *quicklist) deleteAt(node *quicklistNode, i int) {
+	ql.edit(node, func(lp *listpack) { lp.delete(i, 1) })
+	ql.count--
+	if node.lp.len() == 0 {
+		ql.unlink(node)
+	}
+}
+
+func (ql *quicklist) popLeft() (string, bool) {
+	if ql.head == nil {
+		return "", false
+	}
+	node := ql.head
+	v := node.lp.at(0)
+	ql.deleteAt(node, 0)
+	return v, true
+}
+
+func (ql *quicklist) popRight() (string, bool) {
+	if ql.tail == nil {
+		return "", false
+	}
+	node := ql.tail
+	last := node.lp.len() - 1
+	v := node.lp.at(last)
+	ql.deleteAt(node, last)
+	return v, true
+}
+
+// rangeItems returns the items between the already normalized start and
+// stop indexes, both inclusive, skipping whole nodes before start.
+func (ql *quicklist) rangeItems(start, stop int) []string {
+	items := make([]string, 0, stop-start+1)
+	node, offset := ql.head, 0
+	for node != nil && offset+node.lp.len() <= start {
+		offset += node.lp.len()
+		node = node.next
+	}
+	for ; node != nil && offset <= stop; node = node.next {
+		node.lp.forEach(func(i int, v string) bool {
+			if idx := offset + i; idx >= start && idx <= stop {
+				items = append(items, v)
+			}
+			return offset+i < stop
+		})
+		offset += node.lp.len()
+	}
+	return items
+}
+
+// locate returns the node holding the element at index i and the position
+// of the element in that node, walking from whichever end is closer.
+func (ql *quicklist) locate(i int) (*quicklistNode, int) {
+	if i < ql.count/2 {
+		for node := ql.head; node != nil; node = node.next {
+			if i < node.lp.len() {
+				return node, i
+			}
+			i -= node.lp.len()
+		}
+		return nil, 0
+	}
+	fromTail := ql.count - 1 - i
+	for node := ql.tail; node != nil; node = node.prev {
+		if fromTail < node.lp.len() {
+			return node, node.lp.len() - 1 - fromTail
+		}
+		fromTail -= node.lp.len()
+	}
+	return nil, 0
+}
+
+func (ql *quicklist) index(i int) string {
+	node, off := ql.locate(i)
+	return node.lp.at(off)
+}
+
+func (ql *quicklist) set(i int, v string) {
+	node, off := ql.locate(i)
+	ql.edit(node, func(lp *listpack) { lp.replace(off, v) })
+}
+
+// insert places v before index i. A full node is split at the insertion
+// point and v goes to whichever half has room, or to a new node between
+// them.
+func (ql *quicklist) insert(i int, v string) {
+	switch {
+	case i == 0:
+		ql.pushLeft(v)
+		return
+	case i == ql.count:
+		ql.pushRight(v)
+		return
+	}
+	node, off := ql.locate(i)
+	if ql.fits(node, v) {
+		ql.edit(node, func(lp *listpack) { lp.insert(off, v) })
+		ql.count++
+		return
+	}
+
+	right := node
+	if off > 0 {
+		rest := node.lp.values()[off:]
+		ql.edit(node, func(lp *listpack) { lp.delete(off, len(rest)) })
+		right = &quicklistNode{lp: newListpack(rest...)}
+		ql.linkBefore(node.next, right)
+	}
+	appendTo := func(lp *listpack) { lp.insert(lp.len(), v) }
+	switch {
+	case off > 0 && ql.fits(node, v):
+		ql.edit(node, appendTo)
+	case ql.fits(right.prev, v):
+		ql.edit(right.prev, appendTo)
+	case ql.fits(right, v):
+		ql.edit(right, func(lp *listpack) { lp.insert(0, v) })
+	default:
+		ql.linkBefore(right, &quicklistNode{lp: newListpack(v)})
+	}
+	ql.count++
+}
+
+// delete removes count elements starting at index i, dropping the nodes
+// that become empty.
+func (ql *quicklist) delete(i, count int) {
+	node, off := ql.locate(i)
+	for count > 0 && node != nil {
+		n := min(count, node.lp.len()-off)
+		next := node.next
+		ql.edit(node, func(lp *listpack) { lp.delete(off, n) })
+		ql.count -= n
+		count -= n
+		if node.lp.len() == 0 {
+			ql.unlink(node)
+		}
+		node, off = next, 0
+	}
+}
+
+func (ql *quicklist) forEach(fn func(i int, v string) bool) {
+	offset := 0
+	for node := ql.head; node != nil; node = node.next {
+		stop := false
+		node.lp.forEach(func(i int, v string) bool {
+			stop = !fn(offset+i, v)
+			return !stop
+		})
+		if stop {
+			return
+		}
+		offset += node.lp.len()
+	}
+}
+
+func (ql *quicklist) forEachReverse(fn func(i int, v string) bool) {
+	offset := ql.count
+	for node := ql.tail; node != nil; node = node.prev {
+		offset -= node.lp.len()
+		values := node.lp.values()
+		for i := len(values) - 1; i >= 0; i-- {
+			if !fn(offset+i, values[i]) {
+				return
+			}
+		}
+	}
+}
+
+func (ql *quicklist) size() int {
+	return ql.bytes
+}
+
+func (ql *quicklist) memUsage() int64 {
+	return quicklistSize + ql.mem
+}
+
+func (ql *quicklist) encoding() string {
+	return "quicklist"
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+// checkQuicklistCounters checks the running totals of ql against a walk
+// over its nodes.
+func checkQuicklistCounters(t *testing.T, ql *quicklist) {
+	t.Helper()
+	bytes, mem := 0, quicklistSize
+	for node := ql.head; node != nil; node = node.next {
+		bytes += node.lp.bytes()
+		mem += quicklistNodeSize + node.lp.memUsage()
+	}
+	if ql.size() != bytes || ql.memUsage() != mem {
+		t.Fatalf("got size %d and memory %d; the nodes add up to %d and %d", ql.size(), ql.memUsage(), bytes, mem)
+	}
+}
+
+func TestQuicklist_MatchesSlice(t *testing.T) {
+	lim := DefaultEncodingLimits()
+	lim.ListMaxListpackSize = 4
+	ql := newQuicklist(&lim)
+	var want []string
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	for i := 0; i < 5000; i++ {
+		v := strconv.Itoa(i)
+		switch rng.IntN(4) {
+		case 0:
+			ql.pushLeft(v)
+			want = append([]string{v}, want...)
+		case 1:
+			ql.pushRight(v)
+			want = append(want, v)
+		case 2:
+			got, ok := ql.popLeft()
+			if ok != (len(want) > 0) || ok && got != want[0] {
+				t.Fatalf("popLeft: got %q, %v", got, ok)
+			}
+			if ok {
+				want = want[1:]
+			}
+		case 3:
+			got, ok := ql.popRight()
+			if ok != (len(want) > 0) || ok && got != want[len(want)-1] {
+				t.Fatalf("popRight: got %q, %v", got, ok)
+			}
+			if ok {
+				want = want[:len(want)-1]
+			}
+		}
+	}
+
+	if ql.len() != len(want) {
+		t.Fatalf("got len %d; want %d", ql.len(), len(want))
+	}
+	if ql.nodes < len(want)/4 {
+		t.Fatalf("%d nodes can't hold %d items with a fill of 4", ql.nodes, len(want))
+	}
+	checkQuicklistCounters(t, ql)
+	for start := 0; start < len(want); start += 7 {
+		stop := min(start+5, len(want)-1)
+		if got := ql.rangeItems(start, stop); !slices.Equal(got, want[start:stop+1]) {
+			t.Fatalf("range %d..%d: got %q; want %q", start, stop, got, want[start:stop+1])
+		}
+	}
+}
+
+func TestQuicklist_RandomAccessMatchesSlice(t *testing.T) {
+	lim := DefaultEncodingLimits()
+	lim.ListMaxListpackSize = 4
+	ql := newQuicklist(&lim)
+	var want []string
+
+	rng := rand.New(rand.NewPCG(3, 4))
+	for i := 0; i < 5000; i++ {
+		v := strconv.Itoa(i)
+		switch op := rng.IntN(4); {
+		case op == 0 || len(want) == 0:
+			at := rng.IntN(len(want) + 1)
+			ql.insert(at, v)
+			want = slices.Insert(want, at, v)
+		case op == 1:
+			at := rng.IntN(len(want))
+			ql.set(at, v)
+			want[at] = v
+		case op == 2:
+			at := rng.IntN(len(want))
+			n := min(rng.IntN(6)+1, len(want)-at)
+			ql.delete(at, n)
+			want = slices.Delete(want, at, at+n)
+		case op == 3:
+			at := rng.IntN(len(want))
+			if got := ql.index(at); got != want[at] {
+				t.Fatalf("index %d: got %q; want %q", at, got, want[at])
+			}
+		}
+		checkQuicklistCounters(t, ql)
+	}
+
+	if got := ql.rangeItems(0, ql.len()-1); !slices.Equal(got, want) {
+		t.Fatalf("got %q; want %q", got, want)
+	}
+}
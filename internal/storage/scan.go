@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"math/bits"
+
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/glob"
+)
+
+func scanDict[V any](d *dict[V], cursor uint64, count int, visit func(key string, value V)) uint64 {
+	maxIterations := count * 10
+	visited := 0
+	for {
+		cursor = d.scan(cursor, func(key string, value V) {
+			visited++
+			visit(key, value)
+		})
+		maxIterations--
+		if cursor == 0 || visited >= count || maxIterations <= 0 {
+			return cursor
+		}
+	}
+}
+
+// Scan walks the shards one after another. The shard index lives in the low
+// bits of the cursor and the cursor of the shard's dict in the remaining ones.
+func (s *KV) Scan(cursor uint64, count int, pattern, typ string) ([]string, uint64) {
+	shardBits := bits.Len(uint(len(s.shards) - 1))
+	idx := int(cursor & uint64(len(s.shards)-1))
+	inner := cursor >> shardBits
+
+	var keys []string
+	for {
+		sh := s.shards[idx]
+		s.run([]int{idx}, false, func(tx *txn) error {
+			inner = scanDict(sh.data, inner, count-len(keys), func(key string, e *entry) {
+				if tx.lookup(key) == nil {
+					return
+				}
+				if typ != "" && e.typeName() != typ {
+					return
+				}
+				if glob.Match(pattern, key) {
+					keys = append(keys, key)
+				}
+			})
+			return nil
+		})
+
+		if inner == 0 {
+			idx++
+			if idx == len(s.shards) {
+				return keys, 0
+			}
+		}
+		if inner != 0 || len(keys) >= count {
+			return keys, inner<<shardBits | uint64(idx)
+		}
+	}
+}
+
+func (e *entry) SScan(cursor uint64, count int, pattern string) ([]string, uint64, error) {
+	if e.typ != setType {
+		return nil, 0, ErrWrongType
+	}
+
+	var members []string
+	add := func(member string) {
+		if glob.Match(pattern, member) {
+			members = append(members, member)
+		}
+	}
+	// compact encodings are small enough to be returned in one call
+	set, ok := e.set().(hashtableSet)
+	if !ok {
+		e.set().forEach(func(member string) bool {
+			add(member)
+			return true
+		})
+		return members, 0, nil
+	}
+	next := scanDict(set.d, cursor, count, func(member string, _ struct{}) { add(member) })
+	return members, next, nil
+}
+
+func (e *entry) HScan(cursor uint64, count int, pattern string) ([]string, uint64, error) {
+	if e.typ != hashType {
+		return nil, 0, ErrWrongType
+	}
+
+	var flat []string
+	add := func(field, value string) {
+		if glob.Match(pattern, field) {
+			flat = append(flat, field, value)
+		}
+	}
+	h, ok := e.hash().(hashtableHash)
+	if !ok {
+		e.hash().forEach(func(field, value string) bool {
+			add(field, value)
+			return true
+		})
+		return flat, 0, nil
+	}
+	next := scanDict(h.d, cursor, count, add)
+	return flat, next, nil
+}
+
+func (s *KV) SScan(key string, cursor uint64, count int, pattern string) ([]string, uint64, error) {
+	members := []string{}
+	var next uint64
+	err := s.view([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		var err error
+		members, next, err = e.SScan(cursor, count, pattern)
+		return err
+	})
+	return members, next, err
+}
+
+func (s *KV) HScan(key string, cursor uint64, count int, pattern string) ([]string, uint64, error) {
+	flat := []string{}
+	var next uint64
+	err := s.view([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		var err error
+		flat, next, err = e.HScan(cursor, count, pattern)
+		return err
+	})
+	return flat, next, err
+}
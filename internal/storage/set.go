@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"math/rand/v2"
+	"strconv"
+)
+
+// setStore is implemented by every set encoding.
+type setStore interface {
+	len() int
+	add(member string) bool
+	remove(member string) bool
+	contains(member string) bool
+	forEach(fn func(member string) bool)
+	// random returns a random member of a non-empty set.
+	random() string
+	memUsage() int64
+	encoding() string
+}
+
+type intsetSet struct{ is *intset }
+
+func (s intsetSet) len() int { return s.is.len() }
+
+func (s intsetSet) add(member string) bool {
+	v, _ := parseSetInteger(member)
+	return s.is.add(v)
+}
+
+func (s intsetSet) remove(member string) bool {
+	v, ok := parseSetInteger(member)
+	return ok && s.is.remove(v)
+}
+
+func (s intsetSet) contains(member string) bool {
+	v, ok := parseSetInteger(member)
+	return ok && s.is.contains(v)
+}
+
+func (s intsetSet) forEach(fn func(member string) bool) {
+	for i := 0; i < s.is.len(); i++ {
+		if !fn(strconv.FormatInt(s.is.get(i), 10)) {
+			return
+		}
+	}
+}
+
+func (s intsetSet) random() string {
+	return strconv.FormatInt(s.is.get(rand.IntN(s.is.len())), 10)
+}
+
+func (s intsetSet) memUsage() int64  { return s.is.memUsage() }
+func (s intsetSet) encoding() string { return "intset" }
+
+type listpackSet struct{ lp *listpack }
+
+func (s listpackSet) len() int { return s.lp.len() }
+
+func (s listpackSet) add(member string) bool {
+	if s.lp.index(member, 1) >= 0 {
+		return false
+	}
+	s.lp.insert(s.lp.len(), member)
+	return true
+}
+
+func (s listpackSet) remove(member string) bool {
+	i := s.lp.index(member, 1)
+	if i < 0 {
+		return false
+	}
+	s.lp.delete(i, 1)
+	return true
+}
+
+func (s listpackSet) contains(member string) bool {
+	return s.lp.index(member, 1) >= 0
+}
+
+func (s listpackSet) forEach(fn func(member string) bool) {
+	s.lp.forEach(func(_ int, member string) bool { return fn(member) })
+}
+
+func (s listpackSet) random() string { return s.lp.at(rand.IntN(s.lp.len())) }
+
+func (s listpackSet) memUsage() int64  { return s.lp.memUsage() }
+func (s listpackSet) encoding() string { return "listpack" }
+
+type hashtableSet struct{ d *dict[struct{}] }
+
+func (s hashtableSet) len() int                    { return s.d.len() }
+func (s hashtableSet) add(member string) bool      { return s.d.set(member, struct{}{}) }
+func (s hashtableSet) remove(member string) bool   { return s.d.delete(member) }
+func (s hashtableSet) memUsage() int64             { return s.d.memUsage() }
+func (s hashtableSet) encoding() string            { return "hashtable" }
+func (s hashtableSet) contains(member string) bool { _, ok := s.d.get(member); return ok }
+
+func (s hashtableSet) random() string {
+	member, _ := s.d.random()
+	return member
+}
+
+func (s hashtableSet) forEach(fn func(member string) bool) {
+	s.d.forEach(func(member string, _ struct{}) bool { return fn(member) })
+}
+
+// newSetStore picks the most compact encoding able to hold members.
+func newSetStore(lim *EncodingLimits, members []string) setStore {
+	var s setStore = intsetSet{newIntset()}
+	s = convertSetFor(lim, s, len(members), members...)
+	for _, m := range members {
+		s.add(m)
+	}
+	return s
+}
+
+// convertSetFor returns s, or s converted to a more general encoding if it
+// can't hold size members after adding the given ones. Conversions only go
+// from intset to listpack to hashtable, never back.
+func convertSetFor(lim *EncodingLimits, s setStore, size int, adding ...string) setStore {
+	allIntegers, longest := true, 0
+	for _, m := range adding {
+		if _, ok := parseSetInteger(m); !ok {
+			allIntegers = false
+		}
+		longest = max(longest, len(m))
+	}
+
+	switch s.(type) {
+	case intsetSet:
+		if allIntegers && size <= lim.SetMaxIntsetEntries {
+			return s
+		}
+		if size <= lim.SetMaxListpackEntries && longest <= lim.SetMaxListpackValue {
+			return convertSet(s, listpackSet{newListpack()})
+		}
+		return convertSet(s, hashtableSet{newDict[struct{}]()})
+	case listpackSet:
+		if size <= lim.SetMaxListpackEntries && longest <= lim.SetMaxListpackValue {
+			return s
+		}
+		return convertSet(s, hashtableSet{newDict[struct{}]()})
+	default:
+		return s
+	}
+}
+
+func convertSet(from, to setStore) setStore {
+	from.forEach(func(member string) bool {
+		to.add(member)
+		return true
+	})
+	return to
+}
@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func sorted(members []string) []string {
+	slices.Sort(members)
+	return members
+}
+
+func TestSetOperation(t *testing.T) {
+	kv := NewKV()
+	kv.SAdd("a", "1", "2", "3", "x")
+	kv.SAdd("b", "2", "3", "4")
+	kv.SAdd("c", "3", "x")
+
+	tests := []struct {
+		op   SetOp
+		keys []string
+		want []string
+	}{
+		{SetInter, []string{"a", "b", "c"}, []string{"3"}},
+		{SetInter, []string{"a", "missing"}, []string{}},
+		{SetUnion, []string{"b", "c", "missing"}, []string{"2", "3", "4", "x"}},
+		{SetDiff, []string{"a", "b"}, []string{"1", "x"}},
+		{SetDiff, []string{"a", "missing", "c"}, []string{"1", "2"}},
+		{SetDiff, []string{"missing", "a"}, []string{}},
+	}
+	for _, tt := range tests {
+		got, err := kv.SetOperation(tt.op, tt.keys...)
+		if err != nil {
+			t.Fatalf("%v %v: unexpected error: %v", tt.op, tt.keys, err)
+		}
+		if !slices.Equal(sorted(got), tt.want) {
+			t.Fatalf("%v %v: got %q; want %q", tt.op, tt.keys, got, tt.want)
+		}
+	}
+
+	if n, _ := kv.SInterCard(1, "a", "b"); n != 1 {
+		t.Fatalf("SInterCard with limit 1: got %d", n)
+	}
+	if n, _ := kv.SetOperationStore(SetInter, "a", "a", "b"); n != 2 {
+		t.Fatalf("SetOperationStore over its own source: got %d", n)
+	}
+	kv.Set("s", "v")
+	if _, err := kv.SetOperation(SetUnion, "a", "s"); err != ErrWrongType {
+		t.Fatalf("expected ErrWrongType, got %v", err)
+	}
+}
+
+func TestSRandMember_Distinct(t *testing.T) {
+	kv := NewKV()
+	for i := 0; i < 200; i++ {
+		kv.SAdd("s", "m"+strconv.Itoa(i))
+	}
+	for _, count := range []int{1, 10, 100, 200, 500, math.MaxInt} {
+		members, _ := kv.SRandMember("s", count, true)
+		if len(members) != min(count, 200) {
+			t.Fatalf("count %d: got %d members", count, len(members))
+		}
+		if len(slices.Compact(sorted(members))) != len(members) {
+			t.Fatalf("count %d: got repeated members", count)
+		}
+	}
+	if members, _ := kv.SRandMember("s", 500, false); len(members) != 500 {
+		t.Fatalf("got %d members; want 500", len(members))
+	}
+}
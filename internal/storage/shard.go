@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"hash/maphash"
+	"math/bits"
+	"slices"
+	"sync"
+)
+
+const DefaultShardCount = 16
+
+// shards use their own seed so that keys of one shard still spread over all
+// buckets of the shard's dict
+var shardSeed = maphash.MakeSeed()
+
+type shard struct {
+	mu      sync.RWMutex
+	data    *dict[*entry]
+	expires *dict[int64]
+	// fieldExpires maps hashes with field TTLs to their next field expiry
+	fieldExpires *dict[int64]
+}
+
+func newShard() *shard {
+	return &shard{
+		data:         newDict[*entry](),
+		expires:      newDict[int64](),
+		fieldExpires: newDict[int64](),
+	}
+}
+
+// normalizeShardCount rounds n up to a power of two so that shard indexes can
+// be taken from the low bits of a hash and packed into SCAN cursors.
+func normalizeShardCount(n int) int {
+	if n <= 1 {
+		return 1
+	}
+	return 1 << bits.Len(uint(n-1))
+}
+
+func (s *KV) shardIndex(key string) int {
+	return int(maphash.String(shardSeed, key) & uint64(len(s.shards)-1))
+}
+
+// shardIndexes returns the sorted, deduplicated shards holding keys. Locks are
+// always taken in this order, so multi-key operations can't deadlock.
+func (s *KV) shardIndexes(keys []string) []int {
+	idxs := make([]int, 0, len(keys))
+	for _, key := range keys {
+		idxs = append(idxs, s.shardIndex(key))
+	}
+	slices.Sort(idxs)
+	return slices.Compact(idxs)
+}
+
+func (s *KV) allShardIndexes() []int {
+	idxs := make([]int, len(s.shards))
+	for i := range idxs {
+		idxs[i] = i
+	}
+	return idxs
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+type Stats struct {
+	expiredKeys           atomic.Int64
+	expiredSubkeys        atomic.Int64
+	expiredStalePerc      atomic.Uint64
+	expiredTimeCapReached atomic.Int64
+	evictedKeys           atomic.Int64
+}
+
+func (st *Stats) ExpiredKeys() int64 {
+	return st.expiredKeys.Load()
+}
+
+// ExpiredSubkeys counts hash fields deleted because their TTL passed.
+func (st *Stats) ExpiredSubkeys() int64 {
+	return st.expiredSubkeys.Load()
+}
+
+// ExpiredStalePerc is a running estimate of the percentage of keys with a TTL
+// that are already logically expired but still occupy memory.
+func (st *Stats) ExpiredStalePerc() float64 {
+	return math.Float64frombits(st.expiredStalePerc.Load())
+}
+
+func (st *Stats) ExpiredTimeCapReached() int64 {
+	return st.expiredTimeCapReached.Load()
+}
+
+func (st *Stats) EvictedKeys() int64 {
+	return st.evictedKeys.Load()
+}
+
+func (st *Stats) updateStalePerc(current float64) {
+	old := st.ExpiredStalePerc()
+	st.expiredStalePerc.Store(math.Float64bits(current*0.05 + old*0.95))
+}
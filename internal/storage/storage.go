@@ -1,323 +1,374 @@
 package storage
 
 import (
-	"log"
+	"cmp"
 	"math"
-	"path"
+	"slices"
 	"strconv"
-	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/AndrewSukhobok95/go-build-my-own-redis/internal/glob"
 )
 
 type KV struct {
-	mu      sync.RWMutex
-	data    map[string]*entry
-	expires map[string]int64
+	shards  []*shard
+	stats   *Stats
+	events  *events
+	blocked *blocked
+	limits  *EncodingLimits
+	index   atomic.Int64
+	used    atomic.Int64
+	// expireCursor is the shard the active expire cycle samples next
+	expireCursor atomic.Uint64
+	loading      atomic.Bool
 }
 
 func NewKV() *KV {
+	limits := DefaultEncodingLimits()
+	return newKV(DefaultShardCount, &Stats{}, &events{}, newBlocked(), &limits)
+}
+
+func newKV(shardCount int, stats *Stats, events *events, blocked *blocked, limits *EncodingLimits) *KV {
+	shards := make([]*shard, normalizeShardCount(shardCount))
+	for i := range shards {
+		shards[i] = newShard()
+	}
 	return &KV{
-		data:    make(map[string]*entry),
-		expires: make(map[string]int64),
+		shards:  shards,
+		stats:   stats,
+		events:  events,
+		blocked: blocked,
+		limits:  limits,
 	}
 }
 
 func (s *KV) Set(key, value string) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.data[key] = newStringEntry(value)
+	s.SetWithOptions(key, value, SetOptions{})
 }
 
 func (s *KV) Get(key string) (string, bool, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	e, exists := s.data[key]
-	if s.IsExpired(key) || !exists {
-		return "", false, nil
-	}
-
-	strVal, err := e.String()
-	return strVal, err == nil, err
+	var (
+		val    string
+		exists bool
+	)
+	err := s.view([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		var err error
+		val, err = e.String()
+		exists = err == nil
+		return err
+	})
+	return val, exists, err
 }
 
 func (s *KV) Delete(keys ...string) int {
-	s.mu.Lock()
-	defer s.mu.Unlock()
 	var n int
-	for _, k := range keys {
-		if _, exists := s.data[k]; exists {
-			delete(s.data, k)
-			delete(s.expires, k)
-			n++
+	s.update(keys, func(tx *txn) error {
+		for _, k := range keys {
+			if tx.lookup(k) != nil && tx.delete(k) {
+				n++
+			}
 		}
-	}
+		return nil
+	})
 	return n
 }
 
 func (s *KV) Incr(key string, delta int64) (int64, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	var valInt int64 = 0
-	e, exists := s.data[key]
-
-	if exists {
-		val, err := e.String()
-		if err != nil {
-			return 0, err
-		}
-		valInt, err = strconv.ParseInt(val, 10, 64)
-		if err != nil {
-			return 0, ErrNotInteger
+	var newValInt int64
+	err := s.update([]string{key}, func(tx *txn) error {
+		var valInt int64 = 0
+		if e := tx.lookup(key); e != nil {
+			val, err := e.String()
+			if err != nil {
+				return err
+			}
+			valInt, err = strconv.ParseInt(val, 10, 64)
+			if err != nil {
+				return ErrNotInteger
+			}
 		}
-	}
 
-	if (delta > 0 && valInt > math.MaxInt64-delta) || (delta < 0 && valInt < math.MinInt64-delta) {
-		return 0, ErrOverflow
-	}
+		if (delta > 0 && valInt > math.MaxInt64-delta) || (delta < 0 && valInt < math.MinInt64-delta) {
+			return ErrOverflow
+		}
 
-	newValInt := valInt + delta
-	s.data[key] = newStringEntry(strconv.FormatInt(newValInt, 10))
-	return newValInt, nil
+		newValInt = valInt + delta
+		tx.set(key, newStringEntry(strconv.FormatInt(newValInt, 10)))
+		return nil
+	})
+	return newValInt, err
 }
 
 func (s *KV) Append(key, value string) (int, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	var base string = ""
-	if e, exists := s.data[key]; exists {
-		valStr, err := e.String()
-		if err != nil {
-			return 0, err
+	var n int
+	err := s.update([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			tx.set(key, newStringEntry(value))
+			n = len(value)
+			return nil
 		}
-		base = valStr
-	}
-
-	newVal := base + value
-	s.data[key] = newStringEntry(newVal)
-
-	return len(newVal), nil
+		var err error
+		n, err = e.Append(value)
+		return err
+	})
+	return n, err
 }
 
 func (s *KV) Type(key string) string {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	e, isp := s.data[key]
-	if !isp || s.IsExpired(key) {
-		return "none"
-	}
-	switch e.typ {
-	case stringType:
-		return "string"
-	case listType:
-		return "list"
-	case hashType:
-		return "hash"
-	default:
-		return "none"
-	}
+	typ := "none"
+	s.view([]string{key}, func(tx *txn) error {
+		if e := tx.lookup(key); e != nil {
+			typ = e.typeName()
+		}
+		return nil
+	})
+	return typ
 }
 
 func (s *KV) Exists(keys ...string) int {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
 	var n int
-	for _, k := range keys {
-		if _, isp := s.data[k]; isp && !s.IsExpired(k) {
-			n++
+	s.view(keys, func(tx *txn) error {
+		for _, k := range keys {
+			if tx.lookup(k) != nil {
+				n++
+			}
 		}
-	}
+		return nil
+	})
 	return n
 }
 
-func (s *KV) Keys(pattern string) ([]string, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+func (s *KV) Keys(pattern string) []string {
 	var existing []string
-	for k := range s.data {
-		if s.IsExpired(k) {
-			continue
-		}
-		matched, err := path.Match(pattern, k)
-		if err != nil {
-			log.Println("Error, while looking for pattern in keys:", err)
-			return nil, err
-		}
-		if matched {
-			existing = append(existing, k)
+	s.viewAll(func(tx *txn) error {
+		tx.forEach(func(k string, _ *entry) bool {
+			if glob.Match(pattern, k) && tx.lookup(k) != nil {
+				existing = append(existing, k)
+			}
+			return true
+		})
+		return nil
+	})
+	return existing
+}
+
+func (s *KV) KeyCounts() (keys, expires int) {
+	s.viewAll(func(tx *txn) error {
+		for _, idx := range tx.shards {
+			keys += s.shards[idx].data.len()
+			expires += s.shards[idx].expires.len()
 		}
-	}
-	return existing, nil
+		return nil
+	})
+	return keys, expires
 }
 
 func (s *KV) Flushdb() {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	clear(s.data)
-	clear(s.expires)
-}
-
-func (s *KV) SetExpire(key string, duration time.Duration) (keyExists bool) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	_, keyExists = s.data[key]
-	if keyExists {
-		expireAt := time.Now().Add(duration)
-		s.expires[key] = expireAt.UnixMilli()
-	}
-	return keyExists
+	s.updateAll(func(tx *txn) error {
+		for _, idx := range tx.shards {
+			s.shards[idx].data.clear()
+			s.shards[idx].expires.clear()
+			s.shards[idx].fieldExpires.clear()
+		}
+		s.used.Store(0)
+		return nil
+	})
 }
 
-func (s *KV) TTL(key string) int64 {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	_, isp := s.data[key]
-	if !isp {
-		return -2
-	}
+type ExpireCondition int
 
-	expiration, expired := s.expires[key]
-	if !expired {
-		return -1
-	}
+const (
+	ExpireNX ExpireCondition = 1 << iota
+	ExpireXX
+	ExpireGT
+	ExpireLT
+)
 
-	ttl := time.Until(time.UnixMilli(expiration)).Milliseconds()
-	if ttl < 0 {
-		return -2
-	}
-	return ttl
+// ExpireAt sets the absolute expiration time of key if the cond flags allow it. A key
+// without TTL counts as never expiring for GT and LT. A time that is already
+// in the past deletes the key right away, unless the AOF is loading.
+func (s *KV) ExpireAt(key string, unixMilli int64, cond ExpireCondition) (applied bool) {
+	s.update([]string{key}, func(tx *txn) error {
+		if tx.lookup(key) == nil {
+			return nil
+		}
+		current, hasTTL := tx.expireAt(key)
+		switch {
+		case cond&ExpireNX != 0 && hasTTL,
+			cond&ExpireXX != 0 && !hasTTL,
+			cond&ExpireGT != 0 && (!hasTTL || unixMilli <= current),
+			cond&ExpireLT != 0 && hasTTL && unixMilli >= current:
+			return nil
+		}
+		applied = true
+		if s.past(unixMilli) {
+			tx.delete(key)
+			return nil
+		}
+		tx.setExpireAt(key, unixMilli)
+		return nil
+	})
+	return applied
 }
 
-func (s *KV) IsExpired(key string) bool {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	_, isp := s.data[key]
-	if !isp {
-		return true
-	}
-
-	expiration, expired := s.expires[key]
-	if !expired {
-		return false
-	}
-
-	ttl := time.Until(time.UnixMilli(expiration))
-	return ttl <= 0
+func (s *KV) Persist(key string) (removed bool) {
+	s.update([]string{key}, func(tx *txn) error {
+		if tx.lookup(key) == nil {
+			return nil
+		}
+		removed = tx.persist(key)
+		return nil
+	})
+	return removed
 }
 
-func (s *KV) ExpiredKeys() []string {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	var expiredKeys []string
-	for key := range s.expires {
-		if s.IsExpired(key) {
-			expiredKeys = append(expiredKeys, key)
+// ExpireTime returns the absolute expiration time of key in unix milliseconds,
+// -1 if the key has no TTL and -2 if it doesn't exist.
+func (s *KV) ExpireTime(key string) int64 {
+	var expireTime int64
+	s.view([]string{key}, func(tx *txn) error {
+		if tx.lookup(key) == nil {
+			expireTime = -2
+			return nil
 		}
-	}
-	return expiredKeys
+		expiration, hasTTL := tx.expireAt(key)
+		if !hasTTL {
+			expireTime = -1
+			return nil
+		}
+		expireTime = expiration
+		return nil
+	})
+	return expireTime
 }
 
-func (s *KV) Cleanup(interval time.Duration, stop <-chan struct{}) {
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
-	for {
-		select {
-		case <-ticker.C:
-			s.Delete(s.ExpiredKeys()...)
-		case <-stop:
-			return
+func (s *KV) TTL(key string) int64 {
+	var ttl int64
+	s.view([]string{key}, func(tx *txn) error {
+		if tx.lookup(key) == nil {
+			ttl = -2
+			return nil
 		}
-	}
+		expiration, hasTTL := tx.expireAt(key)
+		if !hasTTL {
+			ttl = -1
+			return nil
+		}
+		ttl = max(time.Until(time.UnixMilli(expiration)).Milliseconds(), 0)
+		return nil
+	})
+	return ttl
 }
 
 func (s *KV) LPush(key string, values ...string) (int, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	e, exists := s.data[key]
-	if !exists {
-		s.data[key] = newListEntry(values)
-		return len(values), nil
-	}
-
-	n, err := e.PushLeft(values...)
-	if err != nil {
-		return 0, err
-	}
-	return n, nil
+	return s.push(key, true, false, values)
 }
 
 func (s *KV) RPush(key string, values ...string) (int, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	return s.push(key, false, false, values)
+}
 
-	e, exists := s.data[key]
-	if !exists {
-		s.data[key] = newListEntry(values)
-		return len(values), nil
-	}
+// LPushX is LPush for existing lists only; it returns 0 if key is missing.
+func (s *KV) LPushX(key string, values ...string) (int, error) {
+	return s.push(key, true, true, values)
+}
+
+func (s *KV) RPushX(key string, values ...string) (int, error) {
+	return s.push(key, false, true, values)
+}
 
-	n, err := e.PushRight(values...)
+func (s *KV) push(key string, left, onlyExisting bool, values []string) (int, error) {
+	var n int
+	err := s.update([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			if onlyExisting {
+				return nil
+			}
+			e = newListEntry(s.limits, nil)
+			tx.set(key, e)
+		}
+		var err error
+		if left {
+			n, err = e.PushLeft(s.limits, values...)
+		} else {
+			n, err = e.PushRight(s.limits, values...)
+		}
+		return err
+	})
 	if err != nil {
 		return 0, err
 	}
 	return n, nil
 }
 
-func (s *KV) LPop(key string) (string, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+func (s *KV) LPop(key string, count int) ([]string, error) {
+	return s.pop(key, true, count)
+}
 
-	e, exists := s.data[key]
-	if !exists {
-		return "", nil
-	}
+func (s *KV) RPop(key string, count int) ([]string, error) {
+	return s.pop(key, false, count)
+}
 
-	popped, err := e.PopLeft()
+// pop removes up to count elements from one end of the list. It returns nil
+// if the key doesn't exist.
+func (s *KV) pop(key string, left bool, count int) ([]string, error) {
+	var popped []string
+	err := s.update([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		var err error
+		popped, err = tx.popList(key, e, left, count)
+		return err
+	})
 	if err != nil {
-		return "", err
-	}
-
-	if len(e.data.([]string)) == 0 {
-		delete(s.data, key)
+		return nil, err
 	}
 	return popped, nil
 }
 
-func (s *KV) RPop(key string) (string, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	e, exists := s.data[key]
-	if !exists {
-		return "", nil
-	}
-
-	popped, err := e.PopRight()
+// popList pops up to count elements from the list e stored at key and
+// deletes the key once the list is empty.
+func (tx *txn) popList(key string, e *entry, left bool, count int) ([]string, error) {
+	n, err := e.LLen()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-
-	if len(e.data.([]string)) == 0 {
-		delete(s.data, key)
+	popped := make([]string, 0, min(count, n))
+	for range min(count, n) {
+		var v string
+		if left {
+			v, _ = e.PopLeft(tx.kv.limits)
+		} else {
+			v, _ = e.PopRight(tx.kv.limits)
+		}
+		popped = append(popped, v)
+	}
+	if n, _ := e.LLen(); n == 0 {
+		tx.delete(key)
 	}
 	return popped, nil
 }
 
 func (s *KV) LLen(key string) (int, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	e, exists := s.data[key]
-	if !exists {
-		return 0, nil
-	}
-
-	n, err := e.LLen()
+	var n int
+	err := s.view([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		var err error
+		n, err = e.LLen()
+		return err
+	})
 	if err != nil {
 		return 0, err
 	}
@@ -325,31 +376,201 @@ func (s *KV) LLen(key string) (int, error) {
 }
 
 func (s *KV) LRange(key string, start, stop int) ([]string, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	e, exists := s.data[key]
-	if !exists {
-		return []string{}, nil
-	}
-
-	l, err := e.LRange(start, stop)
+	l := []string{}
+	err := s.view([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		var err error
+		l, err = e.LRange(start, stop)
+		return err
+	})
 	if err != nil {
 		return []string{}, err
 	}
 	return l, nil
 }
 
-func (s *KV) SAdd(key string, members ...string) (int, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+func (s *KV) LIndex(key string, idx int) (string, bool, error) {
+	var (
+		val    string
+		exists bool
+	)
+	err := s.view([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		var err error
+		val, exists, err = e.LIndex(idx)
+		return err
+	})
+	return val, exists, err
+}
+
+func (s *KV) LSet(key string, idx int, value string) error {
+	return s.update([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return ErrNoSuchKey
+		}
+		return e.LSet(s.limits, idx, value)
+	})
+}
+
+// LInsert returns the new length of the list, -1 if pivot wasn't found and
+// 0 if the key doesn't exist.
+func (s *KV) LInsert(key string, before bool, pivot, value string) (int, error) {
+	var n int
+	err := s.update([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		var err error
+		n, err = e.LInsert(s.limits, before, pivot, value)
+		return err
+	})
+	return n, err
+}
+
+func (s *KV) LRem(key string, count int, value string) (int, error) {
+	var removed int
+	err := s.update([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		var err error
+		if removed, err = e.LRem(s.limits, count, value); err != nil {
+			return err
+		}
+		if n, _ := e.LLen(); n == 0 {
+			tx.delete(key)
+		}
+		return nil
+	})
+	return removed, err
+}
 
-	e, exists := s.data[key]
-	if !exists {
-		e = newSetEntry()
-		s.data[key] = e
+func (s *KV) LTrim(key string, start, stop int) error {
+	return s.update([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		if err := e.LTrim(s.limits, start, stop); err != nil {
+			return err
+		}
+		if n, _ := e.LLen(); n == 0 {
+			tx.delete(key)
+		}
+		return nil
+	})
+}
+
+func (s *KV) LPos(key, value string, rank, count, maxLen int) ([]int, error) {
+	var positions []int
+	err := s.view([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		var err error
+		positions, err = e.LPos(value, rank, count, maxLen)
+		return err
+	})
+	return positions, err
+}
+
+// LMove pops an element from one end of src and pushes it to one end of
+// dst, atomically. src and dst may be the same list.
+func (s *KV) LMove(src, dst string, fromLeft, toLeft bool) (string, bool, error) {
+	var (
+		moved  string
+		exists bool
+	)
+	err := s.update([]string{src, dst}, func(tx *txn) error {
+		var err error
+		moved, exists, err = tx.moveList(src, dst, fromLeft, toLeft)
+		return err
+	})
+	return moved, exists, err
+}
+
+func (tx *txn) moveList(src, dst string, fromLeft, toLeft bool) (string, bool, error) {
+	from := tx.lookup(src)
+	if from == nil {
+		return "", false, nil
 	}
-	cnt, err := e.SAdd(members...)
+	if _, err := from.LLen(); err != nil {
+		return "", false, err
+	}
+	to := tx.lookup(dst)
+	if to != nil && to.typ != listType {
+		return "", false, ErrWrongType
+	}
+
+	popped, _ := tx.popList(src, from, fromLeft, 1)
+	if src == dst {
+		// popping the last element deleted the key, which is also dst
+		to = tx.lookup(dst)
+	}
+	if to == nil {
+		to = newListEntry(tx.kv.limits, nil)
+		tx.set(dst, to)
+	}
+	if toLeft {
+		to.PushLeft(tx.kv.limits, popped...)
+	} else {
+		to.PushRight(tx.kv.limits, popped...)
+	}
+	return popped[0], true, nil
+}
+
+// LMPop pops up to count elements from the first non-empty list among keys
+// and returns its key, or an empty key if all of them are empty.
+func (s *KV) LMPop(keys []string, left bool, count int) (string, []string, error) {
+	var (
+		key    string
+		popped []string
+	)
+	err := s.update(keys, func(tx *txn) error {
+		var err error
+		key, popped, err = tx.mpopList(keys, left, count)
+		return err
+	})
+	return key, popped, err
+}
+
+func (tx *txn) mpopList(keys []string, left bool, count int) (string, []string, error) {
+	for _, key := range keys {
+		e := tx.lookup(key)
+		if e == nil {
+			continue
+		}
+		popped, err := tx.popList(key, e, left, count)
+		if err != nil {
+			return "", nil, err
+		}
+		return key, popped, nil
+	}
+	return "", nil, nil
+}
+
+func (s *KV) SAdd(key string, members ...string) (int, error) {
+	var cnt int
+	err := s.update([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			e = newSetEntry(s.limits)
+			tx.set(key, e)
+		}
+		var err error
+		cnt, err = e.SAdd(s.limits, members...)
+		return err
+	})
 	if err != nil {
 		return 0, err
 	}
@@ -357,15 +578,16 @@ func (s *KV) SAdd(key string, members ...string) (int, error) {
 }
 
 func (s *KV) SMembers(key string) ([]string, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	e, exists := s.data[key]
-	if !exists {
-		return []string{}, nil
-	}
-
-	members, err := e.SMembers()
+	members := []string{}
+	err := s.view([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		var err error
+		members, err = e.SMembers()
+		return err
+	})
 	if err != nil {
 		return []string{}, err
 	}
@@ -373,100 +595,442 @@ func (s *KV) SMembers(key string) ([]string, error) {
 }
 
 func (s *KV) SIsMember(key string, member string) (bool, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	e, exists := s.data[key]
-	if !exists {
-		return false, nil
-	}
-
-	isMember, err := e.SIsMember(member)
+	var isMember bool
+	err := s.view([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		var err error
+		isMember, err = e.SIsMember(member)
+		return err
+	})
 	if err != nil {
 		return false, err
 	}
-
 	return isMember, nil
 }
 
 func (s *KV) SRem(key string, members ...string) (int, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	e, exists := s.data[key]
-	if !exists {
-		return 0, nil
-	}
-
-	cnt, err := e.SRem(members...)
-	if err != nil {
-		return 0, err
-	}
-
-	newSize, err := e.SLen()
+	var cnt int
+	err := s.update([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		var err error
+		cnt, err = e.SRem(members...)
+		if err != nil {
+			return err
+		}
+		if newSize, _ := e.SLen(); newSize == 0 {
+			tx.delete(key)
+		}
+		return nil
+	})
 	if err != nil {
 		return 0, err
 	}
-	if newSize == 0 {
-		delete(s.data, key)
-	}
 	return cnt, nil
 }
 
-func (s *KV) HSet(key, field, value string) (int, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+func (s *KV) SCard(key string) (int, error) {
+	var n int
+	err := s.view([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		var err error
+		n, err = e.SLen()
+		return err
+	})
+	return n, err
+}
+
+func (s *KV) SMIsMember(key string, members ...string) ([]bool, error) {
+	found := make([]bool, len(members))
+	err := s.view([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		for i, m := range members {
+			var err error
+			if found[i], err = e.SIsMember(m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return found, err
+}
+
+// SPop removes and returns up to count random members.
+func (s *KV) SPop(key string, count int) ([]string, error) {
+	var popped []string
+	err := s.update([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		var err error
+		if popped, err = e.SRandMembers(count, true); err != nil {
+			return err
+		}
+		e.SRem(popped...)
+		if n, _ := e.SLen(); n == 0 {
+			tx.delete(key)
+		}
+		return nil
+	})
+	return popped, err
+}
+
+// SRandMember returns count random members, see entry.SRandMembers.
+func (s *KV) SRandMember(key string, count int, distinct bool) ([]string, error) {
+	var members []string
+	err := s.view([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		var err error
+		members, err = e.SRandMembers(count, distinct)
+		return err
+	})
+	return members, err
+}
+
+// SMove moves member from the set at src to the set at dst and reports
+// whether it was found in src.
+func (s *KV) SMove(src, dst, member string) (bool, error) {
+	var moved bool
+	err := s.update([]string{src, dst}, func(tx *txn) error {
+		from := tx.lookup(src)
+		if from == nil {
+			return nil
+		}
+		to := tx.lookup(dst)
+		if to != nil && to.typ != setType {
+			return ErrWrongType
+		}
+		var err error
+		if moved, err = from.SIsMember(member); err != nil || !moved {
+			return err
+		}
+		if src == dst {
+			return nil
+		}
+
+		from.SRem(member)
+		if n, _ := from.SLen(); n == 0 {
+			tx.delete(src)
+		}
+		if to == nil {
+			to = newSetEntry(s.limits)
+			tx.set(dst, to)
+		}
+		_, err = to.SAdd(s.limits, member)
+		return err
+	})
+	return moved, err
+}
+
+type SetOp int
+
+const (
+	SetInter SetOp = iota
+	SetUnion
+	SetDiff
+)
+
+// SetOperation returns the intersection, union or difference of the sets
+// at keys. Missing keys count as empty sets.
+func (s *KV) SetOperation(op SetOp, keys ...string) ([]string, error) {
+	var members []string
+	err := s.view(keys, func(tx *txn) error {
+		var err error
+		members, err = tx.setOperation(op, keys, 0)
+		return err
+	})
+	return members, err
+}
+
+// SetOperationStore stores the result of SetOperation at dest, replacing
+// whatever was there, and returns its size.
+func (s *KV) SetOperationStore(op SetOp, dest string, keys ...string) (int, error) {
+	var n int
+	err := s.update(append([]string{dest}, keys...), func(tx *txn) error {
+		members, err := tx.setOperation(op, keys, 0)
+		if err != nil {
+			return err
+		}
+		tx.delete(dest)
+		if n = len(members); n > 0 {
+			tx.set(dest, newSetEntry(s.limits, members...))
+		}
+		return nil
+	})
+	return n, err
+}
+
+// SInterCard returns the size of the intersection of the sets at keys,
+// counting no further than limit if it's positive.
+func (s *KV) SInterCard(limit int, keys ...string) (int, error) {
+	var n int
+	err := s.view(keys, func(tx *txn) error {
+		members, err := tx.setOperation(SetInter, keys, limit)
+		n = len(members)
+		return err
+	})
+	return n, err
+}
 
-	e, exists := s.data[key]
-	if !exists {
-		e = newHashEntry()
-		s.data[key] = e
+// setOperation computes op over the sets at keys, stopping after limit
+// members if it's positive.
+func (tx *txn) setOperation(op SetOp, keys []string, limit int) ([]string, error) {
+	sets := make([]setStore, len(keys))
+	for i, key := range keys {
+		e := tx.lookup(key)
+		if e == nil {
+			continue
+		}
+		if e.typ != setType {
+			return nil, ErrWrongType
+		}
+		sets[i] = e.set()
 	}
 
-	isNew, err := e.HSet(field, value)
-	if err != nil {
-		return 0, err
+	var result []string
+	full := func() bool { return limit > 0 && len(result) >= limit }
+	switch op {
+	case SetInter:
+		if slices.Contains(sets, nil) {
+			return []string{}, nil
+		}
+		// walk the smallest set and probe the others
+		slices.SortFunc(sets, func(a, b setStore) int { return cmp.Compare(a.len(), b.len()) })
+		sets[0].forEach(func(m string) bool {
+			for _, other := range sets[1:] {
+				if !other.contains(m) {
+					return true
+				}
+			}
+			result = append(result, m)
+			return !full()
+		})
+	case SetUnion:
+		seen := make(map[string]struct{})
+		for _, set := range sets {
+			if set == nil {
+				continue
+			}
+			set.forEach(func(m string) bool {
+				if _, dup := seen[m]; !dup {
+					seen[m] = struct{}{}
+					result = append(result, m)
+				}
+				return true
+			})
+		}
+	case SetDiff:
+		if sets[0] == nil {
+			return []string{}, nil
+		}
+		sets[0].forEach(func(m string) bool {
+			for _, other := range sets[1:] {
+				if other != nil && other.contains(m) {
+					return true
+				}
+			}
+			result = append(result, m)
+			return true
+		})
 	}
-	if isNew {
-		return 1, nil
+	if result == nil {
+		result = []string{}
 	}
-	return 0, nil
+	return result, nil
 }
 
-func (s *KV) HGet(key, field string) (string, bool, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	e, exists := s.data[key]
-	if !exists {
-		return "", false, nil
+// HSet sets the given field/value pairs and returns how many fields were
+// added.
+func (s *KV) HSet(key string, pairs ...string) (int, error) {
+	var added int
+	err := s.update([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			e = newHashEntry()
+			tx.set(key, e)
+		}
+		var err error
+		if added, err = e.HSet(s.limits, pairs...); err != nil {
+			return err
+		}
+		if e.fieldExpires != nil {
+			tx.syncFieldExpires(key, e)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
 	}
+	return added, nil
+}
+
+// HSetNX sets field only if it doesn't exist yet.
+func (s *KV) HSetNX(key, field, value string) (bool, error) {
+	var added int
+	err := s.update([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			e = newHashEntry()
+			tx.set(key, e)
+		} else if _, exists, err := e.HGet(field); err != nil || exists {
+			return err
+		}
+		var err error
+		added, err = e.HSet(s.limits, field, value)
+		return err
+	})
+	return added == 1, err
+}
 
-	value, fieldExists, err := e.HGet(field)
+func (s *KV) HGet(key, field string) (string, bool, error) {
+	var (
+		value       string
+		fieldExists bool
+	)
+	err := s.view([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		var err error
+		value, fieldExists, err = e.HGet(field)
+		return err
+	})
 	if err != nil {
 		return "", false, err
 	}
-
 	return value, fieldExists, nil
 }
 
 func (s *KV) HGetAll(key string) ([]string, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	e, exists := s.data[key]
-	if !exists {
-		return []string{}, nil
-	}
-
-	m, err := e.HGetAll()
+	flatHashSet := []string{}
+	err := s.view([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		var err error
+		flatHashSet, err = e.HGetAll()
+		return err
+	})
 	if err != nil {
 		return []string{}, err
 	}
-
-	flatHashSet := make([]string, 0, len(m)*2)
-	for k, v := range m {
-		flatHashSet = append(flatHashSet, k, v)
-	}
 	return flatHashSet, nil
 }
+
+func (s *KV) HMGet(key string, fields ...string) ([]string, []bool, error) {
+	values := make([]string, len(fields))
+	found := make([]bool, len(fields))
+	err := s.view([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		for i, f := range fields {
+			var err error
+			if values[i], found[i], err = e.HGet(f); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return values, found, err
+}
+
+// HDel deletes fields from the hash at key, and the key once it's empty.
+func (s *KV) HDel(key string, fields ...string) (int, error) {
+	var deleted int
+	err := s.update([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		var err error
+		if deleted, err = e.HDel(fields...); err != nil {
+			return err
+		}
+		if n, _ := e.HLen(); n == 0 {
+			tx.delete(key)
+		} else if e.fieldExpires != nil {
+			tx.syncFieldExpires(key, e)
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+func (s *KV) HLen(key string) (int, error) {
+	var n int
+	err := s.view([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		var err error
+		n, err = e.HLen()
+		return err
+	})
+	return n, err
+}
+
+func (s *KV) HIncrBy(key, field string, delta int64) (int64, error) {
+	var result int64
+	err := s.update([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			e = newHashEntry()
+			tx.set(key, e)
+		}
+		var err error
+		result, err = e.HIncrBy(s.limits, field, delta)
+		return err
+	})
+	return result, err
+}
+
+func (s *KV) HIncrByFloat(key, field string, delta float64) (string, error) {
+	var result string
+	err := s.update([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			e = newHashEntry()
+			tx.set(key, e)
+		}
+		var err error
+		result, err = e.HIncrByFloat(s.limits, field, delta)
+		return err
+	})
+	return result, err
+}
+
+// HRandField returns count random fields and their values, see
+// entry.HRandFields.
+func (s *KV) HRandField(key string, count int, distinct bool) ([]string, []string, error) {
+	var fields, values []string
+	err := s.view([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		var err error
+		fields, values, err = e.HRandFields(count, distinct)
+		return err
+	})
+	return fields, values, err
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+)
+
+// Run with -cpu 1,2,4,8 to see how throughput scales with GOMAXPROCS; the
+// shards=1 variants behave like a keyspace behind a single global lock.
+
+const benchKeys = 1 << 14
+
+func benchKeyNames() []string {
+	keys := make([]string, benchKeys)
+	for i := range keys {
+		keys[i] = "key:" + strconv.Itoa(i)
+	}
+	return keys
+}
+
+func benchmarkParallel(b *testing.B, op func(kv *KV, key string, i int)) {
+	keys := benchKeyNames()
+	for _, shards := range []int{1, DefaultShardCount} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			kv := NewDatabases(1, shards).DB(0)
+			for _, key := range keys {
+				kv.Set(key, "value")
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					op(kv, keys[i&(benchKeys-1)], i)
+					i += 7919
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkKV_Set(b *testing.B) {
+	benchmarkParallel(b, func(kv *KV, key string, _ int) {
+		kv.Set(key, "value")
+	})
+}
+
+func BenchmarkKV_Get(b *testing.B) {
+	benchmarkParallel(b, func(kv *KV, key string, _ int) {
+		kv.Get(key)
+	})
+}
+
+func BenchmarkKV_Incr(b *testing.B) {
+	benchmarkParallel(b, func(kv *KV, key string, i int) {
+		kv.Incr("counter:"+strconv.Itoa(i&1023), 1)
+	})
+}
+
+func BenchmarkKV_MixedReadWrite(b *testing.B) {
+	benchmarkParallel(b, func(kv *KV, key string, i int) {
+		if i%5 == 0 {
+			kv.Set(key, "value")
+		} else {
+			kv.Get(key)
+		}
+	})
+}
+
+func BenchmarkKV_MultiKeyDelete(b *testing.B) {
+	keys := benchKeyNames()
+	benchmarkParallel(b, func(kv *KV, key string, i int) {
+		kv.Delete(key, keys[(i+1)&(benchKeys-1)], keys[(i+2)&(benchKeys-1)])
+	})
+}
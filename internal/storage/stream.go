@@ -0,0 +1,321 @@
+package storage
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"unsafe"
+)
+
+// StreamID identifies a stream entry: the millisecond time it was added at
+// and a sequence number among the entries of the same millisecond.
+type StreamID struct {
+	Ms, Seq uint64
+}
+
+// MaxStreamID is the largest ID, written "+" in ranges.
+var MaxStreamID = StreamID{math.MaxUint64, math.MaxUint64}
+
+func (id StreamID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+func (id StreamID) Compare(other StreamID) int {
+	if c := cmp.Compare(id.Ms, other.Ms); c != 0 {
+		return c
+	}
+	return cmp.Compare(id.Seq, other.Seq)
+}
+
+func (id StreamID) IsZero() bool { return id == StreamID{} }
+
+// Next returns the smallest ID greater than id. It reports false if id is
+// already the largest one.
+func (id StreamID) Next() (StreamID, bool) {
+	switch {
+	case id.Seq < math.MaxUint64:
+		return StreamID{id.Ms, id.Seq + 1}, true
+	case id.Ms < math.MaxUint64:
+		return StreamID{id.Ms + 1, 0}, true
+	default:
+		return id, false
+	}
+}
+
+// Prev returns the largest ID smaller than id. It reports false if id is
+// 0-0.
+func (id StreamID) Prev() (StreamID, bool) {
+	switch {
+	case id.Seq > 0:
+		return StreamID{id.Ms, id.Seq - 1}, true
+	case id.Ms > 0:
+		return StreamID{id.Ms - 1, math.MaxUint64}, true
+	default:
+		return id, false
+	}
+}
+
+// StreamEntry is an entry of a stream. Fields holds field/value pairs; it is
+// nil for an entry that was deleted while still pending in a group.
+type StreamEntry struct {
+	ID     StreamID
+	Fields []string
+}
+
+var (
+	streamEntrySize = int64(unsafe.Sizeof(StreamEntry{}))
+	streamNodeSize  = int64(unsafe.Sizeof(streamNode{}))
+)
+
+func (e StreamEntry) memUsage() int64 {
+	n := streamEntrySize + int64(len(e.Fields))*int64(unsafe.Sizeof(""))
+	for _, f := range e.Fields {
+		n += int64(len(f))
+	}
+	return n
+}
+
+// streamNode holds a run of consecutive entries, like a listpack of a Redis
+// stream. Nodes are filled up to stream-node-max-entries and
+// stream-node-max-bytes, and approximate trimming only drops whole nodes.
+type streamNode struct {
+	entries []StreamEntry
+	bytes   int64
+}
+
+func (n *streamNode) lastID() StreamID { return n.entries[len(n.entries)-1].ID }
+
+// stream keeps its nodes in a slice ordered by ID, which takes the role of
+// the radix tree Redis indexes them with: appends go to the last node and
+// lookups binary search the nodes, then the entries of one node.
+type stream struct {
+	nodes  []*streamNode
+	length int
+	lastID StreamID
+	// maxDeletedID is the largest ID removed by XDEL, which tells whether
+	// the entries counter of a group can still be trusted.
+	maxDeletedID StreamID
+	entriesAdded int64
+	groups       map[string]*streamGroup
+	bytes        int64
+}
+
+func newStream() *stream {
+	return &stream{groups: make(map[string]*streamGroup)}
+}
+
+func (s *stream) firstID() StreamID {
+	if s.length == 0 {
+		return StreamID{}
+	}
+	return s.nodes[0].entries[0].ID
+}
+
+// nextID returns the ID of an entry added now, after lastID.
+func (s *stream) nextID(nowMs uint64) (StreamID, bool) {
+	if nowMs > s.lastID.Ms {
+		return StreamID{nowMs, 0}, true
+	}
+	return s.lastID.Next()
+}
+
+func (s *stream) append(lim *EncodingLimits, id StreamID, fields []string) {
+	e := StreamEntry{ID: id, Fields: fields}
+	size := e.memUsage()
+	var node *streamNode
+	if len(s.nodes) > 0 {
+		node = s.nodes[len(s.nodes)-1]
+		full := lim.StreamNodeMaxEntries > 0 && len(node.entries) >= lim.StreamNodeMaxEntries
+		full = full || (lim.StreamNodeMaxBytes > 0 && node.bytes+size > int64(lim.StreamNodeMaxBytes))
+		if full {
+			node = nil
+		}
+	}
+	if node == nil {
+		node = &streamNode{}
+		s.nodes = append(s.nodes, node)
+		s.bytes += streamNodeSize
+	}
+	node.entries = append(node.entries, e)
+	node.bytes += size
+	s.bytes += size
+	s.length++
+	s.lastID = id
+	s.entriesAdded++
+}
+
+// seek returns the position of the first entry with an ID of at least id,
+// which is past the end if there is none.
+func (s *stream) seek(id StreamID) (node, pos int) {
+	node = sort.Search(len(s.nodes), func(i int) bool { return s.nodes[i].lastID().Compare(id) >= 0 })
+	if node == len(s.nodes) {
+		return node, 0
+	}
+	entries := s.nodes[node].entries
+	pos = sort.Search(len(entries), func(i int) bool { return entries[i].ID.Compare(id) >= 0 })
+	return node, pos
+}
+
+func (s *stream) get(id StreamID) (StreamEntry, bool) {
+	node, pos := s.seek(id)
+	if node == len(s.nodes) || s.nodes[node].entries[pos].ID != id {
+		return StreamEntry{}, false
+	}
+	return s.nodes[node].entries[pos], true
+}
+
+// forRange visits the entries with IDs from start to end, both inclusive,
+// in ascending order or, if rev, from end down to start.
+func (s *stream) forRange(start, end StreamID, rev bool, fn func(e StreamEntry) bool) {
+	if start.Compare(end) > 0 {
+		return
+	}
+	if !rev {
+		node, pos := s.seek(start)
+		for ; node < len(s.nodes); node, pos = node+1, 0 {
+			for _, e := range s.nodes[node].entries[pos:] {
+				if e.ID.Compare(end) > 0 || !fn(e) {
+					return
+				}
+			}
+		}
+		return
+	}
+	node, pos := len(s.nodes), 0
+	if next, ok := end.Next(); ok {
+		node, pos = s.seek(next)
+	}
+	// pos is the first entry after end, so walk back from the one before
+	for ; node >= 0; node-- {
+		if node < len(s.nodes) {
+			entries := s.nodes[node].entries
+			for i := pos - 1; i >= 0; i-- {
+				if entries[i].ID.Compare(start) < 0 || !fn(entries[i]) {
+					return
+				}
+			}
+		}
+		if node > 0 {
+			pos = len(s.nodes[node-1].entries)
+		}
+	}
+}
+
+// removeAt removes an entry and its node once that is empty.
+func (s *stream) removeAt(node, pos int) {
+	n := s.nodes[node]
+	size := n.entries[pos].memUsage()
+	n.entries = slices.Delete(n.entries, pos, pos+1)
+	n.bytes -= size
+	s.bytes -= size
+	s.length--
+	if len(n.entries) == 0 {
+		s.nodes = slices.Delete(s.nodes, node, node+1)
+		s.bytes -= streamNodeSize
+	}
+}
+
+// delete removes the entry with the given ID, as XDEL does.
+func (s *stream) delete(id StreamID) bool {
+	node, pos := s.seek(id)
+	if node == len(s.nodes) || s.nodes[node].entries[pos].ID != id {
+		return false
+	}
+	s.removeAt(node, pos)
+	if id.Compare(s.maxDeletedID) > 0 {
+		s.maxDeletedID = id
+	}
+	return true
+}
+
+// StreamTrimBy is the strategy of a stream trim.
+type StreamTrimBy int
+
+const (
+	TrimNone StreamTrimBy = iota
+	TrimMaxLen
+	TrimMinID
+)
+
+// StreamTrim removes the oldest entries of a stream, either down to MaxLen
+// entries or up to MinID. An Approx trim only removes whole nodes, at most
+// Limit entries, 0 meaning no limit and -1 the default of 100 full nodes.
+type StreamTrim struct {
+	By     StreamTrimBy
+	MaxLen int64
+	MinID  StreamID
+	Approx bool
+	Limit  int64
+}
+
+// trim applies t and returns how many entries it removed.
+func (s *stream) trim(lim *EncodingLimits, t StreamTrim) int {
+	limit := int64(0)
+	if t.Approx {
+		limit = t.Limit
+		if limit < 0 {
+			limit = 100 * int64(lim.StreamNodeMaxEntries)
+		}
+	}
+	done := func() bool {
+		if t.By == TrimMaxLen {
+			return int64(s.length) <= t.MaxLen
+		}
+		return s.length == 0 || s.firstID().Compare(t.MinID) >= 0
+	}
+
+	removed := 0
+	for t.By != TrimNone && len(s.nodes) > 0 && !done() {
+		node := s.nodes[0]
+		n := len(node.entries)
+		if limit > 0 && int64(removed+n) > limit {
+			break
+		}
+		whole := int64(s.length-n) >= t.MaxLen
+		if t.By == TrimMinID {
+			whole = node.lastID().Compare(t.MinID) < 0
+		}
+		if whole {
+			s.nodes = s.nodes[1:]
+			s.length -= n
+			s.bytes -= node.bytes + streamNodeSize
+			removed += n
+			continue
+		}
+		if t.Approx {
+			break
+		}
+		for !done() {
+			s.removeAt(0, 0)
+			removed++
+		}
+	}
+	return removed
+}
+
+// exactTrim returns a trim with no approximation that leaves the stream as
+// it is now, which is how an approximate trim is logged to the AOF: its
+// outcome depends on the node limits, which may change across restarts.
+func (s *stream) exactTrim(t StreamTrim) StreamTrim {
+	exact := StreamTrim{By: t.By}
+	switch t.By {
+	case TrimMaxLen:
+		exact.MaxLen = int64(s.length)
+	case TrimMinID:
+		exact.MinID = s.firstID()
+		if s.length == 0 {
+			exact.MinID, _ = s.lastID.Next()
+		}
+	}
+	return exact
+}
+
+func (s *stream) memUsage() int64 {
+	n := int64(unsafe.Sizeof(*s)) + s.bytes
+	for name, g := range s.groups {
+		n += int64(len(name)) + g.memUsage()
+	}
+	return n
+}
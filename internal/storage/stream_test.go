@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"slices"
+	"testing"
+)
+
+func streamIDs(entries []StreamEntry) []StreamID {
+	var ids []StreamID
+	for _, e := range entries {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+func TestStreamRangeTrim(t *testing.T) {
+	lim := DefaultEncodingLimits()
+	lim.StreamNodeMaxEntries = 3
+	st := newStream()
+	for i := uint64(1); i <= 10; i++ {
+		st.append(&lim, StreamID{i, 0}, []string{"f", "v"})
+	}
+	if len(st.nodes) != 4 {
+		t.Fatalf("got %d nodes; want 4", len(st.nodes))
+	}
+
+	var got []StreamID
+	st.forRange(StreamID{3, 0}, StreamID{6, 0}, true, func(e StreamEntry) bool {
+		got = append(got, e.ID)
+		return true
+	})
+	if want := []StreamID{{6, 0}, {5, 0}, {4, 0}, {3, 0}}; !slices.Equal(got, want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+
+	// an approximate trim stops at the first node it can't drop whole
+	if n := st.trim(&lim, StreamTrim{By: TrimMaxLen, MaxLen: 5, Approx: true, Limit: -1}); n != 3 {
+		t.Fatalf("approx trim removed %d; want 3", n)
+	}
+	if exact := st.exactTrim(StreamTrim{By: TrimMaxLen}); exact.MaxLen != 7 {
+		t.Fatalf("got an exact MAXLEN of %d; want 7", exact.MaxLen)
+	}
+	if n := st.trim(&lim, StreamTrim{By: TrimMinID, MinID: StreamID{6, 0}}); n != 2 {
+		t.Fatalf("exact trim removed %d; want 2", n)
+	}
+	if st.firstID() != (StreamID{6, 0}) || st.length != 5 {
+		t.Fatalf("got first ID %v and length %d; want 6-0 and 5", st.firstID(), st.length)
+	}
+
+	if !st.delete(StreamID{8, 0}) || st.delete(StreamID{8, 0}) {
+		t.Fatal("delete should succeed once")
+	}
+	if _, ok := st.get(StreamID{8, 0}); ok || st.maxDeletedID != (StreamID{8, 0}) {
+		t.Fatal("deleted entry is still there")
+	}
+}
+
+func TestStreamAddIDs(t *testing.T) {
+	kv := NewKV()
+	if _, _, _, err := kv.XAdd("s", XAddArgs{Fields: []string{"f", "v"}}); err != ErrStreamIDZero {
+		t.Fatalf("got %v; want ErrStreamIDZero", err)
+	}
+	id, _, _, _ := kv.XAdd("s", XAddArgs{ID: StreamID{5, 0}, AutoSeq: true, Fields: []string{"f", "v"}})
+	next, _, _, _ := kv.XAdd("s", XAddArgs{ID: StreamID{5, 0}, AutoSeq: true, Fields: []string{"f", "v"}})
+	if id != (StreamID{5, 0}) || next != (StreamID{5, 1}) {
+		t.Fatalf("got %v and %v; want 5-0 and 5-1", id, next)
+	}
+	if _, _, _, err := kv.XAdd("s", XAddArgs{ID: StreamID{4, 0}, AutoSeq: true, Fields: []string{"f", "v"}}); err != ErrStreamIDTooSmall {
+		t.Fatalf("got %v; want ErrStreamIDTooSmall", err)
+	}
+	if _, _, added, _ := kv.XAdd("missing", XAddArgs{AutoID: true, NoMkStream: true, Fields: []string{"f", "v"}}); added {
+		t.Fatal("NOMKSTREAM created a stream")
+	}
+}
+
+func TestStreamGroups(t *testing.T) {
+	kv := NewKV()
+	for i := uint64(1); i <= 3; i++ {
+		kv.XAdd("s", XAddArgs{ID: StreamID{i, 0}, Fields: []string{"f", "v"}})
+	}
+	if err := kv.XGroupCreate("s", "g", StreamID{}, false, false, -1); err != nil {
+		t.Fatal(err)
+	}
+	if err := kv.XGroupCreate("s", "g", StreamID{}, false, false, -1); err != ErrBusyGroup {
+		t.Fatalf("got %v; want ErrBusyGroup", err)
+	}
+
+	read := func(consumer string, newOnly bool, count int) []StreamID {
+		reads, _, err := kv.XReadGroup(XReadGroupArgs{Group: "g", Consumer: consumer, Keys: []string{"s"},
+			IDs: []StreamID{{}}, New: []bool{newOnly}, Count: count})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(reads) == 0 {
+			return nil
+		}
+		return streamIDs(reads[0].Entries)
+	}
+	if got := read("alice", true, 2); !slices.Equal(got, []StreamID{{1, 0}, {2, 0}}) {
+		t.Fatalf("alice got %v", got)
+	}
+	if got := read("bob", true, 0); !slices.Equal(got, []StreamID{{3, 0}}) {
+		t.Fatalf("bob got %v", got)
+	}
+	if got := read("bob", true, 0); got != nil {
+		t.Fatalf("bob got %v after reading everything", got)
+	}
+
+	kv.XDel("s", StreamID{2, 0})
+	if got := read("alice", false, 0); !slices.Equal(got, []StreamID{{1, 0}, {2, 0}}) {
+		t.Fatalf("alice's history is %v", got)
+	}
+
+	res, err := kv.XAutoClaim("s", XClaimArgs{Group: "g", Consumer: "carol", Count: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := streamIDs(claimedEntries(res.Claimed)); !slices.Equal(got, []StreamID{{1, 0}, {3, 0}}) {
+		t.Fatalf("carol claimed %v", got)
+	}
+	if !slices.Equal(res.Deleted, []StreamID{{2, 0}}) || !res.Created {
+		t.Fatalf("got deleted %v, created %v", res.Deleted, res.Created)
+	}
+
+	if n, _ := kv.XAck("s", "g", StreamID{1, 0}, StreamID{9, 0}); n != 1 {
+		t.Fatalf("acked %d; want 1", n)
+	}
+	sum, _ := kv.XPending("s", "g")
+	if sum.Count != 1 || !slices.Equal(sum.Consumers, []ConsumerPending{{"carol", 1}}) {
+		t.Fatalf("got pending summary %+v", sum)
+	}
+	infos, _ := kv.XInfoGroups("s")
+	if len(infos) != 1 || !infos[0].LagKnown || infos[0].Lag != 0 {
+		t.Fatalf("got group info %+v", infos)
+	}
+}
+
+func claimedEntries(claimed []Claimed) []StreamEntry {
+	var entries []StreamEntry
+	for _, c := range claimed {
+		entries = append(entries, c.StreamEntry)
+	}
+	return entries
+}
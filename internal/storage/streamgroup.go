@@ -0,0 +1,779 @@
+package storage
+
+import (
+	"slices"
+	"time"
+	"unsafe"
+)
+
+// pendingEntry is an entry delivered to a consumer of a group and not
+// acknowledged yet.
+type pendingEntry struct {
+	consumer      *streamConsumer
+	deliveryTime  int64
+	deliveryCount int64
+}
+
+type streamConsumer struct {
+	name string
+	// seenTime is the last time the consumer tried to read or claim, and
+	// activeTime the last time it got something, or -1 if never.
+	seenTime, activeTime int64
+	pending              int
+}
+
+// streamPEL is the pending entries list of a group, kept sorted by ID.
+type streamPEL struct {
+	ids     []StreamID
+	entries map[StreamID]*pendingEntry
+}
+
+// streamGroup is a consumer group. entriesRead counts the entries the
+// group has been served since the stream began, or is -1 when unknown.
+type streamGroup struct {
+	lastID      StreamID
+	entriesRead int64
+	pel         streamPEL
+	consumers   map[string]*streamConsumer
+}
+
+var (
+	pendingEntrySize   = int64(unsafe.Sizeof(pendingEntry{}) + unsafe.Sizeof(StreamID{}))
+	streamConsumerSize = int64(unsafe.Sizeof(streamConsumer{}))
+)
+
+func newStreamGroup(lastID StreamID, entriesRead int64) *streamGroup {
+	return &streamGroup{
+		lastID:      lastID,
+		entriesRead: entriesRead,
+		pel:         streamPEL{entries: make(map[StreamID]*pendingEntry)},
+		consumers:   make(map[string]*streamConsumer),
+	}
+}
+
+func (g *streamGroup) memUsage() int64 {
+	n := int64(unsafe.Sizeof(*g)) + int64(len(g.pel.ids))*pendingEntrySize
+	for name := range g.consumers {
+		n += streamConsumerSize + int64(len(name))
+	}
+	return n
+}
+
+// seek returns the position of the first pending ID of at least id.
+func (p *streamPEL) seek(id StreamID) int {
+	i, _ := slices.BinarySearchFunc(p.ids, id, StreamID.Compare)
+	return i
+}
+
+func (p *streamPEL) add(id StreamID, pe *pendingEntry) {
+	if _, exists := p.entries[id]; !exists {
+		p.ids = slices.Insert(p.ids, p.seek(id), id)
+	}
+	p.entries[id] = pe
+}
+
+func (p *streamPEL) remove(id StreamID) *pendingEntry {
+	pe, exists := p.entries[id]
+	if !exists {
+		return nil
+	}
+	delete(p.entries, id)
+	i := p.seek(id)
+	p.ids = slices.Delete(p.ids, i, i+1)
+	pe.consumer.pending--
+	return pe
+}
+
+// consumer returns the named consumer, creating it if needed, and marks it
+// as seen at now. It reports whether it was created.
+func (g *streamGroup) consumer(name string, now int64) (*streamConsumer, bool) {
+	c, exists := g.consumers[name]
+	if !exists {
+		c = &streamConsumer{name: name, activeTime: -1}
+		g.consumers[name] = c
+	}
+	c.seenTime = now
+	return c, !exists
+}
+
+// deliver records that id was served to c at now.
+func (g *streamGroup) deliver(id StreamID, c *streamConsumer, now int64) {
+	if pe, exists := g.pel.entries[id]; exists {
+		pe.consumer.pending--
+	}
+	g.pel.add(id, &pendingEntry{consumer: c, deliveryTime: now, deliveryCount: 1})
+	c.pending++
+	c.activeTime = now
+}
+
+// hasTombstones reports whether XDEL may have removed an entry after id.
+func (s *stream) hasTombstones(id StreamID) bool {
+	return s.length > 0 && !s.maxDeletedID.IsZero() && id.Compare(s.maxDeletedID) <= 0
+}
+
+// entriesBefore estimates how many entries were added up to id since the
+// stream began, or returns -1 if that can't be known, like Redis's
+// streamEstimateDistanceFromFirstEverEntry.
+func (s *stream) entriesBefore(id StreamID) int64 {
+	if s.entriesAdded == 0 {
+		return 0
+	}
+	if s.length == 0 && id.Compare(s.lastID) <= 0 {
+		return s.entriesAdded
+	}
+	switch c := id.Compare(s.lastID); {
+	case c == 0:
+		return s.entriesAdded
+	case c > 0:
+		return -1
+	}
+	first := s.firstID()
+	if s.maxDeletedID.IsZero() || s.maxDeletedID.Compare(first) < 0 {
+		switch c := id.Compare(first); {
+		case c < 0:
+			return s.entriesAdded - int64(s.length)
+		case c == 0:
+			return s.entriesAdded - int64(s.length) + 1
+		}
+	}
+	return -1
+}
+
+// lag returns how many entries the group has yet to read, if known.
+func (s *stream) lag(g *streamGroup) (int64, bool) {
+	if s.entriesAdded == 0 {
+		return 0, true
+	}
+	if g.entriesRead >= 0 && !s.hasTombstones(g.lastID) {
+		return s.entriesAdded - g.entriesRead, true
+	}
+	if read := s.entriesBefore(g.lastID); read >= 0 {
+		return s.entriesAdded - read, true
+	}
+	return 0, false
+}
+
+// advance moves the last delivered ID of g to id, which was just served.
+func (s *stream) advance(g *streamGroup, id StreamID) {
+	g.lastID = id
+	if g.entriesRead >= 0 && !s.hasTombstones(id) {
+		g.entriesRead++
+	} else if s.entriesAdded > 0 {
+		g.entriesRead = s.entriesBefore(id)
+	}
+}
+
+// lookupGroup returns the stream at key and its group, failing with
+// ErrNoGroup if either is missing.
+func (tx *txn) lookupGroup(key, group string) (*stream, *streamGroup, error) {
+	st, err := tx.lookupStream(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if st == nil || st.groups[group] == nil {
+		return nil, nil, ErrNoGroup
+	}
+	return st, st.groups[group], nil
+}
+
+// lookupGroupOf is lookupGroup for the XGROUP subcommands, which fail with
+// ErrStreamKey on a missing stream.
+func (tx *txn) lookupGroupOf(key, group string) (*stream, *streamGroup, error) {
+	st, err := tx.lookupStream(key)
+	if err == nil && st == nil {
+		err = ErrStreamKey
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if st.groups[group] == nil {
+		return st, nil, ErrNoGroup
+	}
+	return st, st.groups[group], nil
+}
+
+// XGroupCreate creates a group that delivers the entries after id, or
+// after the last one if last. A missing stream is created if mkStream.
+// entriesRead is -1 when not given.
+func (s *KV) XGroupCreate(key, group string, id StreamID, last, mkStream bool, entriesRead int64) error {
+	return s.update([]string{key}, func(tx *txn) error {
+		st, err := tx.lookupStream(key)
+		if err != nil {
+			return err
+		}
+		if st == nil {
+			if !mkStream {
+				return ErrStreamKey
+			}
+			e := newStreamEntry()
+			tx.set(key, e)
+			st = e.stream()
+		}
+		if st.groups[group] != nil {
+			return ErrBusyGroup
+		}
+		if last {
+			id = st.lastID
+		}
+		st.groups[group] = newStreamGroup(id, entriesRead)
+		return nil
+	})
+}
+
+// XGroupSetID makes a group deliver the entries after id, or after the last
+// one if last.
+func (s *KV) XGroupSetID(key, group string, id StreamID, last bool, entriesRead int64) error {
+	return s.update([]string{key}, func(tx *txn) error {
+		st, g, err := tx.lookupGroupOf(key, group)
+		if err != nil {
+			return err
+		}
+		if last {
+			id = st.lastID
+		}
+		g.lastID, g.entriesRead = id, entriesRead
+		return nil
+	})
+}
+
+func (s *KV) XGroupDestroy(key, group string) (bool, error) {
+	var destroyed bool
+	err := s.update([]string{key}, func(tx *txn) error {
+		st, _, err := tx.lookupGroupOf(key, group)
+		if err == ErrNoGroup {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		delete(st.groups, group)
+		destroyed = true
+		return nil
+	})
+	return destroyed, err
+}
+
+func (s *KV) XGroupCreateConsumer(key, group, consumer string) (bool, error) {
+	var created bool
+	err := s.update([]string{key}, func(tx *txn) error {
+		_, g, err := tx.lookupGroupOf(key, group)
+		if err != nil {
+			return err
+		}
+		if g.consumers[consumer] == nil {
+			_, created = g.consumer(consumer, time.Now().UnixMilli())
+		}
+		return nil
+	})
+	return created, err
+}
+
+// XGroupDelConsumer deletes a consumer with its pending entries and returns
+// how many it had.
+func (s *KV) XGroupDelConsumer(key, group, consumer string) (int, error) {
+	var pending int
+	err := s.update([]string{key}, func(tx *txn) error {
+		_, g, err := tx.lookupGroupOf(key, group)
+		if err != nil {
+			return err
+		}
+		c := g.consumers[consumer]
+		if c == nil {
+			return nil
+		}
+		pending = c.pending
+		for _, id := range slices.Clone(g.pel.ids) {
+			if g.pel.entries[id].consumer == c {
+				g.pel.remove(id)
+			}
+		}
+		delete(g.consumers, consumer)
+		return nil
+	})
+	return pending, err
+}
+
+// XReadGroupArgs describe an XREADGROUP. For every key, New tells whether
+// to deliver the entries never delivered to the group, or else the history
+// of the consumer after the matching ID of IDs.
+type XReadGroupArgs struct {
+	Group, Consumer string
+	Keys            []string
+	IDs             []StreamID
+	New             []bool
+	Count           int
+	NoAck           bool
+}
+
+// GroupRead is what XREADGROUP got from one stream, with the state it left
+// so that it can be logged as XCLAIM and XGROUP SETID.
+type GroupRead struct {
+	StreamRead
+	// Deliveries is the delivery count of every pending entry read, nil
+	// with NoAck.
+	Deliveries  []int64
+	Time        int64
+	LastID      StreamID
+	EntriesRead int64
+}
+
+// XReadGroup serves a consumer of a group. Streams with no new entries are
+// left out, while history reads are always returned. It reports whether
+// the consumer was created.
+func (s *KV) XReadGroup(a XReadGroupArgs) ([]GroupRead, bool, error) {
+	var reads []GroupRead
+	var created bool
+	err := s.update(a.Keys, func(tx *txn) error {
+		now := time.Now().UnixMilli()
+		for i, key := range a.Keys {
+			st, g, err := tx.lookupGroup(key, a.Group)
+			if err != nil {
+				return err
+			}
+			c, isNew := g.consumer(a.Consumer, now)
+			created = created || isNew
+			read := GroupRead{StreamRead: StreamRead{Key: key}, Time: now}
+			full := func() bool { return a.Count > 0 && len(read.Entries) >= a.Count }
+
+			if a.New[i] {
+				start, ok := g.lastID.Next()
+				if ok {
+					st.forRange(start, MaxStreamID, false, func(e StreamEntry) bool {
+						read.Entries = append(read.Entries, e)
+						st.advance(g, e.ID)
+						if !a.NoAck {
+							g.deliver(e.ID, c, now)
+							read.Deliveries = append(read.Deliveries, 1)
+						}
+						return !full()
+					})
+				}
+				if len(read.Entries) == 0 {
+					continue
+				}
+			} else if start, ok := a.IDs[i].Next(); ok {
+				for _, id := range g.pel.ids[g.pel.seek(start):] {
+					pe := g.pel.entries[id]
+					if pe.consumer != c {
+						continue
+					}
+					if full() {
+						break
+					}
+					e, exists := st.get(id)
+					if !exists {
+						e = StreamEntry{ID: id}
+					}
+					pe.deliveryTime = now
+					pe.deliveryCount++
+					read.Entries = append(read.Entries, e)
+					read.Deliveries = append(read.Deliveries, pe.deliveryCount)
+				}
+			}
+			read.LastID, read.EntriesRead = g.lastID, g.entriesRead
+			reads = append(reads, read)
+		}
+		return nil
+	})
+	return reads, created, err
+}
+
+// XAck removes ids from the pending entries of a group and returns how many
+// were pending.
+func (s *KV) XAck(key, group string, ids ...StreamID) (int, error) {
+	var acked int
+	err := s.update([]string{key}, func(tx *txn) error {
+		_, g, err := tx.lookupGroup(key, group)
+		if err == ErrNoGroup {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if g.pel.remove(id) != nil {
+				acked++
+			}
+		}
+		return nil
+	})
+	return acked, err
+}
+
+// PendingEntry describes an entry pending in a group.
+type PendingEntry struct {
+	ID           StreamID
+	Consumer     string
+	DeliveryTime int64
+	Deliveries   int64
+}
+
+func (p *streamPEL) describe(id StreamID) PendingEntry {
+	pe := p.entries[id]
+	return PendingEntry{id, pe.consumer.name, pe.deliveryTime, pe.deliveryCount}
+}
+
+// PendingSummary is the short form of XPENDING: how many entries are
+// pending, their lowest and highest IDs and how many each consumer has.
+type PendingSummary struct {
+	Count     int
+	Min, Max  StreamID
+	Consumers []ConsumerPending
+}
+
+type ConsumerPending struct {
+	Name  string
+	Count int
+}
+
+func (s *KV) XPending(key, group string) (PendingSummary, error) {
+	var sum PendingSummary
+	err := s.view([]string{key}, func(tx *txn) error {
+		_, g, err := tx.lookupGroup(key, group)
+		if err != nil {
+			return err
+		}
+		sum.Count = len(g.pel.ids)
+		if sum.Count == 0 {
+			return nil
+		}
+		sum.Min, sum.Max = g.pel.ids[0], g.pel.ids[sum.Count-1]
+		for _, name := range sortedKeys(g.consumers) {
+			if n := g.consumers[name].pending; n > 0 {
+				sum.Consumers = append(sum.Consumers, ConsumerPending{name, n})
+			}
+		}
+		return nil
+	})
+	return sum, err
+}
+
+// XPendingRange returns up to count pending entries with IDs from start to
+// end, idle for at least minIdle milliseconds, only those of consumer if
+// it isn't "".
+func (s *KV) XPendingRange(key, group string, minIdle int64, start, end StreamID, count int, consumer string) ([]PendingEntry, error) {
+	entries := []PendingEntry{}
+	err := s.view([]string{key}, func(tx *txn) error {
+		_, g, err := tx.lookupGroup(key, group)
+		if err != nil {
+			return err
+		}
+		now := time.Now().UnixMilli()
+		for _, id := range g.pel.ids[g.pel.seek(start):] {
+			if len(entries) >= count || id.Compare(end) > 0 {
+				break
+			}
+			pe := g.pel.entries[id]
+			if (consumer != "" && pe.consumer.name != consumer) || now-pe.deliveryTime < minIdle {
+				continue
+			}
+			entries = append(entries, g.pel.describe(id))
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// XClaimArgs describe an XCLAIM, which claims IDs, or an XAUTOCLAIM, which
+// scans up to Count pending entries from Start. Time is the delivery time
+// to record, -1 for now, and RetryCount the delivery count, -1 to count
+// the claim as one more delivery unless JustID.
+type XClaimArgs struct {
+	Group, Consumer string
+	MinIdle         int64
+	IDs             []StreamID
+	Start           StreamID
+	Count           int
+	Time            int64
+	RetryCount      int64
+	Force, JustID   bool
+	LastID          StreamID
+}
+
+// Claimed is a pending entry that changed hands. Fields is nil if JustID.
+type Claimed struct {
+	StreamEntry
+	DeliveryTime int64
+	Deliveries   int64
+}
+
+// ClaimResult is the outcome of a claim. Deleted holds the pending IDs
+// that were dropped because their entry is gone, Next the ID where an
+// XAUTOCLAIM resumes, 0-0 once it scanned everything, and LastID and
+// EntriesRead the state of the group afterwards.
+type ClaimResult struct {
+	Claimed     []Claimed
+	Deleted     []StreamID
+	Next        StreamID
+	LastID      StreamID
+	EntriesRead int64
+	Created     bool
+}
+
+// claim hands the pending entry id over to c, unless it isn't idle enough.
+// It reports false if the entry no longer exists and was dropped instead.
+func (st *stream) claim(g *streamGroup, c *streamConsumer, id StreamID, a XClaimArgs, now int64, res *ClaimResult) bool {
+	pe := g.pel.entries[id]
+	e, exists := st.get(id)
+	if !exists {
+		g.pel.remove(id)
+		res.Deleted = append(res.Deleted, id)
+		return false
+	}
+	if now-pe.deliveryTime < a.MinIdle {
+		return true
+	}
+	if pe.consumer != c {
+		pe.consumer.pending--
+		pe.consumer = c
+		c.pending++
+	}
+	pe.deliveryTime = now
+	if a.Time >= 0 {
+		pe.deliveryTime = min(a.Time, now)
+	}
+	switch {
+	case a.RetryCount >= 0:
+		pe.deliveryCount = a.RetryCount
+	case !a.JustID:
+		pe.deliveryCount++
+	}
+	c.activeTime = now
+	if a.JustID {
+		e.Fields = nil
+	}
+	res.Claimed = append(res.Claimed, Claimed{e, pe.deliveryTime, pe.deliveryCount})
+	return true
+}
+
+// XClaim gives the pending entries a.IDs that are idle for at least
+// a.MinIdle to a.Consumer. With Force, IDs of existing entries that aren't
+// pending are claimed too.
+func (s *KV) XClaim(key string, a XClaimArgs) (ClaimResult, error) {
+	var res ClaimResult
+	err := s.update([]string{key}, func(tx *txn) error {
+		st, g, err := tx.lookupGroup(key, a.Group)
+		if err != nil {
+			return err
+		}
+		now := time.Now().UnixMilli()
+		c, created := g.consumer(a.Consumer, now)
+		res.Created = created
+		if a.LastID.Compare(g.lastID) > 0 {
+			g.lastID = a.LastID
+		}
+		for _, id := range a.IDs {
+			if g.pel.entries[id] == nil {
+				if _, exists := st.get(id); !a.Force || !exists {
+					continue
+				}
+				// a forced entry is claimed whatever MinIdle asks for
+				g.pel.add(id, &pendingEntry{consumer: c, deliveryTime: now - a.MinIdle})
+				c.pending++
+			}
+			st.claim(g, c, id, a, now, &res)
+		}
+		res.LastID, res.EntriesRead = g.lastID, g.entriesRead
+		return nil
+	})
+	return res, err
+}
+
+// XAutoClaim claims up to a.Count pending entries idle for at least
+// a.MinIdle, scanning from a.Start.
+func (s *KV) XAutoClaim(key string, a XClaimArgs) (ClaimResult, error) {
+	var res ClaimResult
+	err := s.update([]string{key}, func(tx *txn) error {
+		st, g, err := tx.lookupGroup(key, a.Group)
+		if err != nil {
+			return err
+		}
+		now := time.Now().UnixMilli()
+		c, created := g.consumer(a.Consumer, now)
+		res.Created = created
+		a.Time, a.RetryCount = -1, -1
+		// like Redis, give up after looking at ten times count entries
+		attempts := a.Count * 10
+		i := g.pel.seek(a.Start)
+		for i < len(g.pel.ids) && attempts > 0 && len(res.Claimed) < a.Count {
+			attempts--
+			if st.claim(g, c, g.pel.ids[i], a, now, &res) {
+				i++
+			}
+		}
+		if i < len(g.pel.ids) {
+			res.Next = g.pel.ids[i]
+		}
+		res.LastID, res.EntriesRead = g.lastID, g.entriesRead
+		return nil
+	})
+	return res, err
+}
+
+// ConsumerInfo describes a consumer. Entries lists its pending entries,
+// which only XINFO STREAM FULL asks for.
+type ConsumerInfo struct {
+	Name                 string
+	Pending              int
+	SeenTime, ActiveTime int64
+	Entries              []PendingEntry
+}
+
+// GroupInfo describes a group. Lag is only valid if LagKnown, and
+// EntriesRead is -1 when unknown. Entries and ConsumerList are only filled
+// for XINFO STREAM FULL.
+type GroupInfo struct {
+	Name         string
+	Consumers    int
+	Pending      int
+	LastID       StreamID
+	EntriesRead  int64
+	Lag          int64
+	LagKnown     bool
+	Entries      []PendingEntry
+	ConsumerList []ConsumerInfo
+}
+
+// StreamInfo describes a stream. Entries and GroupList are only filled for
+// XINFO STREAM FULL.
+type StreamInfo struct {
+	Length       int
+	Nodes        int
+	LastID       StreamID
+	MaxDeletedID StreamID
+	EntriesAdded int64
+	FirstID      StreamID
+	Groups       int
+	First, Last  *StreamEntry
+	Entries      []StreamEntry
+	GroupList    []GroupInfo
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func (st *stream) groupInfo(name string, full bool) GroupInfo {
+	g := st.groups[name]
+	info := GroupInfo{
+		Name:        name,
+		Consumers:   len(g.consumers),
+		Pending:     len(g.pel.ids),
+		LastID:      g.lastID,
+		EntriesRead: g.entriesRead,
+	}
+	info.Lag, info.LagKnown = st.lag(g)
+	if !full {
+		return info
+	}
+	info.Entries = []PendingEntry{}
+	for _, id := range g.pel.ids {
+		info.Entries = append(info.Entries, g.pel.describe(id))
+	}
+	info.ConsumerList = consumerInfos(g)
+	for i := range info.ConsumerList {
+		c := &info.ConsumerList[i]
+		c.Entries = []PendingEntry{}
+		for _, pe := range info.Entries {
+			if pe.Consumer == c.Name {
+				c.Entries = append(c.Entries, pe)
+			}
+		}
+	}
+	return info
+}
+
+func consumerInfos(g *streamGroup) []ConsumerInfo {
+	infos := []ConsumerInfo{}
+	for _, name := range sortedKeys(g.consumers) {
+		c := g.consumers[name]
+		infos = append(infos, ConsumerInfo{Name: name, Pending: c.pending, SeenTime: c.seenTime, ActiveTime: c.activeTime})
+	}
+	return infos
+}
+
+// XInfoStream describes the stream at key. With full it also lists up to
+// count entries, all of them if count is 0, and every group in detail.
+func (s *KV) XInfoStream(key string, full bool, count int) (StreamInfo, error) {
+	var info StreamInfo
+	err := s.view([]string{key}, func(tx *txn) error {
+		st, err := tx.lookupStream(key)
+		if err == nil && st == nil {
+			err = ErrNoSuchKey
+		}
+		if err != nil {
+			return err
+		}
+		info = StreamInfo{
+			Length:       st.length,
+			Nodes:        len(st.nodes),
+			LastID:       st.lastID,
+			MaxDeletedID: st.maxDeletedID,
+			EntriesAdded: st.entriesAdded,
+			FirstID:      st.firstID(),
+			Groups:       len(st.groups),
+		}
+		if !full {
+			if st.length > 0 {
+				first, last := st.nodes[0].entries[0], st.nodes[len(st.nodes)-1].lastID()
+				lastEntry, _ := st.get(last)
+				info.First, info.Last = &first, &lastEntry
+			}
+			return nil
+		}
+		info.Entries = []StreamEntry{}
+		st.forRange(StreamID{}, MaxStreamID, false, func(e StreamEntry) bool {
+			info.Entries = append(info.Entries, e)
+			return count == 0 || len(info.Entries) < count
+		})
+		info.GroupList = []GroupInfo{}
+		for _, name := range sortedKeys(st.groups) {
+			info.GroupList = append(info.GroupList, st.groupInfo(name, true))
+		}
+		return nil
+	})
+	return info, err
+}
+
+func (s *KV) XInfoGroups(key string) ([]GroupInfo, error) {
+	infos := []GroupInfo{}
+	err := s.view([]string{key}, func(tx *txn) error {
+		st, err := tx.lookupStream(key)
+		if err == nil && st == nil {
+			err = ErrNoSuchKey
+		}
+		if err != nil {
+			return err
+		}
+		for _, name := range sortedKeys(st.groups) {
+			infos = append(infos, st.groupInfo(name, false))
+		}
+		return nil
+	})
+	return infos, err
+}
+
+func (s *KV) XInfoConsumers(key, group string) ([]ConsumerInfo, error) {
+	var infos []ConsumerInfo
+	err := s.view([]string{key}, func(tx *txn) error {
+		st, err := tx.lookupStream(key)
+		if err == nil && st == nil {
+			err = ErrNoSuchKey
+		}
+		if err != nil {
+			return err
+		}
+		g := st.groups[group]
+		if g == nil {
+			return ErrNoGroup
+		}
+		infos = consumerInfos(g)
+		return nil
+	})
+	return infos, err
+}
@@ -0,0 +1,215 @@
+package storage
+
+import (
+	"math"
+	"time"
+)
+
+// XAddArgs describe an XADD. AutoID lets the stream pick the ID of the
+// entry, and AutoSeq only its sequence number within ID.Ms.
+type XAddArgs struct {
+	ID         StreamID
+	AutoID     bool
+	AutoSeq    bool
+	NoMkStream bool
+	Trim       StreamTrim
+	Fields     []string
+}
+
+// idFor returns the ID an entry added by a gets, which must be greater
+// than the last one.
+func (s *stream) idFor(a XAddArgs) (StreamID, error) {
+	switch {
+	case a.AutoID:
+		id, ok := s.nextID(uint64(time.Now().UnixMilli()))
+		if !ok {
+			return id, ErrStreamExhausted
+		}
+		return id, nil
+	case a.AutoSeq:
+		id := StreamID{Ms: a.ID.Ms}
+		switch {
+		case id.Ms > s.lastID.Ms:
+			return id, nil
+		case id.Ms < s.lastID.Ms || s.lastID.Seq == math.MaxUint64:
+			return id, ErrStreamIDTooSmall
+		}
+		id.Seq = s.lastID.Seq + 1
+		return id, nil
+	default:
+		if a.ID.IsZero() {
+			return a.ID, ErrStreamIDZero
+		}
+		if a.ID.Compare(s.lastID) <= 0 {
+			return a.ID, ErrStreamIDTooSmall
+		}
+		return a.ID, nil
+	}
+}
+
+// XAdd appends an entry to the stream at key, creating it unless
+// NoMkStream, then applies the trim of a. It returns the ID of the entry
+// and, for an approximate trim, the exact one with the same outcome. It
+// reports false if the stream didn't exist and wasn't created.
+func (s *KV) XAdd(key string, a XAddArgs) (StreamID, StreamTrim, bool, error) {
+	var id StreamID
+	var trim StreamTrim
+	var added bool
+	err := s.update([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil && a.NoMkStream {
+			return nil
+		}
+		if e != nil && e.typ != streamType {
+			return ErrWrongType
+		}
+		st := newStream()
+		if e != nil {
+			st = e.stream()
+		}
+		var err error
+		if id, err = st.idFor(a); err != nil {
+			return err
+		}
+		if e == nil {
+			tx.set(key, &entry{typ: streamType, data: st})
+		}
+		st.append(s.limits, id, a.Fields)
+		st.trim(s.limits, a.Trim)
+		trim = st.exactTrim(a.Trim)
+		added = true
+		return nil
+	})
+	return id, trim, added, err
+}
+
+// lookupStream returns the stream at key, or nil if there is none.
+func (tx *txn) lookupStream(key string) (*stream, error) {
+	e := tx.lookup(key)
+	if e == nil {
+		return nil, nil
+	}
+	if e.typ != streamType {
+		return nil, ErrWrongType
+	}
+	return e.stream(), nil
+}
+
+func (s *KV) XLen(key string) (int, error) {
+	var n int
+	err := s.view([]string{key}, func(tx *txn) error {
+		st, err := tx.lookupStream(key)
+		if st != nil {
+			n = st.length
+		}
+		return err
+	})
+	return n, err
+}
+
+// XRange returns up to count entries with IDs from start to end, or all of
+// them if count < 0, from the highest ID down if rev.
+func (s *KV) XRange(key string, start, end StreamID, rev bool, count int) ([]StreamEntry, error) {
+	entries := []StreamEntry{}
+	err := s.view([]string{key}, func(tx *txn) error {
+		st, err := tx.lookupStream(key)
+		if st == nil || count == 0 {
+			return err
+		}
+		st.forRange(start, end, rev, func(e StreamEntry) bool {
+			entries = append(entries, e)
+			return count < 0 || len(entries) < count
+		})
+		return nil
+	})
+	return entries, err
+}
+
+// XDel removes entries by ID and returns how many existed. Unlike other
+// collections, an emptied stream is kept.
+func (s *KV) XDel(key string, ids ...StreamID) (int, error) {
+	var deleted int
+	err := s.update([]string{key}, func(tx *txn) error {
+		st, err := tx.lookupStream(key)
+		if st == nil {
+			return err
+		}
+		for _, id := range ids {
+			if st.delete(id) {
+				deleted++
+			}
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+// XTrim applies t to the stream at key and returns how many entries it
+// removed and, for an approximate trim, the exact one with the same outcome.
+func (s *KV) XTrim(key string, t StreamTrim) (int, StreamTrim, error) {
+	var removed int
+	var exact StreamTrim
+	err := s.update([]string{key}, func(tx *txn) error {
+		st, err := tx.lookupStream(key)
+		if st == nil {
+			return err
+		}
+		removed = st.trim(s.limits, t)
+		exact = st.exactTrim(t)
+		return nil
+	})
+	return removed, exact, err
+}
+
+// XLastIDs returns the last ID of each stream, 0-0 for a missing key, to
+// resolve the "$" of XREAD.
+func (s *KV) XLastIDs(keys []string) ([]StreamID, error) {
+	ids := make([]StreamID, len(keys))
+	err := s.view(keys, func(tx *txn) error {
+		for i, key := range keys {
+			st, err := tx.lookupStream(key)
+			if err != nil {
+				return err
+			}
+			if st != nil {
+				ids[i] = st.lastID
+			}
+		}
+		return nil
+	})
+	return ids, err
+}
+
+// StreamRead holds the entries a read got from one stream.
+type StreamRead struct {
+	Key     string
+	Entries []StreamEntry
+}
+
+// XRead returns, for every stream with entries after the matching ID of
+// ids, up to count of them, or all of them if count <= 0.
+func (s *KV) XRead(keys []string, ids []StreamID, count int) ([]StreamRead, error) {
+	var reads []StreamRead
+	err := s.view(keys, func(tx *txn) error {
+		for i, key := range keys {
+			st, err := tx.lookupStream(key)
+			if err != nil {
+				return err
+			}
+			start, ok := ids[i].Next()
+			if st == nil || !ok {
+				continue
+			}
+			var entries []StreamEntry
+			st.forRange(start, MaxStreamID, false, func(e StreamEntry) bool {
+				entries = append(entries, e)
+				return count <= 0 || len(entries) < count
+			})
+			if len(entries) > 0 {
+				reads = append(reads, StreamRead{key, entries})
+			}
+		}
+		return nil
+	})
+	return reads, err
+}
@@ -0,0 +1,275 @@
+package storage
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// maxStringSize is the largest string SETRANGE and APPEND-like commands may
+// build, the default proto-max-bulk-len of Redis.
+const maxStringSize = 512 * 1024 * 1024
+
+type SetCondition int
+
+const (
+	SetAlways SetCondition = iota
+	SetNX
+	SetXX
+)
+
+type SetOptions struct {
+	Cond SetCondition
+	// ExpireAt is an absolute unix time in milliseconds, 0 for no TTL.
+	ExpireAt int64
+	// KeepTTL keeps the TTL of the old value instead of clearing it.
+	KeepTTL bool
+	// Get makes SET fail with ErrWrongType if the old value isn't a string.
+	Get bool
+}
+
+// SetWithOptions implements SET. It returns the old string value when there
+// was one and whether the value was written.
+func (s *KV) SetWithOptions(key, value string, opts SetOptions) (old string, hadOld, applied bool, err error) {
+	err = s.update([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e != nil && opts.Get {
+			var err error
+			if old, err = e.String(); err != nil {
+				return err
+			}
+			hadOld = true
+		}
+		if opts.Cond == SetNX && e != nil || opts.Cond == SetXX && e == nil {
+			return nil
+		}
+		applied = true
+		tx.set(key, newStringEntry(value))
+		switch {
+		case opts.ExpireAt != 0:
+			if s.past(opts.ExpireAt) {
+				tx.delete(key)
+				return nil
+			}
+			tx.setExpireAt(key, opts.ExpireAt)
+		case !opts.KeepTTL:
+			tx.persist(key)
+		}
+		return nil
+	})
+	return old, hadOld, applied, err
+}
+
+func (s *KV) GetDel(key string) (string, bool, error) {
+	var val string
+	var exists bool
+	err := s.update([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		var err error
+		if val, err = e.String(); err != nil {
+			return err
+		}
+		exists = true
+		tx.delete(key)
+		return nil
+	})
+	return val, exists, err
+}
+
+// GetEx returns the value of key and then sets its expiration time: to
+// expireAt if it isn't 0, or removes the TTL if persist is set.
+func (s *KV) GetEx(key string, expireAt int64, persist bool) (string, bool, error) {
+	var val string
+	var exists bool
+	err := s.update([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		var err error
+		if val, err = e.String(); err != nil {
+			return err
+		}
+		exists = true
+		switch {
+		case expireAt != 0 && s.past(expireAt):
+			tx.delete(key)
+		case expireAt != 0:
+			tx.setExpireAt(key, expireAt)
+		case persist:
+			tx.persist(key)
+		}
+		return nil
+	})
+	return val, exists, err
+}
+
+// MGet returns the values of keys. Missing keys and keys that don't hold a
+// string are reported as not found.
+func (s *KV) MGet(keys ...string) ([]string, []bool) {
+	values := make([]string, len(keys))
+	found := make([]bool, len(keys))
+	s.view(keys, func(tx *txn) error {
+		for i, key := range keys {
+			if e := tx.lookup(key); e != nil {
+				values[i], _ = e.String()
+				found[i] = e.typ == stringType
+			}
+		}
+		return nil
+	})
+	return values, found
+}
+
+// GetStrings returns the values of keys, with missing keys read as empty
+// strings. It fails with ErrWrongType if any key holds another type.
+func (s *KV) GetStrings(keys ...string) ([]string, error) {
+	values := make([]string, len(keys))
+	err := s.view(keys, func(tx *txn) error {
+		for i, key := range keys {
+			if e := tx.lookup(key); e != nil {
+				var err error
+				if values[i], err = e.String(); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	return values, err
+}
+
+// MSet sets keys and values given as alternating pairs. With nx set, nothing
+// is written unless none of the keys exists.
+func (s *KV) MSet(pairs []string, nx bool) (applied bool) {
+	keys := make([]string, 0, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		keys = append(keys, pairs[i])
+	}
+	s.update(keys, func(tx *txn) error {
+		if nx {
+			for _, key := range keys {
+				if tx.lookup(key) != nil {
+					return nil
+				}
+			}
+		}
+		applied = true
+		for i := 0; i < len(pairs); i += 2 {
+			tx.set(pairs[i], newStringEntry(pairs[i+1]))
+			tx.persist(pairs[i])
+		}
+		return nil
+	})
+	return applied
+}
+
+func (s *KV) StrLen(key string) (int, error) {
+	var n int
+	err := s.view([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		var err error
+		n, err = e.StrLen()
+		return err
+	})
+	return n, err
+}
+
+// GetRange returns the substring between start and end, both inclusive.
+// Negative offsets count from the end of the string.
+func (s *KV) GetRange(key string, start, end int64) (string, error) {
+	var sub string
+	err := s.view([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		val, err := e.view()
+		if err != nil {
+			return err
+		}
+		n := int64(len(val))
+		if start < 0 && end < 0 && start > end {
+			return nil
+		}
+		if start < 0 {
+			start = max(n+start, 0)
+		}
+		if end < 0 {
+			end = max(n+end, 0)
+		}
+		end = min(end, n-1)
+		if n == 0 || start > end {
+			return nil
+		}
+		sub = strings.Clone(val[start : end+1])
+		return nil
+	})
+	return sub, err
+}
+
+// SetRange overwrites the string at key from offset on, padding it with zero
+// bytes if needed, and returns the new length.
+func (s *KV) SetRange(key string, offset int64, value string) (int, error) {
+	var n int
+	err := s.update([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e != nil && e.typ != stringType {
+			return ErrWrongType
+		}
+		if value == "" {
+			if e != nil {
+				n, _ = e.StrLen()
+			}
+			return nil
+		}
+		if offset+int64(len(value)) > maxStringSize {
+			return ErrTooLarge
+		}
+		if e == nil {
+			e = newStringEntry("")
+			tx.set(key, e)
+		}
+		b, err := e.mutableBytes(int(offset) + len(value))
+		if err != nil {
+			return err
+		}
+		copy(b[offset:], value)
+		n = len(b)
+		return nil
+	})
+	return n, err
+}
+
+// IncrByFloat adds delta to the number stored at key and returns the result
+// formatted the way it is stored.
+func (s *KV) IncrByFloat(key string, delta float64) (string, error) {
+	var result string
+	err := s.update([]string{key}, func(tx *txn) error {
+		var current float64
+		if e := tx.lookup(key); e != nil {
+			val, err := e.String()
+			if err != nil {
+				return err
+			}
+			current, err = strconv.ParseFloat(val, 64)
+			if err != nil || math.IsNaN(current) || math.IsInf(current, 0) {
+				return ErrNotFloat
+			}
+		}
+		sum := current + delta
+		if math.IsNaN(sum) || math.IsInf(sum, 0) {
+			return ErrNaN
+		}
+		result = strconv.FormatFloat(sum, 'f', -1, 64)
+		tx.set(key, newStringEntry(result))
+		return nil
+	})
+	return result, err
+}
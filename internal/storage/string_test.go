@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSetWithOptions_TTL(t *testing.T) {
+	kv := NewKV()
+	expireAt := time.Now().Add(time.Hour).UnixMilli()
+	kv.SetWithOptions("k", "v1", SetOptions{ExpireAt: expireAt})
+	kv.SetWithOptions("k", "v2", SetOptions{KeepTTL: true})
+	if got := kv.ExpireTime("k"); got != expireAt {
+		t.Fatalf("KEEPTTL: got expire time %d; want %d", got, expireAt)
+	}
+	kv.Set("k", "v3")
+	if got := kv.ExpireTime("k"); got != -1 {
+		t.Fatalf("SET must clear the TTL, got expire time %d", got)
+	}
+	if _, _, applied, _ := kv.SetWithOptions("k", "v4", SetOptions{Cond: SetNX}); applied {
+		t.Fatalf("NX must not overwrite an existing key")
+	}
+}
+
+func TestGetRange(t *testing.T) {
+	kv := NewKV()
+	kv.Set("s", "This is a string")
+	tests := []struct {
+		start, end int64
+		want       string
+	}{
+		{0, 3, "This"},
+		{-3, -1, "ing"},
+		{0, -1, "This is a string"},
+		{10, 100, "string"},
+		{-1, -5, ""},
+		{20, 30, ""},
+	}
+	for _, tt := range tests {
+		if got, _ := kv.GetRange("s", tt.start, tt.end); got != tt.want {
+			t.Errorf("GetRange(%d, %d) = %q; want %q", tt.start, tt.end, got, tt.want)
+		}
+	}
+}
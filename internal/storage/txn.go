@@ -0,0 +1,213 @@
+package storage
+
+import (
+	"slices"
+	"time"
+)
+
+// txn is the only way KV methods reach the keyspace. It holds the locks of
+// the shards it was opened for, and every key lookup goes through
+// txn.lookup, which hides logically expired keys and deletes them, so all
+// data types share the same lazy expiration semantics.
+type txn struct {
+	kv       *KV
+	writable bool
+	shards   []int
+	expired  []string
+	// touched holds the entries handed out by a writable txn; fn may have
+	// resized them in place, so their memory is reconciled once it returns.
+	touched []*entry
+}
+
+func (s *KV) view(keys []string, fn func(tx *txn) error) error {
+	return s.run(s.shardIndexes(keys), false, fn)
+}
+
+// update runs fn under write locks and then wakes clients blocked on keys.
+func (s *KV) update(keys []string, fn func(tx *txn) error) error {
+	err := s.run(s.shardIndexes(keys), true, fn)
+	s.signalReady(keys)
+	return err
+}
+
+func (s *KV) viewAll(fn func(tx *txn) error) error {
+	return s.run(s.allShardIndexes(), false, fn)
+}
+
+func (s *KV) updateAll(fn func(tx *txn) error) error {
+	return s.run(s.allShardIndexes(), true, fn)
+}
+
+// run locks the given shards in ascending order and calls fn. Expired keys
+// met by a read-only txn can't be deleted under the read locks, so they are
+// deleted right after those are released.
+func (s *KV) run(shards []int, writable bool, fn func(tx *txn) error) error {
+	tx := &txn{kv: s, writable: writable, shards: shards}
+	tx.lock()
+	err := fn(tx)
+	for _, e := range tx.touched {
+		s.recharge(e)
+	}
+	tx.unlock()
+
+	if len(tx.expired) > 0 {
+		cleanup := &txn{kv: s, writable: true, shards: s.shardIndexes(tx.expired)}
+		cleanup.lock()
+		for _, key := range tx.expired {
+			cleanup.lookup(key)
+		}
+		cleanup.unlock()
+	}
+	return err
+}
+
+func (tx *txn) lock() {
+	for _, idx := range tx.shards {
+		if tx.writable {
+			tx.kv.shards[idx].mu.Lock()
+		} else {
+			tx.kv.shards[idx].mu.RLock()
+		}
+	}
+}
+
+func (tx *txn) unlock() {
+	for i := len(tx.shards) - 1; i >= 0; i-- {
+		if tx.writable {
+			tx.kv.shards[tx.shards[i]].mu.Unlock()
+		} else {
+			tx.kv.shards[tx.shards[i]].mu.RUnlock()
+		}
+	}
+}
+
+func (tx *txn) shard(key string) *shard {
+	idx := tx.kv.shardIndex(key)
+	if _, locked := slices.BinarySearch(tx.shards, idx); !locked {
+		panic("storage: key " + key + " accessed outside of its transaction")
+	}
+	return tx.kv.shards[idx]
+}
+
+func (tx *txn) lookup(key string) *entry {
+	e := tx.peek(key)
+	if e == nil {
+		return nil
+	}
+	e.touch()
+	if tx.writable {
+		tx.touched = append(tx.touched, e)
+	}
+	return e
+}
+
+// peek is lookup without recording an access, for introspection commands
+// that must not change what they observe.
+func (tx *txn) peek(key string) *entry {
+	sh := tx.shard(key)
+	e, exists := sh.data.get(key)
+	if !exists {
+		return nil
+	}
+	if tx.kv.isExpired(sh, key) {
+		if tx.writable {
+			tx.kv.deleteExpired(sh, key)
+		} else {
+			tx.expired = append(tx.expired, key)
+		}
+		return nil
+	}
+	if next, ok := sh.fieldExpires.get(key); ok {
+		if now := time.Now().UnixMilli(); next <= now {
+			if tx.writable {
+				if tx.kv.expireFields(sh, key, e, now) {
+					return nil
+				}
+				return e
+			}
+			tx.expired = append(tx.expired, key)
+			return e.withoutExpiredFields(now)
+		}
+	}
+	return e
+}
+
+func (tx *txn) set(key string, e *entry) {
+	sh := tx.shard(key)
+	if old, exists := sh.data.get(key); exists {
+		tx.kv.release(key, old)
+	}
+	sh.data.set(key, e)
+	sh.fieldExpires.delete(key)
+	if e.fieldExpires != nil {
+		tx.syncFieldExpires(key, e)
+	}
+	e.initAccess()
+	tx.kv.charge(key, e)
+	tx.touched = append(tx.touched, e)
+}
+
+func (tx *txn) delete(key string) bool {
+	sh := tx.shard(key)
+	e, exists := sh.data.get(key)
+	if !exists {
+		return false
+	}
+	sh.data.delete(key)
+	sh.expires.delete(key)
+	sh.fieldExpires.delete(key)
+	tx.kv.release(key, e)
+	return true
+}
+
+func (tx *txn) expireAt(key string) (int64, bool) {
+	return tx.shard(key).expires.get(key)
+}
+
+func (tx *txn) setExpireAt(key string, unixMilli int64) {
+	tx.shard(key).expires.set(key, unixMilli)
+}
+
+func (tx *txn) persist(key string) bool {
+	return tx.shard(key).expires.delete(key)
+}
+
+// forEach visits every key of the locked shards, including expired ones.
+func (tx *txn) forEach(fn func(key string, e *entry) bool) {
+	for _, idx := range tx.shards {
+		stop := false
+		tx.kv.shards[idx].data.forEach(func(key string, e *entry) bool {
+			stop = !fn(key, e)
+			return !stop
+		})
+		if stop {
+			return
+		}
+	}
+}
+
+func (s *KV) isExpired(sh *shard, key string) bool {
+	expiration, hasTTL := sh.expires.get(key)
+	return hasTTL && s.past(expiration)
+}
+
+// past reports whether the expiration time unixMilli has come. While the AOF
+// is loading nothing expires, as in Redis: the log is replayed against the
+// data it was written against, and the keys that expired meanwhile are
+// removed by the DEL logged when they did.
+func (s *KV) past(unixMilli int64) bool {
+	return !s.loading.Load() && unixMilli <= time.Now().UnixMilli()
+}
+
+func (s *KV) deleteExpired(sh *shard, key string) {
+	e, exists := sh.data.get(key)
+	if !exists {
+		return
+	}
+	sh.data.delete(key)
+	sh.expires.delete(key)
+	sh.fieldExpires.delete(key)
+	s.release(key, e)
+	s.stats.expiredKeys.Add(1)
+	s.events.notify(s, "expired", key)
+}
@@ -0,0 +1,203 @@
+package storage
+
+import "strconv"
+
+// zsetStore is implemented by every sorted set encoding. Elements are
+// ordered by score, then by member, and ranks are 0-based in that order.
+type zsetStore interface {
+	len() int
+	score(member string) (float64, bool)
+	// set adds member or changes its score, and reports whether it was added.
+	set(member string, score float64) bool
+	remove(member string) bool
+	// partition returns how many elements, from the first one on, satisfy
+	// before. It must hold for a prefix of the set and for nothing after it.
+	partition(before func(member string, score float64) bool) int
+	// forRange visits the elements with ranks start to stop, inclusive, in
+	// ascending order or, if reverse, from stop down to start.
+	forRange(start, stop int, reverse bool, fn func(member string, score float64) bool)
+	memUsage() int64
+	encoding() string
+}
+
+// listpackZset keeps members and scores interleaved in one listpack, sorted
+// like the skiplist.
+type listpackZset struct{ lp *listpack }
+
+func formatStoredScore(score float64) string {
+	return strconv.FormatFloat(score, 'g', -1, 64)
+}
+
+func parseStoredScore(s string) float64 {
+	score, _ := strconv.ParseFloat(s, 64)
+	return score
+}
+
+func (z listpackZset) len() int { return z.lp.len() / 2 }
+
+func (z listpackZset) score(member string) (float64, bool) {
+	i := z.lp.index(member, 2)
+	if i < 0 {
+		return 0, false
+	}
+	return parseStoredScore(z.lp.at(i + 1)), true
+}
+
+func (z listpackZset) set(member string, score float64) bool {
+	added := true
+	if i := z.lp.index(member, 2); i >= 0 {
+		z.lp.delete(i, 2)
+		added = false
+	}
+	rank := z.partition(func(m string, s float64) bool { return zless(s, m, score, member) })
+	z.lp.insert(rank*2, member, formatStoredScore(score))
+	return added
+}
+
+func (z listpackZset) remove(member string) bool {
+	i := z.lp.index(member, 2)
+	if i < 0 {
+		return false
+	}
+	z.lp.delete(i, 2)
+	return true
+}
+
+func (z listpackZset) partition(before func(member string, score float64) bool) int {
+	n := 0
+	var member string
+	z.lp.forEach(func(i int, v string) bool {
+		if i%2 == 0 {
+			member = v
+			return true
+		}
+		if !before(member, parseStoredScore(v)) {
+			return false
+		}
+		n++
+		return true
+	})
+	return n
+}
+
+func (z listpackZset) forRange(start, stop int, reverse bool, fn func(member string, score float64) bool) {
+	if !reverse {
+		var member string
+		z.lp.forEach(func(i int, v string) bool {
+			rank := i / 2
+			switch {
+			case rank < start:
+				return true
+			case rank > stop:
+				return false
+			case i%2 == 0:
+				member = v
+				return true
+			default:
+				return fn(member, parseStoredScore(v))
+			}
+		})
+		return
+	}
+	// a listpack can only be walked forward, so collect the range first
+	var flat []string
+	z.lp.forEach(func(i int, v string) bool {
+		if rank := i / 2; rank >= start && rank <= stop {
+			flat = append(flat, v)
+		}
+		return i/2 <= stop
+	})
+	for i := len(flat) - 2; i >= 0; i -= 2 {
+		if !fn(flat[i], parseStoredScore(flat[i+1])) {
+			return
+		}
+	}
+}
+
+func (z listpackZset) memUsage() int64  { return z.lp.memUsage() }
+func (z listpackZset) encoding() string { return "listpack" }
+
+// skiplistZset pairs a skiplist, for ordered access, with a dict from member
+// to score, for O(1) lookups.
+type skiplistZset struct {
+	d  *dict[float64]
+	sl *skiplist
+}
+
+func newSkiplistZset() skiplistZset {
+	return skiplistZset{d: newDict[float64](), sl: newSkiplist()}
+}
+
+func (z skiplistZset) len() int { return z.d.len() }
+
+func (z skiplistZset) score(member string) (float64, bool) { return z.d.get(member) }
+
+func (z skiplistZset) set(member string, score float64) bool {
+	current, exists := z.d.get(member)
+	if exists {
+		if current == score {
+			return false
+		}
+		z.sl.delete(current, member)
+	}
+	z.sl.insert(score, member)
+	z.d.set(member, score)
+	return !exists
+}
+
+func (z skiplistZset) remove(member string) bool {
+	score, exists := z.d.get(member)
+	if !exists {
+		return false
+	}
+	z.sl.delete(score, member)
+	z.d.delete(member)
+	return true
+}
+
+func (z skiplistZset) partition(before func(member string, score float64) bool) int {
+	return z.sl.partition(before)
+}
+
+func (z skiplistZset) forRange(start, stop int, reverse bool, fn func(member string, score float64) bool) {
+	if start > stop {
+		return
+	}
+	if !reverse {
+		for x := z.sl.byRank(start); x != nil && start <= stop; x, start = x.level[0].forward, start+1 {
+			if !fn(x.member, x.score) {
+				return
+			}
+		}
+		return
+	}
+	for x := z.sl.byRank(stop); x != nil && stop >= start; x, stop = x.backward, stop-1 {
+		if !fn(x.member, x.score) {
+			return
+		}
+	}
+}
+
+func (z skiplistZset) memUsage() int64  { return z.d.memUsage() + z.sl.memUsage() }
+func (z skiplistZset) encoding() string { return "skiplist" }
+
+// convertZsetFor returns z, or z converted to a skiplist if it can't hold
+// size members or one of the given ones. The conversion is never undone.
+func convertZsetFor(lim *EncodingLimits, z zsetStore, size int, adding ...string) zsetStore {
+	if _, ok := z.(listpackZset); !ok {
+		return z
+	}
+	fits := size <= lim.ZsetMaxListpackEntries
+	for _, m := range adding {
+		fits = fits && len(m) <= lim.ZsetMaxListpackValue
+	}
+	if fits {
+		return z
+	}
+	to := newSkiplistZset()
+	z.forRange(0, z.len()-1, false, func(member string, score float64) bool {
+		to.set(member, score)
+		return true
+	})
+	return to
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func zsetElements(z zsetStore, reverse bool) []ZMember {
+	var got []ZMember
+	z.forRange(0, z.len()-1, reverse, func(member string, score float64) bool {
+		got = append(got, ZMember{member, score})
+		return true
+	})
+	return got
+}
+
+func TestZset_EncodingsMatchSortedSlice(t *testing.T) {
+	for _, z := range []zsetStore{listpackZset{newListpack()}, newSkiplistZset()} {
+		t.Run(z.encoding(), func(t *testing.T) {
+			scores := map[string]float64{}
+			rng := rand.New(rand.NewPCG(5, 6))
+			for i := 0; i < 3000; i++ {
+				member := "m" + strconv.Itoa(rng.IntN(200))
+				if rng.IntN(3) == 0 {
+					_, existed := scores[member]
+					if z.remove(member) != existed {
+						t.Fatalf("remove %q: expected %v", member, existed)
+					}
+					delete(scores, member)
+					continue
+				}
+				score := float64(rng.IntN(50))
+				_, existed := scores[member]
+				if z.set(member, score) == existed {
+					t.Fatalf("set %q: expected added=%v", member, !existed)
+				}
+				scores[member] = score
+			}
+
+			var want []ZMember
+			for m, s := range scores {
+				want = append(want, ZMember{m, s})
+			}
+			slices.SortFunc(want, func(a, b ZMember) int {
+				if zless(a.Score, a.Member, b.Score, b.Member) {
+					return -1
+				}
+				return 1
+			})
+			if got := zsetElements(z, false); !slices.Equal(got, want) {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			slices.Reverse(want)
+			if got := zsetElements(z, true); !slices.Equal(got, want) {
+				t.Fatalf("reversed: got %v; want %v", got, want)
+			}
+			slices.Reverse(want)
+
+			for rank, m := range want {
+				before := z.partition(func(member string, score float64) bool { return zless(score, member, m.Score, m.Member) })
+				if before != rank {
+					t.Fatalf("rank of %q: got %d; want %d", m.Member, before, rank)
+				}
+			}
+		})
+	}
+}
+
+func TestZRange(t *testing.T) {
+	kv := NewKV()
+	kv.ZAdd("z", 0, ZMember{"a", 1}, ZMember{"b", 2}, ZMember{"c", 3}, ZMember{"d", 4}, ZMember{"e", 5})
+
+	members := func(r ZRange) []string {
+		got, _ := kv.ZRange("z", r)
+		var names []string
+		for _, m := range got {
+			names = append(names, m.Member)
+		}
+		return names
+	}
+	tests := []struct {
+		name string
+		r    ZRange
+		want []string
+	}{
+		{"rank", ZRange{Start: 1, Stop: -2}, []string{"b", "c", "d"}},
+		{"rank rev", ZRange{Start: 0, Stop: 1, Rev: true}, []string{"e", "d"}},
+		{"rank out of range", ZRange{Start: 5, Stop: 10}, nil},
+		{"score", ZRange{By: ZByScore, Min: ScoreBound{Value: 2}, Max: ScoreBound{Value: 4, Exclusive: true}, Count: -1}, []string{"b", "c"}},
+		{"score limit", ZRange{By: ZByScore, Min: ScoreBound{Value: 0}, Max: ScoreBound{Value: 10}, Offset: 1, Count: 2}, []string{"b", "c"}},
+		{"score rev limit", ZRange{By: ZByScore, Min: ScoreBound{Value: 0}, Max: ScoreBound{Value: 10}, Rev: true, Offset: 1, Count: 2}, []string{"d", "c"}},
+		{"lex", ZRange{By: ZByLex, MinLex: LexBound{Value: "b", Exclusive: true}, MaxLex: LexBound{Inf: 1}, Count: -1}, []string{"c", "d", "e"}},
+	}
+	for _, tt := range tests {
+		if got := members(tt.r); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %q; want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestZAdd_Flags(t *testing.T) {
+	kv := NewKV()
+	kv.ZAdd("z", 0, ZMember{"a", 5})
+	if added, changed, _ := kv.ZAdd("z", ZAddGT, ZMember{"a", 3}, ZMember{"b", 1}); added != 1 || changed != 0 {
+		t.Fatalf("GT: got added=%d changed=%d; want 1 0", added, changed)
+	}
+	if _, applied, _ := kv.ZIncrBy("z", ZAddLT, "a", 1); applied {
+		t.Fatalf("LT: expected an increment to be refused")
+	}
+	if score, _, _ := kv.ZIncrBy("z", 0, "a", -1.5); score != 3.5 {
+		t.Fatalf("got %v; want 3.5", score)
+	}
+	if n, _ := kv.ZRem("z", "a", "b"); n != 2 || kv.Exists("z") != 0 {
+		t.Fatalf("expected the emptied sorted set to be deleted")
+	}
+}
+
+func TestZSetOperationStore(t *testing.T) {
+	kv := NewKV()
+	kv.ZAdd("a", 0, ZMember{"x", 1}, ZMember{"y", 2})
+	kv.ZAdd("b", 0, ZMember{"y", 10}, ZMember{"z", 20})
+	kv.SAdd("s", "y")
+
+	tests := []struct {
+		op      SetOp
+		keys    []string
+		weights []float64
+		agg     ZAggregate
+		want    []ZMember
+	}{
+		{SetUnion, []string{"a", "b"}, nil, ZAggSum, []ZMember{{"x", 1}, {"y", 12}, {"z", 20}}},
+		{SetUnion, []string{"a", "b"}, []float64{3, 1}, ZAggMax, []ZMember{{"x", 3}, {"y", 10}, {"z", 20}}},
+		{SetInter, []string{"a", "b", "s"}, nil, ZAggMin, []ZMember{{"y", 1}}},
+		{SetInter, []string{"a", "missing"}, nil, ZAggSum, nil},
+		{SetDiff, []string{"a", "b"}, nil, ZAggSum, []ZMember{{"x", 1}}},
+	}
+	for _, tt := range tests {
+		n, err := kv.ZSetOperationStore(tt.op, "dest", tt.keys, tt.weights, tt.agg)
+		if err != nil || n != len(tt.want) {
+			t.Fatalf("%v %v: got %d, %v; want %d", tt.op, tt.keys, n, err, len(tt.want))
+		}
+		got, _ := kv.ZRange("dest", ZRange{Start: 0, Stop: -1})
+		if len(tt.want) == 0 && len(got) == 0 {
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%v %v: got %v; want %v", tt.op, tt.keys, got, tt.want)
+		}
+	}
+}
+
+func TestZPop(t *testing.T) {
+	kv := NewKV()
+	kv.ZAdd("z", 0, ZMember{"a", 1}, ZMember{"b", 2}, ZMember{"c", 3})
+	if got, _ := kv.ZPop("z", true, 2); !slices.Equal(got, []ZMember{{"c", 3}, {"b", 2}}) {
+		t.Fatalf("got %v; want c and b", got)
+	}
+	key, got, _ := kv.ZMPop([]string{"missing", "z"}, false, 5)
+	if key != "z" || !slices.Equal(got, []ZMember{{"a", 1}}) {
+		t.Fatalf("got %q %v; want z [a]", key, got)
+	}
+	if kv.Exists("z") != 0 {
+		t.Fatalf("expected the emptied sorted set to be deleted")
+	}
+}
@@ -0,0 +1,649 @@
+package storage
+
+import (
+	"cmp"
+	"math"
+	"slices"
+)
+
+// ZMember is an element of a sorted set.
+type ZMember struct {
+	Member string
+	Score  float64
+}
+
+// ZAddFlags are the options of ZADD that decide whether an element is
+// written. ZAddIncr adds the given score to the current one.
+type ZAddFlags int
+
+const (
+	ZAddNX ZAddFlags = 1 << iota
+	ZAddXX
+	ZAddGT
+	ZAddLT
+	ZAddIncr
+)
+
+type zaddResult int
+
+const (
+	zaddNop zaddResult = iota
+	zaddAdded
+	zaddUpdated
+	zaddUnchanged
+)
+
+// zadd writes one element as flags allow and returns its resulting score.
+func (e *entry) zadd(lim *EncodingLimits, flags ZAddFlags, member string, score float64) (float64, zaddResult, error) {
+	if e.typ != zsetType {
+		return 0, zaddNop, ErrWrongType
+	}
+	z := e.zset()
+	current, exists := z.score(member)
+	if exists {
+		if flags&ZAddNX != 0 {
+			return current, zaddNop, nil
+		}
+		if flags&ZAddIncr != 0 {
+			score += current
+			if math.IsNaN(score) {
+				return 0, zaddNop, ErrScoreNaN
+			}
+		}
+		if (flags&ZAddGT != 0 && score <= current) || (flags&ZAddLT != 0 && score >= current) {
+			return current, zaddNop, nil
+		}
+		if score == current {
+			return score, zaddUnchanged, nil
+		}
+		z.set(member, score)
+		return score, zaddUpdated, nil
+	}
+	if flags&ZAddXX != 0 {
+		return 0, zaddNop, nil
+	}
+	z = convertZsetFor(lim, z, z.len()+1, member)
+	e.data = z
+	z.set(member, score)
+	return score, zaddAdded, nil
+}
+
+// ScoreBound is one end of a score range. Exclusive bounds are written with
+// a "(" prefix in commands.
+type ScoreBound struct {
+	Value     float64
+	Exclusive bool
+}
+
+func (b ScoreBound) allowsLow(score float64) bool {
+	return score > b.Value || (!b.Exclusive && score == b.Value)
+}
+
+func (b ScoreBound) allowsHigh(score float64) bool {
+	return score < b.Value || (!b.Exclusive && score == b.Value)
+}
+
+// LexBound is one end of a lexicographical range. Inf is -1 for "-", the
+// smallest string, 1 for "+", the largest one, and 0 otherwise.
+type LexBound struct {
+	Value     string
+	Exclusive bool
+	Inf       int
+}
+
+func (b LexBound) allowsLow(member string) bool {
+	if b.Inf != 0 {
+		return b.Inf < 0
+	}
+	return member > b.Value || (!b.Exclusive && member == b.Value)
+}
+
+func (b LexBound) allowsHigh(member string) bool {
+	if b.Inf != 0 {
+		return b.Inf > 0
+	}
+	return member < b.Value || (!b.Exclusive && member == b.Value)
+}
+
+type ZRangeBy int
+
+const (
+	ZByRank ZRangeBy = iota
+	ZByScore
+	ZByLex
+)
+
+// ZRange selects elements of a sorted set. By rank, Start and Stop are
+// inclusive indexes that may be negative to count from the end. By score or
+// lex, the elements lie between the Min and Max bounds, and Offset and Count
+// page through them, Count < 0 meaning all of them. Rev orders the result
+// from the highest element down, and ranks then count from there too.
+type ZRange struct {
+	By             ZRangeBy
+	Start, Stop    int
+	Min, Max       ScoreBound
+	MinLex, MaxLex LexBound
+	Rev            bool
+	Offset, Count  int
+}
+
+// ranks resolves r against z into inclusive ascending ranks. The range is
+// empty if start > stop.
+func (r ZRange) ranks(z zsetStore) (start, stop int) {
+	n := z.len()
+	switch r.By {
+	case ZByRank:
+		start, stop = r.Start, r.Stop
+		if start < 0 {
+			start += n
+		}
+		if stop < 0 {
+			stop += n
+		}
+		start, stop = max(start, 0), min(stop, n-1)
+		if r.Rev {
+			start, stop = n-1-stop, n-1-start
+		}
+		return start, stop
+	case ZByScore:
+		start = z.partition(func(_ string, score float64) bool { return !r.Min.allowsLow(score) })
+		stop = z.partition(func(_ string, score float64) bool { return r.Max.allowsHigh(score) }) - 1
+	case ZByLex:
+		start = z.partition(func(member string, _ float64) bool { return !r.MinLex.allowsLow(member) })
+		stop = z.partition(func(member string, _ float64) bool { return r.MaxLex.allowsHigh(member) }) - 1
+	}
+
+	if r.Offset < 0 {
+		return 0, -1
+	}
+	if r.Rev {
+		stop -= r.Offset
+		if r.Count >= 0 {
+			start = max(start, stop-r.Count+1)
+		}
+	} else {
+		start += r.Offset
+		if r.Count >= 0 {
+			stop = min(stop, start+r.Count-1)
+		}
+	}
+	return start, stop
+}
+
+func (e *entry) zrange(r ZRange) ([]ZMember, error) {
+	if e.typ != zsetType {
+		return nil, ErrWrongType
+	}
+	z := e.zset()
+	start, stop := r.ranks(z)
+	result := []ZMember{}
+	z.forRange(start, stop, r.Rev, func(member string, score float64) bool {
+		result = append(result, ZMember{member, score})
+		return true
+	})
+	return result, nil
+}
+
+// ZAdd writes the given elements as flags allow and returns how many were
+// added and how many had their score changed.
+func (s *KV) ZAdd(key string, flags ZAddFlags, members ...ZMember) (added, changed int, err error) {
+	err = s.update([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			if flags&ZAddXX != 0 {
+				return nil
+			}
+			e = newZsetEntry()
+			tx.set(key, e)
+		}
+		for _, m := range members {
+			_, result, err := e.zadd(s.limits, flags, m.Member, m.Score)
+			if err != nil {
+				return err
+			}
+			switch result {
+			case zaddAdded:
+				added++
+			case zaddUpdated:
+				changed++
+			}
+		}
+		if e.zset().len() == 0 {
+			tx.delete(key)
+		}
+		return nil
+	})
+	return added, changed, err
+}
+
+// ZIncrBy adds delta to the score of member, which starts at 0, and returns
+// the new score. It reports false if flags prevented the update.
+func (s *KV) ZIncrBy(key string, flags ZAddFlags, member string, delta float64) (float64, bool, error) {
+	var score float64
+	var applied bool
+	err := s.update([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			if flags&ZAddXX != 0 {
+				return nil
+			}
+			e = newZsetEntry()
+			tx.set(key, e)
+		}
+		var result zaddResult
+		var err error
+		score, result, err = e.zadd(s.limits, flags|ZAddIncr, member, delta)
+		if e.typ == zsetType && e.zset().len() == 0 {
+			tx.delete(key)
+		}
+		applied = result != zaddNop
+		return err
+	})
+	return score, applied, err
+}
+
+// ZRem removes members from the sorted set at key, and the key once it's
+// empty.
+func (s *KV) ZRem(key string, members ...string) (int, error) {
+	var removed int
+	err := s.update([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		if e.typ != zsetType {
+			return ErrWrongType
+		}
+		for _, m := range members {
+			if e.zset().remove(m) {
+				removed++
+			}
+		}
+		if e.zset().len() == 0 {
+			tx.delete(key)
+		}
+		return nil
+	})
+	return removed, err
+}
+
+func (s *KV) ZScore(key, member string) (float64, bool, error) {
+	scores, found, err := s.ZMScore(key, member)
+	return scores[0], found[0], err
+}
+
+func (s *KV) ZMScore(key string, members ...string) ([]float64, []bool, error) {
+	scores := make([]float64, len(members))
+	found := make([]bool, len(members))
+	err := s.view([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		if e.typ != zsetType {
+			return ErrWrongType
+		}
+		for i, m := range members {
+			scores[i], found[i] = e.zset().score(m)
+		}
+		return nil
+	})
+	return scores, found, err
+}
+
+func (s *KV) ZCard(key string) (int, error) {
+	var n int
+	err := s.view([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		if e.typ != zsetType {
+			return ErrWrongType
+		}
+		n = e.zset().len()
+		return nil
+	})
+	return n, err
+}
+
+// ZCount returns how many elements have a score between lo and hi.
+func (s *KV) ZCount(key string, lo, hi ScoreBound) (int, error) {
+	var n int
+	err := s.view([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		if e.typ != zsetType {
+			return ErrWrongType
+		}
+		start, stop := ZRange{By: ZByScore, Min: lo, Max: hi, Count: -1}.ranks(e.zset())
+		n = max(stop-start+1, 0)
+		return nil
+	})
+	return n, err
+}
+
+// ZRank returns the rank of member, counted from the highest score if rev,
+// and its score.
+func (s *KV) ZRank(key, member string, rev bool) (int, float64, bool, error) {
+	var rank int
+	var score float64
+	var found bool
+	err := s.view([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		if e.typ != zsetType {
+			return ErrWrongType
+		}
+		z := e.zset()
+		if score, found = z.score(member); !found {
+			return nil
+		}
+		rank = z.partition(func(m string, s float64) bool { return zless(s, m, score, member) })
+		if rev {
+			rank = z.len() - 1 - rank
+		}
+		return nil
+	})
+	return rank, score, found, err
+}
+
+// ZRange returns the elements selected by r, in its order.
+func (s *KV) ZRange(key string, r ZRange) ([]ZMember, error) {
+	result := []ZMember{}
+	err := s.view([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		var err error
+		result, err = e.zrange(r)
+		return err
+	})
+	return result, err
+}
+
+// ZAggregate combines the scores a member has in several sorted sets.
+type ZAggregate int
+
+const (
+	ZAggSum ZAggregate = iota
+	ZAggMin
+	ZAggMax
+)
+
+func (agg ZAggregate) combine(a, b float64) float64 {
+	switch agg {
+	case ZAggMin:
+		return min(a, b)
+	case ZAggMax:
+		return max(a, b)
+	default:
+		// inf + -inf, which Redis turns into 0
+		if sum := a + b; !math.IsNaN(sum) {
+			return sum
+		}
+		return 0
+	}
+}
+
+// zsource is an input of ZUNIONSTORE and friends: a sorted set, a plain set
+// whose members all score 1, or neither for a missing key.
+type zsource struct {
+	z zsetStore
+	s setStore
+}
+
+func (src zsource) len() int {
+	switch {
+	case src.z != nil:
+		return src.z.len()
+	case src.s != nil:
+		return src.s.len()
+	default:
+		return 0
+	}
+}
+
+func (src zsource) score(member string) (float64, bool) {
+	switch {
+	case src.z != nil:
+		return src.z.score(member)
+	case src.s != nil:
+		return 1, src.s.contains(member)
+	default:
+		return 0, false
+	}
+}
+
+func (src zsource) forEach(fn func(member string, score float64) bool) {
+	switch {
+	case src.z != nil:
+		src.z.forRange(0, src.z.len()-1, false, fn)
+	case src.s != nil:
+		src.s.forEach(func(member string) bool { return fn(member, 1) })
+	}
+}
+
+// ZSetOperationStore stores the union, intersection or difference of the
+// sorted sets at keys into dest and returns its size. Scores are multiplied
+// by weights, if given, and combined with agg; the difference keeps the
+// scores of the first set. Plain sets take part with a score of 1 for every
+// member, and missing keys count as empty.
+func (s *KV) ZSetOperationStore(op SetOp, dest string, keys []string, weights []float64, agg ZAggregate) (int, error) {
+	var n int
+	err := s.update(append([]string{dest}, keys...), func(tx *txn) error {
+		result, err := tx.zsetOperation(op, keys, weights, agg)
+		if err != nil {
+			return err
+		}
+		n = len(result)
+		tx.storeZset(dest, result)
+		return nil
+	})
+	return n, err
+}
+
+func (tx *txn) zsetOperation(op SetOp, keys []string, weights []float64, agg ZAggregate) ([]ZMember, error) {
+	srcs := make([]zsource, len(keys))
+	for i, key := range keys {
+		e := tx.lookup(key)
+		switch {
+		case e == nil:
+		case e.typ == zsetType:
+			srcs[i].z = e.zset()
+		case e.typ == setType:
+			srcs[i].s = e.set()
+		default:
+			return nil, ErrWrongType
+		}
+	}
+	weigh := func(i int, score float64) float64 {
+		if weights == nil {
+			return score
+		}
+		// inf * 0 is NaN, which Redis turns into 0
+		if w := score * weights[i]; !math.IsNaN(w) {
+			return w
+		}
+		return 0
+	}
+
+	var result []ZMember
+	switch op {
+	case SetUnion:
+		index := make(map[string]int)
+		for i, src := range srcs {
+			src.forEach(func(member string, score float64) bool {
+				score = weigh(i, score)
+				if j, seen := index[member]; seen {
+					result[j].Score = agg.combine(result[j].Score, score)
+				} else {
+					index[member] = len(result)
+					result = append(result, ZMember{member, score})
+				}
+				return true
+			})
+		}
+	case SetInter:
+		// walk the smallest input and probe the others
+		order := make([]int, len(srcs))
+		for i := range order {
+			order[i] = i
+		}
+		slices.SortFunc(order, func(a, b int) int { return cmp.Compare(srcs[a].len(), srcs[b].len()) })
+		srcs[order[0]].forEach(func(member string, score float64) bool {
+			total := weigh(order[0], score)
+			for _, i := range order[1:] {
+				other, ok := srcs[i].score(member)
+				if !ok {
+					return true
+				}
+				total = agg.combine(total, weigh(i, other))
+			}
+			result = append(result, ZMember{member, total})
+			return true
+		})
+	case SetDiff:
+		srcs[0].forEach(func(member string, score float64) bool {
+			for _, other := range srcs[1:] {
+				if _, ok := other.score(member); ok {
+					return true
+				}
+			}
+			result = append(result, ZMember{member, score})
+			return true
+		})
+	}
+	return result, nil
+}
+
+// storeZset replaces whatever is at key with a sorted set of members, or
+// just deletes it if members is empty.
+func (tx *txn) storeZset(key string, members []ZMember) {
+	tx.delete(key)
+	if len(members) == 0 {
+		return
+	}
+	names := make([]string, len(members))
+	for i, m := range members {
+		names[i] = m.Member
+	}
+	lim := tx.kv.limits
+	z := convertZsetFor(lim, listpackZset{newListpack()}, len(members), names...)
+	for _, m := range members {
+		z.set(m.Member, m.Score)
+	}
+	tx.set(key, &entry{typ: zsetType, data: z})
+}
+
+// ZRangeStore stores the elements of src selected by r into dst and returns
+// how many there are.
+func (s *KV) ZRangeStore(dst, src string, r ZRange) (int, error) {
+	var n int
+	err := s.update([]string{dst, src}, func(tx *txn) error {
+		var members []ZMember
+		if e := tx.lookup(src); e != nil {
+			var err error
+			if members, err = e.zrange(r); err != nil {
+				return err
+			}
+		}
+		n = len(members)
+		tx.storeZset(dst, members)
+		return nil
+	})
+	return n, err
+}
+
+// ZRemRange removes the elements selected by r and returns how many there
+// were.
+func (s *KV) ZRemRange(key string, r ZRange) (int, error) {
+	var removed int
+	err := s.update([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		members, err := e.zrange(r)
+		if err != nil {
+			return err
+		}
+		for _, m := range members {
+			e.zset().remove(m.Member)
+		}
+		removed = len(members)
+		if e.zset().len() == 0 {
+			tx.delete(key)
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// ZPop removes and returns up to count elements with the lowest scores, or
+// the highest ones if highest, in the order they are popped.
+func (s *KV) ZPop(key string, highest bool, count int) ([]ZMember, error) {
+	var popped []ZMember
+	err := s.update([]string{key}, func(tx *txn) error {
+		e := tx.lookup(key)
+		if e == nil {
+			return nil
+		}
+		var err error
+		popped, err = tx.popZset(key, e, highest, count)
+		return err
+	})
+	if popped == nil {
+		popped = []ZMember{}
+	}
+	return popped, err
+}
+
+func (tx *txn) popZset(key string, e *entry, highest bool, count int) ([]ZMember, error) {
+	if e.typ != zsetType {
+		return nil, ErrWrongType
+	}
+	if count <= 0 {
+		return nil, nil
+	}
+	r := ZRange{Start: 0, Stop: count - 1, Rev: highest}
+	popped, err := e.zrange(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range popped {
+		e.zset().remove(m.Member)
+	}
+	if e.zset().len() == 0 {
+		tx.delete(key)
+	}
+	return popped, nil
+}
+
+// ZMPop pops up to count elements from the first non-empty sorted set among
+// keys and returns its key, or "" if they are all empty.
+func (s *KV) ZMPop(keys []string, highest bool, count int) (string, []ZMember, error) {
+	var key string
+	var popped []ZMember
+	err := s.update(keys, func(tx *txn) error {
+		for _, k := range keys {
+			e := tx.lookup(k)
+			if e == nil {
+				continue
+			}
+			var err error
+			if popped, err = tx.popZset(k, e, highest, count); err != nil {
+				return err
+			}
+			key = k
+			return nil
+		}
+		return nil
+	})
+	return key, popped, err
+}